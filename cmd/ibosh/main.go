@@ -3,14 +3,22 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	boshui "github.com/cloudfoundry/bosh-cli/v7/ui"
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/rkoster/instant-bosh/internal/boshconfig"
+	"github.com/rkoster/instant-bosh/internal/boshssh"
 	"github.com/rkoster/instant-bosh/internal/commands"
+	"github.com/rkoster/instant-bosh/internal/configserver"
 	"github.com/rkoster/instant-bosh/internal/cpi"
 	"github.com/rkoster/instant-bosh/internal/director"
 	"github.com/rkoster/instant-bosh/internal/docker"
+	"github.com/rkoster/instant-bosh/internal/envformat"
 	"github.com/rkoster/instant-bosh/internal/incus"
+	"github.com/rkoster/instant-bosh/internal/manifests/consolidate"
+	"github.com/rkoster/instant-bosh/internal/registry"
 	"github.com/urfave/cli/v2"
 )
 
@@ -31,6 +39,81 @@ func initUIAndLogger(c *cli.Context) (boshui.UI, boshlog.Logger) {
 	return ui, logger
 }
 
+// initTaskUIAndLogger is initUIAndLogger for commands with task event output: with
+// --json the UI writes to stderr, so stdout only holds the JSON lines of the events.
+func initTaskUIAndLogger(c *cli.Context) (boshui.UI, boshlog.Logger) {
+	if !c.Bool("json") {
+		return initUIAndLogger(c)
+	}
+	_, logger := initUIAndLogger(c)
+	writerUI := boshui.NewWriterUI(os.Stderr, os.Stderr, logger)
+	return boshui.NewColorUI(writerUI), logger
+}
+
+// jsonEventsFlag is the --json flag of the commands running director tasks.
+func jsonEventsFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "json",
+		Usage: "Write the task events as JSON lines to stdout, e.g. for CI",
+	}
+}
+
+// cfProfileFlag is the --profile flag of the CF commands that consolidate the instance groups.
+func cfProfileFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "profile",
+		Value: consolidate.ProfileDefault,
+		Usage: "Consolidation profile: " + strings.Join(consolidate.Profiles(), ", ") +
+			" (tiny: 3 VMs, default: 5 VMs, ha-like: 3 diego cells and 2 routers, stock: cf-deployment as is)",
+	}
+}
+
+// cfMappingFlag is the --mapping flag of the CF commands that consolidate the instance groups.
+func cfMappingFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "mapping",
+		Usage: "Path of a YAML consolidation mapping file merged into the profile, e.g. for instance groups added by extra ops files",
+	}
+}
+
+// cfOpsFileFlag is the --ops-file flag of the CF commands that interpolate the manifest.
+func cfOpsFileFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:    "ops-file",
+		Aliases: []string{"o"},
+		Usage:   "Extra ops file applied after the built-in ones (can be repeated); map instance groups it adds with --mapping",
+	}
+}
+
+// directorFlag is the --director flag of the commands that work against the instant-bosh
+// director and the directors deployed on it.
+func directorFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "director",
+		Usage: "Director: instant-bosh or a director deployed with 'ibosh bosh deploy', e.g. bosh-warden",
+		Value: commands.InstantBOSHDirector,
+	}
+}
+
+// envFormatFlag is the --format flag of the print-env commands.
+func envFormatFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "format",
+		Aliases: []string{"f"},
+		Usage:   "Output format: sh, fish, powershell, dotenv, json or direnv (certificates written to the state dir)",
+		Value:   string(envformat.Shell),
+	}
+}
+
+// aliasNameFlag is the --name flag of the alias commands.
+func aliasNameFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "name",
+		Usage: "Alias of the environment",
+		Value: boshconfig.DefaultAlias,
+	}
+}
+
 func createDockerCPI(logger boshlog.Logger, customImage string) (cpi.CPI, error) {
 	dockerClient, err := docker.NewClient(logger, customImage)
 	if err != nil {
@@ -84,6 +167,15 @@ func main() {
 								Usage: "Custom image to use (e.g., ghcr.io/rkoster/instant-bosh:main-9e61f6f)",
 								Value: "",
 							},
+							&cli.BoolFlag{
+								Name:  "refresh",
+								Usage: "Ignore cached registry lookups and re-fetch image metadata",
+							},
+							&cli.StringFlag{
+								Name:    "platform",
+								Usage:   "Image platform for multi-arch images (e.g., linux/arm64, default: platform of the container host)",
+								EnvVars: []string{"IBOSH_PLATFORM"},
+							},
 						},
 						Action: func(c *cli.Context) error {
 							if c.Bool("skip-update") && c.String("image") != "" {
@@ -101,6 +193,8 @@ func main() {
 								SkipUpdate:         c.Bool("skip-update"),
 								SkipStemcellUpload: c.Bool("skip-stemcell-upload"),
 								CustomImage:        c.String("image"),
+								Refresh:            c.Bool("refresh"),
+								Platform:           c.String("platform"),
 							}
 
 							return commands.StartAction(
@@ -210,7 +304,12 @@ func main() {
 					{
 						Name:  "print-env",
 						Usage: "Print environment variables for BOSH CLI (Docker)",
+						Flags: []cli.Flag{envFormatFlag()},
 						Action: func(c *cli.Context) error {
+							format, err := envformat.ParseFormat(c.String("format"))
+							if err != nil {
+								return cli.Exit(fmt.Sprintf("Error: %v", err), 1)
+							}
 							ui, logger := initUIAndLogger(c)
 							cpiInstance, err := createDockerCPI(logger, "")
 							if err != nil {
@@ -218,7 +317,22 @@ func main() {
 							}
 							defer cpiInstance.Close()
 
-							return commands.PrintEnvAction(ui, logger, cpiInstance, &director.DefaultConfigProvider{})
+							return commands.PrintEnvAction(ui, logger, cpiInstance, &director.DefaultConfigProvider{}, format)
+						},
+					},
+					{
+						Name:  "alias",
+						Usage: "Register the director in the BOSH CLI config (~/.bosh/config)",
+						Flags: []cli.Flag{aliasNameFlag()},
+						Action: func(c *cli.Context) error {
+							ui, logger := initUIAndLogger(c)
+							cpiInstance, err := createDockerCPI(logger, "")
+							if err != nil {
+								return cli.Exit(fmt.Sprintf("Error creating Docker CPI: %v", err), 1)
+							}
+							defer cpiInstance.Close()
+
+							return commands.AliasAction(ui, logger, cpiInstance, &director.DefaultConfigProvider{}, c.String("name"))
 						},
 					},
 					{
@@ -239,13 +353,20 @@ The command will:
   4. Upload it to the BOSH director (if not already present)
 
 Works offline if the image is already pulled locally.`,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "platform",
+								Usage:   "Image platform for multi-arch images (e.g., linux/arm64, default: platform of the container host)",
+								EnvVars: []string{"IBOSH_PLATFORM"},
+							},
+						},
 						Action: func(c *cli.Context) error {
 							if c.NArg() < 1 {
 								return cli.Exit("Error: image reference required", 1)
 							}
 							imageRef := c.Args().First()
 							ui, logger := initUIAndLogger(c)
-							return commands.UploadStemcellAction(ui, logger, imageRef)
+							return commands.UploadStemcellAction(ui, logger, imageRef, c.String("platform"))
 						},
 					},
 				},
@@ -287,6 +408,15 @@ Works offline if the image is already pulled locally.`,
 								Usage: "Custom image to use",
 								Value: "",
 							},
+							&cli.BoolFlag{
+								Name:  "refresh",
+								Usage: "Ignore cached registry lookups and re-fetch image metadata",
+							},
+							&cli.StringFlag{
+								Name:    "platform",
+								Usage:   "Image platform for multi-arch images (e.g., linux/arm64, default: platform of the container host)",
+								EnvVars: []string{"IBOSH_PLATFORM"},
+							},
 						},
 						Action: func(c *cli.Context) error {
 							ui, logger := initUIAndLogger(c)
@@ -307,6 +437,8 @@ Works offline if the image is already pulled locally.`,
 								SkipUpdate:         false, // Incus doesn't support skip-update
 								SkipStemcellUpload: true,  // Incus doesn't use stemcell upload yet
 								CustomImage:        c.String("image"),
+								Refresh:            c.Bool("refresh"),
+								Platform:           c.String("platform"),
 							}
 
 							return commands.StartAction(
@@ -441,8 +573,13 @@ Works offline if the image is already pulled locally.`,
 								Value:   "ibosh",
 								EnvVars: []string{"IBOSH_INCUS_PROJECT"},
 							},
+							envFormatFlag(),
 						},
 						Action: func(c *cli.Context) error {
+							format, err := envformat.ParseFormat(c.String("format"))
+							if err != nil {
+								return cli.Exit(fmt.Sprintf("Error: %v", err), 1)
+							}
 							ui, logger := initUIAndLogger(c)
 							cpiInstance, err := createIncusCPI(
 								logger,
@@ -457,7 +594,42 @@ Works offline if the image is already pulled locally.`,
 							}
 							defer cpiInstance.Close()
 
-							return commands.PrintEnvAction(ui, logger, cpiInstance, &director.DefaultConfigProvider{})
+							return commands.PrintEnvAction(ui, logger, cpiInstance, &director.DefaultConfigProvider{}, format)
+						},
+					},
+					{
+						Name:  "alias",
+						Usage: "Register the director in the BOSH CLI config (~/.bosh/config)",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "remote",
+								Usage:   "Incus remote name (uses default remote from 'incus remote list' if not specified)",
+								EnvVars: []string{"IBOSH_INCUS_REMOTE"},
+							},
+							&cli.StringFlag{
+								Name:    "project",
+								Usage:   "Incus project name",
+								Value:   "ibosh",
+								EnvVars: []string{"IBOSH_INCUS_PROJECT"},
+							},
+							aliasNameFlag(),
+						},
+						Action: func(c *cli.Context) error {
+							ui, logger := initUIAndLogger(c)
+							cpiInstance, err := createIncusCPI(
+								logger,
+								c.String("remote"),
+								c.String("project"),
+								"", // network not needed for alias
+								"", // storage-pool not needed for alias
+								"", // image not needed for alias
+							)
+							if err != nil {
+								return cli.Exit(fmt.Sprintf("Error creating Incus CPI: %v", err), 1)
+							}
+							defer cpiInstance.Close()
+
+							return commands.AliasAction(ui, logger, cpiInstance, &director.DefaultConfigProvider{}, c.String("name"))
 						},
 					},
 					{
@@ -542,6 +714,162 @@ The command will:
 					},
 				},
 			},
+			// Image commands (registry only, no running director required)
+			{
+				Name:      "image-diff",
+				Usage:     "Compare the BOSH manifests of two instant-bosh images",
+				ArgsUsage: "<current-image> <new-image>",
+				Description: `Compare the BOSH director manifests embedded in two instant-bosh images.
+
+Only the manifest is downloaded from the registry, the images are not pulled.
+
+Formats:
+  human     dyff's human-readable report (default)
+  go-patch  go-patch ops file that turns the current manifest into the new one
+  json      machine-readable document with release changes and all differences
+  releases  compact list of BOSH release version changes
+
+Examples:
+  ibosh image-diff ghcr.io/rkoster/instant-bosh:1.165 ghcr.io/rkoster/instant-bosh:latest
+  ibosh image-diff --format releases ghcr.io/rkoster/instant-bosh:1.165 ghcr.io/rkoster/instant-bosh:1.166
+  ibosh image-diff --format json ghcr.io/rkoster/instant-bosh:1.165 ghcr.io/rkoster/instant-bosh:1.166 | jq .releases`,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Usage:   "Output format: human, go-patch, json or releases",
+						Value:   string(registry.DiffFormatHuman),
+					},
+					&cli.BoolFlag{
+						Name:  "refresh",
+						Usage: "Ignore cached registry lookups and re-fetch image metadata",
+					},
+					&cli.StringFlag{
+						Name:    "platform",
+						Usage:   "Image platform for multi-arch images (e.g., linux/arm64, default: platform of this machine)",
+						EnvVars: []string{"IBOSH_PLATFORM"},
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 2 {
+						return cli.Exit("Error: current and new image references required", 1)
+					}
+					format, err := registry.ParseDiffFormat(c.String("format"))
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error: %v", err), 1)
+					}
+					ui, logger := initUIAndLogger(c)
+					registryClient, err := registry.NewClientWithOptions(logger, registry.ClientOptions{
+						Refresh:  c.Bool("refresh"),
+						Platform: c.String("platform"),
+					})
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error: %v", err), 1)
+					}
+					return commands.ImageDiffAction(
+						ui,
+						logger,
+						registryClient,
+						c.Args().Get(0),
+						c.Args().Get(1),
+						format,
+					)
+				},
+			},
+			// SSH commands (requires eval "$(ibosh docker/incus print-env)")
+			{
+				Name:      "ssh",
+				Usage:     "SSH into deployment instances",
+				ArgsUsage: "<deployment>[/<instance-group>[/<index-or-id>]]",
+				Description: `Open a shell on, or run a command on, deployment instances.
+
+Access is set up through the director's SSH API and connections go through the
+director container, no bosh CLI or BOSH_ALL_PROXY is needed.
+
+Requires BOSH environment to be configured first:
+  eval "$(ibosh docker print-env)"   # or ibosh incus print-env
+
+Examples:
+  ibosh ssh cf/api/0                       # Interactive shell
+  ibosh ssh cf/diego-cell -c 'uptime'      # Run on all diego-cell instances
+  ibosh ssh cf -c 'sudo monit summary'     # Run on all instances of cf
+  ibosh ssh cf/api/0 -t -c 'sudo -i'       # Run with a pseudo-terminal`,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "command",
+						Aliases: []string{"c"},
+						Usage:   "Command to run instead of an interactive shell",
+					},
+					&cli.BoolFlag{
+						Name:    "tty",
+						Aliases: []string{"t"},
+						Usage:   "Allocate a pseudo-terminal for the command (single instance only)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return cli.Exit("Error: target <deployment>[/<instance-group>[/<index-or-id>]] required", 1)
+					}
+					ui, _ := initUIAndLogger(c)
+					opts := commands.SSHOptions{
+						Command: c.String("command"),
+						TTY:     c.Bool("tty"),
+					}
+					err := commands.SSHAction(ui, c.Args().First(), opts)
+					if status := boshssh.ExitStatus(err); status > 0 {
+						return cli.Exit("", status)
+					}
+					return err
+				},
+			},
+			{
+				Name:      "scp",
+				Usage:     "Copy files to or from deployment instances",
+				ArgsUsage: "<source> <destination>",
+				Description: `Copy a file between the local machine and deployment instances.
+
+Remote paths have the form <deployment>[/<instance-group>[/<index-or-id>]]:<path>.
+Uploads go to all matching instances, downloads require a single instance.
+Prefix local paths containing ':' with './'.
+
+Requires BOSH environment to be configured first:
+  eval "$(ibosh docker print-env)"   # or ibosh incus print-env
+
+Examples:
+  ibosh scp ./fix.sh cf/diego-cell:/tmp/fix.sh   # Upload to all diego-cell instances
+  ibosh scp cf/api/0:/var/vcap/sys/log/cloud_controller_ng/cloud_controller_ng.log .`,
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 2 {
+						return cli.Exit("Error: source and destination required", 1)
+					}
+					ui, _ := initUIAndLogger(c)
+					return commands.SCPAction(ui, c.Args().Get(0), c.Args().Get(1))
+				},
+			},
+			{
+				Name:      "port-forward",
+				Usage:     "Forward local ports to a deployment instance",
+				ArgsUsage: "<deployment>/<instance-group>[/<index-or-id>] <local>:<remote> [<local>:<remote>...]",
+				Description: `Forward local TCP ports to ports on a deployment instance until interrupted.
+
+Connections are tunneled through the jumpbox on the director, so services on VMs
+can be reached from the host even when VM IPs are not routable (Docker backend).
+Local ports are bound on 127.0.0.1.
+
+Requires BOSH environment to be configured first:
+  eval "$(ibosh docker print-env)"   # or ibosh incus print-env
+
+Examples:
+  ibosh port-forward zookeeper/zookeeper/0 2181:2181
+  ibosh port-forward cf/router/0 8080:80 8443:443`,
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 2 {
+						return cli.Exit("Error: target and at least one <local>:<remote> port pair required", 1)
+					}
+					ui, _ := initUIAndLogger(c)
+					return commands.PortForwardAction(ui, c.Args().First(), c.Args().Tail())
+				},
+			},
 			// Credentials commands (requires eval "$(ibosh docker/incus print-env)")
 			{
 				Name:    "creds",
@@ -556,7 +884,13 @@ Examples:
   ibosh creds find                    # List all credentials
   ibosh creds find --path /cf         # List credentials under /cf
   ibosh creds get /cf/admin_password  # Get a specific credential
-  ibosh creds delete /cf/cc_public_tls  # Delete a credential`,
+  ibosh creds delete /cf/cc_public_tls  # Delete a credential
+  ibosh creds set /cf/cf_admin_password --type password --value demo  # Set a credential
+  ibosh creds generate /demo/ca --type certificate --is-ca --common-name demo-ca  # Generate a credential
+  ibosh creds rotate -d cf --type password     # Rotate passwords and redeploy
+  ibosh creds export --path /cf > creds.yml    # Back up credentials
+  ibosh creds import --path /cf creds.yml      # Restore credentials
+  ibosh creds proxy                   # Serve a CredHub API for the credhub CLI`,
 				Subcommands: []*cli.Command{
 					{
 						Name:      "get",
@@ -604,6 +938,400 @@ Examples:
 							return commands.CredsDeleteAction(ui, c.Args().First())
 						},
 					},
+					{
+						Name:      "set",
+						Usage:     "Set a credential value",
+						ArgsUsage: "<name>",
+						Description: `Stores a value for a credential, e.g. to pre-seed fixed passwords before a deploy.
+Value and password credentials are strings; the user, certificate, ssh, rsa and
+json types take a JSON or YAML object (e.g. username/password, or
+ca/certificate/private_key).
+
+Examples:
+  ibosh creds set /instant-bosh/cf/cf_admin_password --type password --value demo
+  ibosh creds set /instant-bosh/cf/router_ssl --type certificate --file router_ssl.yml`,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "type",
+								Aliases: []string{"t"},
+								Usage:   "Credential type: " + strings.Join(configserver.SetTypes, ", "),
+								Value:   "value",
+							},
+							&cli.StringFlag{
+								Name:    "value",
+								Aliases: []string{"v"},
+								Usage:   "Credential value",
+							},
+							&cli.StringFlag{
+								Name:  "file",
+								Usage: "Read the credential value from a file",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() < 1 {
+								return cli.Exit("Error: credential name required", 1)
+							}
+							ui, _ := initUIAndLogger(c)
+							return commands.CredsSetAction(ui, c.Args().First(), commands.CredsSetOptions{
+								Type:  c.String("type"),
+								Value: c.String("value"),
+								File:  c.String("file"),
+							})
+						},
+					},
+					{
+						Name:      "generate",
+						Usage:     "Generate a credential value",
+						ArgsUsage: "<name>",
+						Description: `Lets config-server generate a password, certificate, ssh or rsa credential.
+
+Examples:
+  ibosh creds generate /demo/admin_password
+  ibosh creds generate /demo/ca --type certificate --is-ca --common-name demo-ca
+  ibosh creds generate /demo/tls --type certificate --ca /demo/ca --common-name demo.example.com --alternative-name '*.demo.example.com'`,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "type",
+								Aliases: []string{"t"},
+								Usage:   "Credential type: " + strings.Join(configserver.GenerateTypes, ", "),
+								Value:   "password",
+							},
+							&cli.StringFlag{
+								Name:  "common-name",
+								Usage: "Common name of a certificate",
+							},
+							&cli.StringSliceFlag{
+								Name:  "alternative-name",
+								Usage: "Subject alternative name of a certificate (can be repeated)",
+							},
+							&cli.StringFlag{
+								Name:  "ca",
+								Usage: "Name of the CA credential signing a certificate",
+							},
+							&cli.BoolFlag{
+								Name:  "is-ca",
+								Usage: "Generate a CA certificate",
+							},
+							&cli.StringSliceFlag{
+								Name:  "extended-key-usage",
+								Usage: "Extended key usage of a certificate: server_auth or client_auth (can be repeated)",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() < 1 {
+								return cli.Exit("Error: credential name required", 1)
+							}
+							ui, _ := initUIAndLogger(c)
+							return commands.CredsGenerateAction(ui, c.Args().First(), commands.CredsGenerateOptions{
+								Type: c.String("type"),
+								Certificate: configserver.CertificateParameters{
+									CommonName:       c.String("common-name"),
+									AlternativeNames: c.StringSlice("alternative-name"),
+									CA:               c.String("ca"),
+									IsCA:             c.Bool("is-ca"),
+									ExtendedKeyUsage: c.StringSlice("extended-key-usage"),
+								},
+							})
+						},
+					},
+					{
+						Name:  "rotate",
+						Usage: "Rotate the credentials of a deployment and redeploy it",
+						Description: `Regenerates the manifest variables of a deployment matching --type and
+--name, then redeploys it. Certificates signed by a rotated CA are rotated
+too. A CA is replaced without downtime in three deploys: the new CA is
+trusted next to the old one, then it signs new certificates, then the old
+CA is no longer trusted. Types config-server can't generate are deleted
+and generated by the director during the redeploy.
+
+Examples:
+  ibosh creds rotate -d cf --type password --dry-run
+  ibosh creds rotate -d cf --name 'uaa_*'
+  ibosh creds rotate -d cf --name service_cf_internal_ca`,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "deployment",
+								Aliases:  []string{"d"},
+								Usage:    "Deployment to rotate credentials of",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:    "type",
+								Aliases: []string{"t"},
+								Usage:   "Only rotate variables of this type (e.g., password, certificate)",
+							},
+							&cli.StringFlag{
+								Name:    "name",
+								Aliases: []string{"n"},
+								Usage:   "Only rotate variables whose name matches this pattern (e.g., '*_ssl')",
+							},
+							&cli.BoolFlag{
+								Name:  "dry-run",
+								Usage: "Show the variables that would be rotated",
+							},
+							&cli.BoolFlag{
+								Name:    "force",
+								Aliases: []string{"f"},
+								Usage:   "Skip confirmation prompt",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							ui, _ := initUIAndLogger(c)
+							return commands.CredsRotateAction(ui, commands.CredsRotateOptions{
+								Deployment: c.String("deployment"),
+								Type:       c.String("type"),
+								Name:       c.String("name"),
+								DryRun:     c.Bool("dry-run"),
+								Force:      c.Bool("force"),
+							})
+						},
+					},
+					{
+						Name:  "export",
+						Usage: "Export credentials as a vars-store YAML file",
+						Description: `Prints the values of the credentials under a path as a vars-store style
+YAML file. Names are relative to --path (so the file also works with
+bosh deploy --vars-file), or absolute without it.
+
+Examples:
+  ibosh creds export --path /instant-bosh/cf > cf-creds.yml`,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "path",
+								Aliases: []string{"p"},
+								Usage:   "Export credentials under this path (e.g., /instant-bosh/cf)",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							ui, _ := initUIAndLogger(c)
+							return commands.CredsExportAction(ui, c.String("path"))
+						},
+					},
+					{
+						Name:      "import",
+						Usage:     "Import credentials from a vars-store YAML file",
+						ArgsUsage: "<file>",
+						Description: `Stores the credentials of a file written by 'ibosh creds export', e.g. to
+recreate a deployment with the same passwords and CAs after destroy.
+
+Examples:
+  ibosh creds import --path /instant-bosh/cf cf-creds.yml`,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "path",
+								Aliases: []string{"p"},
+								Usage:   "Path to import relative credential names to (e.g., /instant-bosh/cf)",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() < 1 {
+								return cli.Exit("Error: file required", 1)
+							}
+							ui, _ := initUIAndLogger(c)
+							return commands.CredsImportAction(ui, c.Args().First(), c.String("path"))
+						},
+					},
+					{
+						Name:  "proxy",
+						Usage: "Serve a CredHub-compatible API in front of config-server",
+						Description: `Serves the subset of the CredHub API used by the credhub CLI (info, get,
+set, find, delete and interpolate) on localhost and translates it to
+config-server calls. Runs until interrupted and prints the CREDHUB_*
+variables to configure the credhub CLI with.
+
+Examples:
+  ibosh creds proxy
+  export CREDHUB_SERVER=...             # in another shell, as printed
+  credhub find -p /instant-bosh/cf
+  credhub get -n /instant-bosh/cf/cf_admin_password`,
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:  "port",
+								Usage: "Local port to listen on",
+								Value: commands.CredHubProxyPort,
+							},
+							envFormatFlag(),
+						},
+						Action: func(c *cli.Context) error {
+							format, err := envformat.ParseFormat(c.String("format"))
+							if err != nil {
+								return cli.Exit(fmt.Sprintf("Error: %v", err), 1)
+							}
+							ui, _ := initUIAndLogger(c)
+							return commands.CredsProxyAction(ui, c.Int("port"), format)
+						},
+					},
+				},
+			},
+			{
+				Name:  "certs",
+				Usage: "List certificates and their expiry",
+				Description: `Lists the certificates of the director (vars store) and of the deployments
+(config-server) with subject, SANs, issuer, CA chain and days until expiry,
+and warns about certificates expiring soon.
+
+Requires BOSH environment to be configured first:
+  eval "$(ibosh docker print-env)"   # or ibosh incus print-env
+
+Examples:
+  ibosh certs
+  ibosh certs --warn-days 90
+  ibosh certs rotate /instant-bosh/cf/router_ssl`,
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "warn-days",
+						Usage: "Warn about certificates expiring within this number of days",
+						Value: commands.DefaultCertWarnDays,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					ui, _ := initUIAndLogger(c)
+					return commands.CertsAction(ui, c.Int("warn-days"))
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:      "rotate",
+						Usage:     "Regenerate a certificate and redeploy the deployments using it",
+						ArgsUsage: "<name>",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:    "force",
+								Aliases: []string{"f"},
+								Usage:   "Skip confirmation prompt",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() < 1 {
+								return cli.Exit("Error: certificate name required", 1)
+							}
+							ui, _ := initUIAndLogger(c)
+							return commands.CertsRotateAction(ui, c.Args().First(), c.Bool("force"))
+						},
+					},
+				},
+			},
+			{
+				Name:      "tasks",
+				Usage:     "List director tasks or follow the output of a task",
+				ArgsUsage: "[id]",
+				Description: `Without an ID, lists the recent tasks of the director. With an ID, follows
+the events (or the debug or CPI output) of the task until it finishes.
+Use --director bosh-warden for the director deployed with 'ibosh bosh deploy'.
+
+Examples:
+  ibosh tasks                          # List recent tasks
+  ibosh tasks -d cf --all              # List all tasks of the cf deployment
+  ibosh tasks 42                       # Follow the events of task 42
+  ibosh tasks 42 --debug-output        # Follow the debug output of task 42
+  ibosh tasks --director bosh-warden   # List tasks of the deployed director`,
+				Flags: []cli.Flag{
+					directorFlag(),
+					&cli.IntFlag{
+						Name:    "recent",
+						Aliases: []string{"r"},
+						Usage:   "Number of recent tasks to list",
+						Value:   commands.DefaultRecentTasks,
+					},
+					&cli.BoolFlag{
+						Name:    "all",
+						Aliases: []string{"a"},
+						Usage:   "Include internal tasks, e.g. snapshots and cleanups",
+					},
+					&cli.StringFlag{
+						Name:    "deployment",
+						Aliases: []string{"d"},
+						Usage:   "Only list tasks of this deployment",
+					},
+					&cli.BoolFlag{
+						Name:  "debug-output",
+						Usage: "Follow the debug output of the task instead of its events",
+					},
+					&cli.BoolFlag{
+						Name:  "cpi",
+						Usage: "Follow the CPI calls of the task instead of its events",
+					},
+					jsonEventsFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					ui, _ := initTaskUIAndLogger(c)
+					if c.NArg() == 0 {
+						return commands.TasksAction(ui, commands.TasksOptions{
+							Director:   c.String("director"),
+							Recent:     c.Int("recent"),
+							All:        c.Bool("all"),
+							Deployment: c.String("deployment"),
+						})
+					}
+
+					id, err := strconv.Atoi(c.Args().First())
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error: invalid task ID '%s'", c.Args().First()), 1)
+					}
+					return commands.TaskAction(ui, id, commands.TaskOptions{
+						Director: c.String("director"),
+						Debug:    c.Bool("debug-output"),
+						CPI:      c.Bool("cpi"),
+						JSON:     c.Bool("json"),
+					})
+				},
+			},
+			{
+				Name:  "events",
+				Usage: "List or tail director events",
+				Description: `Lists the events of the director, e.g. deploys, instance updates and
+credential changes, newest first. With --follow, prints new events as they happen.
+--since and --before take a duration ago (e.g. 1h) or a timestamp.
+
+Examples:
+  ibosh events -d cf --since 1h                  # Events of cf in the last hour
+  ibosh events --instance router/0 --action stop # Stops of an instance
+  ibosh events --follow                          # Tail events
+  ibosh events --director bosh-warden            # Events of the deployed director`,
+				Flags: []cli.Flag{
+					directorFlag(),
+					&cli.StringFlag{
+						Name:    "deployment",
+						Aliases: []string{"d"},
+						Usage:   "Only list events of this deployment",
+					},
+					&cli.StringFlag{
+						Name:  "instance",
+						Usage: "Only list events of this instance, e.g. router/0",
+					},
+					&cli.StringFlag{
+						Name:  "action",
+						Usage: "Only list events with this action, e.g. update, delete or stop",
+					},
+					&cli.StringFlag{
+						Name:  "task",
+						Usage: "Only list events of this task ID",
+					},
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "Only list events after this duration ago (e.g. 1h) or timestamp",
+					},
+					&cli.StringFlag{
+						Name:  "before",
+						Usage: "Only list events before this duration ago (e.g. 10m) or timestamp",
+					},
+					&cli.BoolFlag{
+						Name:    "follow",
+						Aliases: []string{"f"},
+						Usage:   "Keep printing new events until interrupted",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					ui, _ := initUIAndLogger(c)
+					return commands.EventsAction(ui, commands.EventsOptions{
+						Director:   c.String("director"),
+						Deployment: c.String("deployment"),
+						Instance:   c.String("instance"),
+						Action:     c.String("action"),
+						Task:       c.String("task"),
+						Since:      c.String("since"),
+						Before:     c.String("before"),
+						Follow:     c.Bool("follow"),
+					})
 				},
 			},
 			// CF commands (requires eval "$(ibosh docker/incus print-env)")
@@ -618,6 +1346,7 @@ Requires BOSH environment to be configured first:
 Examples:
   ibosh cf deploy                          # Deploy CF (auto-selects router IP)
   ibosh cf deploy --router-ip 10.245.0.34  # Deploy with specific router IP
+  ibosh cf deploy --profile tiny           # Deploy CF on 3 VMs
   ibosh cf delete                          # Delete CF deployment
   ibosh cf print-env                       # Print CF CLI env vars
   ibosh cf login                           # Login to CF as admin`,
@@ -646,15 +1375,23 @@ Examples:
 								Name:  "delete-creds",
 								Usage: "Delete all deployment credentials before deploying (forces regeneration)",
 							},
+							cfProfileFlag(),
+							cfMappingFlag(),
+							cfOpsFileFlag(),
+							jsonEventsFlag(),
 						},
 						Action: func(c *cli.Context) error {
-							ui, _ := initUIAndLogger(c)
+							ui, _ := initTaskUIAndLogger(c)
 							opts := commands.CFDeployOptions{
 								RouterIP:           c.String("router-ip"),
 								SystemDomain:       c.String("system-domain"),
 								DryRun:             c.Bool("dry-run"),
 								SkipStemcellUpload: c.Bool("skip-stemcell-upload"),
 								DeleteCreds:        c.Bool("delete-creds"),
+								JSON:               c.Bool("json"),
+								Profile:            c.String("profile"),
+								Mapping:            c.String("mapping"),
+								OpsFiles:           c.StringSlice("ops-file"),
 							}
 							return commands.CFDeployAction(ui, opts)
 						},
@@ -668,10 +1405,11 @@ Examples:
 								Aliases: []string{"f"},
 								Usage:   "Skip confirmation prompt",
 							},
+							jsonEventsFlag(),
 						},
 						Action: func(c *cli.Context) error {
-							ui, _ := initUIAndLogger(c)
-							return commands.CFDeleteAction(ui, c.Bool("force"))
+							ui, _ := initTaskUIAndLogger(c)
+							return commands.CFDeleteAction(ui, c.Bool("force"), c.Bool("json"))
 						},
 					},
 					{
@@ -715,12 +1453,18 @@ Examples:
 								Name:  "system-domain",
 								Usage: "System domain for CF (defaults to <router-ip>.sslip.io)",
 							},
+							cfProfileFlag(),
+							cfMappingFlag(),
+							cfOpsFileFlag(),
 						},
 						Action: func(c *cli.Context) error {
 							ui, _ := initUIAndLogger(c)
 							opts := commands.CFManifestOptions{
 								RouterIP:     c.String("router-ip"),
 								SystemDomain: c.String("system-domain"),
+								Profile:      c.String("profile"),
+								Mapping:      c.String("mapping"),
+								OpsFiles:     c.StringSlice("ops-file"),
 							}
 							return commands.CFManifestAction(ui, opts)
 						},
@@ -787,14 +1531,16 @@ Examples:
 								Name:  "dry-run",
 								Usage: "Show what would be deployed without deploying",
 							},
+							jsonEventsFlag(),
 						},
 						Action: func(c *cli.Context) error {
-							ui, _ := initUIAndLogger(c)
+							ui, _ := initTaskUIAndLogger(c)
 							return commands.BOSHDeployAction(
 								ui,
 								c.String("cpi"),
 								c.String("director-ip"),
 								c.Bool("dry-run"),
+								c.Bool("json"),
 							)
 						},
 					},
@@ -810,15 +1556,17 @@ Examples:
 							&cli.BoolFlag{
 								Name:    "force",
 								Aliases: []string{"f"},
-								Usage:   "Skip confirmation prompt",
+								Usage:   "Skip confirmation prompt and ignore errors deleting VMs",
 							},
+							jsonEventsFlag(),
 						},
 						Action: func(c *cli.Context) error {
-							ui, _ := initUIAndLogger(c)
+							ui, _ := initTaskUIAndLogger(c)
 							return commands.BOSHDeleteAction(
 								ui,
 								c.String("cpi"),
 								c.Bool("force"),
+								c.Bool("json"),
 							)
 						},
 					},
@@ -831,10 +1579,15 @@ Examples:
 								Usage: "CPI type (only 'warden' is supported)",
 								Value: "warden",
 							},
+							envFormatFlag(),
 						},
 						Action: func(c *cli.Context) error {
+							format, err := envformat.ParseFormat(c.String("format"))
+							if err != nil {
+								return cli.Exit(fmt.Sprintf("Error: %v", err), 1)
+							}
 							ui, _ := initUIAndLogger(c)
-							return commands.BOSHPrintEnvAction(ui, c.String("cpi"))
+							return commands.BOSHPrintEnvAction(ui, c.String("cpi"), format)
 						},
 					},
 					{
@@ -866,6 +1619,15 @@ Examples:
 					},
 				},
 			},
+			// Docker credential helper protocol, run by Incus for explicit registry credentials
+			{
+				Name:  "get",
+				Usage: "Print the explicit credentials for the registry URL read from stdin",
+				Action: func(c *cli.Context) error {
+					return registry.ServeCredentialHelper(os.Stdin, os.Stdout)
+				},
+				Hidden: true,
+			},
 			// Deprecated commands with helpful error messages
 			{
 				Name:  "start",
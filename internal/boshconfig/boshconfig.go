@@ -0,0 +1,68 @@
+package boshconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	cmdconf "github.com/cloudfoundry/bosh-cli/v7/cmd/config"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+const (
+	// EnvConfig overrides the path of the BOSH CLI config, like it does for the BOSH CLI.
+	EnvConfig = "BOSH_CONFIG"
+
+	// DefaultAlias is the alias of the instant-bosh director.
+	DefaultAlias = "instant-bosh"
+)
+
+// Environment is a director registered in the BOSH CLI config.
+type Environment struct {
+	Alias        string
+	URL          string
+	CACert       string
+	Client       string
+	ClientSecret string
+}
+
+// Path returns the path of the BOSH CLI config ($BOSH_CONFIG, defaulting to ~/.bosh/config).
+func Path() (string, error) {
+	if path := os.Getenv(EnvConfig); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("determining home directory: %w", err)
+	}
+	return filepath.Join(home, ".bosh", "config"), nil
+}
+
+// Alias registers env in the BOSH CLI config at path, like
+// "bosh alias-env" followed by "bosh log-in" with client credentials does.
+// An existing entry with the same alias or URL is replaced.
+func Alias(path string, env Environment, logger boshlog.Logger) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating BOSH config directory: %w", err)
+	}
+
+	config, err := cmdconf.NewFSConfigFromPath(path, boshsys.NewOsFileSystem(logger))
+	if err != nil {
+		return fmt.Errorf("reading BOSH config %s: %w", path, err)
+	}
+
+	aliased, err := config.AliasEnvironment(env.URL, env.Alias, env.CACert)
+	if err != nil {
+		return fmt.Errorf("aliasing environment %s: %w", env.Alias, err)
+	}
+	aliased = aliased.SetCredentials(env.Alias, cmdconf.Creds{
+		Client:       env.Client,
+		ClientSecret: env.ClientSecret,
+	})
+
+	if err := aliased.Save(); err != nil {
+		return fmt.Errorf("writing BOSH config %s: %w", path, err)
+	}
+	return nil
+}
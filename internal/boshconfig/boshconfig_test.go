@@ -0,0 +1,102 @@
+package boshconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/rkoster/instant-bosh/internal/boshconfig"
+	"gopkg.in/yaml.v3"
+)
+
+type configFile struct {
+	Environments []struct {
+		URL      string `yaml:"url"`
+		CACert   string `yaml:"ca_cert"`
+		Alias    string `yaml:"alias"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+	} `yaml:"environments"`
+}
+
+func readConfig(t *testing.T, path string) configFile {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading config: %v", err)
+	}
+	var config configFile
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		t.Fatalf("parsing config: %v", err)
+	}
+	return config
+}
+
+func TestAlias(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".bosh", "config")
+	existing := "environments:\n- url: https://192.168.50.6:25555\n  alias: vbox\n"
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(existing), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := boshlog.NewLogger(boshlog.LevelNone)
+	env := boshconfig.Environment{
+		Alias:        "instant-bosh",
+		URL:          "https://127.0.0.1:25555",
+		CACert:       "-----BEGIN CERTIFICATE-----\nfake\n-----END CERTIFICATE-----",
+		Client:       "admin",
+		ClientSecret: "secret",
+	}
+	if err := boshconfig.Alias(path, env, logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Re-aliasing with a new URL replaces the entry instead of adding one
+	env.URL = "https://10.245.0.10:25555"
+	env.ClientSecret = "rotated"
+	if err := boshconfig.Alias(path, env, logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config := readConfig(t, path)
+	if len(config.Environments) != 2 {
+		t.Fatalf("expected 2 environments, got %+v", config.Environments)
+	}
+	if config.Environments[0].Alias != "vbox" {
+		t.Errorf("expected existing environment to be kept, got %+v", config.Environments[0])
+	}
+	got := config.Environments[1]
+	if got.Alias != "instant-bosh" || got.URL != env.URL || got.CACert != env.CACert {
+		t.Errorf("unexpected environment %+v", got)
+	}
+	if got.Username != "admin" || got.Password != "rotated" {
+		t.Errorf("expected client credentials admin/rotated, got %s/%s", got.Username, got.Password)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected config mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestPath(t *testing.T) {
+	t.Setenv(boshconfig.EnvConfig, "/tmp/bosh-config")
+	path, err := boshconfig.Path()
+	if err != nil || path != "/tmp/bosh-config" {
+		t.Errorf("expected BOSH_CONFIG to override the path, got %s (%v)", path, err)
+	}
+
+	t.Setenv(boshconfig.EnvConfig, "")
+	t.Setenv("HOME", "/home/test")
+	path, err = boshconfig.Path()
+	if err != nil || path != filepath.Join("/home/test", ".bosh", "config") {
+		t.Errorf("expected ~/.bosh/config, got %s (%v)", path, err)
+	}
+}
@@ -0,0 +1,54 @@
+package boshssh
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter prefixes every line written to it, so output of commands running on
+// several instances at once can be told apart. Complete lines are written atomically
+// to the shared writer; call Flush to write a trailing partial line.
+type PrefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    bytes.Buffer
+}
+
+// NewPrefixWriter returns a PrefixWriter for w. Writers sharing w must share mu.
+func NewPrefixWriter(w io.Writer, mu *sync.Mutex, prefix string) *PrefixWriter {
+	return &PrefixWriter{mu: mu, w: w, prefix: []byte(prefix)}
+}
+
+func (p *PrefixWriter) Write(data []byte) (int, error) {
+	p.buf.Write(data)
+	for {
+		line, err := p.buf.ReadBytes('\n')
+		if err != nil {
+			// Keep the incomplete line for the next write
+			p.buf.Write(line)
+			return len(data), nil
+		}
+		if err := p.writeLine(line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Flush writes a buffered partial line, terminated by a newline.
+func (p *PrefixWriter) Flush() error {
+	if p.buf.Len() == 0 {
+		return nil
+	}
+	line := append(p.buf.Bytes(), '\n')
+	p.buf.Reset()
+	return p.writeLine(line)
+}
+
+func (p *PrefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.w.Write(append(append([]byte{}, p.prefix...), line...))
+	return err
+}
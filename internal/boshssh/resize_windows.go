@@ -0,0 +1,13 @@
+//go:build windows
+
+package boshssh
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+// watchWindowSize is a no-op on Windows, which has no SIGWINCH. The remote terminal
+// keeps the size it was started with.
+func watchWindowSize(fd int, session *ssh.Session) func() {
+	return func() {}
+}
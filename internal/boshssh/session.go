@@ -0,0 +1,229 @@
+package boshssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshuuid "github.com/cloudfoundry/bosh-utils/uuid"
+	"github.com/rkoster/instant-bosh/internal/director"
+	"golang.org/x/crypto/ssh"
+)
+
+// Port is the SSH port of deployment VMs.
+const Port = "22"
+
+// Session holds temporary SSH access to the instances of a deployment, set up
+// through the director's SSH API. Close removes the temporary user again.
+type Session struct {
+	deployment boshdir.Deployment
+	slug       boshdir.AllOrInstanceGroupOrInstanceSlug
+	opts       boshdir.SSHOpts
+	signer     ssh.Signer
+	dial       director.DialContextFunc
+
+	// Hosts are the instances SSH access has been set up for.
+	Hosts []boshdir.Host
+}
+
+// ParseTarget splits "deployment[/instance-group[/index-or-id]]" into the deployment
+// name and instance slug.
+func ParseTarget(target string) (string, boshdir.AllOrInstanceGroupOrInstanceSlug, error) {
+	deploymentName, instance, _ := strings.Cut(target, "/")
+	if deploymentName == "" {
+		return "", boshdir.AllOrInstanceGroupOrInstanceSlug{}, fmt.Errorf("invalid target %q: expected <deployment>[/<instance-group>[/<index-or-id>]]", target)
+	}
+	if instance == "" {
+		return deploymentName, boshdir.NewAllOrInstanceGroupOrInstanceSlug("", ""), nil
+	}
+
+	slug, err := boshdir.NewAllOrInstanceGroupOrInstanceSlugFromString(instance)
+	if err != nil {
+		return "", boshdir.AllOrInstanceGroupOrInstanceSlug{}, fmt.Errorf("invalid target %q: %w", target, err)
+	}
+	return deploymentName, slug, nil
+}
+
+// Setup creates a temporary user with a generated key on the matching instances.
+// Connections to the instances are opened with dial, which reaches the deployment
+// network (e.g. through the director's jumpbox).
+func Setup(deployment boshdir.Deployment, slug boshdir.AllOrInstanceGroupOrInstanceSlug, dial director.DialContextFunc) (*Session, error) {
+	opts, privateKey, err := boshdir.NewSSHOpts(boshuuid.NewGenerator())
+	if err != nil {
+		return nil, fmt.Errorf("generating SSH credentials: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		return nil, fmt.Errorf("parsing generated SSH key: %w", err)
+	}
+
+	result, err := deployment.SetUpSSH(slug, opts)
+	if err != nil {
+		return nil, fmt.Errorf("setting up SSH access: %w", err)
+	}
+
+	session := &Session{
+		deployment: deployment,
+		slug:       slug,
+		opts:       opts,
+		signer:     signer,
+		dial:       dial,
+		Hosts:      result.Hosts,
+	}
+
+	if len(result.Hosts) == 0 {
+		session.Close()
+		return nil, fmt.Errorf("no instances found matching %q", slug.String())
+	}
+
+	return session, nil
+}
+
+// Close removes the temporary SSH user from the instances.
+func (s *Session) Close() error {
+	if err := s.deployment.CleanUpSSH(s.slug, s.opts); err != nil {
+		return fmt.Errorf("cleaning up SSH access: %w", err)
+	}
+	return nil
+}
+
+// Connect opens an SSH connection to an instance. The host key reported by the
+// director is verified when available.
+func (s *Session) Connect(ctx context.Context, host boshdir.Host) (*ssh.Client, error) {
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if host.HostPublicKey != "" {
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(host.HostPublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("parsing host key of %s: %w", InstanceName(host), err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(hostKey)
+	}
+
+	config := &ssh.ClientConfig{
+		User:            host.Username,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(s.signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}
+
+	address := net.JoinHostPort(host.Host, Port)
+	conn, err := s.dial(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s (%s): %w", InstanceName(host), host.Host, err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("opening SSH connection to %s: %w", InstanceName(host), err)
+	}
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// Run executes a command on an instance. It returns an *ssh.ExitError if the
+// command exits with a non-zero status.
+func (s *Session) Run(ctx context.Context, host boshdir.Host, command string, stdout, stderr io.Writer) error {
+	client, err := s.Connect(ctx, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("opening session on %s: %w", InstanceName(host), err)
+	}
+	defer session.Close()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+	return session.Run(command)
+}
+
+// Upload writes content to path on an instance.
+func (s *Session) Upload(ctx context.Context, host boshdir.Host, content io.Reader, path string) error {
+	client, err := s.Connect(ctx, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("opening session on %s: %w", InstanceName(host), err)
+	}
+	defer session.Close()
+
+	var stderr strings.Builder
+	session.Stdin = content
+	session.Stderr = &stderr
+	if err := session.Run("cat > " + ShellQuote(path)); err != nil {
+		return fmt.Errorf("writing %s on %s: %w: %s", path, InstanceName(host), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Download copies the content of path on an instance to w.
+func (s *Session) Download(ctx context.Context, host boshdir.Host, path string, w io.Writer) error {
+	client, err := s.Connect(ctx, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("opening session on %s: %w", InstanceName(host), err)
+	}
+	defer session.Close()
+
+	var stderr strings.Builder
+	session.Stdout = w
+	session.Stderr = &stderr
+	if err := session.Run("cat " + ShellQuote(path)); err != nil {
+		return fmt.Errorf("reading %s on %s: %w: %s", path, InstanceName(host), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// InstanceName returns the instance-group/index-or-id name of a host.
+func InstanceName(host boshdir.Host) string {
+	return host.Job + "/" + host.IndexOrID
+}
+
+// ExitStatus returns the exit status of a failed remote command, or -1 if the
+// error is not caused by the command exiting.
+func ExitStatus(err error) int {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus()
+	}
+	return -1
+}
+
+// ShellQuote quotes a string for use as a single POSIX shell word.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ParseSCPArg splits an scp argument into a target and path. Remote arguments have the
+// form <deployment>[/<instance-group>[/<index-or-id>]]:<path>; anything else, including
+// paths starting with "." or "/" and Windows drive paths, is a local path.
+func ParseSCPArg(arg string) (target, path string, remote bool) {
+	if strings.HasPrefix(arg, ".") || strings.HasPrefix(arg, "/") || filepath.VolumeName(arg) != "" {
+		return "", arg, false
+	}
+	target, path, found := strings.Cut(arg, ":")
+	if !found || target == "" {
+		return "", arg, false
+	}
+	return target, path, true
+}
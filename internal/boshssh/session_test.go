@@ -0,0 +1,336 @@
+package boshssh_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshdirfakes "github.com/cloudfoundry/bosh-cli/v7/director/directorfakes"
+	"github.com/rkoster/instant-bosh/internal/boshssh"
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeVM is an SSH server standing in for a deployment VM. It accepts the key passed to
+// SetUpSSH and supports "cat > <path>", "cat <path>", "exit <n>" and echoes other commands.
+type fakeVM struct {
+	t        *testing.T
+	address  string
+	hostKey  ssh.PublicKey
+	mu       sync.Mutex
+	files    map[string]string
+	authUser string
+	authKey  ssh.PublicKey
+}
+
+func startFakeVM(t *testing.T) *fakeVM {
+	t.Helper()
+
+	_, hostPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivateKey)
+	if err != nil {
+		t.Fatalf("creating host signer: %v", err)
+	}
+
+	vm := &fakeVM{t: t, hostKey: hostSigner.PublicKey(), files: map[string]string{}}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			vm.mu.Lock()
+			defer vm.mu.Unlock()
+			if vm.authKey != nil && conn.User() == vm.authUser && bytes.Equal(key.Marshal(), vm.authKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	vm.address = listener.Addr().String()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go vm.serve(conn, config)
+		}
+	}()
+
+	return vm
+}
+
+func (vm *fakeVM) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				command := string(req.Payload[4:])
+				status := vm.exec(command, channel)
+				channel.SendRequest("exit-status", false, binary.BigEndian.AppendUint32(nil, status))
+				return
+			}
+		}()
+	}
+}
+
+func (vm *fakeVM) exec(command string, channel ssh.Channel) uint32 {
+	unquote := func(s string) string { return strings.Trim(s, "'") }
+
+	switch {
+	case strings.HasPrefix(command, "cat > "):
+		content, _ := io.ReadAll(channel)
+		vm.mu.Lock()
+		vm.files[unquote(strings.TrimPrefix(command, "cat > "))] = string(content)
+		vm.mu.Unlock()
+	case strings.HasPrefix(command, "cat "):
+		vm.mu.Lock()
+		content, ok := vm.files[unquote(strings.TrimPrefix(command, "cat "))]
+		vm.mu.Unlock()
+		if !ok {
+			fmt.Fprintln(channel.Stderr(), "No such file or directory")
+			return 1
+		}
+		io.WriteString(channel, content)
+	case strings.HasPrefix(command, "exit "):
+		var status uint32
+		fmt.Sscanf(command, "exit %d", &status)
+		return status
+	default:
+		fmt.Fprintf(channel, "ran: %s\n", command)
+	}
+	return 0
+}
+
+func setupSession(t *testing.T, vm *fakeVM, hosts int) (*boshssh.Session, *boshdirfakes.FakeDeployment) {
+	t.Helper()
+
+	deployment := &boshdirfakes.FakeDeployment{}
+	deployment.SetUpSSHStub = func(slug boshdir.AllOrInstanceGroupOrInstanceSlug, opts boshdir.SSHOpts) (boshdir.SSHResult, error) {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(opts.PublicKey))
+		if err != nil {
+			t.Fatalf("parsing public key from SSH opts: %v", err)
+		}
+		vm.mu.Lock()
+		vm.authUser = opts.Username
+		vm.authKey = key
+		vm.mu.Unlock()
+
+		result := boshdir.SSHResult{}
+		for i := 0; i < hosts; i++ {
+			result.Hosts = append(result.Hosts, boshdir.Host{
+				Job:           "web",
+				IndexOrID:     fmt.Sprint(i),
+				Username:      opts.Username,
+				Host:          "10.245.0.10",
+				HostPublicKey: string(ssh.MarshalAuthorizedKey(vm.hostKey)),
+			})
+		}
+		return result, nil
+	}
+
+	// Every instance is reached through the fake VM, like the jumpbox would route to it
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		if address != "10.245.0.10:22" {
+			t.Errorf("expected dial to 10.245.0.10:22, got %s", address)
+		}
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, vm.address)
+	}
+
+	session, err := boshssh.Setup(deployment, boshdir.NewAllOrInstanceGroupOrInstanceSlug("web", ""), dial)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return session, deployment
+}
+
+func TestSessionRun(t *testing.T) {
+	vm := startFakeVM(t)
+	session, deployment := setupSession(t, vm, 2)
+
+	if len(session.Hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %d", len(session.Hosts))
+	}
+
+	var stdout bytes.Buffer
+	if err := session.Run(context.Background(), session.Hosts[1], "uptime", &stdout, io.Discard); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.String() != "ran: uptime\n" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+
+	err := session.Run(context.Background(), session.Hosts[0], "exit 3", io.Discard, io.Discard)
+	if status := boshssh.ExitStatus(err); status != 3 {
+		t.Errorf("expected exit status 3, got %d (%v)", status, err)
+	}
+
+	if err := session.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deployment.CleanUpSSHCallCount() != 1 {
+		t.Errorf("expected SSH access to be cleaned up")
+	}
+	_, setupOpts := deployment.SetUpSSHArgsForCall(0)
+	_, cleanupOpts := deployment.CleanUpSSHArgsForCall(0)
+	if cleanupOpts.Username != setupOpts.Username {
+		t.Errorf("expected cleanup of user %s, got %s", setupOpts.Username, cleanupOpts.Username)
+	}
+}
+
+func TestSessionUploadDownload(t *testing.T) {
+	vm := startFakeVM(t)
+	session, _ := setupSession(t, vm, 1)
+	host := session.Hosts[0]
+
+	if err := session.Upload(context.Background(), host, strings.NewReader("hello"), "/tmp/it's here"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var content bytes.Buffer
+	if err := session.Download(context.Background(), host, "/tmp/it's here", &content); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content.String() != "hello" {
+		t.Errorf("expected downloaded content hello, got %q", content.String())
+	}
+
+	err := session.Download(context.Background(), host, "/missing", io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "No such file or directory") {
+		t.Errorf("expected error with remote stderr, got %v", err)
+	}
+}
+
+func TestSessionRejectsUnexpectedHostKey(t *testing.T) {
+	vm := startFakeVM(t)
+	session, _ := setupSession(t, vm, 1)
+
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(otherKey)
+	host := session.Hosts[0]
+	host.HostPublicKey = string(ssh.MarshalAuthorizedKey(otherSigner.PublicKey()))
+
+	if err := session.Run(context.Background(), host, "uptime", io.Discard, io.Discard); err == nil {
+		t.Error("expected error for mismatching host key")
+	}
+}
+
+func TestSetupWithoutInstances(t *testing.T) {
+	deployment := &boshdirfakes.FakeDeployment{}
+	slug := boshdir.NewAllOrInstanceGroupOrInstanceSlug("missing", "")
+
+	if _, err := boshssh.Setup(deployment, slug, nil); err == nil {
+		t.Fatal("expected error when no instances match")
+	}
+	if deployment.CleanUpSSHCallCount() != 1 {
+		t.Errorf("expected SSH access to be cleaned up")
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		target     string
+		deployment string
+		slug       string
+		wantErr    bool
+	}{
+		{target: "cf", deployment: "cf", slug: ""},
+		{target: "cf/api", deployment: "cf", slug: "api"},
+		{target: "cf/api/0", deployment: "cf", slug: "api/0"},
+		{target: "", wantErr: true},
+		{target: "/api", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		deployment, slug, err := boshssh.ParseTarget(tt.target)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseTarget(%q): expected error", tt.target)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTarget(%q): unexpected error: %v", tt.target, err)
+			continue
+		}
+		if deployment != tt.deployment || slug.String() != tt.slug {
+			t.Errorf("ParseTarget(%q) = %s, %s; want %s, %s", tt.target, deployment, slug.String(), tt.deployment, tt.slug)
+		}
+	}
+}
+
+func TestParseSCPArg(t *testing.T) {
+	tests := []struct {
+		arg    string
+		target string
+		path   string
+		remote bool
+	}{
+		{arg: "cf/api/0:/tmp/file", target: "cf/api/0", path: "/tmp/file", remote: true},
+		{arg: "cf:/tmp/file", target: "cf", path: "/tmp/file", remote: true},
+		{arg: "file.txt", path: "file.txt"},
+		{arg: "./a:b", path: "./a:b"},
+		{arg: "/tmp/a:b", path: "/tmp/a:b"},
+	}
+
+	for _, tt := range tests {
+		target, path, remote := boshssh.ParseSCPArg(tt.arg)
+		if target != tt.target || path != tt.path || remote != tt.remote {
+			t.Errorf("ParseSCPArg(%q) = %q, %q, %v; want %q, %q, %v", tt.arg, target, path, remote, tt.target, tt.path, tt.remote)
+		}
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	var mu sync.Mutex
+	w := boshssh.NewPrefixWriter(&out, &mu, "web/0: ")
+
+	fmt.Fprint(w, "one\ntw")
+	fmt.Fprint(w, "o\nthree")
+	w.Flush()
+
+	expected := "web/0: one\nweb/0: two\nweb/0: three\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,71 @@
+package boshssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// Shell starts an interactive session on an instance with a pseudo-terminal. An empty
+// command starts a login shell. When stdin is a terminal it is put in raw mode for the
+// duration of the session and window size changes are forwarded.
+func (s *Session) Shell(ctx context.Context, host boshdir.Host, command string, stdin *os.File, stdout, stderr io.Writer) error {
+	client, err := s.Connect(ctx, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("opening session on %s: %w", InstanceName(host), err)
+	}
+	defer session.Close()
+
+	fd := int(stdin.Fd())
+	width, height := 80, 24
+	if term.IsTerminal(fd) {
+		if w, h, err := term.GetSize(fd); err == nil {
+			width, height = w, h
+		}
+
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("setting terminal to raw mode: %w", err)
+		}
+		defer term.Restore(fd, oldState)
+
+		stopWatching := watchWindowSize(fd, session)
+		defer stopWatching()
+	}
+
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty(termType, height, width, modes); err != nil {
+		return fmt.Errorf("requesting pseudo-terminal on %s: %w", InstanceName(host), err)
+	}
+
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	if command == "" {
+		if err := session.Shell(); err != nil {
+			return fmt.Errorf("starting shell on %s: %w", InstanceName(host), err)
+		}
+		return session.Wait()
+	}
+	return session.Run(command)
+}
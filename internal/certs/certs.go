@@ -0,0 +1,208 @@
+package certs
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+)
+
+// Sources of certificates.
+const (
+	// SourceDirector is the vars store the director was created with.
+	SourceDirector = "director"
+	// SourceConfigServer is the config-server holding the deployment credentials.
+	SourceConfigServer = "config-server"
+)
+
+// Certificate is a certificate credential.
+type Certificate struct {
+	// Name is the credential name, e.g. director_ssl or /instant-bosh/cf/router_ssl
+	Name   string
+	Source string
+
+	Subject  string
+	SANs     []string
+	Issuer   string
+	IsCA     bool
+	NotAfter time.Time
+	// Chain lists the subjects of the CA certificates of the credential
+	Chain []string
+}
+
+// DaysLeft returns the number of days until the certificate expires, negative when expired.
+func (c Certificate) DaysLeft(now time.Time) int {
+	return int(math.Floor(c.NotAfter.Sub(now).Hours() / 24))
+}
+
+// Parse parses a certificate credential value (a map with certificate, private_key and
+// optionally ca). It returns false for values of other types.
+func Parse(name, source string, value interface{}) (Certificate, bool, error) {
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return Certificate{}, false, nil
+	}
+	certificatePEM, ok := fields["certificate"].(string)
+	if !ok {
+		return Certificate{}, false, nil
+	}
+
+	certificates, err := parsePEM(certificatePEM)
+	if err != nil {
+		return Certificate{}, true, fmt.Errorf("parsing certificate %s: %w", name, err)
+	}
+	if len(certificates) == 0 {
+		return Certificate{}, true, fmt.Errorf("parsing certificate %s: no certificate found", name)
+	}
+
+	cert := certificates[0]
+	result := Certificate{
+		Name:     name,
+		Source:   source,
+		Subject:  cert.Subject.String(),
+		Issuer:   cert.Issuer.String(),
+		IsCA:     cert.IsCA,
+		NotAfter: cert.NotAfter,
+	}
+	result.SANs = append(result.SANs, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		result.SANs = append(result.SANs, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		result.SANs = append(result.SANs, uri.String())
+	}
+	result.SANs = append(result.SANs, cert.EmailAddresses...)
+
+	// The chain is made of the intermediates bundled with the certificate and the CA
+	var chain []*x509.Certificate
+	chain = append(chain, certificates[1:]...)
+	if caPEM, ok := fields["ca"].(string); ok {
+		cas, err := parsePEM(caPEM)
+		if err != nil {
+			return Certificate{}, true, fmt.Errorf("parsing CA of %s: %w", name, err)
+		}
+		chain = append(chain, cas...)
+	}
+	seen := map[string]bool{}
+	for _, ca := range chain {
+		subject := ca.Subject.String()
+		if !seen[subject] {
+			seen[subject] = true
+			result.Chain = append(result.Chain, subject)
+		}
+	}
+
+	return result, true, nil
+}
+
+// FromValues parses the certificate credentials among named credential values, e.g. the
+// director vars store. Values of other types are skipped. Credentials that can't be parsed
+// are skipped as well, their errors are returned so they can be reported as warnings.
+func FromValues(source string, values map[string]interface{}) ([]Certificate, []error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		result []Certificate
+		errs   []error
+	)
+	for _, name := range names {
+		cert, ok, err := Parse(name, source, values[name])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			result = append(result, cert)
+		}
+	}
+	Sort(result)
+	return result, errs
+}
+
+// ReadCACert returns the PEM content of a CA certificate given as PEM or as a file path,
+// as the CA certificate variables of print-env --format direnv are. Name is the variable
+// the value was read from.
+func ReadCACert(name, value string) (string, error) {
+	if strings.Contains(value, "-----BEGIN") {
+		return value, nil
+	}
+	content, err := os.ReadFile(value)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", name, err)
+	}
+	return string(content), nil
+}
+
+// Sort sorts certificates by source and name.
+func Sort(certificates []Certificate) {
+	sort.Slice(certificates, func(i, j int) bool {
+		if certificates[i].Source != certificates[j].Source {
+			return certificates[i].Source < certificates[j].Source
+		}
+		return certificates[i].Name < certificates[j].Name
+	})
+}
+
+// Expiring returns the certificates expiring within the given number of days.
+func Expiring(certificates []Certificate, days int, now time.Time) []Certificate {
+	var result []Certificate
+	for _, cert := range certificates {
+		if cert.DaysLeft(now) < days {
+			result = append(result, cert)
+		}
+	}
+	return result
+}
+
+// AffectedDeployments returns the deployments using a config-server credential.
+func AffectedDeployments(director boshdir.Director, name string) ([]boshdir.Deployment, error) {
+	deployments, err := director.Deployments()
+	if err != nil {
+		return nil, fmt.Errorf("listing deployments: %w", err)
+	}
+
+	var result []boshdir.Deployment
+	for _, deployment := range deployments {
+		variables, err := deployment.Variables()
+		if err != nil {
+			return nil, fmt.Errorf("listing variables of deployment %s: %w", deployment.Name(), err)
+		}
+		for _, variable := range variables {
+			if variable.Name == name {
+				result = append(result, deployment)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func parsePEM(data string) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return certificates, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, cert)
+	}
+}
@@ -0,0 +1,141 @@
+package certs_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshdirfakes "github.com/cloudfoundry/bosh-cli/v7/director/directorfakes"
+	"github.com/rkoster/instant-bosh/internal/certs"
+)
+
+var now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// issue creates a certificate valid until notAfter, signed by parent (self-signed if nil)
+func issue(t *testing.T, template *x509.Certificate, notAfter time.Time, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = now.Add(-24 * time.Hour)
+	template.NotAfter = notAfter
+	template.BasicConstraintsValid = true
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestFromValues(t *testing.T) {
+	ca, caKey, caPEM := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "default_ca"}, IsCA: true, KeyUsage: x509.KeyUsageCertSign}, now.AddDate(1, 0, 0), nil, nil)
+	_, _, leafPEM := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "director"},
+		DNSNames:    []string{"director.local"},
+		IPAddresses: []net.IP{net.ParseIP("10.245.0.3")},
+	}, now.Add(10*24*time.Hour+time.Hour), ca, caKey)
+
+	values := map[string]interface{}{
+		"default_ca":     map[string]interface{}{"ca": caPEM, "certificate": caPEM, "private_key": "key"},
+		"director_ssl":   map[string]interface{}{"ca": caPEM, "certificate": leafPEM, "private_key": "key"},
+		"admin_password": "secret",
+		"jumpbox_ssh":    map[string]interface{}{"private_key": "key", "public_key": "key"},
+	}
+
+	result, errs := certs.FromValues(certs.SourceDirector, values)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(result) != 2 {
+		t.Fatalf("expected 2 certificates, got %+v", result)
+	}
+
+	director := result[1]
+	if director.Name != "director_ssl" || director.Source != certs.SourceDirector {
+		t.Errorf("unexpected certificate %+v", director)
+	}
+	if director.Subject != "CN=director" || director.Issuer != "CN=default_ca" || director.IsCA {
+		t.Errorf("unexpected subject/issuer %+v", director)
+	}
+	if !reflect.DeepEqual(director.SANs, []string{"director.local", "10.245.0.3"}) {
+		t.Errorf("unexpected SANs %v", director.SANs)
+	}
+	if !reflect.DeepEqual(director.Chain, []string{"CN=default_ca"}) {
+		t.Errorf("unexpected chain %v", director.Chain)
+	}
+	if days := director.DaysLeft(now); days != 10 {
+		t.Errorf("expected 10 days left, got %d", days)
+	}
+	if !result[0].IsCA {
+		t.Errorf("expected default_ca to be a CA")
+	}
+
+	expiring := certs.Expiring(result, 30, now)
+	if len(expiring) != 1 || expiring[0].Name != "director_ssl" {
+		t.Errorf("expected director_ssl to expire within 30 days, got %+v", expiring)
+	}
+}
+
+func TestParseInvalidCertificate(t *testing.T) {
+	_, ok, err := certs.Parse("broken", certs.SourceConfigServer, map[string]interface{}{"certificate": "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"})
+	if !ok || err == nil {
+		t.Errorf("expected error for an invalid certificate, got %v, %v", ok, err)
+	}
+
+	if _, ok, _ := certs.Parse("password", certs.SourceConfigServer, "secret"); ok {
+		t.Error("expected a password not to be a certificate")
+	}
+}
+
+func TestFromValuesSkipsInvalidCertificates(t *testing.T) {
+	_, _, caPEM := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "default_ca"}, IsCA: true, KeyUsage: x509.KeyUsageCertSign}, now.AddDate(1, 0, 0), nil, nil)
+	values := map[string]interface{}{
+		"broken":     map[string]interface{}{"certificate": "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"},
+		"default_ca": map[string]interface{}{"certificate": caPEM, "private_key": "key"},
+	}
+
+	result, errs := certs.FromValues(certs.SourceDirector, values)
+	if len(result) != 1 || result[0].Name != "default_ca" {
+		t.Errorf("expected default_ca to be listed, got %+v", result)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "broken") {
+		t.Errorf("expected an error for broken, got %v", errs)
+	}
+}
+
+func TestAffectedDeployments(t *testing.T) {
+	cf := &boshdirfakes.FakeDeployment{}
+	cf.NameReturns("cf")
+	cf.VariablesReturns([]boshdir.VariableResult{{Name: "/instant-bosh/cf/router_ssl"}}, nil)
+	zookeeper := &boshdirfakes.FakeDeployment{}
+	zookeeper.NameReturns("zookeeper")
+
+	director := &boshdirfakes.FakeDirector{}
+	director.DeploymentsReturns([]boshdir.Deployment{cf, zookeeper}, nil)
+
+	deployments, err := certs.AffectedDeployments(director, "/instant-bosh/cf/router_ssl")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deployments) != 1 || deployments[0].Name() != "cf" {
+		t.Errorf("expected only cf to be affected, got %v", deployments)
+	}
+}
@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/rkoster/instant-bosh/internal/boshconfig"
+	"github.com/rkoster/instant-bosh/internal/cpi"
+	"github.com/rkoster/instant-bosh/internal/director"
+)
+
+// AliasAction registers the running director in the BOSH CLI config (~/.bosh/config)
+// under alias, with its CA certificate and client credentials, so that
+// "bosh -e <alias>" works without print-env.
+func AliasAction(ui UI, logger boshlog.Logger, cpiInstance cpi.CPI, configProvider director.ConfigProvider, alias string) error {
+	ctx := context.Background()
+
+	running, err := cpiInstance.IsRunning(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !running {
+		return fmt.Errorf("instant-bosh container is not running. Please run 'ibosh start' first")
+	}
+
+	config, err := configProvider.GetDirectorConfig(ctx, cpiInstance, cpiInstance.GetContainerName())
+	if err != nil {
+		return fmt.Errorf("failed to get director config: %w", err)
+	}
+
+	path, err := aliasDirector(logger, config, alias)
+	if err != nil {
+		return err
+	}
+
+	ui.PrintLinef("Registered environment '%s' (%s) in %s", alias, config.Environment, path)
+	printAliasProxyNote(ui, config)
+	return nil
+}
+
+// registerBOSHAlias registers the director under alias in the BOSH CLI config.
+// Failures are reported as a warning, since print-env still works without the alias.
+func registerBOSHAlias(ui UI, logger boshlog.Logger, config *director.Config, alias string) {
+	if config == nil {
+		return
+	}
+
+	path, err := aliasDirector(logger, config, alias)
+	if err != nil {
+		ui.PrintLinef("Warning: failed to register BOSH CLI alias: %v", err)
+		return
+	}
+	ui.PrintLinef("Registered environment '%s' in %s (bosh -e %s)", alias, path, alias)
+}
+
+func aliasDirector(logger boshlog.Logger, config *director.Config, alias string) (string, error) {
+	path, err := boshconfig.Path()
+	if err != nil {
+		return "", err
+	}
+
+	err = boshconfig.Alias(path, boshconfig.Environment{
+		Alias:        alias,
+		URL:          config.Environment,
+		CACert:       config.CACert,
+		Client:       config.Client,
+		ClientSecret: config.ClientSecret,
+	}, logger)
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// printAliasProxyNote explains that the BOSH CLI config cannot hold a proxy, so
+// deployment instances only reachable through the jumpbox still need BOSH_ALL_PROXY.
+func printAliasProxyNote(ui UI, config *director.Config) {
+	if config.AllProxy == "" {
+		return
+	}
+	ui.PrintLinef("Deployment instances are only reachable through the jumpbox, to reach them (e.g. bosh ssh) also set:")
+	ui.PrintLinef("  export BOSH_ALL_PROXY=%s", config.AllProxy)
+}
@@ -0,0 +1,93 @@
+package commands_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/rkoster/instant-bosh/internal/boshconfig"
+	"github.com/rkoster/instant-bosh/internal/commands"
+	"github.com/rkoster/instant-bosh/internal/commands/commandsfakes"
+	"github.com/rkoster/instant-bosh/internal/cpi/cpifakes"
+	"github.com/rkoster/instant-bosh/internal/director"
+	"github.com/rkoster/instant-bosh/internal/director/directorfakes"
+)
+
+var _ = Describe("AliasAction", func() {
+	var (
+		fakeCPI            *cpifakes.FakeCPI
+		fakeConfigProvider *directorfakes.FakeConfigProvider
+		fakeUI             *commandsfakes.FakeUI
+		logger             boshlog.Logger
+		configPath         string
+	)
+
+	BeforeEach(func() {
+		fakeCPI = &cpifakes.FakeCPI{}
+		fakeConfigProvider = &directorfakes.FakeConfigProvider{}
+		fakeUI = &commandsfakes.FakeUI{}
+		logger = boshlog.NewLogger(boshlog.LevelNone)
+
+		configPath = filepath.Join(GinkgoT().TempDir(), ".bosh", "config")
+		GinkgoT().Setenv(boshconfig.EnvConfig, configPath)
+
+		fakeCPI.IsRunningReturns(true, nil)
+		fakeCPI.GetContainerNameReturns("instant-bosh")
+		fakeConfigProvider.GetDirectorConfigReturns(&director.Config{
+			Environment:  "https://127.0.0.1:25555",
+			Client:       "admin",
+			ClientSecret: "fake-secret",
+			CACert:       "fake-cert",
+			AllProxy:     "ssh+socks5://jumpbox@127.0.0.1:2222?private-key=/tmp/jumpbox.key",
+		}, nil)
+	})
+
+	It("writes the environment to the BOSH CLI config", func() {
+		err := commands.AliasAction(fakeUI, logger, fakeCPI, fakeConfigProvider, "my-bosh")
+		Expect(err).NotTo(HaveOccurred())
+
+		config, err := os.ReadFile(configPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(config)).To(ContainSubstring("alias: my-bosh"))
+		Expect(string(config)).To(ContainSubstring("ca_cert: fake-cert"))
+		Expect(string(config)).To(ContainSubstring("username: admin"))
+		Expect(string(config)).To(ContainSubstring("password: fake-secret"))
+	})
+
+	It("explains that the proxy is still needed", func() {
+		err := commands.AliasAction(fakeUI, logger, fakeCPI, fakeConfigProvider, "my-bosh")
+		Expect(err).NotTo(HaveOccurred())
+
+		var printed []string
+		for i := 0; i < fakeUI.PrintLinefCallCount(); i++ {
+			format, args := fakeUI.PrintLinefArgsForCall(i)
+			if len(args) > 0 {
+				printed = append(printed, args[len(args)-1].(string))
+			} else {
+				printed = append(printed, format)
+			}
+		}
+		Expect(printed).To(ContainElement(ContainSubstring("ssh+socks5://")))
+	})
+
+	It("returns an error when the container is not running", func() {
+		fakeCPI.IsRunningReturns(false, nil)
+
+		err := commands.AliasAction(fakeUI, logger, fakeCPI, fakeConfigProvider, "my-bosh")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("not running"))
+		Expect(configPath).NotTo(BeAnExistingFile())
+	})
+
+	It("returns an error when the director config is unavailable", func() {
+		fakeConfigProvider.GetDirectorConfigReturns(nil, errors.New("no vars store"))
+
+		err := commands.AliasAction(fakeUI, logger, fakeCPI, fakeConfigProvider, "my-bosh")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("no vars store"))
+	})
+})
@@ -2,18 +2,20 @@ package commands
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/cppforlife/go-patch/patch"
 	"github.com/rkoster/instant-bosh/internal/configserver"
 	"github.com/rkoster/instant-bosh/internal/cpi"
 	"github.com/rkoster/instant-bosh/internal/director"
+	"github.com/rkoster/instant-bosh/internal/envformat"
+	"github.com/rkoster/instant-bosh/internal/interpolate"
 	"github.com/rkoster/instant-bosh/internal/manifests"
+	"github.com/rkoster/instant-bosh/internal/state"
 	"github.com/rkoster/instant-bosh/internal/uploadedrelease"
 )
 
@@ -24,8 +26,9 @@ type BOSHDeployConfig struct {
 	DryRun     bool   // If true, only prepare manifest without deploying
 }
 
-// BOSHDeployAction deploys a BOSH director as a BOSH deployment
-func BOSHDeployAction(ui UI, cpiType, directorIP string, dryRun bool) error {
+// BOSHDeployAction deploys a BOSH director as a BOSH deployment.
+// With jsonOutput, the events of the deploy task are written as JSON lines to stdout.
+func BOSHDeployAction(ui UI, cpiType, directorIP string, dryRun, jsonOutput bool) error {
 	ctx := context.Background()
 
 	// Validate that we're using Incus backend (required for warden)
@@ -37,14 +40,39 @@ func BOSHDeployAction(ui UI, cpiType, directorIP string, dryRun bool) error {
 		return fmt.Errorf("BOSH deployment with warden CPI requires Incus backend (detected: %s)", detectedCPI)
 	}
 
-	// Resolve configuration
-	config, err := ResolveBOSHConfig(ui, cpiType, directorIP)
+	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create CPI client: %w", err)
+	}
+	defer cpiCleanup()
+
+	directorClient, directorCleanup, err := createTaskDirectorClient(ctx, cpiInstance, newTaskReporter(ui, jsonOutput))
+	if err != nil {
+		return fmt.Errorf("failed to create director client: %w", err)
+	}
+	defer directorCleanup()
+
+	ipSelector, err := newIPSelector(ui, directorClient, cpiInstance)
+	if err != nil {
+		return err
+	}
+
+	// Resolve configuration, a dry run doesn't reserve the director IP
+	config, err := ResolveBOSHConfig(ui, directorClient, ipSelector, cpiType, directorIP, !dryRun)
 	if err != nil {
 		return fmt.Errorf("resolving BOSH config: %w", err)
 	}
 
 	deploymentName := fmt.Sprintf("bosh-%s", config.CPI)
 
+	// Release the reserved director IP when the director isn't deployed, so other deploys can use it
+	deployed := false
+	defer func() {
+		if !deployed && !dryRun {
+			releaseIPs(ui, ipSelector, deploymentName)
+		}
+	}()
+
 	ui.PrintLinef("Deploying BOSH director '%s' with %s CPI", deploymentName, config.CPI)
 	ui.PrintLinef("Director IP: %s", config.DirectorIP)
 
@@ -71,36 +99,16 @@ func BOSHDeployAction(ui UI, cpiType, directorIP string, dryRun bool) error {
 	// Filter the manifest to remove url/sha1 from already-uploaded releases
 	ui.PrintLinef("Checking for already uploaded releases...")
 
-	// Save BOSH env vars before creating clients (createDirectorClient unsets them)
-	savedEnv := saveBOSHEnvVars()
-
-	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
-	if err != nil {
-		restoreBOSHEnvVars(savedEnv)
-		return fmt.Errorf("failed to create CPI client: %w", err)
-	}
-	defer cpiCleanup()
-
-	directorClient, directorCleanup, err := createDirectorClient(ctx, cpiInstance)
-	if err != nil {
-		restoreBOSHEnvVars(savedEnv)
-		return fmt.Errorf("failed to create director client: %w", err)
-	}
-	defer directorCleanup()
-
 	filteredManifest, err := uploadedrelease.Filter(interpolatedManifest, directorClient)
 	if err != nil {
-		restoreBOSHEnvVars(savedEnv)
 		return fmt.Errorf("failed to filter releases: %w", err)
 	}
 
-	// Restore env vars before running bosh deploy (it needs them)
-	restoreBOSHEnvVars(savedEnv)
-
 	// Deploy the BOSH director with filtered manifest
-	if err := deployBOSHDirector(ui, deploymentName, filteredManifest, config); err != nil {
+	if err := deployBOSHDirector(ui, directorClient, deploymentName, filteredManifest); err != nil {
 		return fmt.Errorf("deploying BOSH director: %w", err)
 	}
+	deployed = true
 
 	// Apply warden cloud-config to the deployed director
 	ui.PrintLinef("\nApplying warden cloud-config to director...")
@@ -117,21 +125,35 @@ func BOSHDeployAction(ui UI, cpiType, directorIP string, dryRun bool) error {
 	// Print success message with instructions
 	ui.PrintLinef("\n✓ BOSH director '%s' deployed successfully!", deploymentName)
 	ui.PrintLinef("\nThe warden cloud-config has been applied to the director.")
+
+	// Register the director in the BOSH CLI config, so it can be targeted by alias
+	wardenConfig, err := getWardenDirectorConfigFromConfigServer(deploymentName, config.DirectorIP, logger)
+	if err != nil {
+		ui.PrintLinef("Warning: failed to register BOSH CLI alias: %v", err)
+	} else {
+		registerBOSHAlias(ui, logger, wardenConfig, deploymentName)
+		wardenConfig.Cleanup()
+	}
+
 	ui.PrintLinef("\nTo target this director:")
-	ui.PrintLinef("  bosh alias-env bosh-%s -e %s --ca-cert <(bosh int <(credhub get -n /instant-bosh/%s/director_ssl -k ca) --path /ca)", config.CPI, config.DirectorIP, deploymentName)
-	ui.PrintLinef("  export BOSH_CLIENT=admin")
-	ui.PrintLinef("  export BOSH_CLIENT_SECRET=$(credhub get -n /instant-bosh/%s/admin_password -q)", deploymentName)
-	ui.PrintLinef("  bosh -e bosh-%s env", config.CPI)
+	ui.PrintLinef("  bosh -e %s env", deploymentName)
+	ui.PrintLinef("Variables set by print-env take precedence over the alias, unset them first:")
+	ui.PrintLinef("  unset BOSH_ENVIRONMENT BOSH_CLIENT BOSH_CLIENT_SECRET BOSH_CA_CERT")
+	ui.PrintLinef("Or set the environment with:")
+	ui.PrintLinef("  eval \"$(ibosh bosh print-env --cpi %s)\"", config.CPI)
 	ui.PrintLinef("\nTo upload a dev release:")
-	ui.PrintLinef("  bosh -e bosh-%s upload-release /path/to/dev-release.tgz", config.CPI)
+	ui.PrintLinef("  bosh -e %s upload-release /path/to/dev-release.tgz", deploymentName)
 	ui.PrintLinef("\nTo update the director with changes:")
 	ui.PrintLinef("  ibosh bosh deploy --cpi %s", config.CPI)
 
 	return nil
 }
 
-// BOSHDeleteAction deletes a BOSH director deployment
-func BOSHDeleteAction(ui UI, cpiType string, force bool) error {
+// BOSHDeleteAction deletes a BOSH director deployment.
+// With force, the confirmation is skipped and errors deleting its VMs are ignored.
+func BOSHDeleteAction(ui UI, cpiType string, force, jsonOutput bool) error {
+	ctx := context.Background()
+
 	if cpiType == "" {
 		cpiType = "warden"
 	}
@@ -144,20 +166,26 @@ func BOSHDeleteAction(ui UI, cpiType string, force bool) error {
 	deploymentName := fmt.Sprintf("bosh-%s", cpiType)
 
 	ui.PrintLinef("Deleting BOSH director deployment '%s'", deploymentName)
+	if !force {
+		if err := ui.AskForConfirmation(); err != nil {
+			return err
+		}
+	}
 
-	// Build bosh delete-deployment command
-	args := []string{"-d", deploymentName, "delete-deployment"}
-	if force {
-		args = append(args, "--force")
+	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create CPI client: %w", err)
 	}
+	defer cpiCleanup()
 
-	cmd := exec.Command("bosh", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	directorClient, directorCleanup, err := createTaskDirectorClient(ctx, cpiInstance, newTaskReporter(ui, jsonOutput))
+	if err != nil {
+		return fmt.Errorf("failed to create director client: %w", err)
+	}
+	defer directorCleanup()
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to delete deployment: %w", err)
+	if err := deleteDeployment(directorClient, deploymentName, force); err != nil {
+		return err
 	}
 
 	ui.PrintLinef("\n✓ BOSH director '%s' deleted successfully", deploymentName)
@@ -166,7 +194,7 @@ func BOSHDeleteAction(ui UI, cpiType string, force bool) error {
 }
 
 // BOSHPrintEnvAction prints environment variables for targeting a deployed BOSH director
-func BOSHPrintEnvAction(ui UI, cpiType string) error {
+func BOSHPrintEnvAction(ui UI, cpiType string, format envformat.Format) error {
 	if cpiType == "" {
 		cpiType = "warden"
 	}
@@ -177,9 +205,14 @@ func BOSHPrintEnvAction(ui UI, cpiType string) error {
 	deploymentName := fmt.Sprintf("bosh-%s", cpiType)
 
 	// Get director IP from existing deployment
-	directorIP, err := getExistingBOSHDirectorIP(deploymentName)
+	directorClient, cleanup, err := createNamedDirectorClient(context.Background(), InstantBOSHDirector)
+	if err != nil {
+		return err
+	}
+	directorIP, err := deployedDirectorIP(directorClient, deploymentName)
+	cleanup()
 	if err != nil {
-		return fmt.Errorf("failed to get director IP: %w\nIs the BOSH director deployed? Run 'ibosh bosh deploy' first.", err)
+		return fmt.Errorf("failed to get director IP: %w", err)
 	}
 
 	// Get credentials from config-server
@@ -226,26 +259,45 @@ func BOSHPrintEnvAction(ui UI, cpiType string) error {
 		return fmt.Errorf("jumpbox_ssh.private_key is not a string")
 	}
 
-	// Write jumpbox key to a stable path (not a temp file that gets cleaned up)
+	// Write jumpbox key to a stable path (not a temp file that gets cleaned up).
+	// For direnv the key and CA certificate are kept in the state dir of the deployment.
 	keyPath := filepath.Join(os.TempDir(), fmt.Sprintf("ibosh-%s-jumpbox-key", deploymentName))
+	var stateDir string
+	if format == envformat.Direnv {
+		if stateDir, err = state.Dir(deploymentName); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(stateDir, 0700); err != nil {
+			return fmt.Errorf("creating state directory: %w", err)
+		}
+		keyPath = filepath.Join(stateDir, "jumpbox.key")
+	}
 	if err := os.WriteFile(keyPath, []byte(privateKey), 0600); err != nil {
 		return fmt.Errorf("writing jumpbox key: %w", err)
 	}
 
 	allProxy := fmt.Sprintf("ssh+socks5://jumpbox@%s:22?private-key=%s", directorIP, keyPath)
 
-	// Print as shell exports
-	fmt.Printf("export BOSH_ENVIRONMENT=%s\n", fmt.Sprintf("https://%s:25555", directorIP))
-	fmt.Printf("export BOSH_CLIENT=%s\n", "admin")
-	fmt.Printf("export BOSH_CLIENT_SECRET=%s\n", password)
-	fmt.Printf("export BOSH_CA_CERT='%s'\n", caCert)
-	fmt.Printf("export BOSH_ALL_PROXY=%s\n", allProxy)
+	vars := []envformat.Var{
+		{Name: "BOSH_ENVIRONMENT", Value: fmt.Sprintf("https://%s:25555", directorIP)},
+		{Name: "BOSH_CLIENT", Value: "admin"},
+		{Name: "BOSH_CLIENT_SECRET", Value: password},
+		{Name: "BOSH_CA_CERT", Value: caCert, File: "director-ca.pem"},
+		{Name: "BOSH_ALL_PROXY", Value: allProxy},
+	}
+	if stateDir != "" {
+		if vars, err = envformat.WriteFiles(stateDir, vars); err != nil {
+			return err
+		}
+	}
 
-	return nil
+	return printEnvVars(ui, format, vars)
 }
 
-// ResolveBOSHConfig resolves and validates the BOSH deployment configuration
-func ResolveBOSHConfig(ui UI, cpiType, directorIP string) (*BOSHDeployConfig, error) {
+// ResolveBOSHConfig resolves and validates the BOSH deployment configuration. Without
+// directorIP it uses the IP of the director deployed on directorClient, or auto-selects one
+// with ipSelector, which is reserved for the deploy of the director with reserve.
+func ResolveBOSHConfig(ui UI, directorClient boshdir.Director, ipSelector *IPSelector, cpiType, directorIP string, reserve bool) (*BOSHDeployConfig, error) {
 	// Set default CPI if not specified
 	if cpiType == "" {
 		cpiType = "warden"
@@ -264,17 +316,23 @@ func ResolveBOSHConfig(ui UI, cpiType, directorIP string) (*BOSHDeployConfig, er
 	} else {
 		// Try to get existing director IP from deployment
 		deploymentName := fmt.Sprintf("bosh-%s", cpiType)
-		existingIP, err := getExistingBOSHDirectorIP(deploymentName)
-		if err == nil && existingIP != "" {
-			resolvedIP = existingIP
+		deployment, err := findExistingDeployment(directorClient, deploymentName)
+		if err != nil {
+			return nil, err
+		}
+		if deployment != nil {
+			resolvedIP, err = deployedDirectorIP(directorClient, deploymentName)
+			if err != nil {
+				return nil, err
+			}
 			ui.PrintLinef("Using existing director IP from deployment: %s", resolvedIP)
 		} else {
 			// Auto-select from cloud-config (network 10.244.0.0/24 for warden)
-			ipSelector := NewIPSelector(ui)
-			resolvedIP, err = ipSelector.SelectAvailableIP("default")
+			ips, err := ipSelector.SelectAvailableIPs(context.Background(), "default", []string{deploymentName}, reserve)
 			if err != nil {
 				return nil, fmt.Errorf("failed to select director IP: %w", err)
 			}
+			resolvedIP = ips[0]
 			ui.PrintLinef("Auto-selected director IP: %s", resolvedIP)
 		}
 	}
@@ -353,78 +411,38 @@ func PrepareBOSHManifestFiles(config *BOSHDeployConfig) (*BOSHManifestFiles, err
 	return result, nil
 }
 
-// interpolateBOSHManifest interpolates the manifest with variables using bosh interpolate
+// interpolateBOSHManifest interpolates the manifest with the deployment name and variables
 func interpolateBOSHManifest(manifestFiles *BOSHManifestFiles, config *BOSHDeployConfig) ([]byte, error) {
 	deploymentName := fmt.Sprintf("bosh-%s", config.CPI)
-
-	// Create a temporary ops file to set the deployment name
-	nameOpsFile := filepath.Join(manifestFiles.TempDir, "set-deployment-name.yml")
-	nameOpsContent := fmt.Sprintf(`- type: replace
-  path: /name
-  value: %s
-`, deploymentName)
-	if err := os.WriteFile(nameOpsFile, []byte(nameOpsContent), 0644); err != nil {
-		return nil, fmt.Errorf("writing deployment name ops file: %w", err)
-	}
-
-	// Build bosh interpolate command
-	args := []string{"interpolate", manifestFiles.BaseManifest}
-
-	// Add deployment name ops file first
-	args = append(args, "-o", nameOpsFile)
-
-	// Add other ops files
-	for _, opsFile := range manifestFiles.OpsFiles {
-		args = append(args, "-o", opsFile)
-	}
-
-	// Add variables
-	args = append(args,
-		"-v", fmt.Sprintf("internal_ip=%s", config.DirectorIP),
-		"-v", "internal_cidr=10.244.0.0/24",
-		"-v", "internal_gw=10.244.0.1",
-		"-v", "garden_host=127.0.0.1", // Always localhost for warden
-		"-v", fmt.Sprintf("director_name=%s", deploymentName),
-	)
-
-	cmd := exec.Command("bosh", args...)
-	output, err := cmd.CombinedOutput()
+	namePath := "/name"
+	var nameValue interface{} = deploymentName
+
+	output, err := interpolate.File(manifestFiles.BaseManifest, interpolate.Options{
+		OpsFiles: manifestFiles.OpsFiles,
+		// Set the deployment name
+		Ops: []patch.OpDefinition{{Type: "replace", Path: &namePath, Value: &nameValue}},
+		Vars: []string{
+			fmt.Sprintf("internal_ip=%s", config.DirectorIP),
+			"internal_cidr=10.244.0.0/24",
+			"internal_gw=10.244.0.1",
+			"garden_host=127.0.0.1", // Always localhost for warden
+			fmt.Sprintf("director_name=%s", deploymentName),
+		},
+	})
 	if err != nil {
-		return nil, fmt.Errorf("interpolating manifest: %w\nOutput: %s", err, string(output))
+		return nil, fmt.Errorf("interpolating manifest: %w", err)
 	}
 
 	return output, nil
 }
 
-// deployBOSHDirector deploys the BOSH director using bosh deploy
-func deployBOSHDirector(ui UI, deploymentName string, manifest []byte, config *BOSHDeployConfig) error {
-	// Write manifest to temp file
-	tempManifest := filepath.Join(os.TempDir(), fmt.Sprintf("bosh-%s-manifest.yml", config.CPI))
-	if err := os.WriteFile(tempManifest, manifest, 0644); err != nil {
-		return fmt.Errorf("writing manifest file: %w", err)
-	}
-	defer os.Remove(tempManifest)
-
-	// Build bosh deploy command
+// deployBOSHDirector deploys the BOSH director through the director API
+func deployBOSHDirector(ui UI, directorClient boshdir.Director, deploymentName string, manifest []byte) error {
 	// The BOSH director will automatically use config-server for variable interpolation
-	args := []string{
-		"-n",
-		"-d", deploymentName,
-		"deploy", tempManifest,
-	}
-
-	ui.PrintLinef("\nRunning: bosh %s", strings.Join(args, " "))
+	ui.PrintLinef("\nDeploying '%s'...", deploymentName)
+	ui.PrintLinef("")
 
-	cmd := exec.Command("bosh", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("bosh deploy failed: %w", err)
-	}
-
-	return nil
+	return deployManifest(directorClient, deploymentName, manifest)
 }
 
 // getWardenDirectorConfigFromConfigServer retrieves director configuration from config-server
@@ -544,67 +562,3 @@ func applyWardenCloudConfigToDeployedDirector(ui UI, config *BOSHDeployConfig, l
 
 	return nil
 }
-
-// getExistingBOSHDirectorIP returns the director IP from an existing BOSH deployment, if any
-func getExistingBOSHDirectorIP(deploymentName string) (string, error) {
-	// Try to get from the BOSH deployment's director instance
-	// Clear BOSH_ALL_PROXY since this command targets the instant-bosh director directly,
-	// not through a SOCKS proxy (which may be set from a previous 'bosh print-env' eval)
-	cmd := exec.Command("bosh", "-n", "-d", deploymentName, "instances", "--json")
-	cmd.Env = filterEnv(os.Environ(), "BOSH_ALL_PROXY")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// bosh CLI outputs errors as JSON to stdout when --json is used
-		var errResult struct {
-			Lines []string `json:"Lines"`
-		}
-		if jsonErr := json.Unmarshal(output, &errResult); jsonErr == nil && len(errResult.Lines) > 0 {
-			return "", fmt.Errorf("failed to get BOSH instances: %s", strings.Join(errResult.Lines, "; "))
-		}
-		return "", fmt.Errorf("failed to get BOSH instances: %w\n%s", err, string(output))
-	}
-
-	var result struct {
-		Tables []struct {
-			Rows []struct {
-				Instance string `json:"instance"`
-				IPs      string `json:"ips"`
-			} `json:"Rows"`
-		} `json:"Tables"`
-	}
-	if err := json.Unmarshal(output, &result); err != nil {
-		return "", err
-	}
-
-	// Find bosh instance IP
-	for _, table := range result.Tables {
-		for _, row := range table.Rows {
-			if strings.HasPrefix(row.Instance, "bosh/") {
-				ips := strings.Split(row.IPs, "\n")
-				if len(ips) > 0 && ips[0] != "" {
-					return strings.TrimSpace(ips[0]), nil
-				}
-			}
-		}
-	}
-
-	return "", fmt.Errorf("no bosh instance found in deployment")
-}
-
-// filterEnv returns a copy of env with the specified keys removed
-func filterEnv(env []string, keys ...string) []string {
-	filtered := make([]string, 0, len(env))
-	for _, e := range env {
-		exclude := false
-		for _, key := range keys {
-			if strings.HasPrefix(e, key+"=") {
-				exclude = true
-				break
-			}
-		}
-		if !exclude {
-			filtered = append(filtered, e)
-		}
-	}
-	return filtered
-}
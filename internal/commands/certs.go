@@ -0,0 +1,223 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshtbl "github.com/cloudfoundry/bosh-cli/v7/ui/table"
+	"github.com/rkoster/instant-bosh/internal/certs"
+	"github.com/rkoster/instant-bosh/internal/configserver"
+	"github.com/rkoster/instant-bosh/internal/director"
+)
+
+// DefaultCertWarnDays is the default number of days before expiry certs warns about.
+const DefaultCertWarnDays = 30
+
+// CertsAction lists the certificates of the director vars store and of config-server with
+// their subject, SANs, issuer, CA chain and days until expiry, and warns about
+// certificates expiring within warnDays.
+func CertsAction(ui UI, warnDays int) error {
+	ctx := context.Background()
+
+	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cpiCleanup()
+
+	varsStore, err := director.ReadVarsStore(ctx, &cpiContainerWrapper{cpi: cpiInstance}, cpiInstance.GetContainerName())
+	if err != nil {
+		return err
+	}
+	inventory, parseErrs := certs.FromValues(certs.SourceDirector, varsStore)
+	for _, err := range parseErrs {
+		ui.ErrorLinef("Warning: skipping %v", err)
+	}
+
+	directorClient, directorCleanup, err := createDirectorClient(ctx, cpiInstance)
+	if err != nil {
+		return err
+	}
+	defer directorCleanup()
+
+	deploymentCerts, credErrs, err := configServerCertificates(directorClient)
+	if err != nil {
+		ui.ErrorLinef("Warning: skipping deployment certificates: %v", err)
+	}
+	for _, err := range credErrs {
+		ui.ErrorLinef("Warning: skipping %v", err)
+	}
+	inventory = append(inventory, deploymentCerts...)
+	certs.Sort(inventory)
+
+	now := time.Now()
+	table := boshtbl.Table{
+		Header: []boshtbl.Header{
+			boshtbl.NewHeader("Name"),
+			boshtbl.NewHeader("Source"),
+			boshtbl.NewHeader("Subject"),
+			boshtbl.NewHeader("SANs"),
+			boshtbl.NewHeader("Issuer"),
+			boshtbl.NewHeader("CA Chain"),
+			boshtbl.NewHeader("Expires"),
+			boshtbl.NewHeader("Days Left"),
+		},
+	}
+	for _, cert := range inventory {
+		table.Rows = append(table.Rows, []boshtbl.Value{
+			boshtbl.NewValueString(cert.Name),
+			boshtbl.NewValueString(cert.Source),
+			boshtbl.NewValueString(cert.Subject),
+			boshtbl.NewValueStrings(cert.SANs),
+			boshtbl.NewValueString(cert.Issuer),
+			boshtbl.NewValueStrings(cert.Chain),
+			boshtbl.NewValueString(cert.NotAfter.Format("2006-01-02")),
+			boshtbl.NewValueInt(cert.DaysLeft(now)),
+		})
+	}
+	ui.PrintTable(table)
+
+	for _, cert := range certs.Expiring(inventory, warnDays, now) {
+		if days := cert.DaysLeft(now); days < 0 {
+			ui.ErrorLinef("Warning: %s (%s) expired %d days ago", cert.Name, cert.Source, -days)
+		} else {
+			ui.ErrorLinef("Warning: %s (%s) expires in %d days", cert.Name, cert.Source, days)
+		}
+	}
+
+	return nil
+}
+
+// configServerCertificates returns the certificates in config-server used by deployments and configs.
+// Certificates that can't be read or parsed are skipped, their errors are returned separately.
+func configServerCertificates(directorClient configserver.VariableDirector) ([]certs.Certificate, []error, error) {
+	client, err := configserver.NewClientFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	client.SetDirector(directorClient)
+
+	creds, err := client.Find("")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		result []certs.Certificate
+		errs   []error
+	)
+	for _, cred := range creds {
+		if cred.Type != "certificate" {
+			continue
+		}
+		stored, err := client.Get(cred.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("getting certificate %s: %w", cred.Name, err))
+			continue
+		}
+		cert, ok, err := certs.Parse(cred.Name, certs.SourceConfigServer, stored.Value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			result = append(result, cert)
+		}
+	}
+	return result, errs, nil
+}
+
+// CertsRotateAction regenerates a certificate in config-server and redeploys the
+// deployments using it. The certificate is deleted and generated again by the director
+// from the options in the deployment manifest.
+func CertsRotateAction(ui UI, name string, force bool) error {
+	if !strings.HasPrefix(name, "/") {
+		return fmt.Errorf("only certificates in config-server (names starting with /) can be rotated; "+
+			"the director certificates (%s) are created with the director, recreate it to rotate them", name)
+	}
+
+	client, err := configserver.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cpiCleanup()
+
+	directorClient, directorCleanup, err := createTaskDirectorClient(ctx, cpiInstance, NewTaskReporter(ui))
+	if err != nil {
+		return err
+	}
+	defer directorCleanup()
+
+	stored, err := client.Get(name)
+	if err != nil {
+		return err
+	}
+	cert, ok, err := certs.Parse(name, certs.SourceConfigServer, stored.Value)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s is not a certificate", name)
+	}
+
+	deployments, err := certs.AffectedDeployments(directorClient, name)
+	if err != nil {
+		return err
+	}
+	if len(deployments) == 0 {
+		return fmt.Errorf("%s is not used by any deployment, so it would not be generated again; use 'ibosh creds generate' instead", name)
+	}
+
+	ui.PrintLinef("Rotating %s (%s, expires %s)", name, cert.Subject, cert.NotAfter.Format("2006-01-02"))
+	ui.PrintLinef("The certificate will be deleted and regenerated by redeploying:")
+	for _, deployment := range deployments {
+		ui.PrintLinef("  %s", deployment.Name())
+	}
+	if cert.IsCA {
+		ui.PrintLinef("")
+		ui.PrintLinef("%s is a CA: certificates signed by it keep the old CA until they are rotated as well.", name)
+	}
+	ui.PrintLinef("")
+
+	if !force {
+		if err := ui.AskForConfirmation(); err != nil {
+			ui.PrintLinef("Rotate operation cancelled")
+			return nil
+		}
+	}
+
+	if err := client.Delete(name); err != nil && !errors.Is(err, configserver.ErrCredentialNotFound) {
+		return fmt.Errorf("deleting %s: %w", name, err)
+	}
+
+	for _, deployment := range deployments {
+		if err := redeploy(ui, directorClient, deployment); err != nil {
+			return err
+		}
+	}
+
+	ui.PrintLinef("Rotated %s", name)
+	return nil
+}
+
+// redeploy deploys the current manifest of a deployment again through directorClient,
+// e.g. to generate deleted credentials
+func redeploy(ui UI, directorClient boshdir.Director, deployment boshdir.Deployment) error {
+	manifest, err := deployment.Manifest()
+	if err != nil {
+		return fmt.Errorf("getting manifest of deployment %s: %w", deployment.Name(), err)
+	}
+
+	ui.PrintLinef("Redeploying %s...", deployment.Name())
+	return deployManifest(directorClient, deployment.Name(), []byte(manifest))
+}
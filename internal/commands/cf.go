@@ -1,12 +1,12 @@
 package commands
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
 
 	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
@@ -16,6 +16,7 @@ import (
 	"github.com/rkoster/instant-bosh/internal/director"
 	"github.com/rkoster/instant-bosh/internal/docker"
 	"github.com/rkoster/instant-bosh/internal/incus"
+	"github.com/rkoster/instant-bosh/internal/interpolate"
 	"github.com/rkoster/instant-bosh/internal/manifests"
 	"github.com/rkoster/instant-bosh/internal/manifests/consolidate"
 	"github.com/rkoster/instant-bosh/internal/uploadedrelease"
@@ -28,7 +29,7 @@ func createCPIAndDirectorClient(ctx context.Context) (cpi.CPI, func(), error) {
 	// Create a logger for the clients
 	logger := boshlog.NewLogger(boshlog.LevelError)
 
-	// Detect CPI type from bosh env
+	// Detect CPI type from the director API or the backend running instant-bosh
 	cpiType, err := cpi.DetectCPIType(ctx)
 	if err != nil {
 		return nil, nil, fmt.Errorf("detecting CPI type: %w", err)
@@ -64,9 +65,26 @@ func createCPIAndDirectorClient(ctx context.Context) (cpi.CPI, func(), error) {
 
 // createDirectorClient creates a BOSH director client from the CPI instance
 func createDirectorClient(ctx context.Context, cpiInstance cpi.CPI) (boshdir.Director, func(), error) {
-	logger := boshlog.NewLogger(boshlog.LevelError)
+	config, err := getDirectorConfig(ctx, cpiInstance)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cleanup := func() {
+		config.Cleanup()
+	}
+
+	directorClient, err := newDirectorFromConfig(config)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
 
-	// Get the director config from the container
+	return directorClient, cleanup, nil
+}
+
+// getDirectorConfig gets the director config from the local state or the container
+func getDirectorConfig(ctx context.Context, cpiInstance cpi.CPI) (*director.Config, error) {
 	containerName := cpiInstance.GetContainerName()
 
 	// Create a wrapper that implements container.Client for GetDirectorConfig
@@ -75,21 +93,21 @@ func createDirectorClient(ctx context.Context, cpiInstance cpi.CPI) (boshdir.Dir
 	configProvider := &director.DefaultConfigProvider{}
 	config, err := configProvider.GetDirectorConfig(ctx, wrapper, containerName)
 	if err != nil {
-		return nil, nil, fmt.Errorf("getting director config: %w", err)
+		return nil, fmt.Errorf("getting director config: %w", err)
 	}
+	return config, nil
+}
 
-	cleanup := func() {
-		config.Cleanup()
-	}
+// newDirectorFromConfig creates a BOSH director client from a director config
+func newDirectorFromConfig(config *director.Config) (boshdir.Director, error) {
+	logger := boshlog.NewLogger(boshlog.LevelError)
 
 	directorFactory := &director.DefaultDirectorFactory{}
 	directorClient, err := directorFactory.NewDirector(config, logger)
 	if err != nil {
-		cleanup()
-		return nil, nil, fmt.Errorf("creating director client: %w", err)
+		return nil, fmt.Errorf("creating director client: %w", err)
 	}
-
-	return directorClient, cleanup, nil
+	return directorClient, nil
 }
 
 // cpiContainerWrapper wraps a CPI to implement container.Client interface
@@ -105,6 +123,10 @@ func (w *cpiContainerWrapper) GetHostAddress() string {
 	return w.cpi.GetHostAddress()
 }
 
+func (w *cpiContainerWrapper) EnvironmentName() string {
+	return w.cpi.EnvironmentName()
+}
+
 func (w *cpiContainerWrapper) HasDirectNetworkAccess() bool {
 	return w.cpi.HasDirectNetworkAccess()
 }
@@ -115,23 +137,39 @@ func (w *cpiContainerWrapper) Close() error {
 
 // CFDeployOptions contains options for CF deployment
 type CFDeployOptions struct {
-	RouterIP           string // Optional: specify router IP, otherwise auto-select
-	SystemDomain       string // Optional: specify system domain, otherwise derive from router IP
-	DryRun             bool   // If true, show what would be deployed without deploying
-	SkipStemcellUpload bool   // If true, skip auto-uploading required stemcells
-	DeleteCreds        bool   // If true, delete all deployment credentials before deploying (forces regeneration)
+	RouterIP           string   // Optional: specify router IP, otherwise auto-select
+	SystemDomain       string   // Optional: specify system domain, otherwise derive from router IP
+	DryRun             bool     // If true, show what would be deployed without deploying
+	SkipStemcellUpload bool     // If true, skip auto-uploading required stemcells
+	DeleteCreds        bool     // If true, delete all deployment credentials before deploying (forces regeneration)
+	JSON               bool     // If true, write task events as JSON lines to stdout
+	Profile            string   // Optional: consolidation profile (tiny, default, ha-like or stock)
+	Mapping            string   // Optional: path of a consolidation mapping file merged into the profile
+	OpsFiles           []string // Optional: extra ops files applied after the built-in ones
 }
 
 // CFManifestOptions contains options for CF manifest generation
 type CFManifestOptions struct {
-	RouterIP     string // Optional: specify router IP
-	SystemDomain string // Optional: specify system domain
+	RouterIP     string   // Optional: specify router IP
+	SystemDomain string   // Optional: specify system domain
+	Profile      string   // Optional: consolidation profile (tiny, default, ha-like or stock)
+	Mapping      string   // Optional: path of a consolidation mapping file merged into the profile
+	OpsFiles     []string // Optional: extra ops files applied after the built-in ones
+}
+
+// CFConfigOptions contains options for resolving the CF configuration
+type CFConfigOptions struct {
+	RouterIP     string // Optional: specify router IP, otherwise use the deployed or an auto-selected one
+	SystemDomain string // Optional: specify system domain, otherwise derive from router IP
+	Routers      int    // Number of routers, the routers after the first get static IPs as well
+	Reserve      bool   // If true, auto-selected IPs are reserved for the deploy of CF
 }
 
 // CFManifestConfig contains resolved configuration for CF manifest generation
 type CFManifestConfig struct {
-	RouterIP     string
-	SystemDomain string
+	RouterIP       string
+	SystemDomain   string
+	ExtraRouterIPs []string // Static IPs of the routers after the first
 }
 
 // CFManifestFiles contains paths to prepared CF manifest files
@@ -148,38 +186,68 @@ func (f *CFManifestFiles) Cleanup() {
 	}
 }
 
-// ResolveCFConfig determines the router IP and system domain for CF deployment.
-// If routerIP is empty, it tries to get from existing deployment or auto-selects from cloud-config.
-// If systemDomain is empty, it derives from routerIP as <routerIP>.sslip.io.
+// ResolveCFConfig determines the router IPs and system domain for CF deployment.
+// If opts.RouterIP is empty, it uses the router IP of the CF deployment of directorClient, or
+// auto-selects one with ipSelector if CF is not deployed. Routers after the first keep their
+// deployed IPs as well, missing ones are auto-selected together, so they all differ.
+// If opts.SystemDomain is empty, it derives from the router IP as <routerIP>.sslip.io.
 // The ui parameter is used to print informational messages (to stderr via ErrorLinef).
-func ResolveCFConfig(ui UI, routerIP, systemDomain string) (*CFManifestConfig, error) {
-	resolvedIP := routerIP
+func ResolveCFConfig(ui UI, directorClient boshdir.Director, ipSelector *IPSelector, opts CFConfigOptions) (*CFManifestConfig, error) {
+	resolvedIP := opts.RouterIP
+
+	// Get the router IPs of a running CF deployment
+	var existingIPs []string
+	if directorClient != nil && (resolvedIP == "" || opts.Routers > 1) {
+		var err error
+		existingIPs, err = getExistingRouterIPs(directorClient)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if resolvedIP == "" && len(existingIPs) > 0 {
+		resolvedIP = existingIPs[0]
+		if ui != nil {
+			ui.ErrorLinef("Using existing router IP from CF deployment: %s", resolvedIP)
+		}
+	}
+	var extraIPs []string
+	for _, ip := range existingIPs {
+		if ip != resolvedIP && len(extraIPs) < opts.Routers-1 {
+			extraIPs = append(extraIPs, ip)
+		}
+	}
+
+	// Select the missing router IPs in one go, so they differ even when they aren't reserved
+	var owners []string
 	if resolvedIP == "" {
-		// First, try to get the existing router IP from a running CF deployment
-		existingIP, err := getExistingRouterIP()
-		if err == nil && existingIP != "" {
-			resolvedIP = existingIP
-			if ui != nil {
-				ui.ErrorLinef("Using existing router IP from CF deployment: %s", resolvedIP)
-			}
-		} else {
-			// No existing deployment, select a new IP
-			ipSelector := NewIPSelector(ui)
-			resolvedIP, err = ipSelector.SelectAvailableIP("default")
-			if err != nil {
-				return nil, fmt.Errorf("failed to select router IP: %w", err)
-			}
+		owners = append(owners, cfRouterIPOwner(0))
+	}
+	for i := len(extraIPs); i < opts.Routers-1; i++ {
+		owners = append(owners, cfRouterIPOwner(i+1))
+	}
+	if len(owners) > 0 {
+		if ipSelector == nil {
+			return nil, fmt.Errorf("failed to select router IP: no BOSH director to select it from")
+		}
+		selected, err := ipSelector.SelectAvailableIPs(context.Background(), "default", owners, opts.Reserve, resolvedIP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to select router IP: %w", err)
+		}
+		if resolvedIP == "" {
+			resolvedIP, selected = selected[0], selected[1:]
 		}
+		extraIPs = append(extraIPs, selected...)
 	}
 
-	resolvedDomain := systemDomain
+	resolvedDomain := opts.SystemDomain
 	if resolvedDomain == "" {
 		resolvedDomain = fmt.Sprintf("%s.sslip.io", resolvedIP)
 	}
 
 	return &CFManifestConfig{
-		RouterIP:     resolvedIP,
-		SystemDomain: resolvedDomain,
+		RouterIP:       resolvedIP,
+		SystemDomain:   resolvedDomain,
+		ExtraRouterIPs: extraIPs,
 	}, nil
 }
 
@@ -265,12 +333,17 @@ func PrepareCFManifestFiles() (*CFManifestFiles, error) {
 // CFManifestAction outputs the interpolated and consolidated CF deployment manifest to stdout.
 // Variables remain as placeholders (e.g. ((cf_admin_password))) but system_domain
 // and router_static_ip are substituted with resolved values.
-// Instance groups are consolidated into the 5 target groups before output.
+// Instance groups are consolidated according to the profile before output.
 // If BOSH environment is configured, releases that are already uploaded to the
 // director will have their url and sha1 fields removed.
 func CFManifestAction(ui UI, opts CFManifestOptions) error {
 	ctx := context.Background()
 
+	profile, err := resolveCFProfile(opts.Profile, opts.Mapping)
+	if err != nil {
+		return err
+	}
+
 	// Check BOSH env only if router IP not specified (needed for auto-selection)
 	hasBOSHEnv := checkBOSHEnv() == nil
 	if opts.RouterIP == "" && !hasBOSHEnv {
@@ -279,8 +352,29 @@ func CFManifestAction(ui UI, opts CFManifestOptions) error {
 			"Or specify --router-ip explicitly")
 	}
 
-	// Resolve configuration (router IP + system domain)
-	config, err := ResolveCFConfig(ui, opts.RouterIP, opts.SystemDomain)
+	// The director is needed to auto-select the router IP; without --router-ip its errors are fatal
+	var (
+		directorClient boshdir.Director
+		ipSelector     *IPSelector
+	)
+	if hasBOSHEnv {
+		client, selector, cleanup, err := createDirectorAndIPSelector(ctx, ui)
+		if err != nil && opts.RouterIP == "" {
+			return err
+		}
+		if err == nil {
+			defer cleanup()
+			directorClient, ipSelector = client, selector
+		}
+	}
+
+	// Resolve configuration (router IPs + system domain)
+	// The manifest is deployed by the user, if at all, so selected IPs aren't reserved
+	config, err := ResolveCFConfig(ui, directorClient, ipSelector, CFConfigOptions{
+		RouterIP:     opts.RouterIP,
+		SystemDomain: opts.SystemDomain,
+		Routers:      profile.Instances(profile.Target("router")),
+	})
 	if err != nil {
 		return err
 	}
@@ -292,49 +386,22 @@ func CFManifestAction(ui UI, opts CFManifestOptions) error {
 	}
 	defer files.Cleanup()
 
-	// Build bosh interpolate command
-	args := []string{
-		"interpolate", files.ManifestPath,
-		"-v", fmt.Sprintf("system_domain=%s", config.SystemDomain),
-		"-v", fmt.Sprintf("router_static_ip=%s", config.RouterIP),
-	}
-	for _, opsPath := range files.OpsPaths {
-		args = append(args, "-o", opsPath)
-	}
-
-	cmd := exec.Command("bosh", args...)
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("bosh interpolate failed: %w", err)
+	interpolated, err := interpolateCFManifest(files, config, opts.OpsFiles)
+	if err != nil {
+		return err
 	}
 
-	// Consolidate instance groups into the 5 target groups
-	manifest, err := consolidate.ConsolidateInstanceGroups(stdout.Bytes())
+	manifest, err := consolidateCFManifest(interpolated, profile, config)
 	if err != nil {
-		return fmt.Errorf("failed to consolidate instance groups: %w", err)
+		return err
 	}
 
 	// If BOSH environment is configured, filter out already-uploaded releases
-	if hasBOSHEnv {
-		savedEnv := saveBOSHEnvVars()
-
-		cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
+	if directorClient != nil {
+		filtered, err := uploadedrelease.Filter(manifest, directorClient)
 		if err == nil {
-			directorClient, directorCleanup, err := createDirectorClient(ctx, cpiInstance)
-			if err == nil {
-				filtered, err := uploadedrelease.Filter(manifest, directorClient)
-				if err == nil {
-					manifest = filtered
-				}
-				directorCleanup()
-			}
-			cpiCleanup()
+			manifest = filtered
 		}
-
-		restoreBOSHEnvVars(savedEnv)
 	}
 
 	// Output the manifest to stdout
@@ -347,20 +414,56 @@ func CFManifestAction(ui UI, opts CFManifestOptions) error {
 func CFDeployAction(ui UI, opts CFDeployOptions) error {
 	ctx := context.Background()
 
-	// Check that BOSH env vars are set
-	if err := checkBOSHEnv(); err != nil {
+	profile, err := resolveCFProfile(opts.Profile, opts.Mapping)
+	if err != nil {
+		return err
+	}
+
+	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create CPI client: %w", err)
+	}
+	defer cpiCleanup()
+
+	directorClient, directorCleanup, err := createTaskDirectorClient(ctx, cpiInstance, newTaskReporter(ui, opts.JSON))
+	if err != nil {
+		return fmt.Errorf("failed to create director client: %w", err)
+	}
+	defer directorCleanup()
+
+	ipSelector, err := newIPSelector(ui, directorClient, cpiInstance)
+	if err != nil {
 		return err
 	}
 
-	// Use shared config resolution
-	config, err := ResolveCFConfig(ui, opts.RouterIP, opts.SystemDomain)
+	// Use shared config resolution, a dry run doesn't reserve the router IPs
+	routers := profile.Instances(profile.Target("router"))
+	config, err := ResolveCFConfig(ui, directorClient, ipSelector, CFConfigOptions{
+		RouterIP:     opts.RouterIP,
+		SystemDomain: opts.SystemDomain,
+		Routers:      routers,
+		Reserve:      !opts.DryRun,
+	})
 	if err != nil {
 		return err
 	}
 
+	// Release the reserved router IPs when CF isn't deployed, so other deploys can use them
+	deployed := false
+	defer func() {
+		if !deployed && !opts.DryRun {
+			var owners []string
+			for i := range routers {
+				owners = append(owners, cfRouterIPOwner(i))
+			}
+			releaseIPs(ui, ipSelector, owners...)
+		}
+	}()
+
 	ui.PrintLinef("Deploying CF with:")
 	ui.PrintLinef("  Router IP:     %s", config.RouterIP)
 	ui.PrintLinef("  System Domain: %s", config.SystemDomain)
+	ui.PrintLinef("  Profile:       %s", profile.Name())
 	ui.PrintLinef("")
 
 	// Use shared manifest preparation
@@ -387,30 +490,12 @@ func CFDeployAction(ui UI, opts CFDeployOptions) error {
 		return nil
 	}
 
-	// Save BOSH env vars before creating clients (createDirectorClient unsets them)
-	savedEnv := saveBOSHEnvVars()
-
-	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
-	if err != nil {
-		restoreBOSHEnvVars(savedEnv)
-		return fmt.Errorf("failed to create CPI client: %w", err)
-	}
-	defer cpiCleanup()
-
-	directorClient, directorCleanup, err := createDirectorClient(ctx, cpiInstance)
-	if err != nil {
-		restoreBOSHEnvVars(savedEnv)
-		return fmt.Errorf("failed to create director client: %w", err)
-	}
-	defer directorCleanup()
-
 	// Ensure required stemcells are uploaded before deploy
 	if !opts.SkipStemcellUpload {
 		ui.PrintLinef("Checking and uploading required stemcells...")
 
 		err = EnsureStemcellsForCF(ctx, ui, directorClient, cpiInstance, files.ManifestPath, files.OpsPaths, config.SystemDomain, config.RouterIP)
 		if err != nil {
-			restoreBOSHEnvVars(savedEnv)
 			return fmt.Errorf("failed to ensure stemcells: %w", err)
 		}
 		ui.PrintLinef("")
@@ -418,33 +503,17 @@ func CFDeployAction(ui UI, opts CFDeployOptions) error {
 
 	// Interpolate the manifest with all ops files to get the final manifest
 	ui.PrintLinef("Interpolating manifest...")
-	interpolateArgs := []string{
-		"interpolate", files.ManifestPath,
-		"-v", fmt.Sprintf("system_domain=%s", config.SystemDomain),
-		"-v", fmt.Sprintf("router_static_ip=%s", config.RouterIP),
-	}
-	for _, opsPath := range files.OpsPaths {
-		interpolateArgs = append(interpolateArgs, "-o", opsPath)
-	}
-
-	interpolateCmd := exec.Command("bosh", interpolateArgs...)
-	var interpolateOut bytes.Buffer
-	var interpolateErr bytes.Buffer
-	interpolateCmd.Stdout = &interpolateOut
-	interpolateCmd.Stderr = &interpolateErr
-
-	if err := interpolateCmd.Run(); err != nil {
-		restoreBOSHEnvVars(savedEnv)
-		return fmt.Errorf("bosh interpolate failed: %w\n%s", err, interpolateErr.String())
+	interpolated, err := interpolateCFManifest(files, config, opts.OpsFiles)
+	if err != nil {
+		return err
 	}
 
-	// Consolidate instance groups into the 5 target groups (before release filtering
-	// so the release filter sees the already-consolidated structure)
-	ui.PrintLinef("Consolidating instance groups...")
-	consolidatedManifest, err := consolidate.ConsolidateInstanceGroups(interpolateOut.Bytes())
+	// Consolidate instance groups into the groups of the profile (before release
+	// filtering so the release filter sees the already-consolidated structure)
+	ui.PrintLinef("Consolidating instance groups (%s profile)...", profile.Name())
+	consolidatedManifest, err := consolidateCFManifest(interpolated, profile, config)
 	if err != nil {
-		restoreBOSHEnvVars(savedEnv)
-		return fmt.Errorf("failed to consolidate instance groups: %w", err)
+		return err
 	}
 
 	// Filter the manifest to remove url/sha1 from already-uploaded releases
@@ -452,37 +521,17 @@ func CFDeployAction(ui UI, opts CFDeployOptions) error {
 
 	filteredManifest, err := uploadedrelease.Filter(consolidatedManifest, directorClient)
 	if err != nil {
-		restoreBOSHEnvVars(savedEnv)
 		return fmt.Errorf("failed to filter releases: %w", err)
 	}
 
-	// Restore env vars before running bosh deploy (it needs them)
-	restoreBOSHEnvVars(savedEnv)
-
-	// Write the filtered manifest to a file
-	filteredManifestPath := files.TmpDir + "/cf-deployment-filtered.yml"
-	if err := os.WriteFile(filteredManifestPath, filteredManifest, 0644); err != nil {
-		return fmt.Errorf("failed to write filtered manifest: %w", err)
-	}
-
-	// Build bosh deploy command with pre-interpolated manifest (no ops files needed)
-	args := []string{
-		"deploy", filteredManifestPath,
-		"-d", "cf",
-		"-n", // non-interactive
-	}
-
-	ui.PrintLinef("Running: bosh %s", strings.Join(args, " "))
+	// Deploy the pre-interpolated manifest (no ops files needed)
+	ui.PrintLinef("Deploying 'cf'...")
 	ui.PrintLinef("")
 
-	cmd := exec.Command("bosh", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("bosh deploy failed: %w", err)
+	if err := deployManifest(directorClient, "cf", filteredManifest); err != nil {
+		return err
 	}
+	deployed = true
 
 	ui.PrintLinef("")
 	ui.PrintLinef("CF deployment complete!")
@@ -497,26 +546,32 @@ func CFDeployAction(ui UI, opts CFDeployOptions) error {
 }
 
 // CFDeleteAction deletes the CF deployment
-func CFDeleteAction(ui UI, force bool) error {
-	// Check that BOSH env vars are set
-	if err := checkBOSHEnv(); err != nil {
-		return err
+func CFDeleteAction(ui UI, force, jsonOutput bool) error {
+	ctx := context.Background()
+
+	if !force {
+		ui.PrintLinef("Deployment 'cf' will be deleted")
+		if err := ui.AskForConfirmation(); err != nil {
+			return err
+		}
 	}
 
-	args := []string{"delete-deployment", "-d", "cf"}
-	if force {
-		args = append(args, "-n") // non-interactive
+	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create CPI client: %w", err)
 	}
+	defer cpiCleanup()
 
-	ui.PrintLinef("Deleting CF deployment...")
+	directorClient, directorCleanup, err := createTaskDirectorClient(ctx, cpiInstance, newTaskReporter(ui, jsonOutput))
+	if err != nil {
+		return fmt.Errorf("failed to create director client: %w", err)
+	}
+	defer directorCleanup()
 
-	cmd := exec.Command("bosh", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	ui.PrintLinef("Deleting CF deployment...")
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("bosh delete-deployment failed: %w", err)
+	if err := deleteDeployment(directorClient, "cf", false); err != nil {
+		return err
 	}
 
 	ui.PrintLinef("CF deployment deleted")
@@ -652,127 +707,117 @@ func checkBOSHEnv() error {
 	return nil
 }
 
-// boshEnvVars holds saved BOSH environment variables
-type boshEnvVars struct {
-	Environment  string
-	Client       string
-	ClientSecret string
-	CACert       string
-	AllProxy     string
-}
-
-// saveBOSHEnvVars saves current BOSH environment variables
-func saveBOSHEnvVars() boshEnvVars {
-	return boshEnvVars{
-		Environment:  os.Getenv("BOSH_ENVIRONMENT"),
-		Client:       os.Getenv("BOSH_CLIENT"),
-		ClientSecret: os.Getenv("BOSH_CLIENT_SECRET"),
-		CACert:       os.Getenv("BOSH_CA_CERT"),
-		AllProxy:     os.Getenv("BOSH_ALL_PROXY"),
-	}
-}
+// routerGroups are the instance groups holding gorouter in the consolidation profiles,
+// in lookup order: router, or compute in the tiny profile.
+var routerGroups = []string{"router", "compute"}
 
-// restoreBOSHEnvVars restores previously saved BOSH environment variables
-func restoreBOSHEnvVars(saved boshEnvVars) {
-	if saved.Environment != "" {
-		os.Setenv("BOSH_ENVIRONMENT", saved.Environment)
-	}
-	if saved.Client != "" {
-		os.Setenv("BOSH_CLIENT", saved.Client)
-	}
-	if saved.ClientSecret != "" {
-		os.Setenv("BOSH_CLIENT_SECRET", saved.ClientSecret)
+// getExistingRouterIPs returns the IPs of the router instances of the CF deployment of
+// directorClient, none if CF is not deployed
+func getExistingRouterIPs(directorClient boshdir.Director) ([]string, error) {
+	deployment, err := findExistingDeployment(directorClient, "cf")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CF deployment: %w", err)
 	}
-	if saved.CACert != "" {
-		os.Setenv("BOSH_CA_CERT", saved.CACert)
+	if deployment == nil {
+		return nil, nil
 	}
-	if saved.AllProxy != "" {
-		os.Setenv("BOSH_ALL_PROXY", saved.AllProxy)
+
+	for _, group := range routerGroups {
+		ips, err := instanceIPs(deployment, group)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get CF instances: %w", err)
+		}
+		if len(ips) > 0 {
+			return ips, nil
+		}
 	}
+
+	return nil, fmt.Errorf("router instance not found in CF deployment (specify --router-ip)")
 }
 
-// getExistingRouterIP returns the router IP from an existing CF deployment, if any
-func getExistingRouterIP() (string, error) {
-	// Try to get from the CF deployment's router instance
-	cmd := exec.Command("bosh", "-d", "cf", "instances", "--json")
-	output, err := cmd.Output()
+// getCFSystemDomain determines the CF system domain from the CF deployment of the instant-bosh director
+func getCFSystemDomain() (string, error) {
+	directorClient, cleanup, err := createNamedDirectorClient(context.Background(), InstantBOSHDirector)
 	if err != nil {
-		return "", fmt.Errorf("failed to get CF instances: %w", err)
+		return "", err
 	}
+	defer cleanup()
 
-	var result struct {
-		Tables []struct {
-			Rows []struct {
-				Instance string `json:"instance"`
-				IPs      string `json:"ips"`
-			} `json:"Rows"`
-		} `json:"Tables"`
-	}
-	if err := json.Unmarshal(output, &result); err != nil {
+	ips, err := getExistingRouterIPs(directorClient)
+	if err != nil {
 		return "", err
 	}
-
-	// Find router instance IP
-	for _, table := range result.Tables {
-		for _, row := range table.Rows {
-			if strings.HasPrefix(row.Instance, "router/") {
-				ip := strings.TrimSpace(strings.Split(row.IPs, "\n")[0])
-				if ip != "" {
-					return ip, nil
-				}
-			}
-		}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("CF deployment not found")
 	}
-
-	return "", fmt.Errorf("router instance not found in CF deployment")
+	return fmt.Sprintf("%s.sslip.io", ips[0]), nil
 }
 
-// getCFSystemDomain determines the CF system domain from the deployment
-func getCFSystemDomain() (string, error) {
-	// Try to get from the CF deployment's router instance
-	cmd := exec.Command("bosh", "-d", "cf", "instances", "--json")
-	output, err := cmd.Output()
+// resolveCFProfile returns the consolidation profile with name, with the mapping file at
+// mappingPath merged into it if set.
+func resolveCFProfile(name, mappingPath string) (*consolidate.Profile, error) {
+	profile, err := consolidate.LookupProfile(name)
 	if err != nil {
-		return "", fmt.Errorf("failed to get CF instances: %w", err)
+		return nil, err
+	}
+	if mappingPath == "" {
+		return profile, nil
 	}
 
-	var result struct {
-		Tables []struct {
-			Rows []struct {
-				Instance string `json:"instance"`
-				IPs      string `json:"ips"`
-			} `json:"Rows"`
-		} `json:"Tables"`
+	data, err := os.ReadFile(mappingPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping file: %w", err)
 	}
-	if err := json.Unmarshal(output, &result); err != nil {
-		return "", err
+	mapping, err := consolidate.ParseMapping(data)
+	if err != nil {
+		return nil, err
 	}
+	return profile.WithMapping(mapping)
+}
 
-	// Find router instance IP
-	for _, table := range result.Tables {
-		for _, row := range table.Rows {
-			if strings.HasPrefix(row.Instance, "router/") {
-				ip := strings.TrimSpace(strings.Split(row.IPs, "\n")[0])
-				if ip != "" {
-					return fmt.Sprintf("%s.sslip.io", ip), nil
-				}
-			}
-		}
+// cfRouterIPOwner returns the owner of the IP reserved for router i of CF
+func cfRouterIPOwner(i int) string {
+	if i == 0 {
+		return "cf"
 	}
+	return fmt.Sprintf("cf-router-%d", i)
+}
 
-	return "", fmt.Errorf("router instance not found in CF deployment")
+// consolidateCFManifest consolidates the instance groups of the interpolated CF manifest
+// according to profile. Profiles with several routers get the static IPs of config for the
+// routers after the first.
+func consolidateCFManifest(manifest []byte, profile *consolidate.Profile, config *CFManifestConfig) ([]byte, error) {
+	var opts consolidate.Options
+	if len(config.ExtraRouterIPs) > 0 {
+		opts.StaticIPs = map[string][]string{profile.Target("router"): config.ExtraRouterIPs}
+	}
+
+	consolidated, err := consolidate.ConsolidateWithProfile(manifest, profile, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consolidate instance groups: %w", err)
+	}
+	return consolidated, nil
 }
 
-// extractManifestVariables extracts variable names from a manifest using bosh interpolate
-func extractManifestVariables(manifestPath string, opsPaths []string) ([]string, error) {
-	// Build bosh interpolate command to extract variables section
-	args := []string{"interpolate", "--path", "/variables", manifestPath}
-	for _, opsPath := range opsPaths {
-		args = append(args, "-o", opsPath)
+// interpolateCFManifest applies the ops files, the extra ops files of the user, system domain
+// and router IP to the CF manifest
+func interpolateCFManifest(files *CFManifestFiles, config *CFManifestConfig, extraOpsFiles []string) ([]byte, error) {
+	manifest, err := interpolate.File(files.ManifestPath, interpolate.Options{
+		OpsFiles: append(slices.Clone(files.OpsPaths), extraOpsFiles...),
+		Vars: []string{
+			fmt.Sprintf("system_domain=%s", config.SystemDomain),
+			fmt.Sprintf("router_static_ip=%s", config.RouterIP),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to interpolate CF manifest: %w", err)
 	}
+	return manifest, nil
+}
 
-	cmd := exec.Command("bosh", args...)
-	output, err := cmd.Output()
+// extractManifestVariables extracts variable names from a manifest with its ops files applied
+func extractManifestVariables(manifestPath string, opsPaths []string) ([]string, error) {
+	output, err := interpolate.File(manifestPath, interpolate.Options{OpsFiles: opsPaths, Path: "/variables"})
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract variables from manifest: %w", err)
 	}
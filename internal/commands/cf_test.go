@@ -0,0 +1,108 @@
+package commands_test
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshdirfakes "github.com/cloudfoundry/bosh-cli/v7/director/directorfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/rkoster/instant-bosh/internal/commands"
+	"github.com/rkoster/instant-bosh/internal/commands/commandsfakes"
+	"github.com/rkoster/instant-bosh/internal/cpi/cpifakes"
+	"github.com/rkoster/instant-bosh/internal/ipam"
+)
+
+var _ = Describe("ResolveCFConfig", func() {
+	var (
+		fakeUI       *commandsfakes.FakeUI
+		fakeDirector *boshdirfakes.FakeDirector
+		cf           *boshdirfakes.FakeDeployment
+	)
+
+	BeforeEach(func() {
+		fakeUI = &commandsfakes.FakeUI{}
+		fakeDirector = &boshdirfakes.FakeDirector{}
+
+		cf = &boshdirfakes.FakeDeployment{}
+		cf.NameReturns("cf")
+		cf.InstancesReturns([]boshdir.Instance{
+			{Group: "control", IPs: []string{"10.245.0.20"}},
+			{Group: "router", IPs: []string{"10.245.0.34"}},
+		}, nil)
+		fakeDirector.DeploymentsReturns([]boshdir.Deployment{cf}, nil)
+	})
+
+	It("keeps the router IP of the deployed CF", func() {
+		config, err := commands.ResolveCFConfig(fakeUI, fakeDirector, nil, commands.CFConfigOptions{Reserve: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.RouterIP).To(Equal("10.245.0.34"))
+		Expect(config.SystemDomain).To(Equal("10.245.0.34.sslip.io"))
+	})
+
+	It("finds the router in the compute group of the tiny profile", func() {
+		cf.InstancesReturns([]boshdir.Instance{{Group: "compute", IPs: []string{"10.245.0.35"}}}, nil)
+
+		config, err := commands.ResolveCFConfig(fakeUI, fakeDirector, nil, commands.CFConfigOptions{Reserve: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.RouterIP).To(Equal("10.245.0.35"))
+	})
+
+	It("returns director errors instead of selecting a new router IP", func() {
+		fakeDirector.DeploymentsReturns(nil, errors.New("connection refused"))
+
+		_, err := commands.ResolveCFConfig(fakeUI, fakeDirector, nil, commands.CFConfigOptions{Reserve: true})
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+	})
+
+	It("does not ask the director when the router IP is given", func() {
+		config, err := commands.ResolveCFConfig(fakeUI, nil, nil, commands.CFConfigOptions{RouterIP: "10.245.0.40", SystemDomain: "cf.example.com"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.RouterIP).To(Equal("10.245.0.40"))
+		Expect(config.SystemDomain).To(Equal("cf.example.com"))
+	})
+
+	It("selects a different IP for every router without reserving them", func() {
+		fakeDirector.DeploymentsReturns(nil, nil)
+		fakeDirector.ListConfigsReturns([]boshdir.Config{{Name: "default", Type: "cloud", Content: `
+networks:
+- name: default
+  subnets:
+  - range: 10.245.0.0/16
+    static: [10.245.0.34 - 10.245.0.40]
+`}}, nil)
+		fakeCPI := &cpifakes.FakeCPI{}
+		reservationsPath := filepath.Join(GinkgoT().TempDir(), ipam.ReservationsFileName)
+		selector := commands.NewIPSelector(fakeUI, fakeDirector, fakeCPI, ipam.NewReservations(reservationsPath, time.Hour))
+
+		config, err := commands.ResolveCFConfig(fakeUI, fakeDirector, selector, commands.CFConfigOptions{Routers: 3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.RouterIP).To(Equal("10.245.0.34"))
+		Expect(config.ExtraRouterIPs).To(Equal([]string{"10.245.0.35", "10.245.0.36"}))
+		Expect(reservationsPath).NotTo(BeAnExistingFile())
+	})
+
+	It("keeps the deployed routers and selects IPs for the missing ones", func() {
+		cf.InstancesReturns([]boshdir.Instance{
+			{Group: "router", IPs: []string{"10.245.0.34"}},
+			{Group: "router", IPs: []string{"10.245.0.36"}},
+		}, nil)
+		fakeDirector.ListConfigsReturns([]boshdir.Config{{Name: "default", Type: "cloud", Content: `
+networks:
+- name: default
+  subnets:
+  - range: 10.245.0.0/16
+    static: [10.245.0.34 - 10.245.0.40]
+`}}, nil)
+		fakeCPI := &cpifakes.FakeCPI{}
+		selector := commands.NewIPSelector(fakeUI, fakeDirector, fakeCPI, ipam.NewReservations(filepath.Join(GinkgoT().TempDir(), ipam.ReservationsFileName), time.Hour))
+
+		config, err := commands.ResolveCFConfig(fakeUI, fakeDirector, selector, commands.CFConfigOptions{Routers: 3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.RouterIP).To(Equal("10.245.0.34"))
+		Expect(config.ExtraRouterIPs).To(Equal([]string{"10.245.0.36", "10.245.0.35"}))
+	})
+})
@@ -1,7 +1,16 @@
 package commands
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshtbl "github.com/cloudfoundry/bosh-cli/v7/ui/table"
 	"github.com/rkoster/instant-bosh/internal/configserver"
+	"gopkg.in/yaml.v3"
 )
 
 // CredsGetAction retrieves a credential by name from the config-server
@@ -41,24 +50,307 @@ func CredsDeleteAction(ui UI, name string) error {
 	return nil
 }
 
-// CredsFindAction lists credentials from the config-server
-// Note: config-server doesn't support listing, so we provide helpful guidance
+// CredsSetOptions contains options for setting a credential
+type CredsSetOptions struct {
+	Type  string // Credential type, see configserver.SetTypes
+	Value string // Value, or JSON/YAML object for structured types
+	File  string // File to read the value from instead of Value
+}
+
+// CredsSetAction stores a value for a credential in the config-server, e.g. to pre-seed
+// credentials before a deploy
+func CredsSetAction(ui UI, name string, opts CredsSetOptions) error {
+	content := opts.Value
+	switch {
+	case opts.File != "" && opts.Value != "":
+		return fmt.Errorf("only one of --value and --file may be given")
+	case opts.File != "":
+		data, err := os.ReadFile(opts.File)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", opts.File, err)
+		}
+		content = string(data)
+	case opts.Value == "":
+		return fmt.Errorf("a value is required, use --value or --file")
+	}
+
+	value, err := configserver.ParseValue(opts.Type, content)
+	if err != nil {
+		return err
+	}
+
+	client, err := configserver.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	cred, err := client.Set(name, value)
+	if err != nil {
+		return err
+	}
+
+	ui.PrintLinef("Set credential: %s", cred.Name)
+	return nil
+}
+
+// CredsGenerateOptions contains options for generating a credential
+type CredsGenerateOptions struct {
+	Type        string // Credential type, see configserver.GenerateTypes
+	Certificate configserver.CertificateParameters
+}
+
+// CredsGenerateAction lets the config-server generate a value for a credential
+func CredsGenerateAction(ui UI, name string, opts CredsGenerateOptions) error {
+	if !slices.Contains(configserver.GenerateTypes, opts.Type) {
+		return fmt.Errorf("unsupported credential type %q (supported: %s)", opts.Type, strings.Join(configserver.GenerateTypes, ", "))
+	}
+
+	var parameters interface{}
+	if opts.Type == "certificate" {
+		if opts.Certificate.CA == "" && !opts.Certificate.IsCA {
+			return fmt.Errorf("a certificate must be signed by a CA (--ca) or be a CA itself (--is-ca)")
+		}
+		parameters = opts.Certificate
+	}
+
+	client, err := configserver.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	cred, err := client.Generate(name, opts.Type, parameters)
+	if err != nil {
+		return err
+	}
+
+	ui.PrintLinef("Generated credential: %s", cred.Name)
+	return nil
+}
+
+// CredsFindAction lists the credentials whose name starts with pathPrefix. Config-server
+// can't list credentials, so the names are collected from the deployments and configs
+// of the director.
 func CredsFindAction(ui UI, pathPrefix string) error {
-	// Config-server doesn't support listing credentials like CredHub does.
-	// Provide helpful instructions for users.
-	ui.PrintLinef("Config-server does not support listing credentials.")
-	ui.PrintLinef("")
-	ui.PrintLinef("To see available credentials, use the BOSH CLI:")
-	ui.PrintLinef("  bosh variables -d <deployment>")
-	ui.PrintLinef("")
-	ui.PrintLinef("For example:")
-	ui.PrintLinef("  bosh variables -d cf")
-	ui.PrintLinef("")
-	ui.PrintLinef("Then retrieve a specific credential with:")
-	ui.PrintLinef("  ibosh creds get /instant-bosh/<deployment>/<variable-name>")
-	ui.PrintLinef("")
-	ui.PrintLinef("Example:")
-	ui.PrintLinef("  ibosh creds get /instant-bosh/cf/cf_admin_password")
+	client, err := configserver.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	_, cleanup, err := setConfigServerDirector(context.Background(), client, boshdir.NewNoopTaskReporter())
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	creds, err := client.Find(pathPrefix)
+	if err != nil {
+		return err
+	}
+
+	if len(creds) == 0 {
+		ui.PrintLinef("No credentials found")
+		return nil
+	}
+
+	table := boshtbl.Table{
+		Header: []boshtbl.Header{
+			boshtbl.NewHeader("ID"),
+			boshtbl.NewHeader("Name"),
+			boshtbl.NewHeader("Type"),
+		},
+		SortBy: []boshtbl.ColumnSort{{Column: 1, Asc: true}},
+	}
+	for _, cred := range creds {
+		table.Rows = append(table.Rows, []boshtbl.Value{
+			boshtbl.NewValueString(cred.ID),
+			boshtbl.NewValueString(cred.Name),
+			boshtbl.NewValueString(cred.Type),
+		})
+	}
+	ui.PrintTable(table)
+
+	return nil
+}
+
+// CredsExportAction prints the credentials under pathPrefix as a vars-store style YAML
+// file, e.g. to recreate a deployment with the same credentials after destroy
+func CredsExportAction(ui UI, pathPrefix string) error {
+	client, err := configserver.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	_, cleanup, err := setConfigServerDirector(context.Background(), client, boshdir.NewNoopTaskReporter())
+	if err != nil {
+		return err
+	}
+	defer cleanup()
 
+	vars, err := client.Export(pathPrefix)
+	if err != nil {
+		return err
+	}
+
+	output, err := yaml.Marshal(vars)
+	if err != nil {
+		return fmt.Errorf("failed to marshal credentials: %w", err)
+	}
+	ui.PrintBlock(output)
+
+	return nil
+}
+
+// CredsImportAction stores the credentials of a vars-store style YAML file written by
+// CredsExportAction. Relative names are resolved against pathPrefix.
+func CredsImportAction(ui UI, path, pathPrefix string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var vars map[string]interface{}
+	if err := yaml.Unmarshal(data, &vars); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	client, err := configserver.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	names, err := client.Import(vars, pathPrefix)
+	for _, name := range names {
+		ui.PrintLinef("Set credential: %s", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	ui.PrintLinef("Imported %d credentials", len(names))
+	return nil
+}
+
+// setConfigServerDirector connects to the director of the current BOSH environment and
+// sets it on client to find credentials. The director client reports the tasks it waits
+// for to taskReporter. The returned function closes the connection.
+func setConfigServerDirector(ctx context.Context, client *configserver.Client, taskReporter boshdir.TaskReporter) (boshdir.Director, func(), error) {
+	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	directorClient, directorCleanup, err := createTaskDirectorClient(ctx, cpiInstance, taskReporter)
+	if err != nil {
+		cpiCleanup()
+		return nil, nil, err
+	}
+
+	client.SetDirector(directorClient)
+	return directorClient, func() {
+		directorCleanup()
+		cpiCleanup()
+	}, nil
+}
+
+// CredsRotateOptions contains options for rotating the credentials of a deployment
+type CredsRotateOptions struct {
+	Deployment string // Deployment whose manifest variables are rotated
+	Type       string // Optional: only rotate variables of this type
+	Name       string // Optional: only rotate variables whose name matches this glob pattern
+	DryRun     bool   // Only show the variables that would be rotated
+	Force      bool   // Skip the confirmation prompt
+}
+
+// CredsRotateAction rotates the matching manifest variables of a deployment and redeploys
+// it. CAs are rotated before, and together with, the certificates they sign, in stages
+// that are deployed one by one (see configserver.Client.RotationStages).
+func CredsRotateAction(ui UI, opts CredsRotateOptions) error {
+	client, err := configserver.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	directorClient, cleanup, err := setConfigServerDirector(context.Background(), client, NewTaskReporter(ui))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	deployment, err := directorClient.FindDeployment(opts.Deployment)
+	if err != nil {
+		return fmt.Errorf("finding deployment %s: %w", opts.Deployment, err)
+	}
+	manifest, err := deployment.Manifest()
+	if err != nil {
+		return fmt.Errorf("getting manifest of deployment %s: %w", opts.Deployment, err)
+	}
+	variables, err := configserver.ManifestVariables(manifest)
+	if err != nil {
+		return err
+	}
+
+	plan, err := configserver.RotationPlan(variables, opts.Type, opts.Name)
+	if err != nil {
+		return err
+	}
+	if len(plan) == 0 {
+		ui.PrintLinef("No variables of deployment %s match", opts.Deployment)
+		return nil
+	}
+
+	namespace := fmt.Sprintf("/instant-bosh/%s", opts.Deployment)
+	table := boshtbl.Table{
+		Header: []boshtbl.Header{
+			boshtbl.NewHeader("Name"),
+			boshtbl.NewHeader("Type"),
+			boshtbl.NewHeader("Action"),
+		},
+	}
+	for _, variable := range plan {
+		action := "regenerate"
+		if !variable.Regeneratable() {
+			action = "delete (generated on deploy)"
+		}
+		table.Rows = append(table.Rows, []boshtbl.Value{
+			boshtbl.NewValueString(variable.Name),
+			boshtbl.NewValueString(variable.Type),
+			boshtbl.NewValueString(action),
+		})
+	}
+	ui.PrintLinef("Rotating %d variables of deployment %s in this order:", len(plan), opts.Deployment)
+	ui.PrintTable(table)
+
+	stages := client.RotationStages(namespace, plan)
+	if len(stages) > 1 {
+		ui.PrintLinef("")
+		ui.PrintLinef("CAs are rotated in %d deploys:", len(stages))
+		for i, stage := range stages {
+			ui.PrintLinef("  %d. %s", i+1, stage.Description)
+		}
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+	if !opts.Force {
+		if err := ui.AskForConfirmation(); err != nil {
+			ui.PrintLinef("Rotate operation cancelled")
+			return nil
+		}
+	}
+
+	for i, stage := range stages {
+		ui.PrintLinef("")
+		ui.PrintLinef("Stage %d/%d: %s", i+1, len(stages), stage.Description)
+		if err := stage.Apply(); err != nil {
+			return fmt.Errorf("stage %d (%s): %w", i+1, stage.Description, err)
+		}
+		if err := redeploy(ui, directorClient, deployment); err != nil {
+			return fmt.Errorf("stage %d (%s): %w", i+1, stage.Description, err)
+		}
+	}
+
+	ui.PrintLinef("")
+	ui.PrintLinef("Rotated %d variables of deployment %s", len(plan), opts.Deployment)
 	return nil
 }
@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	"github.com/rkoster/instant-bosh/internal/configserver"
+	"github.com/rkoster/instant-bosh/internal/credhubproxy"
+	"github.com/rkoster/instant-bosh/internal/envformat"
+	"github.com/rkoster/instant-bosh/internal/state"
+)
+
+// CredHubProxyPort is the default port of the CredHub proxy, the port CredHub listens on.
+const CredHubProxyPort = 8844
+
+// CredsProxyAction serves a CredHub-compatible API on localhost in front of the
+// config-server until interrupted, so the credhub CLI and CredHub-aware tools can be
+// used with instant-bosh. It prints the CREDHUB_* variables to configure the credhub CLI.
+func CredsProxyAction(ui UI, port int, format envformat.Format) error {
+	client, err := configserver.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// Finding credentials needs the director; without it the proxy serves everything else
+	ctx := context.Background()
+	if _, cleanup, err := setConfigServerDirector(ctx, client, boshdir.NewNoopTaskReporter()); err != nil {
+		ui.ErrorLinef("Warning: finding credentials is not available: %v", err)
+	} else {
+		defer cleanup()
+	}
+
+	cert, certPEM, err := credhubproxy.NewCertificate("127.0.0.1", "localhost")
+	if err != nil {
+		return fmt.Errorf("creating proxy certificate: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("listening on local port %d: %w", port, err)
+	}
+
+	server := &http.Server{
+		Handler: credhubproxy.NewHandler(client.UAAURL(), func(token string) credhubproxy.Store {
+			return client.WithToken(token)
+		}),
+		TLSConfig:         &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// The credhub CLI authenticates with the config-server client at the director's UAA,
+	// so it needs to trust both the proxy and the UAA
+	baseDir, err := state.BaseDir()
+	if err != nil {
+		return err
+	}
+	vars, err := envformat.WriteFiles(filepath.Join(baseDir, "credhub-proxy"), []envformat.Var{
+		{Name: "CREDHUB_SERVER", Value: "https://" + listener.Addr().String()},
+		{Name: "CREDHUB_CLIENT", Value: os.Getenv("CONFIG_SERVER_CLIENT")},
+		{Name: "CREDHUB_SECRET", Value: os.Getenv("CONFIG_SERVER_SECRET")},
+		{Name: "CREDHUB_CA_CERT", Value: certPEM + client.UAACACert(), File: "ca.pem"},
+	})
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ServeTLS(listener, "", "")
+	}()
+
+	ui.PrintLinef("CredHub API proxy listening on https://%s", listener.Addr())
+	ui.PrintLinef("")
+	ui.PrintLinef("Configure the credhub CLI in another shell with:")
+	if err := printEnvVars(ui, format, vars); err != nil {
+		return err
+	}
+	ui.PrintLinef("")
+	ui.PrintLinef("Press Ctrl+C to stop")
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("serving CredHub API: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("stopping CredHub API proxy: %w", err)
+	}
+	return nil
+}
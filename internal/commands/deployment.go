@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/rkoster/instant-bosh/internal/cpi"
+	"github.com/rkoster/instant-bosh/internal/director"
+)
+
+// createTaskDirectorClient creates a BOSH director client from the CPI instance, which
+// reports the tasks it waits for, e.g. deploys and stemcell uploads, to taskReporter
+func createTaskDirectorClient(ctx context.Context, cpiInstance cpi.CPI, taskReporter boshdir.TaskReporter) (boshdir.Director, func(), error) {
+	config, err := getDirectorConfig(ctx, cpiInstance)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cleanup := func() {
+		config.Cleanup()
+	}
+
+	logger := boshlog.NewLogger(boshlog.LevelError)
+	directorClient, err := director.NewDirectorWithTaskReporter(config, logger, taskReporter)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("creating director client: %w", err)
+	}
+
+	return directorClient, cleanup, nil
+}
+
+// deployManifest deploys the manifest as deploymentName through the director API.
+// The progress of the deploy task is reported by the task reporter of the client.
+func deployManifest(directorClient boshdir.Director, deploymentName string, manifest []byte) error {
+	deployment, err := directorClient.FindDeployment(deploymentName)
+	if err != nil {
+		return fmt.Errorf("finding deployment '%s': %w", deploymentName, err)
+	}
+
+	if err := deployment.Update(manifest, boshdir.UpdateOpts{}); err != nil {
+		return fmt.Errorf("deploying '%s': %w", deploymentName, err)
+	}
+	return nil
+}
+
+// deleteDeployment deletes deploymentName through the director API. With force,
+// errors deleting instances and disks are ignored, like bosh delete-deployment --force.
+func deleteDeployment(directorClient boshdir.Director, deploymentName string, force bool) error {
+	deployment, err := directorClient.FindDeployment(deploymentName)
+	if err != nil {
+		return fmt.Errorf("finding deployment '%s': %w", deploymentName, err)
+	}
+
+	if err := deployment.Delete(force); err != nil {
+		return fmt.Errorf("deleting '%s': %w", deploymentName, err)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 	"github.com/rkoster/instant-bosh/internal/cpi"
+	"github.com/rkoster/instant-bosh/internal/state"
 )
 
 func DestroyAction(ui UI, logger boshlog.Logger, cpiInstance cpi.CPI, force bool) error {
@@ -34,6 +35,7 @@ func DestroyAction(ui UI, logger boshlog.Logger, cpiInstance cpi.CPI, force bool
 	}
 
 	if !exists && !resourcesExist {
+		removeLocalState(logger, cpiInstance)
 		ui.PrintLinef("No instant-bosh resources found to destroy")
 		return nil
 	}
@@ -44,6 +46,19 @@ func DestroyAction(ui UI, logger boshlog.Logger, cpiInstance cpi.CPI, force bool
 		return err
 	}
 
+	removeLocalState(logger, cpiInstance)
+
 	ui.PrintLinef("Destroy complete")
 	return nil
 }
+
+// removeLocalState deletes the connection details stored for the environment.
+func removeLocalState(logger boshlog.Logger, cpiInstance cpi.CPI) {
+	env := cpiInstance.EnvironmentName()
+	if env == "" {
+		return
+	}
+	if err := state.Remove(env); err != nil {
+		logger.Debug("destroyCommand", "Failed to remove local state: %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/rkoster/instant-bosh/internal/commands"
 	"github.com/rkoster/instant-bosh/internal/commands/commandsfakes"
 	"github.com/rkoster/instant-bosh/internal/cpi/cpifakes"
+	"github.com/rkoster/instant-bosh/internal/state"
 )
 
 var _ = Describe("DestroyAction", func() {
@@ -52,6 +53,22 @@ var _ = Describe("DestroyAction", func() {
 		})
 	})
 
+	Describe("local state", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv(state.EnvStateDir, GinkgoT().TempDir())
+			fakeCPI.EnvironmentNameReturns("docker")
+			Expect(state.Save("docker", &state.State{HostAddress: "127.0.0.1"}, "fake-key")).To(Succeed())
+		})
+
+		It("removes the local state of the environment", func() {
+			err := commands.DestroyAction(fakeUI, logger, fakeCPI, true)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = state.Load("docker")
+			Expect(err).To(MatchError(state.ErrNotFound))
+		})
+	})
+
 	Describe("with confirmation required", func() {
 		Context("when user confirms destroy operation", func() {
 			BeforeEach(func() {
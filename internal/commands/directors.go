@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/rkoster/instant-bosh/internal/director"
+)
+
+// InstantBOSHDirector is the name of the instant-bosh director, as in its BOSH CLI alias.
+// Directors deployed with `ibosh bosh deploy` are named after their deployment, e.g. bosh-warden.
+const InstantBOSHDirector = "instant-bosh"
+
+// createNamedDirectorClient creates a client for the instant-bosh director, or for a
+// director deployed on it with `ibosh bosh deploy` (e.g. bosh-warden). The credentials
+// of a deployed director are read from config-server.
+func createNamedDirectorClient(ctx context.Context, name string) (boshdir.Director, func(), error) {
+	if name != "" && name != InstantBOSHDirector && !strings.HasPrefix(name, "bosh-") {
+		return nil, nil, fmt.Errorf("unknown director '%s' (use %s or a deployed director, e.g. bosh-warden)", name, InstantBOSHDirector)
+	}
+
+	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	directorClient, directorCleanup, err := createDirectorClient(ctx, cpiInstance)
+	if err != nil {
+		cpiCleanup()
+		return nil, nil, err
+	}
+	cleanup := func() {
+		directorCleanup()
+		cpiCleanup()
+	}
+
+	if name == "" || name == InstantBOSHDirector {
+		return directorClient, cleanup, nil
+	}
+	defer cleanup()
+
+	directorIP, err := deployedDirectorIP(directorClient, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger := boshlog.NewLogger(boshlog.LevelError)
+	config, err := getWardenDirectorConfigFromConfigServer(name, directorIP, logger)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting director config of '%s': %w", name, err)
+	}
+
+	deployedClient, err := director.NewDirector(config, logger)
+	if err != nil {
+		config.Cleanup()
+		return nil, nil, fmt.Errorf("creating director client: %w", err)
+	}
+	return deployedClient, func() { config.Cleanup() }, nil
+}
+
+// deployedDirectorIP returns the IP of the bosh instance of a director deployment
+func deployedDirectorIP(directorClient boshdir.Director, deploymentName string) (string, error) {
+	deployment, err := findExistingDeployment(directorClient, deploymentName)
+	if err != nil {
+		return "", err
+	}
+	if deployment == nil {
+		return "", fmt.Errorf("deployment '%s' not found\nIs the BOSH director deployed? Run 'ibosh bosh deploy' first.", deploymentName)
+	}
+
+	ips, err := instanceIPs(deployment, "bosh")
+	if err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("no bosh instance found in deployment '%s'", deploymentName)
+	}
+	return ips[0], nil
+}
+
+// findExistingDeployment returns the deployment with name, nil if the director has no such deployment
+func findExistingDeployment(directorClient boshdir.Director, name string) (boshdir.Deployment, error) {
+	deployments, err := directorClient.Deployments()
+	if err != nil {
+		return nil, fmt.Errorf("listing deployments: %w", err)
+	}
+	for _, deployment := range deployments {
+		if deployment.Name() == name {
+			return deployment, nil
+		}
+	}
+	return nil, nil
+}
+
+// instanceIPs returns the first IP of each instance of group in deployment that has an IP
+func instanceIPs(deployment boshdir.Deployment, group string) ([]string, error) {
+	instances, err := deployment.Instances()
+	if err != nil {
+		return nil, fmt.Errorf("listing instances of '%s': %w", deployment.Name(), err)
+	}
+
+	var ips []string
+	for _, instance := range instances {
+		if instance.Group == group && len(instance.IPs) > 0 {
+			ips = append(ips, instance.IPs[0])
+		}
+	}
+	return ips, nil
+}
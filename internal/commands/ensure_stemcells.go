@@ -1,13 +1,12 @@
 package commands
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"os/exec"
 
 	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
 	"github.com/rkoster/instant-bosh/internal/cpi"
+	"github.com/rkoster/instant-bosh/internal/interpolate"
 	"github.com/rkoster/instant-bosh/internal/stemcell"
 )
 
@@ -19,7 +18,7 @@ type EnsureStemcellsOptions struct {
 }
 
 // EnsureStemcells ensures all required stemcells are uploaded before deployment
-// 1. Run `bosh interpolate` to get final manifest
+// 1. Interpolate the manifest with its ops files and variables
 // 2. Parse stemcells from manifest
 // 3. Check director for existing stemcells
 // 4. Upload missing ones via CPI-specific method
@@ -30,29 +29,17 @@ func EnsureStemcells(
 	cpiInstance cpi.CPI,
 	opts EnsureStemcellsOptions,
 ) error {
-	// Build bosh interpolate command
-	args := []string{"interpolate", opts.ManifestPath}
-
-	for _, opsFile := range opts.OpsFiles {
-		args = append(args, "-o", opsFile)
-	}
-
-	for _, varFlag := range opts.VarFlags {
-		args = append(args, "-v", varFlag)
-	}
-
-	// Run bosh interpolate to get the final manifest
-	cmd := exec.CommandContext(ctx, "bosh", args...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("running bosh interpolate: %w\n%s", err, stderr.String())
+	// Interpolate to get the final manifest
+	manifest, err := interpolate.File(opts.ManifestPath, interpolate.Options{
+		OpsFiles: opts.OpsFiles,
+		Vars:     opts.VarFlags,
+	})
+	if err != nil {
+		return err
 	}
 
 	// Parse stemcells from manifest
-	requirements, err := stemcell.ParseFromManifest(stdout.Bytes())
+	requirements, err := stemcell.ParseFromManifest(manifest)
 	if err != nil {
 		return fmt.Errorf("parsing stemcells from manifest: %w", err)
 	}
@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"time"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshtbl "github.com/cloudfoundry/bosh-cli/v7/ui/table"
+)
+
+// eventsPollInterval is how often events --follow asks the director for new events
+const eventsPollInterval = 2 * time.Second
+
+// eventTimeFormat is the timestamp format of the before and after filters of the director
+const eventTimeFormat = "2006-01-02 15:04:05 UTC"
+
+// EventsOptions contains options for listing director events
+type EventsOptions struct {
+	Director   string // Director to list events of: instant-bosh (default) or e.g. bosh-warden
+	Deployment string // Optional: only list events of this deployment
+	Instance   string // Optional: only list events of this instance, e.g. router/0
+	Action     string // Optional: only list events with this action, e.g. update or delete
+	Task       string // Optional: only list events of this task ID
+	Since      string // Optional: only list events after this duration ago (e.g. 1h) or timestamp
+	Before     string // Optional: only list events before this duration ago or timestamp
+	Follow     bool   // If true, keep printing new events until interrupted
+}
+
+// EventsAction lists the events of a director, or tails them with Follow
+func EventsAction(ui UI, opts EventsOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	directorClient, cleanup, err := createNamedDirectorClient(ctx, opts.Director)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return ListEvents(ctx, ui, directorClient, opts, time.Now())
+}
+
+// ListEvents prints the events of directorClient matching the filters of opts as a table.
+// With Follow it prints them as lines instead, oldest first, and polls for new events
+// until ctx is done.
+func ListEvents(ctx context.Context, ui UI, directorClient boshdir.Director, opts EventsOptions, now time.Time) error {
+	filter, err := eventsFilter(opts, now)
+	if err != nil {
+		return err
+	}
+
+	events, err := directorClient.Events(filter)
+	if err != nil {
+		return fmt.Errorf("listing events: %w", err)
+	}
+
+	if !opts.Follow {
+		printEventsTable(ui, events)
+		return nil
+	}
+
+	lastID := 0
+	for {
+		// The director returns the newest events first
+		for _, event := range slices.Backward(events) {
+			id, err := strconv.Atoi(event.ID())
+			if err != nil || id <= lastID {
+				continue
+			}
+			lastID = id
+			printEventLine(ui, event)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(eventsPollInterval):
+		}
+
+		events, err = directorClient.Events(filter)
+		if err != nil {
+			return fmt.Errorf("listing events: %w", err)
+		}
+	}
+}
+
+// eventsFilter converts the options to a director events filter
+func eventsFilter(opts EventsOptions, now time.Time) (boshdir.EventsFilter, error) {
+	after, err := eventTime(opts.Since, now)
+	if err != nil {
+		return boshdir.EventsFilter{}, fmt.Errorf("invalid --since: %w", err)
+	}
+	before, err := eventTime(opts.Before, now)
+	if err != nil {
+		return boshdir.EventsFilter{}, fmt.Errorf("invalid --before: %w", err)
+	}
+
+	return boshdir.EventsFilter{
+		Deployment: opts.Deployment,
+		Instance:   opts.Instance,
+		Action:     opts.Action,
+		Task:       opts.Task,
+		After:      after,
+		Before:     before,
+	}, nil
+}
+
+// eventTime converts a duration ago (e.g. 30m) or a timestamp to the time format of the director
+func eventTime(value string, now time.Time) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		return now.Add(-ago).UTC().Format(eventTimeFormat), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format(eventTimeFormat), nil
+		}
+	}
+	return "", fmt.Errorf("'%s' is neither a duration (e.g. 1h) nor a timestamp (e.g. 2006-01-02 15:04:05)", value)
+}
+
+func printEventsTable(ui UI, events []boshdir.Event) {
+	table := boshtbl.Table{
+		Header: []boshtbl.Header{
+			boshtbl.NewHeader("ID"),
+			boshtbl.NewHeader("Time"),
+			boshtbl.NewHeader("User"),
+			boshtbl.NewHeader("Action"),
+			boshtbl.NewHeader("Object Type"),
+			boshtbl.NewHeader("Object Name"),
+			boshtbl.NewHeader("Task ID"),
+			boshtbl.NewHeader("Deployment"),
+			boshtbl.NewHeader("Instance"),
+			boshtbl.NewHeader("Context"),
+			boshtbl.NewHeader("Error"),
+		},
+	}
+	for _, event := range events {
+		id := event.ID()
+		if event.ParentID() != "" {
+			id += " <- " + event.ParentID()
+		}
+		table.Rows = append(table.Rows, []boshtbl.Value{
+			boshtbl.NewValueString(id),
+			boshtbl.NewValueTime(event.Timestamp()),
+			boshtbl.NewValueString(event.User()),
+			boshtbl.NewValueString(event.Action()),
+			boshtbl.NewValueString(event.ObjectType()),
+			boshtbl.NewValueString(event.ObjectName()),
+			boshtbl.NewValueString(event.TaskID()),
+			boshtbl.NewValueString(event.DeploymentName()),
+			boshtbl.NewValueString(event.Instance()),
+			boshtbl.NewValueInterface(event.Context()),
+			boshtbl.NewValueString(event.Error()),
+		})
+	}
+	ui.PrintTable(table)
+}
+
+func printEventLine(ui UI, event boshdir.Event) {
+	line := fmt.Sprintf("%s | %s | %s %s %s", event.ID(), event.Timestamp().UTC().Format(time.RFC3339), event.Action(), event.ObjectType(), event.ObjectName())
+	if event.TaskID() != "" {
+		line += " | task " + event.TaskID()
+	}
+	if event.DeploymentName() != "" {
+		line += " | " + event.DeploymentName()
+	}
+	if event.Instance() != "" {
+		line += " | " + event.Instance()
+	}
+
+	if event.Error() != "" {
+		ui.ErrorLinef("%s | Error: %s", line, event.Error())
+		return
+	}
+	ui.PrintLinef("%s", line)
+}
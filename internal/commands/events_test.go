@@ -0,0 +1,94 @@
+package commands_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshdirfakes "github.com/cloudfoundry/bosh-cli/v7/director/directorfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/rkoster/instant-bosh/internal/commands"
+	"github.com/rkoster/instant-bosh/internal/commands/commandsfakes"
+)
+
+var _ = Describe("ListEvents", func() {
+	var (
+		fakeUI       *commandsfakes.FakeUI
+		fakeDirector *boshdirfakes.FakeDirector
+		now          time.Time
+	)
+
+	newEvent := func(id, action, instance, errMsg string) boshdir.Event {
+		event := &boshdirfakes.FakeEvent{}
+		event.IDReturns(id)
+		event.TimestampReturns(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+		event.ActionReturns(action)
+		event.ObjectTypeReturns("instance")
+		event.ObjectNameReturns(instance)
+		event.DeploymentNameReturns("cf")
+		event.InstanceReturns(instance)
+		event.ErrorReturns(errMsg)
+		return event
+	}
+
+	BeforeEach(func() {
+		fakeUI = &commandsfakes.FakeUI{}
+		fakeDirector = &boshdirfakes.FakeDirector{}
+		now = time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC)
+
+		// Newest first, like the director
+		fakeDirector.EventsReturns([]boshdir.Event{
+			newEvent("12", "update", "router/0", "timed out"),
+			newEvent("11", "stop", "router/0", ""),
+		}, nil)
+	})
+
+	It("passes the filters and the time window to the director", func() {
+		err := commands.ListEvents(context.Background(), fakeUI, fakeDirector, commands.EventsOptions{
+			Deployment: "cf",
+			Instance:   "router/0",
+			Action:     "stop",
+			Task:       "42",
+			Since:      "1h",
+			Before:     "2026-10-18 12:15:00",
+		}, now)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeDirector.EventsArgsForCall(0)).To(Equal(boshdir.EventsFilter{
+			Deployment: "cf",
+			Instance:   "router/0",
+			Action:     "stop",
+			Task:       "42",
+			After:      "2026-10-18 11:30:00 UTC",
+			Before:     "2026-10-18 12:15:00 UTC",
+		}))
+		Expect(fakeUI.PrintTableCallCount()).To(Equal(1))
+		Expect(fakeUI.PrintTableArgsForCall(0).Rows).To(HaveLen(2))
+	})
+
+	It("rejects an invalid time window", func() {
+		err := commands.ListEvents(context.Background(), fakeUI, fakeDirector, commands.EventsOptions{Since: "yesterday"}, now)
+		Expect(err).To(MatchError(ContainSubstring("invalid --since")))
+		Expect(fakeDirector.EventsCallCount()).To(Equal(0))
+	})
+
+	It("prints new events oldest first when following", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := commands.ListEvents(ctx, fakeUI, fakeDirector, commands.EventsOptions{Follow: true}, now)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeUI.PrintLinefCallCount()).To(Equal(1))
+		pattern, args := fakeUI.PrintLinefArgsForCall(0)
+		Expect(fmt.Sprintf(pattern, args...)).To(Equal("11 | 2026-10-18T12:00:00Z | stop instance router/0 | cf | router/0"))
+
+		Expect(fakeUI.ErrorLinefCallCount()).To(Equal(1))
+		pattern, args = fakeUI.ErrorLinefArgsForCall(0)
+		Expect(fmt.Sprintf(pattern, args...)).To(Equal("12 | 2026-10-18T12:00:00Z | update instance router/0 | cf | router/0 | Error: timed out"))
+		Expect(fakeUI.PrintTableCallCount()).To(Equal(0))
+	})
+})
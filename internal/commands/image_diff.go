@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/rkoster/instant-bosh/internal/registry"
+)
+
+// ImageDiffAction compares the BOSH manifests embedded in two instant-bosh images
+// and prints the differences in the requested format to stdout.
+// Informational messages (e.g. "no differences") go to stderr so the output can be piped.
+func ImageDiffAction(
+	ui UI,
+	logger boshlog.Logger,
+	registryClient registry.Client,
+	currentRef string,
+	newRef string,
+	format registry.DiffFormat,
+) error {
+	ctx := context.Background()
+
+	currentImage := resolveImageInfo(ctx, logger, registryClient, currentRef)
+	newImage := resolveImageInfo(ctx, logger, registryClient, newRef)
+
+	diff, err := registryClient.CompareManifests(ctx, currentImage, newImage)
+	if err != nil {
+		return fmt.Errorf("comparing manifests: %w", err)
+	}
+
+	output, err := diff.Format(format)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		ui.ErrorLinef("No differences in BOSH manifest")
+		return nil
+	}
+
+	ui.PrintLinef("%s", output)
+	return nil
+}
+
+// resolveImageInfo pins an image reference to its digest for accurate manifest extraction.
+// If resolution fails, the original reference is used without a digest.
+func resolveImageInfo(ctx context.Context, logger boshlog.Logger, registryClient registry.Client, imageRef string) registry.ImageInfo {
+	pinnedRef, digest, err := registryClient.ResolveImageRef(ctx, imageRef)
+	if err != nil {
+		logger.Debug("imageDiffCommand", "Failed to resolve image ref %s: %v", imageRef, err)
+		return registry.ImageInfo{Ref: imageRef}
+	}
+	return registry.ImageInfo{Ref: pinnedRef, Digest: digest}
+}
@@ -1,188 +1,137 @@
 package commands
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net"
-	"os/exec"
-	"strings"
+	"path/filepath"
 
-	"gopkg.in/yaml.v3"
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	"github.com/rkoster/instant-bosh/internal/cpi"
+	"github.com/rkoster/instant-bosh/internal/ipam"
+	"github.com/rkoster/instant-bosh/internal/state"
 )
 
-// IPSelector provides methods for selecting available IPs from BOSH cloud-config
+// IPSelector selects available static IPs from the cloud config of the director
 type IPSelector struct {
-	ui UI
+	ui           UI
+	director     boshdir.Director
+	cpi          cpi.CPI
+	reservations *ipam.Reservations
 }
 
-// NewIPSelector creates a new IP selector
-func NewIPSelector(ui UI) *IPSelector {
-	return &IPSelector{ui: ui}
+// NewIPSelector creates a new IP selector. Selected IPs are reserved in reservations.
+func NewIPSelector(ui UI, directorClient boshdir.Director, cpiInstance cpi.CPI, reservations *ipam.Reservations) *IPSelector {
+	return &IPSelector{ui: ui, director: directorClient, cpi: cpiInstance, reservations: reservations}
 }
 
-// SelectAvailableIP selects an available IP from the cloud-config static range for the given network
-// If networkName is empty, it uses "default"
-func (s *IPSelector) SelectAvailableIP(networkName string) (string, error) {
-	if networkName == "" {
-		networkName = "default"
+// newIPSelector creates an IP selector for the CPI and director clients of a command,
+// reserving IPs in the local state of the environment
+func newIPSelector(ui UI, directorClient boshdir.Director, cpiInstance cpi.CPI) (*IPSelector, error) {
+	dir, err := state.Dir(cpiInstance.EnvironmentName())
+	if err != nil {
+		return nil, err
 	}
+	reservations := ipam.NewReservations(filepath.Join(dir, ipam.ReservationsFileName), ipam.DefaultReservationTTL)
+	return NewIPSelector(ui, directorClient, cpiInstance, reservations), nil
+}
 
-	// Get cloud-config from BOSH
-	cmd := exec.Command("bosh", "cloud-config", "--json")
-	output, err := cmd.Output()
+// createDirectorAndIPSelector creates a client of the instant-bosh director and an IP
+// selector using it. The returned cleanup closes the clients.
+func createDirectorAndIPSelector(ctx context.Context, ui UI) (boshdir.Director, *IPSelector, func(), error) {
+	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to get cloud-config: %w", err)
+		return nil, nil, nil, err
 	}
 
-	// Parse JSON output - BOSH CLI uses "Blocks" for cloud-config output
-	var result struct {
-		Tables []struct {
-			Rows []struct {
-				Content string `json:"content"`
-			} `json:"Rows"`
-		} `json:"Tables"`
-		Blocks []string `json:"Blocks"`
-	}
-	if err := json.Unmarshal(output, &result); err != nil {
-		return "", fmt.Errorf("failed to parse cloud-config output: %w", err)
+	directorClient, directorCleanup, err := createDirectorClient(ctx, cpiInstance)
+	if err != nil {
+		cpiCleanup()
+		return nil, nil, nil, err
 	}
-
-	// Try Blocks first (newer BOSH CLI format), then Tables (older format)
-	var cloudConfigYAML string
-	if len(result.Blocks) > 0 {
-		cloudConfigYAML = result.Blocks[0]
-	} else if len(result.Tables) > 0 && len(result.Tables[0].Rows) > 0 {
-		cloudConfigYAML = result.Tables[0].Rows[0].Content
-	} else {
-		return "", fmt.Errorf("no cloud-config found")
+	cleanup := func() {
+		directorCleanup()
+		cpiCleanup()
 	}
 
-	// Parse cloud-config YAML
-	var cloudConfig struct {
-		Networks []struct {
-			Name    string `yaml:"name"`
-			Subnets []struct {
-				Static []string `yaml:"static"`
-			} `yaml:"subnets"`
-		} `yaml:"networks"`
-	}
-	if err := yaml.Unmarshal([]byte(cloudConfigYAML), &cloudConfig); err != nil {
-		return "", fmt.Errorf("failed to parse cloud-config YAML: %w", err)
+	ipSelector, err := newIPSelector(ui, directorClient, cpiInstance)
+	if err != nil {
+		cleanup()
+		return nil, nil, nil, err
 	}
+	return directorClient, ipSelector, cleanup, nil
+}
 
-	// Find static IPs from specified network
-	var staticRange string
-	for _, network := range cloudConfig.Networks {
-		if network.Name == networkName && len(network.Subnets) > 0 && len(network.Subnets[0].Static) > 0 {
-			staticRange = network.Subnets[0].Static[0]
-			break
-		}
+// SelectAvailableIP selects a static IP of the given network from the cloud config and
+// reserves it for owner (a deployment name), so concurrent deploys select different IPs.
+// All subnets and static ranges of the network are used, except reserved ranges, IPs
+// used by deployments and IPs of the containers on the instant-bosh network.
+// If networkName is empty, it uses "default"
+func (s *IPSelector) SelectAvailableIP(ctx context.Context, networkName, owner string) (string, error) {
+	ips, err := s.SelectAvailableIPs(ctx, networkName, []string{owner}, true)
+	if err != nil {
+		return "", err
 	}
+	return ips[0], nil
+}
 
-	if staticRange == "" {
-		return "", fmt.Errorf("no static IP range found in cloud-config for network '%s'", networkName)
+// SelectAvailableIPs selects a different static IP for each of owners like SelectAvailableIP,
+// skipping the IPs in exclude as well. Without reserve the IPs are only selected, for
+// manifests that ibosh doesn't deploy.
+func (s *IPSelector) SelectAvailableIPs(ctx context.Context, networkName string, owners []string, reserve bool, exclude ...string) ([]string, error) {
+	if networkName == "" {
+		networkName = "default"
 	}
 
-	// Parse static range (format: "10.245.0.34-10.245.0.100")
-	availableIPs, err := parseIPRange(staticRange)
+	cloudConfigs, err := ipam.CloudConfigs(s.director)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse static IP range: %w", err)
+		return nil, fmt.Errorf("failed to get cloud-config: %w", err)
 	}
-
-	if len(availableIPs) == 0 {
-		return "", fmt.Errorf("no IPs in static range")
+	candidates, err := ipam.StaticIPs(cloudConfigs, networkName)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get currently used IPs from BOSH instances
-	usedIPs, err := getUsedIPs()
+	used, err := ipam.UsedIPs(s.director)
 	if err != nil {
-		s.ui.PrintLinef("Warning: could not get used IPs, may conflict: %v", err)
+		return nil, fmt.Errorf("failed to get used IPs: %w", err)
 	}
-
-	// Find first available IP
-	for _, ip := range availableIPs {
-		if !usedIPs[ip] {
-			return ip, nil
+	ipam.AddUsed(used, s.cpi.GetContainerIP())
+	containers, err := s.cpi.GetContainersOnNetwork(ctx)
+	if err != nil {
+		// Not all CPIs list the containers on their network
+		if s.ui != nil {
+			s.ui.ErrorLinef("Warning: could not list containers on the network, may conflict: %v", err)
 		}
 	}
-
-	return "", fmt.Errorf("no available IPs in static range (all %d IPs are in use)", len(availableIPs))
-}
-
-// parseIPRange parses an IP range string like "10.245.0.34-10.245.0.100"
-func parseIPRange(rangeStr string) ([]string, error) {
-	parts := strings.Split(rangeStr, "-")
-	if len(parts) != 2 {
-		// Single IP
-		return []string{rangeStr}, nil
-	}
-
-	startIP := net.ParseIP(strings.TrimSpace(parts[0]))
-	endIP := net.ParseIP(strings.TrimSpace(parts[1]))
-
-	if startIP == nil || endIP == nil {
-		return nil, fmt.Errorf("invalid IP range: %s", rangeStr)
+	for _, container := range containers {
+		ipam.AddUsed(used, container.IP)
 	}
+	ipam.AddUsed(used, exclude...)
 
-	startIP = startIP.To4()
-	endIP = endIP.To4()
-
-	if startIP == nil || endIP == nil {
-		return nil, fmt.Errorf("only IPv4 supported: %s", rangeStr)
+	selectIP := s.reservations.Select
+	if reserve {
+		selectIP = s.reservations.Reserve
 	}
-
 	var ips []string
-	for ip := startIP; !ip.Equal(endIP); incrementIP(ip) {
-		ips = append(ips, ip.String())
-		if len(ips) > 1000 { // Safety limit
-			break
+	for _, owner := range owners {
+		ip, err := selectIP(owner, candidates, used)
+		if err != nil {
+			return nil, fmt.Errorf("network '%s': %w", networkName, err)
 		}
+		// The next owner gets another IP, also when nothing is reserved
+		used[ip] = true
+		ips = append(ips, ip.String())
 	}
-	ips = append(ips, endIP.String())
-
 	return ips, nil
 }
 
-// incrementIP increments an IP address by 1
-func incrementIP(ip net.IP) {
-	for i := len(ip) - 1; i >= 0; i-- {
-		ip[i]++
-		if ip[i] > 0 {
-			break
+// releaseIPs releases the IPs reserved for owners when their deploy failed. IPs of the
+// instances the deploy did create are used, and not selected again either way.
+func releaseIPs(ui UI, ipSelector *IPSelector, owners ...string) {
+	for _, owner := range owners {
+		if err := ipSelector.reservations.Release(owner); err != nil {
+			ui.ErrorLinef("Warning: failed to release reserved IPs: %v", err)
+			return
 		}
 	}
 }
-
-// getUsedIPs returns a map of IPs currently in use by BOSH instances
-func getUsedIPs() (map[string]bool, error) {
-	cmd := exec.Command("bosh", "instances", "--json")
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, err
-	}
-
-	var result struct {
-		Tables []struct {
-			Rows []struct {
-				IPs string `json:"ips"`
-			} `json:"Rows"`
-		} `json:"Tables"`
-	}
-	if err := json.Unmarshal(output, &result); err != nil {
-		return nil, err
-	}
-
-	used := make(map[string]bool)
-	for _, table := range result.Tables {
-		for _, row := range table.Rows {
-			for _, ip := range strings.Split(row.IPs, "\n") {
-				ip = strings.TrimSpace(ip)
-				if ip != "" {
-					used[ip] = true
-				}
-			}
-		}
-	}
-
-	return used, nil
-}
@@ -0,0 +1,91 @@
+package commands_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshdirfakes "github.com/cloudfoundry/bosh-cli/v7/director/directorfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/rkoster/instant-bosh/internal/commands"
+	"github.com/rkoster/instant-bosh/internal/commands/commandsfakes"
+	"github.com/rkoster/instant-bosh/internal/cpi"
+	"github.com/rkoster/instant-bosh/internal/cpi/cpifakes"
+	"github.com/rkoster/instant-bosh/internal/ipam"
+)
+
+var _ = Describe("IPSelector", func() {
+	var (
+		fakeCPI      *cpifakes.FakeCPI
+		fakeUI       *commandsfakes.FakeUI
+		fakeDirector *boshdirfakes.FakeDirector
+		reservations *ipam.Reservations
+		selector     *commands.IPSelector
+	)
+
+	BeforeEach(func() {
+		fakeCPI = &cpifakes.FakeCPI{}
+		fakeUI = &commandsfakes.FakeUI{}
+		fakeDirector = &boshdirfakes.FakeDirector{}
+
+		fakeCPI.GetContainerIPReturns("10.245.0.10")
+		fakeCPI.GetContainersOnNetworkReturns([]cpi.ContainerInfo{{Name: "instant-bosh", IP: "10.245.0.10"}, {Name: "registry", IP: "10.245.0.11"}}, nil)
+		fakeDirector.ListConfigsReturns([]boshdir.Config{{Name: "default", Type: "cloud", Content: `
+networks:
+- name: default
+  subnets:
+  - range: 10.245.0.0/16
+    gateway: 10.245.0.1
+    reserved: [10.245.0.2 - 10.245.0.9]
+    static: [10.245.0.10 - 10.245.0.12]
+  - range: 10.246.0.0/16
+    static: [10.246.0.10 - 10.246.0.11]
+`}}, nil)
+
+		zookeeper := &boshdirfakes.FakeDeployment{}
+		zookeeper.NameReturns("zookeeper")
+		zookeeper.InstancesReturns([]boshdir.Instance{{IPs: []string{"10.245.0.12"}}}, nil)
+		fakeDirector.DeploymentsReturns([]boshdir.Deployment{zookeeper}, nil)
+
+		reservations = ipam.NewReservations(filepath.Join(GinkgoT().TempDir(), ipam.ReservationsFileName), time.Hour)
+		selector = commands.NewIPSelector(fakeUI, fakeDirector, fakeCPI, reservations)
+	})
+
+	It("skips IPs used by containers and deployments across subnets", func() {
+		ip, err := selector.SelectAvailableIP(context.Background(), "", "cf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ip).To(Equal("10.246.0.10"))
+
+		_, filter := fakeDirector.ListConfigsArgsForCall(0)
+		Expect(filter.Type).To(Equal("cloud"))
+	})
+
+	It("does not hand out IPs reserved by a concurrent deploy", func() {
+		first, err := selector.SelectAvailableIP(context.Background(), "default", "cf")
+		Expect(err).NotTo(HaveOccurred())
+		second, err := selector.SelectAvailableIP(context.Background(), "default", "bosh-warden")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).NotTo(Equal(first))
+
+		_, err = selector.SelectAvailableIP(context.Background(), "default", "zookeeper-2")
+		Expect(err).To(MatchError(ipam.ErrNoAvailableIP))
+	})
+
+	It("warns when the containers on the network can't be listed", func() {
+		fakeCPI.GetContainersOnNetworkReturns(nil, errors.New("not implemented"))
+
+		ip, err := selector.SelectAvailableIP(context.Background(), "default", "cf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ip).To(Equal("10.245.0.11"))
+		Expect(fakeUI.ErrorLinefCallCount()).To(Equal(1))
+	})
+
+	It("fails for a network that is not in the cloud config", func() {
+		_, err := selector.SelectAvailableIP(context.Background(), "missing", "cf")
+		Expect(err).To(MatchError(ContainSubstring(`network "missing" not found`)))
+	})
+})
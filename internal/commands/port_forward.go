@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/rkoster/instant-bosh/internal/boshssh"
+	"github.com/rkoster/instant-bosh/internal/portforward"
+)
+
+// PortForwardAction forwards local ports to a deployment instance until interrupted.
+// target has the form <deployment>/<instance-group>[/<index-or-id>] and must match a
+// single instance. Connections are tunneled through the director's jumpbox, so
+// instance IPs do not need to be routable from the host.
+func PortForwardAction(ui UI, target string, specs []string) error {
+	if len(specs) == 0 {
+		return errors.New("at least one port forward (<local>:<remote>) is required")
+	}
+	forwards := make([]portforward.Forward, 0, len(specs))
+	for _, spec := range specs {
+		forward, err := portforward.ParseForward(spec)
+		if err != nil {
+			return err
+		}
+		forwards = append(forwards, forward)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	deploymentName, slug, err := boshssh.ParseTarget(target)
+	if err != nil {
+		return err
+	}
+
+	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cpiCleanup()
+
+	directorClient, dial, directorCleanup, err := createDirectorConnection(ctx, cpiInstance)
+	if err != nil {
+		return err
+	}
+	defer directorCleanup()
+
+	deployment, err := directorClient.FindDeployment(deploymentName)
+	if err != nil {
+		return fmt.Errorf("finding deployment %s: %w", deploymentName, err)
+	}
+
+	instanceName, ip, err := portforward.InstanceAddress(deployment, slug)
+	if err != nil {
+		return err
+	}
+
+	// Bind all local ports before forwarding, so a port in use fails the command
+	listeners := make([]net.Listener, 0, len(forwards))
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+	for _, forward := range forwards {
+		listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(forward.LocalPort)))
+		if err != nil {
+			return fmt.Errorf("listening on local port %d: %w", forward.LocalPort, err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	errs := make(chan error, len(forwards))
+	for i, forward := range forwards {
+		remoteAddress := net.JoinHostPort(ip, strconv.Itoa(forward.RemotePort))
+		ui.PrintLinef("Forwarding %s -> %s (%s)", listeners[i].Addr(), instanceName, remoteAddress)
+
+		go func(listener net.Listener) {
+			errs <- portforward.Serve(ctx, listener, dial, remoteAddress, func(err error) {
+				ui.ErrorLinef("Forwarding connection to %s failed: %v", remoteAddress, err)
+			})
+		}(listeners[i])
+	}
+	ui.PrintLinef("Press Ctrl+C to stop")
+
+	var result error
+	for range forwards {
+		if err := <-errs; err != nil && result == nil {
+			// A broken listener stops all forwards
+			result = err
+			stop()
+		}
+	}
+	return result
+}
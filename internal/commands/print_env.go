@@ -7,9 +7,13 @@ import (
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 	"github.com/rkoster/instant-bosh/internal/cpi"
 	"github.com/rkoster/instant-bosh/internal/director"
+	"github.com/rkoster/instant-bosh/internal/envformat"
+	"github.com/rkoster/instant-bosh/internal/state"
 )
 
-func PrintEnvAction(ui UI, logger boshlog.Logger, cpiInstance cpi.CPI, configProvider director.ConfigProvider) error {
+// PrintEnvAction prints the environment variables for the BOSH CLI and the creds commands
+// in the given format (e.g. export lines for eval "$(ibosh docker print-env)").
+func PrintEnvAction(ui UI, logger boshlog.Logger, cpiInstance cpi.CPI, configProvider director.ConfigProvider, format envformat.Format) error {
 	ctx := context.Background()
 
 	running, err := cpiInstance.IsRunning(ctx)
@@ -26,23 +30,43 @@ func PrintEnvAction(ui UI, logger boshlog.Logger, cpiInstance cpi.CPI, configPro
 		return fmt.Errorf("failed to get director config: %w", err)
 	}
 
-	ui.PrintLinef("export BOSH_CLIENT=%s", config.Client)
-	ui.PrintLinef("export BOSH_CLIENT_SECRET=%s", config.ClientSecret)
-	ui.PrintLinef("export BOSH_ENVIRONMENT=%s", config.Environment)
-	ui.PrintLinef("export BOSH_CA_CERT='%s'", config.CACert)
-	if config.AllProxy != "" {
-		ui.PrintLinef("export BOSH_ALL_PROXY=%s", config.AllProxy)
-	} else {
-		ui.PrintLinef("unset BOSH_ALL_PROXY 2>/dev/null; true")
+	vars := []envformat.Var{
+		{Name: "BOSH_CLIENT", Value: config.Client},
+		{Name: "BOSH_CLIENT_SECRET", Value: config.ClientSecret},
+		{Name: "BOSH_ENVIRONMENT", Value: config.Environment},
+		{Name: "BOSH_CA_CERT", Value: config.CACert, File: "director-ca.pem"},
+		{Name: "BOSH_ALL_PROXY", Value: config.AllProxy, Unset: config.AllProxy == ""},
+		// Config-server environment variables for ibosh creds commands
+		{Name: "CONFIG_SERVER_URL", Value: config.ConfigServerURL},
+		{Name: "CONFIG_SERVER_CLIENT", Value: config.ConfigServerClient},
+		{Name: "CONFIG_SERVER_SECRET", Value: config.ConfigServerSecret},
+		{Name: "CONFIG_SERVER_CA_CERT", Value: config.ConfigServerCACert, File: "config-server-ca.pem"},
+		{Name: "UAA_URL", Value: config.UAAURL},
+		{Name: "UAA_CA_CERT", Value: config.UAACACert, File: "uaa-ca.pem"},
 	}
 
-	// Config-server environment variables for ibosh creds commands
-	ui.PrintLinef("export CONFIG_SERVER_URL=%s", config.ConfigServerURL)
-	ui.PrintLinef("export CONFIG_SERVER_CLIENT=%s", config.ConfigServerClient)
-	ui.PrintLinef("export CONFIG_SERVER_SECRET=%s", config.ConfigServerSecret)
-	ui.PrintLinef("export CONFIG_SERVER_CA_CERT='%s'", config.ConfigServerCACert)
-	ui.PrintLinef("export UAA_URL=%s", config.UAAURL)
-	ui.PrintLinef("export UAA_CA_CERT='%s'", config.UAACACert)
+	if format == envformat.Direnv {
+		dir, err := state.Dir(director.EnvironmentName(cpiInstance, cpiInstance.GetContainerName()))
+		if err != nil {
+			return err
+		}
+		if vars, err = envformat.WriteFiles(dir, vars); err != nil {
+			return err
+		}
+	}
+
+	return printEnvVars(ui, format, vars)
+}
+
+// printEnvVars prints vars in the given format
+func printEnvVars(ui UI, format envformat.Format, vars []envformat.Var) error {
+	lines, err := envformat.Render(format, vars)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		ui.PrintLinef(line.Format, line.Args...)
+	}
 
 	return nil
 }
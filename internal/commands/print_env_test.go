@@ -1,7 +1,10 @@
 package commands_test
 
 import (
+	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
 
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 	. "github.com/onsi/ginkgo/v2"
@@ -12,6 +15,8 @@ import (
 	"github.com/rkoster/instant-bosh/internal/cpi/cpifakes"
 	"github.com/rkoster/instant-bosh/internal/director"
 	"github.com/rkoster/instant-bosh/internal/director/directorfakes"
+	"github.com/rkoster/instant-bosh/internal/envformat"
+	"github.com/rkoster/instant-bosh/internal/state"
 )
 
 var _ = Describe("PrintEnvAction", func() {
@@ -48,7 +53,7 @@ var _ = Describe("PrintEnvAction", func() {
 
 	Describe("when container is running", func() {
 		It("should print environment variables for shell evaluation", func() {
-			err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider)
+			err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider, envformat.Shell)
 
 			Expect(err).NotTo(HaveOccurred())
 
@@ -115,7 +120,7 @@ var _ = Describe("PrintEnvAction", func() {
 		})
 
 		It("should output in shell-compatible format", func() {
-			err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider)
+			err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider, envformat.Shell)
 
 			Expect(err).NotTo(HaveOccurred())
 
@@ -143,7 +148,7 @@ var _ = Describe("PrintEnvAction", func() {
 			})
 
 			It("should use the provided configuration", func() {
-				err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider)
+				err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider, envformat.Shell)
 
 				Expect(err).NotTo(HaveOccurred())
 
@@ -159,13 +164,65 @@ var _ = Describe("PrintEnvAction", func() {
 		})
 	})
 
+	Describe("output formats", func() {
+		It("should print a single JSON object", func() {
+			err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider, envformat.JSON)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeUI.PrintLinefCallCount()).To(Equal(1))
+
+			_, args := fakeUI.PrintLinefArgsForCall(0)
+			var values map[string]string
+			Expect(json.Unmarshal([]byte(args[0].(string)), &values)).To(Succeed())
+			Expect(values).To(HaveKeyWithValue("BOSH_CLIENT", "admin"))
+			Expect(values).To(HaveKeyWithValue("BOSH_ALL_PROXY", ContainSubstring("ssh+socks5")))
+			Expect(values["BOSH_CA_CERT"]).To(ContainSubstring("fake-cert"))
+		})
+
+		It("should print fish commands", func() {
+			err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider, envformat.Fish)
+
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < fakeUI.PrintLinefCallCount(); i++ {
+				format, _ := fakeUI.PrintLinefArgsForCall(i)
+				Expect(format).To(HavePrefix("set -gx "))
+			}
+		})
+
+		Context("with direnv", func() {
+			var stateDir string
+
+			BeforeEach(func() {
+				stateDir = GinkgoT().TempDir()
+				GinkgoT().Setenv(state.EnvStateDir, stateDir)
+				fakeCPI.EnvironmentNameReturns("docker")
+			})
+
+			It("should write the CA certificates to the state dir and reference them by path", func() {
+				err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider, envformat.Direnv)
+
+				Expect(err).NotTo(HaveOccurred())
+
+				caPath := filepath.Join(stateDir, "docker", "director-ca.pem")
+				Expect(os.ReadFile(caPath)).To(ContainSubstring("fake-cert"))
+
+				format, args := fakeUI.PrintLinefArgsForCall(3)
+				Expect(format).To(Equal("export BOSH_CA_CERT=%s"))
+				Expect(args[0]).To(Equal(caPath))
+
+				_, args = fakeUI.PrintLinefArgsForCall(8)
+				Expect(args[0]).To(Equal(filepath.Join(stateDir, "docker", "config-server-ca.pem")))
+			})
+		})
+	})
+
 	Describe("when container is not running", func() {
 		BeforeEach(func() {
 			fakeCPI.IsRunningReturns(false, nil)
 		})
 
 		It("should return an error instructing to start instant-bosh", func() {
-			err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider)
+			err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider, envformat.Shell)
 
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("not running"))
@@ -186,7 +243,7 @@ var _ = Describe("PrintEnvAction", func() {
 			})
 
 			It("should return an error", func() {
-				err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider)
+				err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider, envformat.Shell)
 
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("cpi error"))
@@ -203,7 +260,7 @@ var _ = Describe("PrintEnvAction", func() {
 			})
 
 			It("should return an error", func() {
-				err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider)
+				err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider, envformat.Shell)
 
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("failed to get director config"))
@@ -218,7 +275,7 @@ var _ = Describe("PrintEnvAction", func() {
 
 	Describe("usage with eval", func() {
 		It("should produce output suitable for shell evaluation", func() {
-			err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider)
+			err := commands.PrintEnvAction(fakeUI, logger, fakeCPI, fakeConfigProvider, envformat.Shell)
 
 			Expect(err).NotTo(HaveOccurred())
 
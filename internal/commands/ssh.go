@@ -0,0 +1,242 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	"github.com/rkoster/instant-bosh/internal/boshssh"
+	"github.com/rkoster/instant-bosh/internal/cpi"
+	"github.com/rkoster/instant-bosh/internal/director"
+)
+
+// SSHOptions contains options for the ssh command
+type SSHOptions struct {
+	Command string // Optional: command to run instead of an interactive shell
+	TTY     bool   // If true, allocate a pseudo-terminal for Command (single instance only)
+}
+
+// SSHAction opens a shell on, or runs a command on, deployment instances.
+// target has the form <deployment>[/<instance-group>[/<index-or-id>]].
+// A command runs on all matching instances concurrently with prefixed output,
+// an interactive shell requires the target to match a single instance.
+func SSHAction(ui UI, target string, opts SSHOptions) error {
+	ctx := context.Background()
+
+	session, cleanup, err := setupSSHSession(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if opts.Command == "" || opts.TTY {
+		if len(session.Hosts) != 1 {
+			return fmt.Errorf("%s matches %d instances, an interactive session requires exactly one (e.g. %s/%s)",
+				target, len(session.Hosts), strings.SplitN(target, "/", 2)[0], boshssh.InstanceName(session.Hosts[0]))
+		}
+		return session.Shell(ctx, session.Hosts[0], opts.Command, os.Stdin, os.Stdout, os.Stderr)
+	}
+
+	if len(session.Hosts) == 1 {
+		return session.Run(ctx, session.Hosts[0], opts.Command, os.Stdout, os.Stderr)
+	}
+
+	return runOnInstances(ctx, ui, session, opts.Command)
+}
+
+// runOnInstances runs command on all instances of the session concurrently,
+// prefixing every line of output with the instance name.
+func runOnInstances(ctx context.Context, ui UI, session *boshssh.Session, command string) error {
+	var (
+		outputMu sync.Mutex
+		wg       sync.WaitGroup
+		errs     = make([]error, len(session.Hosts))
+	)
+
+	for i, host := range session.Hosts {
+		wg.Add(1)
+		go func(i int, host boshdir.Host) {
+			defer wg.Done()
+			prefix := boshssh.InstanceName(host) + ": "
+			stdout := boshssh.NewPrefixWriter(os.Stdout, &outputMu, prefix)
+			stderr := boshssh.NewPrefixWriter(os.Stderr, &outputMu, prefix)
+			errs[i] = session.Run(ctx, host, command, stdout, stderr)
+			stdout.Flush()
+			stderr.Flush()
+		}(i, host)
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		name := boshssh.InstanceName(session.Hosts[i])
+		if status := boshssh.ExitStatus(err); status >= 0 {
+			ui.ErrorLinef("%s: command exited with status %d", name, status)
+		} else {
+			ui.ErrorLinef("%s: %v", name, err)
+		}
+		failed = append(failed, name)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("command failed on %d of %d instances: %s", len(failed), len(session.Hosts), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// SCPAction copies a file between the local machine and deployment instances.
+// Exactly one of src and dst must be remote (<deployment>[/<instance-group>[/<index-or-id>]]:<path>).
+// Uploads go to all matching instances, downloads require a single instance.
+func SCPAction(ui UI, src, dst string) error {
+	ctx := context.Background()
+
+	srcTarget, srcPath, srcRemote := boshssh.ParseSCPArg(src)
+	dstTarget, dstPath, dstRemote := boshssh.ParseSCPArg(dst)
+
+	switch {
+	case srcRemote && dstRemote:
+		return errors.New("copying between instances is not supported, either source or destination must be local")
+	case !srcRemote && !dstRemote:
+		return errors.New("either source or destination must be remote (<deployment>/<instance>:<path>)")
+	case dstRemote:
+		return uploadToInstances(ctx, ui, srcPath, dstTarget, dstPath)
+	default:
+		return downloadFromInstance(ctx, ui, srcTarget, srcPath, dstPath)
+	}
+}
+
+func uploadToInstances(ctx context.Context, ui UI, localPath, target, remotePath string) error {
+	if _, err := os.Stat(localPath); err != nil {
+		return fmt.Errorf("reading %s: %w", localPath, err)
+	}
+
+	session, cleanup, err := setupSSHSession(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	for _, host := range session.Hosts {
+		file, err := os.Open(localPath)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", localPath, err)
+		}
+		err = session.Upload(ctx, host, file, remotePath)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		ui.PrintLinef("Copied %s to %s:%s", localPath, boshssh.InstanceName(host), remotePath)
+	}
+	return nil
+}
+
+func downloadFromInstance(ctx context.Context, ui UI, target, remotePath, localPath string) error {
+	session, cleanup, err := setupSSHSession(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if len(session.Hosts) != 1 {
+		return fmt.Errorf("%s matches %d instances, downloading requires exactly one", target, len(session.Hosts))
+	}
+	host := session.Hosts[0]
+
+	if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+		localPath = filepath.Join(localPath, filepath.Base(remotePath))
+	}
+
+	file, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", localPath, err)
+	}
+	if err := session.Download(ctx, host, remotePath, file); err != nil {
+		file.Close()
+		os.Remove(localPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", localPath, err)
+	}
+
+	ui.PrintLinef("Copied %s:%s to %s", boshssh.InstanceName(host), remotePath, localPath)
+	return nil
+}
+
+// setupSSHSession sets up SSH access to the instances matching target.
+// The returned cleanup removes the temporary SSH user and closes the director connection.
+func setupSSHSession(ctx context.Context, target string) (*boshssh.Session, func(), error) {
+	deploymentName, slug, err := boshssh.ParseTarget(target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cpiInstance, cpiCleanup, err := createCPIAndDirectorClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	directorClient, dial, directorCleanup, err := createDirectorConnection(ctx, cpiInstance)
+	if err != nil {
+		cpiCleanup()
+		return nil, nil, err
+	}
+
+	deployment, err := directorClient.FindDeployment(deploymentName)
+	if err != nil {
+		directorCleanup()
+		cpiCleanup()
+		return nil, nil, fmt.Errorf("finding deployment %s: %w", deploymentName, err)
+	}
+
+	session, err := boshssh.Setup(deployment, slug, dial)
+	if err != nil {
+		directorCleanup()
+		cpiCleanup()
+		return nil, nil, err
+	}
+
+	cleanup := func() {
+		session.Close()
+		directorCleanup()
+		cpiCleanup()
+	}
+	return session, cleanup, nil
+}
+
+// createDirectorConnection creates a BOSH director client from the CPI instance, together
+// with a dialer reaching the deployment network through the director container.
+func createDirectorConnection(ctx context.Context, cpiInstance cpi.CPI) (boshdir.Director, director.DialContextFunc, func(), error) {
+	config, err := getDirectorConfig(ctx, cpiInstance)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	dial, closeDialer, err := config.NewDialer()
+	if err != nil {
+		config.Cleanup()
+		return nil, nil, nil, err
+	}
+
+	cleanup := func() {
+		closeDialer()
+		config.Cleanup()
+	}
+
+	directorClient, err := newDirectorFromConfig(config)
+	if err != nil {
+		cleanup()
+		return nil, nil, nil, err
+	}
+
+	return directorClient, dial, cleanup, nil
+}
@@ -9,11 +9,13 @@ import (
 	"time"
 
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/rkoster/instant-bosh/internal/boshconfig"
 	"github.com/rkoster/instant-bosh/internal/cpi"
 	"github.com/rkoster/instant-bosh/internal/director"
 	"github.com/rkoster/instant-bosh/internal/docker"
 	"github.com/rkoster/instant-bosh/internal/logwriter"
 	"github.com/rkoster/instant-bosh/internal/registry"
+	"github.com/rkoster/instant-bosh/internal/state"
 	"github.com/rkoster/instant-bosh/internal/stemcell"
 )
 
@@ -47,8 +49,23 @@ func StartActionWithWriter(
 
 	ctx := context.Background()
 
+	platform, err := selectImagePlatform(ctx, logger, cpiInstance, opts)
+	if err != nil {
+		return err
+	}
+
 	// Create registry client for CPI-agnostic image operations
-	registryClient := registry.NewClient(logger)
+	registryClient, err := registry.NewClientWithOptions(logger, registry.ClientOptions{
+		Refresh:  opts.Refresh,
+		Platform: platform,
+	})
+	if err != nil {
+		return err
+	}
+	if dockerClient, ok := unwrapDockerClient(cpiInstance); ok {
+		// Stemcell tags are resolved with the same cache and --refresh setting
+		dockerClient.SetRegistryClient(registryClient)
+	}
 
 	// Resolve the target image to a digest-pinned reference
 	// This ensures we track the exact image version, even with mutable tags like "latest"
@@ -91,6 +108,11 @@ func StartActionWithWriter(
 		if !upgraded {
 			// User cancelled upgrade or no upgrade needed
 			ui.PrintLinef("instant-bosh is already running")
+			if config, err := refreshLocalState(ctx, logger, cpiInstance, configProvider); err != nil {
+				ui.PrintLinef("Warning: %v", err)
+			} else {
+				registerBOSHAlias(ui, logger, config, boshconfig.DefaultAlias)
+			}
 			printEnvInstructions(ui, cpiInstance)
 			return nil
 		}
@@ -178,6 +200,12 @@ func StartActionWithWriter(
 
 	ui.PrintLinef("instant-bosh is ready!")
 
+	config, err := refreshLocalState(ctx, logger, cpiInstance, configProvider)
+	if err != nil {
+		return err
+	}
+	registerBOSHAlias(ui, logger, config, boshconfig.DefaultAlias)
+
 	ui.PrintLinef("Applying cloud-config...")
 	if err := applyCloudConfig(ctx, cpiInstance, logger, configProvider, directorFactory); err != nil {
 		return fmt.Errorf("failed to apply cloud-config: %w", err)
@@ -385,6 +413,35 @@ func handleRunningContainerUpgrade(
 	return true, nil
 }
 
+// selectImagePlatform returns the platform used to select the image from multi-arch
+// manifest lists: the explicit --platform, otherwise the platform of the host running
+// the container. Only Docker can run images for a platform other than its own.
+func selectImagePlatform(ctx context.Context, logger boshlog.Logger, cpiInstance cpi.CPI, opts StartOptions) (string, error) {
+	if opts.Platform != "" {
+		platform, err := registry.ParsePlatform(opts.Platform)
+		if err != nil {
+			return "", err
+		}
+		opts.Platform = platform
+
+		if dockerClient, ok := unwrapDockerClient(cpiInstance); ok {
+			dockerClient.SetPlatform(platform)
+		}
+	}
+
+	hostPlatform, err := cpiInstance.Platform(ctx)
+	if err != nil || hostPlatform == "" {
+		logger.Debug("startCommand", "Failed to get host platform: %v", err)
+		return opts.Platform, nil
+	}
+
+	if opts.Platform != "" && opts.Platform != hostPlatform {
+		return "", fmt.Errorf("platform %s is not supported, this backend only runs %s images", opts.Platform, hostPlatform)
+	}
+
+	return hostPlatform, nil
+}
+
 // handleDockerImagePull handles Docker-specific image pulling for non-running containers.
 // For Incus, the image is pulled when creating the container, so this is not needed.
 func handleDockerImagePull(
@@ -458,6 +515,26 @@ func handleDockerImagePull(
 	return nil
 }
 
+// refreshLocalState stores the connection details of the running director and the image
+// it runs in the local state directory, which all other commands read from.
+func refreshLocalState(ctx context.Context, logger boshlog.Logger, cpiInstance cpi.CPI, configProvider director.ConfigProvider) (*director.Config, error) {
+	var image state.Image
+	imageInfo, err := cpiInstance.GetCurrentImageInfo(ctx)
+	if err != nil {
+		logger.Debug("startCommand", "Failed to get current image info: %v", err)
+	} else {
+		image = state.Image{Ref: imageInfo.Ref, Digest: imageInfo.Digest}
+	}
+
+	config, err := configProvider.RefreshDirectorConfig(ctx, cpiInstance, cpiInstance.GetContainerName(), image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh local state: %w", err)
+	}
+	logger.Debug("startCommand", "Refreshed local state for %s", cpiInstance.EnvironmentName())
+
+	return config, nil
+}
+
 func applyCloudConfig(
 	ctx context.Context,
 	cpiInstance cpi.CPI,
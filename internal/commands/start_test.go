@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"io"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/rkoster/instant-bosh/internal/boshconfig"
 	"github.com/rkoster/instant-bosh/internal/commands"
 	"github.com/rkoster/instant-bosh/internal/commands/commandsfakes"
 	"github.com/rkoster/instant-bosh/internal/cpi"
@@ -39,6 +42,7 @@ var _ = Describe("StartAction", func() {
 		fakeUI = &commandsfakes.FakeUI{}
 
 		logger = boshlog.NewLogger(boshlog.LevelNone)
+		GinkgoT().Setenv(boshconfig.EnvConfig, filepath.Join(GinkgoT().TempDir(), "config"))
 		opts = cpi.StartOptions{
 			SkipUpdate:         false,
 			SkipStemcellUpload: true,
@@ -98,6 +102,49 @@ var _ = Describe("StartAction", func() {
 				Expect(fakeDirector.UpdateCloudConfigCallCount()).To(Equal(1))
 				Expect(fakeUI.PrintLinefCallCount()).To(BeNumerically(">", 0))
 			})
+
+			It("refreshes the local state with the running image", func() {
+				fakeCPI.GetCurrentImageInfoReturns(cpi.ImageInfo{
+					Ref:    "ghcr.io/rkoster/instant-bosh@sha256:abc123",
+					Digest: "sha256:abc123",
+				}, nil)
+
+				err := commands.StartActionWithWriter(fakeUI, logger, fakeCPI, fakeConfigProvider, fakeDirectorFactory, opts, io.Discard)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeConfigProvider.RefreshDirectorConfigCallCount()).To(Equal(1))
+				_, _, containerName, image := fakeConfigProvider.RefreshDirectorConfigArgsForCall(0)
+				Expect(containerName).To(Equal("instant-bosh"))
+				Expect(image.Ref).To(Equal("ghcr.io/rkoster/instant-bosh@sha256:abc123"))
+				Expect(image.Digest).To(Equal("sha256:abc123"))
+			})
+
+			It("registers the director in the BOSH CLI config", func() {
+				fakeConfigProvider.RefreshDirectorConfigReturns(&director.Config{
+					Environment:  "https://127.0.0.1:25555",
+					Client:       "admin",
+					ClientSecret: "fake-password",
+					CACert:       "fake-cert",
+				}, nil)
+
+				err := commands.StartActionWithWriter(fakeUI, logger, fakeCPI, fakeConfigProvider, fakeDirectorFactory, opts, io.Discard)
+				Expect(err).NotTo(HaveOccurred())
+
+				config, err := os.ReadFile(os.Getenv(boshconfig.EnvConfig))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(config)).To(ContainSubstring("alias: instant-bosh"))
+				Expect(string(config)).To(ContainSubstring("url: https://127.0.0.1:25555"))
+				Expect(string(config)).To(ContainSubstring("password: fake-password"))
+			})
+
+			It("returns an error when the local state cannot be refreshed", func() {
+				fakeConfigProvider.RefreshDirectorConfigReturns(nil, errors.New("vars store unavailable"))
+
+				err := commands.StartActionWithWriter(fakeUI, logger, fakeCPI, fakeConfigProvider, fakeDirectorFactory, opts, io.Discard)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("failed to refresh local state"))
+				Expect(fakeDirector.UpdateCloudConfigCallCount()).To(Equal(0))
+			})
 		})
 
 		Context("when container exists but is not running", func() {
@@ -118,6 +165,35 @@ var _ = Describe("StartAction", func() {
 		})
 	})
 
+	Describe("platform selection", func() {
+		Context("when an explicit platform differs from the host platform", func() {
+			BeforeEach(func() {
+				fakeCPI.PlatformReturns("linux/amd64", nil)
+				opts.Platform = "linux/arm64"
+			})
+
+			It("fails before starting the container", func() {
+				err := commands.StartActionWithWriter(fakeUI, logger, fakeCPI, fakeConfigProvider, fakeDirectorFactory, opts, io.Discard)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("platform linux/arm64 is not supported"))
+
+				Expect(fakeCPI.StartCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when an explicit platform is invalid", func() {
+			BeforeEach(func() {
+				opts.Platform = "linux/not a platform"
+			})
+
+			It("returns an error", func() {
+				err := commands.StartActionWithWriter(fakeUI, logger, fakeCPI, fakeConfigProvider, fakeDirectorFactory, opts, io.Discard)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("invalid platform"))
+			})
+		})
+	})
+
 	Describe("container already running scenarios", func() {
 		Context("when container is already running", func() {
 			BeforeEach(func() {
@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshuifmt "github.com/cloudfoundry/bosh-cli/v7/ui/fmt"
+	boshuitask "github.com/cloudfoundry/bosh-cli/v7/ui/task"
+)
+
+// TaskReporter reports the event output of director tasks, e.g. deploys and deletes.
+// It renders stages, tasks, durations and failures in the UI like the bosh CLI, or
+// writes each event as a JSON line for CI.
+type TaskReporter struct {
+	ui   UI
+	json io.Writer
+
+	mu     sync.Mutex
+	rest   map[int]string
+	events map[int][]*boshuitask.Event
+}
+
+var _ boshdir.TaskReporter = &TaskReporter{}
+
+// NewTaskReporter creates a task reporter rendering task events in the UI.
+func NewTaskReporter(ui UI) *TaskReporter {
+	return &TaskReporter{ui: ui, rest: map[int]string{}, events: map[int][]*boshuitask.Event{}}
+}
+
+// NewJSONTaskReporter creates a task reporter writing task events to w as JSON lines.
+// Each line is a director event with the task_id added; the start and end of a task
+// are written as lines with task_id and task_state.
+func NewJSONTaskReporter(w io.Writer) *TaskReporter {
+	return &TaskReporter{json: w, rest: map[int]string{}, events: map[int][]*boshuitask.Event{}}
+}
+
+// newTaskReporter creates the task reporter for the --json flag of a command. JSON
+// events are written to stdout, the UI of these commands writes to stderr.
+func newTaskReporter(ui UI, jsonOutput bool) *TaskReporter {
+	if jsonOutput {
+		return NewJSONTaskReporter(os.Stdout)
+	}
+	return NewTaskReporter(ui)
+}
+
+// TaskStarted is called when the director client starts waiting for task id.
+func (r *TaskReporter) TaskStarted(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events[id] = nil
+	if r.json != nil {
+		r.writeJSON(map[string]interface{}{"task_id": id, "task_state": "started"})
+		return
+	}
+	r.ui.PrintLinef("Task %d", id)
+	r.ui.PrintLinef("")
+}
+
+// TaskFinished is called when task id finished in state, e.g. done or error.
+func (r *TaskReporter) TaskFinished(id int, state string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if rest := strings.TrimSpace(r.rest[id]); rest != "" {
+		r.showLine(id, rest)
+	}
+	delete(r.rest, id)
+	events := r.events[id]
+	delete(r.events, id)
+
+	if r.json != nil {
+		r.writeJSON(map[string]interface{}{"task_id": id, "task_state": state})
+		return
+	}
+
+	if len(events) > 0 {
+		first, last := events[0], events[len(events)-1]
+		r.ui.PrintLinef("")
+		r.ui.PrintLinef("Task %d Started  %s", id, first.TimeAsStr())
+		r.ui.PrintLinef("Task %d Finished %s", id, last.TimeAsStr())
+		r.ui.PrintLinef("Task %d Duration %s", id, first.DurationAsStr(*last))
+	}
+	if state == "done" {
+		r.ui.PrintLinef("Task %d %s", id, state)
+	} else {
+		r.ui.ErrorLinef("Task %d %s", id, state)
+	}
+	r.ui.PrintLinef("")
+}
+
+// TaskOutputChunk is called with the next chunk of the event output of task id.
+// Events are newline separated JSON documents, which may be split across chunks.
+func (r *TaskReporter) TaskOutputChunk(id int, chunk []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rest[id] += string(chunk)
+	for {
+		line, rest, found := strings.Cut(r.rest[id], "\n")
+		if !found {
+			break
+		}
+		r.rest[id] = rest
+		if line = strings.TrimSpace(line); line != "" {
+			r.showLine(id, line)
+		}
+	}
+}
+
+func (r *TaskReporter) showLine(id int, line string) {
+	if r.json != nil {
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			event = map[string]interface{}{"message": line}
+		}
+		event["task_id"] = id
+		r.writeJSON(event)
+		return
+	}
+
+	event := boshuitask.Event{TaskID: id}
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		// Not an event, e.g. the debug output of a task
+		r.ui.PrintLinef("%s", line)
+		return
+	}
+	for _, previous := range r.events[id] {
+		if previous.IsSame(event) {
+			event.StartEvent = previous
+			break
+		}
+	}
+	r.events[id] = append(r.events[id], &event)
+	r.showEvent(id, event)
+}
+
+func (r *TaskReporter) showEvent(id int, event boshuitask.Event) {
+	prefix := fmt.Sprintf("Task %d | %s | ", id, event.TimeAsHoursStr())
+	// Align details with the description after the prefix
+	indent := strings.Repeat(" ", len(prefix))
+
+	desc := event.Stage
+	if len(event.Tags) > 0 {
+		desc += " " + strings.Join(event.Tags, ", ")
+	}
+
+	switch {
+	case event.Type == boshuitask.EventTypeDeprecation:
+		r.ui.ErrorLinef("%sDeprecation: %s", prefix, event.Message)
+	case event.Type == boshuitask.EventTypeWarning:
+		r.ui.ErrorLinef("%sWarning: %s", prefix, event.Message)
+	case event.State == boshuitask.EventStateStarted:
+		r.ui.PrintLinef("%s%s: %s", prefix, desc, event.Task)
+	case event.State == boshuitask.EventStateInProgress:
+		r.ui.PrintLinef("%sL %s: %s", indent, event.Data.Status, event.Task)
+	case event.State == boshuitask.EventStateFinished:
+		r.ui.PrintLinef("%s%s: %s (%s)", prefix, desc, event.Task, eventDuration(event))
+	case event.State == boshuitask.EventStateFailed:
+		r.ui.ErrorLinef("%s%s: %s (%s)", prefix, desc, event.Task, eventDuration(event))
+		r.ui.ErrorLinef("%sL Error: %s", indent, event.Data.Error)
+	case event.Error != nil:
+		r.ui.ErrorLinef("%sError: %s", prefix, event.Error.Message)
+	}
+}
+
+func (r *TaskReporter) writeJSON(value map[string]interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	r.json.Write(append(data, '\n'))
+}
+
+// eventDuration returns the duration since the start of the task of event
+func eventDuration(event boshuitask.Event) string {
+	if event.StartEvent == nil {
+		return boshuifmt.Duration(0)
+	}
+	return event.DurationSinceStartAsStr()
+}
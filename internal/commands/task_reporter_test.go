@@ -0,0 +1,105 @@
+package commands_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/rkoster/instant-bosh/internal/commands"
+	"github.com/rkoster/instant-bosh/internal/commands/commandsfakes"
+)
+
+var _ = Describe("TaskReporter", func() {
+	const events = `{"time":1700000000,"stage":"Preparing deployment","tags":[],"total":1,"task":"Preparing deployment","index":1,"state":"started","progress":0}
+{"time":1700000002,"stage":"Preparing deployment","tags":[],"total":1,"task":"Preparing deployment","index":1,"state":"finished","progress":100}
+{"time":1700000002,"stage":"Updating instance","tags":["router"],"total":1,"task":"router/abc (0) (canary)","index":1,"state":"started","progress":0}
+{"time":1700000065,"stage":"Updating instance","tags":["router"],"total":1,"task":"router/abc (0) (canary)","index":1,"state":"failed","progress":100,"data":{"error":"'router/abc (0)' is not running after update"}}
+{"time":1700000065,"error":{"code":400007,"message":"'router/abc (0)' is not running after update"}}
+`
+
+	var fakeUI *commandsfakes.FakeUI
+
+	BeforeEach(func() {
+		fakeUI = &commandsfakes.FakeUI{}
+	})
+
+	printed := func() []string {
+		var lines []string
+		for i := 0; i < fakeUI.PrintLinefCallCount(); i++ {
+			pattern, args := fakeUI.PrintLinefArgsForCall(i)
+			lines = append(lines, fmt.Sprintf(pattern, args...))
+		}
+		return lines
+	}
+
+	errored := func() []string {
+		var lines []string
+		for i := 0; i < fakeUI.ErrorLinefCallCount(); i++ {
+			pattern, args := fakeUI.ErrorLinefArgsForCall(i)
+			lines = append(lines, fmt.Sprintf(pattern, args...))
+		}
+		return lines
+	}
+
+	It("renders stages, durations and failures in the UI", func() {
+		reporter := commands.NewTaskReporter(fakeUI)
+		reporter.TaskStarted(42)
+		// Events may be split across chunks
+		reporter.TaskOutputChunk(42, []byte(events[:100]))
+		reporter.TaskOutputChunk(42, []byte(events[100:]))
+		reporter.TaskFinished(42, "error")
+
+		Expect(printed()).To(ContainElements(
+			"Task 42",
+			"Task 42 | 22:13:20 | Preparing deployment: Preparing deployment",
+			"Task 42 | 22:13:22 | Preparing deployment: Preparing deployment (00:00:02)",
+			"Task 42 | 22:13:22 | Updating instance router: router/abc (0) (canary)",
+			"Task 42 Duration 00:01:05",
+		))
+		Expect(errored()).To(Equal([]string{
+			"Task 42 | 22:14:25 | Updating instance router: router/abc (0) (canary) (00:01:03)",
+			"                     L Error: 'router/abc (0)' is not running after update",
+			"Task 42 | 22:14:25 | Error: 'router/abc (0)' is not running after update",
+			"Task 42 error",
+		}))
+	})
+
+	It("prints output that is not an event as is", func() {
+		reporter := commands.NewTaskReporter(fakeUI)
+		reporter.TaskStarted(7)
+		reporter.TaskOutputChunk(7, []byte("D, [2024-01-01] DEBUG -- : Lock acquired\n"))
+		reporter.TaskFinished(7, "done")
+
+		Expect(printed()).To(ContainElement("D, [2024-01-01] DEBUG -- : Lock acquired"))
+		Expect(printed()).To(ContainElement("Task 7 done"))
+		Expect(fakeUI.ErrorLinefCallCount()).To(Equal(0))
+	})
+
+	It("writes events as JSON lines with the task ID", func() {
+		var out bytes.Buffer
+		reporter := commands.NewJSONTaskReporter(&out)
+		reporter.TaskStarted(42)
+		reporter.TaskOutputChunk(42, []byte(events))
+		reporter.TaskFinished(42, "error")
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(7))
+
+		var decoded []map[string]interface{}
+		for _, line := range lines {
+			var event map[string]interface{}
+			Expect(json.Unmarshal([]byte(line), &event)).To(Succeed())
+			Expect(event).To(HaveKeyWithValue("task_id", BeNumerically("==", 42)))
+			decoded = append(decoded, event)
+		}
+		Expect(decoded[0]).To(HaveKeyWithValue("task_state", "started"))
+		Expect(decoded[4]).To(HaveKeyWithValue("state", "failed"))
+		Expect(decoded[4]).To(HaveKeyWithValue("stage", "Updating instance"))
+		Expect(decoded[6]).To(HaveKeyWithValue("task_state", "error"))
+		Expect(fakeUI.PrintLinefCallCount()).To(Equal(0))
+	})
+})
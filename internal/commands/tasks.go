@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshtbl "github.com/cloudfoundry/bosh-cli/v7/ui/table"
+)
+
+// DefaultRecentTasks is the default number of tasks listed by tasks.
+const DefaultRecentTasks = 30
+
+// TasksOptions contains options for listing director tasks
+type TasksOptions struct {
+	Director   string // Director to list tasks of: instant-bosh (default) or e.g. bosh-warden
+	Recent     int    // Number of recent tasks to list
+	All        bool   // If true, include internal tasks, e.g. snapshots and cleanups
+	Deployment string // Optional: only list tasks of this deployment
+}
+
+// TaskOptions contains options for following the output of a director task
+type TaskOptions struct {
+	Director string // Director running the task: instant-bosh (default) or e.g. bosh-warden
+	Debug    bool   // If true, follow the debug output instead of the events
+	CPI      bool   // If true, follow the CPI calls instead of the events
+	JSON     bool   // If true, write the events as JSON lines to stdout
+}
+
+// TasksAction lists the recent tasks of a director
+func TasksAction(ui UI, opts TasksOptions) error {
+	directorClient, cleanup, err := createNamedDirectorClient(context.Background(), opts.Director)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return ListTasks(ui, directorClient, opts)
+}
+
+// ListTasks prints a table of the recent tasks of directorClient
+func ListTasks(ui UI, directorClient boshdir.Director, opts TasksOptions) error {
+	recent := opts.Recent
+	if recent <= 0 {
+		recent = DefaultRecentTasks
+	}
+
+	tasks, err := directorClient.RecentTasks(recent, boshdir.TasksFilter{All: opts.All, Deployment: opts.Deployment})
+	if err != nil {
+		return fmt.Errorf("listing tasks: %w", err)
+	}
+
+	table := boshtbl.Table{
+		Header: []boshtbl.Header{
+			boshtbl.NewHeader("ID"),
+			boshtbl.NewHeader("State"),
+			boshtbl.NewHeader("Started At"),
+			boshtbl.NewHeader("Finished At"),
+			boshtbl.NewHeader("User"),
+			boshtbl.NewHeader("Deployment"),
+			boshtbl.NewHeader("Description"),
+			boshtbl.NewHeader("Result"),
+		},
+	}
+	for _, task := range tasks {
+		state := boshtbl.NewValueFmt(boshtbl.NewValueString(task.State()), task.IsError())
+		table.Rows = append(table.Rows, []boshtbl.Value{
+			boshtbl.NewValueInt(task.ID()),
+			state,
+			boshtbl.NewValueTime(task.StartedAt()),
+			boshtbl.NewValueTime(task.FinishedAt()),
+			boshtbl.NewValueString(task.User()),
+			boshtbl.NewValueString(task.DeploymentName()),
+			boshtbl.NewValueString(task.Description()),
+			boshtbl.NewValueString(task.Result()),
+		})
+	}
+	ui.PrintTable(table)
+
+	return nil
+}
+
+// TaskAction follows the output of a director task until it finishes
+func TaskAction(ui UI, id int, opts TaskOptions) error {
+	directorClient, cleanup, err := createNamedDirectorClient(context.Background(), opts.Director)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return FollowTask(directorClient, id, opts, newTaskReporter(ui, opts.JSON))
+}
+
+// FollowTask reports the output of task id to taskReporter until the task finishes.
+// It returns an error when the task did not succeed.
+func FollowTask(directorClient boshdir.Director, id int, opts TaskOptions, taskReporter boshdir.TaskReporter) error {
+	task, err := directorClient.FindTask(id)
+	if err != nil {
+		return fmt.Errorf("finding task %d: %w", id, err)
+	}
+
+	switch {
+	case opts.Debug:
+		err = task.DebugOutput(taskReporter)
+	case opts.CPI:
+		err = task.CPIOutput(taskReporter)
+	default:
+		err = task.EventOutput(taskReporter)
+	}
+	if err != nil {
+		return fmt.Errorf("following task %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package commands_test
+
+import (
+	"errors"
+	"time"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshdirfakes "github.com/cloudfoundry/bosh-cli/v7/director/directorfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/rkoster/instant-bosh/internal/commands"
+	"github.com/rkoster/instant-bosh/internal/commands/commandsfakes"
+)
+
+var _ = Describe("Tasks", func() {
+	var (
+		fakeUI       *commandsfakes.FakeUI
+		fakeDirector *boshdirfakes.FakeDirector
+		fakeTask     *boshdirfakes.FakeTask
+	)
+
+	BeforeEach(func() {
+		fakeUI = &commandsfakes.FakeUI{}
+		fakeDirector = &boshdirfakes.FakeDirector{}
+
+		fakeTask = &boshdirfakes.FakeTask{}
+		fakeTask.IDReturns(42)
+		fakeTask.StateReturns("error")
+		fakeTask.IsErrorReturns(true)
+		fakeTask.StartedAtReturns(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+		fakeTask.DeploymentNameReturns("cf")
+		fakeTask.DescriptionReturns("create deployment")
+		fakeTask.ResultReturns("'router/0' is not running after update")
+		fakeDirector.RecentTasksReturns([]boshdir.Task{fakeTask}, nil)
+		fakeDirector.FindTaskReturns(fakeTask, nil)
+	})
+
+	Describe("ListTasks", func() {
+		It("lists the recent tasks with the filters", func() {
+			err := commands.ListTasks(fakeUI, fakeDirector, commands.TasksOptions{All: true, Deployment: "cf"})
+			Expect(err).NotTo(HaveOccurred())
+
+			limit, filter := fakeDirector.RecentTasksArgsForCall(0)
+			Expect(limit).To(Equal(commands.DefaultRecentTasks))
+			Expect(filter).To(Equal(boshdir.TasksFilter{All: true, Deployment: "cf"}))
+
+			Expect(fakeUI.PrintTableCallCount()).To(Equal(1))
+			table := fakeUI.PrintTableArgsForCall(0)
+			Expect(table.Rows).To(HaveLen(1))
+			Expect(table.Rows[0][0].String()).To(Equal("42"))
+			Expect(table.Rows[0][1].String()).To(Equal("error"))
+			Expect(table.Rows[0][5].String()).To(Equal("cf"))
+			Expect(table.Rows[0][7].String()).To(Equal("'router/0' is not running after update"))
+		})
+
+		It("returns an error when listing fails", func() {
+			fakeDirector.RecentTasksReturns(nil, errors.New("unauthorized"))
+
+			err := commands.ListTasks(fakeUI, fakeDirector, commands.TasksOptions{Recent: 5})
+			Expect(err).To(MatchError(ContainSubstring("unauthorized")))
+		})
+	})
+
+	Describe("FollowTask", func() {
+		var reporter *boshdirfakes.FakeTaskReporter
+
+		BeforeEach(func() {
+			reporter = &boshdirfakes.FakeTaskReporter{}
+		})
+
+		It("follows the events by default", func() {
+			Expect(commands.FollowTask(fakeDirector, 42, commands.TaskOptions{}, reporter)).To(Succeed())
+
+			Expect(fakeDirector.FindTaskArgsForCall(0)).To(Equal(42))
+			Expect(fakeTask.EventOutputCallCount()).To(Equal(1))
+			Expect(fakeTask.EventOutputArgsForCall(0)).To(Equal(reporter))
+		})
+
+		It("follows the debug or CPI output", func() {
+			Expect(commands.FollowTask(fakeDirector, 42, commands.TaskOptions{Debug: true}, reporter)).To(Succeed())
+			Expect(fakeTask.DebugOutputCallCount()).To(Equal(1))
+
+			Expect(commands.FollowTask(fakeDirector, 42, commands.TaskOptions{CPI: true}, reporter)).To(Succeed())
+			Expect(fakeTask.CPIOutputCallCount()).To(Equal(1))
+			Expect(fakeTask.EventOutputCallCount()).To(Equal(0))
+		})
+
+		It("returns an error when the task failed", func() {
+			fakeTask.EventOutputReturns(errors.New("Expected task '42' to succeed but state is 'error'"))
+
+			err := commands.FollowTask(fakeDirector, 42, commands.TaskOptions{}, reporter)
+			Expect(err).To(MatchError(ContainSubstring("following task 42")))
+		})
+	})
+})
@@ -12,10 +12,11 @@ import (
 	"github.com/rkoster/instant-bosh/internal/boshio"
 	"github.com/rkoster/instant-bosh/internal/director"
 	"github.com/rkoster/instant-bosh/internal/docker"
+	"github.com/rkoster/instant-bosh/internal/registry"
 	"github.com/rkoster/instant-bosh/internal/stemcell"
 )
 
-func UploadStemcellAction(ui boshui.UI, logger boshlog.Logger, imageRef string) error {
+func UploadStemcellAction(ui boshui.UI, logger boshlog.Logger, imageRef string, platform string) error {
 	return UploadStemcellActionWithFactories(
 		ui,
 		logger,
@@ -23,6 +24,7 @@ func UploadStemcellAction(ui boshui.UI, logger boshlog.Logger, imageRef string)
 		&director.DefaultConfigProvider{},
 		&director.DefaultDirectorFactory{},
 		imageRef,
+		platform,
 	)
 }
 
@@ -33,6 +35,7 @@ func UploadStemcellActionWithFactories(
 	configProvider director.ConfigProvider,
 	directorFactory director.DirectorFactory,
 	imageRef string,
+	platform string,
 ) error {
 	ctx := context.Background()
 
@@ -43,6 +46,15 @@ func UploadStemcellActionWithFactories(
 	}
 	defer dockerClient.Close()
 
+	// Select the stemcell image for an explicit platform instead of the daemon platform
+	if platform != "" {
+		platform, err = registry.ParsePlatform(platform)
+		if err != nil {
+			return err
+		}
+		dockerClient.SetPlatform(platform)
+	}
+
 	// Check if instant-bosh is running
 	running, err := dockerClient.IsContainerRunning(ctx)
 	if err != nil {
@@ -111,6 +111,7 @@ var _ = Describe("UploadStemcellAction", func() {
 				fakeConfigProvider,
 				fakeDirectorFactory,
 				"ghcr.io/cloudfoundry/ubuntu-noble-stemcell:1.165",
+				"",
 			)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -155,6 +156,7 @@ var _ = Describe("UploadStemcellAction", func() {
 				fakeConfigProvider,
 				fakeDirectorFactory,
 				"ghcr.io/cloudfoundry/ubuntu-noble-stemcell:1.165",
+				"",
 			)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -187,6 +189,7 @@ var _ = Describe("UploadStemcellAction", func() {
 				fakeConfigProvider,
 				fakeDirectorFactory,
 				"ghcr.io/cloudfoundry/ubuntu-noble-stemcell:1.165",
+				"",
 			)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("not running"))
@@ -213,6 +216,7 @@ var _ = Describe("UploadStemcellAction", func() {
 				fakeConfigProvider,
 				fakeDirectorFactory,
 				"ghcr.io/this-does-not-exist/ubuntu-noble-stemcell:99.999.nonexistent",
+				"",
 			)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("failed to resolve image metadata"))
@@ -232,6 +236,7 @@ var _ = Describe("UploadStemcellAction", func() {
 				fakeConfigProvider,
 				fakeDirectorFactory,
 				"ghcr.io/cloudfoundry/ubuntu-noble-stemcell:1.165",
+				"",
 			)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("failed to upload stemcell"))
@@ -261,6 +266,7 @@ var _ = Describe("UploadStemcellAction", func() {
 				fakeConfigProvider,
 				fakeDirectorFactory,
 				"ghcr.io/cloudfoundry/ubuntu-noble-stemcell:latest",
+				"",
 			)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -1,9 +1,11 @@
 package configserver
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +14,9 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/rkoster/instant-bosh/internal/certs"
+	"github.com/rkoster/instant-bosh/internal/tokencache"
 )
 
 // Client provides access to the config-server API
@@ -20,12 +25,20 @@ type Client struct {
 	uaaURL       string
 	clientID     string
 	clientSecret string
+	uaaCACert    string
 	httpClient   *http.Client
 
+	// director lists credential names for Find, see SetDirector
+	director VariableDirector
+
+	// tokenCache persists tokens across invocations, see SetTokenCache
+	tokenCache *tokencache.Cache
+
 	// Token caching
-	tokenMu     sync.Mutex
-	accessToken string
-	tokenExpiry time.Time
+	tokenMu sync.Mutex
+	token   tokencache.Token
+	// fixedToken is set by WithToken: the token is passed on as is and never refreshed
+	fixedToken bool
 }
 
 // Credential represents a credential stored in config-server
@@ -33,6 +46,22 @@ type Credential struct {
 	ID    string      `json:"id"`
 	Name  string      `json:"name"`
 	Value interface{} `json:"value"`
+
+	// Type is the declared or inferred type of a credential returned by Find
+	Type string `json:"type,omitempty"`
+}
+
+// ErrCredentialNotFound is returned when a credential does not exist
+var ErrCredentialNotFound = errors.New("credential not found")
+
+// StatusError is returned when config-server responds with an unexpected status
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
 }
 
 // ErrNotConfigured is returned when required environment variables are not set
@@ -78,7 +107,22 @@ func NewClientFromEnv() (*Client, error) {
 		return nil, &ErrNotConfigured{MissingVars: missing}
 	}
 
-	return NewClient(serverURL, uaaURL, clientID, clientSecret, caCert, uaaCACert)
+	// Like BOSH_CA_CERT, the CA certificates may be given as paths (print-env --format direnv)
+	caCert, err := certs.ReadCACert("CONFIG_SERVER_CA_CERT", caCert)
+	if err != nil {
+		return nil, err
+	}
+	uaaCACert, err = certs.ReadCACert("UAA_CA_CERT", uaaCACert)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewClient(serverURL, uaaURL, clientID, clientSecret, caCert, uaaCACert)
+	if err != nil {
+		return nil, err
+	}
+	client.SetTokenCache(tokencache.Default())
+	return client, nil
 }
 
 // NewClient creates a new config-server client
@@ -111,21 +155,63 @@ func NewClient(serverURL, uaaURL, clientID, clientSecret, caCert, uaaCACert stri
 		uaaURL:       strings.TrimSuffix(uaaURL, "/"),
 		clientID:     clientID,
 		clientSecret: clientSecret,
+		uaaCACert:    uaaCACert,
 		httpClient:   httpClient,
 	}, nil
 }
 
-// getAccessToken retrieves or refreshes the OAuth2 access token from UAA
-func (c *Client) getAccessToken() (string, error) {
+// UAAURL returns the URL of the UAA issuing config-server tokens
+func (c *Client) UAAURL() string {
+	return c.uaaURL
+}
+
+// UAACACert returns the CA certificate of the UAA
+func (c *Client) UAACACert() string {
+	return c.uaaCACert
+}
+
+// WithToken returns a client that authenticates with the given access token instead of
+// requesting its own, e.g. to pass on the token of a proxied request. Config-server
+// validates the token, so the caller's permissions apply.
+func (c *Client) WithToken(token string) *Client {
+	return &Client{
+		serverURL:  c.serverURL,
+		uaaURL:     c.uaaURL,
+		uaaCACert:  c.uaaCACert,
+		httpClient: c.httpClient,
+		director:   c.director,
+		token:      tokencache.Token{Type: "bearer", AccessToken: token, ExpiresAt: time.Now().Add(24 * time.Hour)},
+		fixedToken: true,
+	}
+}
+
+// SetTokenCache sets the cache persisting UAA tokens across invocations, shared with the
+// director client. Without a cache, tokens are only re-used by the same client.
+func (c *Client) SetTokenCache(cache *tokencache.Cache) {
+	c.tokenCache = cache
+}
+
+// getAccessToken returns the OAuth2 access token, from memory, the token cache or UAA.
+// With refresh, e.g. after config-server rejected the token, a new token is requested.
+func (c *Client) getAccessToken(refresh bool) (string, error) {
 	c.tokenMu.Lock()
 	defer c.tokenMu.Unlock()
 
-	// Return cached token if still valid (with 30 second buffer)
-	if c.accessToken != "" && time.Now().Add(30*time.Second).Before(c.tokenExpiry) {
-		return c.accessToken, nil
+	if c.fixedToken || (!refresh && c.token.Valid(time.Now())) {
+		return c.token.AccessToken, nil
 	}
 
-	// Request new token from UAA
+	key := tokencache.Key{UAAURL: c.uaaURL, Client: c.clientID, ClientSecret: c.clientSecret}
+	token, err := c.tokenCache.Token(key, refresh, c.requestToken)
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+	return c.token.AccessToken, nil
+}
+
+// requestToken requests a new access token from UAA with the client credentials grant
+func (c *Client) requestToken() (tokencache.Token, error) {
 	tokenURL := c.uaaURL + "/oauth/token"
 
 	data := url.Values{}
@@ -135,7 +221,7 @@ func (c *Client) getAccessToken() (string, error) {
 
 	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
 	if err != nil {
-		return "", fmt.Errorf("failed to create token request: %w", err)
+		return tokencache.Token{}, fmt.Errorf("failed to create token request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -143,17 +229,17 @@ func (c *Client) getAccessToken() (string, error) {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to request token from UAA: %w", err)
+		return tokencache.Token{}, fmt.Errorf("failed to request token from UAA: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read token response: %w", err)
+		return tokencache.Token{}, fmt.Errorf("failed to read token response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("UAA token request failed with status %d: %s", resp.StatusCode, string(body))
+		return tokencache.Token{}, fmt.Errorf("UAA token request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
 	var tokenResp struct {
@@ -162,13 +248,52 @@ func (c *Client) getAccessToken() (string, error) {
 		ExpiresIn   int    `json:"expires_in"`
 	}
 	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return "", fmt.Errorf("failed to parse token response: %w", err)
+		return tokencache.Token{}, fmt.Errorf("failed to parse token response: %w", err)
 	}
 
-	c.accessToken = tokenResp.AccessToken
-	c.tokenExpiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	return tokencache.Token{
+		Type:        tokenResp.TokenType,
+		AccessToken: tokenResp.AccessToken,
+		ExpiresAt:   time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+	}, nil
+}
 
-	return c.accessToken, nil
+// do sends a request authenticated with the access token. When config-server rejects a
+// token taken from the cache, e.g. one of a recreated director, a new token is requested
+// and the request is sent again.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	token, err := c.getAccessToken(false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized || c.fixedToken {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	token, err = c.getAccessToken(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+	}
+	retry.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err = c.httpClient.Do(retry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	return resp, nil
 }
 
 // Get retrieves a credential by name
@@ -178,12 +303,6 @@ func (c *Client) Get(name string) (*Credential, error) {
 		name = "/" + name
 	}
 
-	// Get access token
-	token, err := c.getAccessToken()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get access token: %w", err)
-	}
-
 	// Build URL: /v1/data?name=<name>
 	u, err := url.Parse(c.serverURL + "/v1/data")
 	if err != nil {
@@ -199,12 +318,11 @@ func (c *Client) Get(name string) (*Credential, error) {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -214,11 +332,11 @@ func (c *Client) Get(name string) (*Credential, error) {
 	}
 
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("credential not found: %s", name)
+		return nil, fmt.Errorf("%w: %s", ErrCredentialNotFound, name)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	// Config-server returns {"data": [...]} wrapper
@@ -230,20 +348,14 @@ func (c *Client) Get(name string) (*Credential, error) {
 	}
 
 	if len(wrapper.Data) == 0 {
-		return nil, fmt.Errorf("credential not found: %s", name)
+		return nil, fmt.Errorf("%w: %s", ErrCredentialNotFound, name)
 	}
 
 	return &wrapper.Data[0], nil
 }
 
-// ErrFindNotSupported is returned when Find is called but config-server doesn't support listing
-var ErrFindNotSupported = fmt.Errorf("config-server does not support listing credentials. Use 'bosh variables -d <deployment>' to see available credential names, then use 'ibosh creds get <name>'")
-
-// Find is not supported by config-server (unlike CredHub)
-// Config-server only supports getting credentials by exact name
-func (c *Client) Find(pathPrefix string) ([]Credential, error) {
-	return nil, ErrFindNotSupported
-}
+// ErrFindNotSupported is returned when Find is called without a director to list credentials from
+var ErrFindNotSupported = fmt.Errorf("config-server does not support listing credentials and no BOSH director is set to list them from. Use 'bosh variables -d <deployment>' to see available credential names, then use 'ibosh creds get <name>'")
 
 // Delete removes a credential by name from the config-server
 func (c *Client) Delete(name string) error {
@@ -252,12 +364,6 @@ func (c *Client) Delete(name string) error {
 		name = "/" + name
 	}
 
-	// Get access token
-	token, err := c.getAccessToken()
-	if err != nil {
-		return fmt.Errorf("failed to get access token: %w", err)
-	}
-
 	// Build URL: /v1/data?name=<name>
 	u, err := url.Parse(c.serverURL + "/v1/data")
 	if err != nil {
@@ -273,12 +379,11 @@ func (c *Client) Delete(name string) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
@@ -288,17 +393,80 @@ func (c *Client) Delete(name string) error {
 	}
 
 	if resp.StatusCode == http.StatusNotFound {
-		return fmt.Errorf("credential not found: %s", name)
+		return fmt.Errorf("%w: %s", ErrCredentialNotFound, name)
 	}
 
 	// Config-server returns 204 No Content on successful delete
 	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	return nil
 }
 
+// Set stores a value for a credential, creating a new version of it
+func (c *Client) Set(name string, value interface{}) (*Credential, error) {
+	return c.write("PUT", map[string]interface{}{"name": credentialName(name), "value": value})
+}
+
+// Generate lets config-server generate a value of the given type (password, certificate,
+// ssh or rsa) for a credential. parameters are the generation options of the type,
+// e.g. CertificateParameters, and may be nil.
+func (c *Client) Generate(name, credType string, parameters interface{}) (*Credential, error) {
+	payload := map[string]interface{}{"name": credentialName(name), "type": credType}
+	if parameters != nil {
+		payload["parameters"] = parameters
+	}
+	return c.write("POST", payload)
+}
+
+// write sends a PUT or POST request to /v1/data and returns the stored credential
+func (c *Client) write(method string, payload map[string]interface{}) (*Credential, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequest(method, c.serverURL+"/v1/data", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// Unlike GET, config-server returns the stored credential without a {"data": [...]} wrapper
+	var cred Credential
+	if err := json.Unmarshal(body, &cred); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &cred, nil
+}
+
+// credentialName ensures name starts with /
+func credentialName(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		return "/" + name
+	}
+	return name
+}
+
 // FormatValue formats a credential value for display
 func FormatValue(value interface{}) string {
 	switch v := value.(type) {
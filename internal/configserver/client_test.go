@@ -0,0 +1,214 @@
+package configserver_test
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rkoster/instant-bosh/internal/configserver"
+	"github.com/rkoster/instant-bosh/internal/tokencache"
+)
+
+// fakePEM returns a PEM block whose content identifies the credential it was generated for
+func fakePEM(blockType, content string) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: []byte(content)}))
+}
+
+// generateCertificate adds the certificate, private_key and ca fields of a generated
+// certificate to payload. The ca field is the certificate of the signing CA, taken from
+// creds, or the certificate itself when it has no CA.
+func generateCertificate(creds map[string]configserver.Credential, payload map[string]interface{}, generation int) {
+	name := payload["name"].(string)
+	certificate := fakePEM("CERTIFICATE", fmt.Sprintf("%s#%d", name, generation))
+	payload["certificate"] = certificate
+	payload["private_key"] = fakePEM("RSA PRIVATE KEY", fmt.Sprintf("%s#%d", name, generation))
+	payload["ca"] = certificate
+
+	parameters, _ := payload["parameters"].(map[string]interface{})
+	if ca, ok := parameters["ca"].(string); ok {
+		if value, ok := creds[ca].Value.(map[string]interface{}); ok {
+			payload["ca"] = value["certificate"]
+		}
+	}
+}
+
+// newConfigServer starts a fake config-server and UAA serving the given credentials. PUT
+// and POST requests store their payload in creds, with generated values for POST.
+func newConfigServer(t *testing.T, creds map[string]configserver.Credential) *configserver.Client {
+	t.Helper()
+	client, _ := newConfigServerWithLog(t, creds)
+	return client
+}
+
+// newConfigServerWithLog is newConfigServer, also returning a log of the modifying
+// requests ("<METHOD> <name>")
+func newConfigServerWithLog(t *testing.T, creds map[string]configserver.Credential) (*configserver.Client, *[]string) {
+	t.Helper()
+
+	var log []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 3600})
+	})
+	mux.HandleFunc("GET /v1/data", func(w http.ResponseWriter, r *http.Request) {
+		cred, ok := creds[r.URL.Query().Get("name")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": []configserver.Credential{cred}})
+	})
+	mux.HandleFunc("PUT /v1/data", func(w http.ResponseWriter, r *http.Request) {
+		var cred configserver.Credential
+		json.NewDecoder(r.Body).Decode(&cred)
+		cred.ID = "put"
+		creds[cred.Name] = cred
+		log = append(log, "PUT "+cred.Name)
+		json.NewEncoder(w).Encode(cred)
+	})
+	mux.HandleFunc("POST /v1/data", func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		cred := configserver.Credential{ID: "post", Name: payload["name"].(string), Value: payload}
+		if payload["type"] == "certificate" {
+			generateCertificate(creds, payload, len(log))
+		}
+		creds[cred.Name] = cred
+		log = append(log, "POST "+cred.Name)
+		json.NewEncoder(w).Encode(cred)
+	})
+
+	mux.HandleFunc("DELETE /v1/data", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		if _, ok := creds[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(creds, name)
+		log = append(log, "DELETE "+name)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	client, err := configserver.NewClient(server.URL, server.URL, "client", "secret", caCert, caCert)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	return client, &log
+}
+
+func TestGetSetDelete(t *testing.T) {
+	creds := map[string]configserver.Credential{}
+	client := newConfigServer(t, creds)
+
+	cred, err := client.Set("demo/admin_password", "fixed")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cred.ID != "put" || cred.Name != "/demo/admin_password" {
+		t.Errorf("unexpected credential %+v", cred)
+	}
+
+	cred, err = client.Get("/demo/admin_password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cred.Value != "fixed" {
+		t.Errorf("expected value fixed, got %v", cred.Value)
+	}
+
+	if _, err := client.Get("/missing"); !errors.Is(err, configserver.ErrCredentialNotFound) {
+		t.Errorf("expected ErrCredentialNotFound, got %v", err)
+	}
+}
+
+func TestTokenCache(t *testing.T) {
+	// The fake UAA issues numbered tokens, config-server only accepts the latest one
+	issued := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		issued++
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": fmt.Sprintf("token-%d", issued), "expires_in": 3600})
+	})
+	mux.HandleFunc("GET /v1/data", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", issued) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": []configserver.Credential{{Name: "/demo/password", Value: "secret"}}})
+	})
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	cache := tokencache.New(t.TempDir())
+	get := func() {
+		t.Helper()
+		client, err := configserver.NewClient(server.URL, server.URL, "client", "secret", caCert, caCert)
+		if err != nil {
+			t.Fatalf("creating client: %v", err)
+		}
+		client.SetTokenCache(cache)
+		if _, err := client.Get("/demo/password"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// A second client, like a later invocation, re-uses the cached token
+	get()
+	get()
+	if issued != 1 {
+		t.Errorf("expected 1 token request, got %d", issued)
+	}
+
+	// A rejected cached token, e.g. of a recreated director, is refreshed
+	issued++
+	get()
+	if issued != 3 {
+		t.Errorf("expected a new token after rejection, got %d token requests", issued)
+	}
+	key := tokencache.Key{UAAURL: server.URL, Client: "client", ClientSecret: "secret"}
+	if token, ok := cache.Get(key); !ok || token.AccessToken != "token-3" {
+		t.Errorf("expected refreshed token to be cached, got %+v", token)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	creds := map[string]configserver.Credential{}
+	client := newConfigServer(t, creds)
+
+	_, err := client.Generate("/demo/router_ssl", "certificate", configserver.CertificateParameters{
+		CommonName:       "router.example.com",
+		AlternativeNames: []string{"*.example.com"},
+		CA:               "/demo/ca",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	payload := creds["/demo/router_ssl"].Value.(map[string]interface{})
+	if payload["type"] != "certificate" {
+		t.Errorf("expected type certificate, got %v", payload["type"])
+	}
+	parameters := payload["parameters"].(map[string]interface{})
+	if parameters["common_name"] != "router.example.com" || parameters["ca"] != "/demo/ca" {
+		t.Errorf("unexpected parameters %v", parameters)
+	}
+	if _, ok := parameters["is_ca"]; ok {
+		t.Errorf("expected unset options to be omitted, got %v", parameters)
+	}
+
+	if _, err := client.Generate("/demo/password", "password", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := creds["/demo/password"].Value.(map[string]interface{})["parameters"]; ok {
+		t.Errorf("expected no parameters for a password")
+	}
+}
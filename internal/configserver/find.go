@@ -0,0 +1,154 @@
+package configserver
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	"gopkg.in/yaml.v3"
+)
+
+// VariableDirector is the part of the BOSH director API Find uses to enumerate the
+// credentials in config-server, implemented by boshdir.Director.
+type VariableDirector interface {
+	Deployments() ([]boshdir.Deployment, error)
+	ListConfigs(limit int, filter boshdir.ConfigsFilter) ([]boshdir.Config, error)
+}
+
+// configTypes are the config types that may reference credentials
+var configTypes = []string{"cloud", "runtime"}
+
+// placeholderPattern matches ((name)) and ((name.key)) placeholders
+var placeholderPattern = regexp.MustCompile(`\(\(!?([-/\w.]+)\)\)`)
+
+// SetDirector sets the director Find asks for the credentials used by deployments and configs
+func (c *Client) SetDirector(director VariableDirector) {
+	c.director = director
+}
+
+// Find lists the credentials whose name starts with pathPrefix. Config-server can't list
+// credentials, so the names are collected from the director: the variables of every
+// deployment (as listed by bosh variables) and the absolute variables of the cloud and
+// runtime configs. Types come from the variables sections of the manifests and configs,
+// or are derived from the value when not declared.
+func (c *Client) Find(pathPrefix string) ([]Credential, error) {
+	if c.director == nil {
+		return nil, ErrFindNotSupported
+	}
+	if pathPrefix != "" && !strings.HasPrefix(pathPrefix, "/") {
+		pathPrefix = "/" + pathPrefix
+	}
+
+	creds := map[string]*Credential{}
+	add := func(name, id, credType string) {
+		if !strings.HasPrefix(name, pathPrefix) {
+			return
+		}
+		cred, ok := creds[name]
+		if !ok {
+			cred = &Credential{Name: name}
+			creds[name] = cred
+		}
+		if cred.ID == "" {
+			cred.ID = id
+		}
+		if cred.Type == "" {
+			cred.Type = credType
+		}
+	}
+
+	deployments, err := c.director.Deployments()
+	if err != nil {
+		return nil, fmt.Errorf("listing deployments: %w", err)
+	}
+	for _, deployment := range deployments {
+		manifest, err := deployment.Manifest()
+		if err != nil {
+			return nil, fmt.Errorf("getting manifest of deployment %s: %w", deployment.Name(), err)
+		}
+		types, _ := variableDefinitions(manifest)
+
+		variables, err := deployment.Variables()
+		if err != nil {
+			return nil, fmt.Errorf("listing variables of deployment %s: %w", deployment.Name(), err)
+		}
+		for _, variable := range variables {
+			// Relative variable names are resolved to /<director>/<deployment>/<name>
+			credType, ok := types[variable.Name]
+			if !ok {
+				credType = types[path.Base(variable.Name)]
+			}
+			add(variable.Name, variable.ID, credType)
+		}
+	}
+
+	for _, configType := range configTypes {
+		configs, err := c.director.ListConfigs(1, boshdir.ConfigsFilter{Type: configType})
+		if err != nil {
+			return nil, fmt.Errorf("listing %s configs: %w", configType, err)
+		}
+		for _, config := range configs {
+			types, names := variableDefinitions(config.Content)
+			for _, name := range names {
+				// Relative names in configs are resolved per deployment and listed above
+				if strings.HasPrefix(name, "/") {
+					add(name, "", types[name])
+				}
+			}
+		}
+	}
+
+	// Fill in what the director does not know by reading the credential
+	result := make([]Credential, 0, len(creds))
+	for _, cred := range creds {
+		if cred.ID == "" || cred.Type == "" {
+			stored, err := c.Get(cred.Name)
+			if errors.Is(err, ErrCredentialNotFound) {
+				// Referenced by a config but not generated or set yet
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if cred.ID == "" {
+				cred.ID = stored.ID
+			}
+			if cred.Type == "" {
+				cred.Type = InferType(stored.Value)
+			}
+		}
+		result = append(result, *cred)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result, nil
+}
+
+// variableDefinitions returns the types of the variables declared in the variables section
+// of a manifest or config, and the names of all declared and referenced variables.
+func variableDefinitions(content string) (map[string]string, []string) {
+	var document struct {
+		Variables []struct {
+			Name string `yaml:"name"`
+			Type string `yaml:"type"`
+		} `yaml:"variables"`
+	}
+	// Unparsable content only loses the declared types
+	_ = yaml.Unmarshal([]byte(content), &document)
+
+	types := map[string]string{}
+	var names []string
+	for _, variable := range document.Variables {
+		types[variable.Name] = variable.Type
+		names = append(names, variable.Name)
+	}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(content, -1) {
+		// ((name.key)) references a key of the credential name
+		names = append(names, strings.SplitN(match[1], ".", 2)[0])
+	}
+	return types, names
+}
@@ -0,0 +1,95 @@
+package configserver_test
+
+import (
+	"testing"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshdirfakes "github.com/cloudfoundry/bosh-cli/v7/director/directorfakes"
+	"github.com/rkoster/instant-bosh/internal/configserver"
+)
+
+func TestFind(t *testing.T) {
+	client := newConfigServer(t, map[string]configserver.Credential{
+		"/instant-bosh/cf/uaa_login":      {ID: "7", Name: "/instant-bosh/cf/uaa_login", Value: map[string]interface{}{"username": "u", "password": "p"}},
+		"/instant-bosh/dns_healthcheck":   {ID: "8", Name: "/instant-bosh/dns_healthcheck", Value: map[string]interface{}{"ca": "ca", "certificate": "c", "private_key": "k"}},
+		"/instant-bosh/zookeeper/zk_pass": {ID: "9", Name: "/instant-bosh/zookeeper/zk_pass", Value: "secret"},
+	})
+
+	cf := &boshdirfakes.FakeDeployment{}
+	cf.NameReturns("cf")
+	cf.ManifestReturns(`
+variables:
+- name: cf_admin_password
+  type: password
+- name: router_ssl
+  type: certificate
+`, nil)
+	cf.VariablesReturns([]boshdir.VariableResult{
+		{ID: "1", Name: "/instant-bosh/cf/cf_admin_password"},
+		{ID: "2", Name: "/instant-bosh/cf/router_ssl"},
+		{ID: "3", Name: "/instant-bosh/cf/uaa_login"},
+	}, nil)
+
+	zookeeper := &boshdirfakes.FakeDeployment{}
+	zookeeper.NameReturns("zookeeper")
+	zookeeper.VariablesReturns([]boshdir.VariableResult{{ID: "4", Name: "/instant-bosh/zookeeper/zk_pass"}}, nil)
+
+	director := &boshdirfakes.FakeDirector{}
+	director.DeploymentsReturns([]boshdir.Deployment{cf, zookeeper}, nil)
+	director.ListConfigsStub = func(limit int, filter boshdir.ConfigsFilter) ([]boshdir.Config, error) {
+		if filter.Type != "runtime" {
+			return nil, nil
+		}
+		return []boshdir.Config{{Type: "runtime", Name: "dns", Content: `
+addons:
+- name: bosh-dns
+  jobs:
+  - properties:
+      health:
+        server:
+          tls: ((/instant-bosh/dns_healthcheck))
+          ca: ((/instant-bosh/dns_healthcheck.ca))
+          missing: ((/instant-bosh/not_generated))
+          relative: ((deployment_scoped))
+`}}, nil
+	}
+
+	client.SetDirector(director)
+
+	creds, err := client.Find("/instant-bosh")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []configserver.Credential{
+		{ID: "1", Name: "/instant-bosh/cf/cf_admin_password", Type: "password"},
+		{ID: "2", Name: "/instant-bosh/cf/router_ssl", Type: "certificate"},
+		{ID: "3", Name: "/instant-bosh/cf/uaa_login", Type: "user"},
+		{ID: "8", Name: "/instant-bosh/dns_healthcheck", Type: "certificate"},
+		{ID: "4", Name: "/instant-bosh/zookeeper/zk_pass", Type: "value"},
+	}
+	if len(creds) != len(expected) {
+		t.Fatalf("expected %d credentials, got %d: %+v", len(expected), len(creds), creds)
+	}
+	for i, cred := range creds {
+		if cred.ID != expected[i].ID || cred.Name != expected[i].Name || cred.Type != expected[i].Type {
+			t.Errorf("credential %d: expected %+v, got %+v", i, expected[i], cred)
+		}
+	}
+
+	creds, err = client.Find("instant-bosh/cf/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(creds) != 3 {
+		t.Errorf("expected 3 credentials under /instant-bosh/cf/, got %+v", creds)
+	}
+}
+
+func TestFindWithoutDirector(t *testing.T) {
+	client := newConfigServer(t, nil)
+
+	if _, err := client.Find(""); err != configserver.ErrFindNotSupported {
+		t.Errorf("expected ErrFindNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,410 @@
+package configserver
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Variable is a variable declared in the variables section of a manifest
+type Variable struct {
+	Name    string                 `yaml:"name"`
+	Type    string                 `yaml:"type"`
+	Options map[string]interface{} `yaml:"options"`
+}
+
+// CA returns the name of the CA signing a certificate variable, or "" if there is none
+func (v Variable) CA() string {
+	ca, _ := v.Options["ca"].(string)
+	return ca
+}
+
+// IsCA reports whether a variable is a CA certificate
+func (v Variable) IsCA() bool {
+	isCA, _ := v.Options["is_ca"].(bool)
+	return v.Type == "certificate" && isCA
+}
+
+// ManifestVariables returns the variables declared in a manifest
+func ManifestVariables(manifest string) ([]Variable, error) {
+	var document struct {
+		Variables []Variable `yaml:"variables"`
+	}
+	if err := yaml.Unmarshal([]byte(manifest), &document); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return document.Variables, nil
+}
+
+// RotationPlan selects the variables to rotate: those of the given type whose name matches
+// the glob pattern (both optional), and the certificates signed by a selected CA, which
+// would otherwise keep the old CA. Every CA is ordered before the certificates it signs.
+func RotationPlan(variables []Variable, credType, pattern string) ([]Variable, error) {
+	selected := map[string]bool{}
+	for _, variable := range variables {
+		if credType != "" && variable.Type != credType {
+			continue
+		}
+		if pattern != "" {
+			match, err := path.Match(pattern, variable.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid name pattern %q: %w", pattern, err)
+			}
+			if !match {
+				continue
+			}
+		}
+		selected[variable.Name] = true
+	}
+
+	// Add the certificates signed by selected CAs, including those of intermediate CAs
+	for added := true; added; {
+		added = false
+		for _, variable := range variables {
+			if !selected[variable.Name] && variable.CA() != "" && selected[variable.CA()] {
+				selected[variable.Name] = true
+				added = true
+			}
+		}
+	}
+
+	byName := map[string]Variable{}
+	for _, variable := range variables {
+		byName[variable.Name] = variable
+	}
+
+	var plan []Variable
+	visited := map[string]bool{}
+	var visit func(variable Variable)
+	visit = func(variable Variable) {
+		if visited[variable.Name] {
+			return
+		}
+		visited[variable.Name] = true
+		if ca, ok := byName[variable.CA()]; ok && selected[ca.Name] {
+			visit(ca)
+		}
+		plan = append(plan, variable)
+	}
+	for _, variable := range variables {
+		if selected[variable.Name] {
+			visit(variable)
+		}
+	}
+	return plan, nil
+}
+
+// Regeneratable reports whether config-server can generate values of a variable's type
+func (v Variable) Regeneratable() bool {
+	return slices.Contains(GenerateTypes, v.Type)
+}
+
+// nextCASuffix is appended to the name of a CA for its new version while it transitions
+const nextCASuffix = "_next"
+
+// RotationStage is a set of credential changes that is deployed before the next stage
+type RotationStage struct {
+	Description string
+	apply       func() error
+}
+
+// Apply makes the credential changes of the stage
+func (s RotationStage) Apply() error {
+	return s.apply()
+}
+
+// RotationStages splits the rotation of plan (see RotationPlan) for a deployment whose
+// credentials are stored under namespace into stages, each to be followed by a deploy.
+// Without CAs signing other rotated certificates, all variables are rotated in one stage.
+// Otherwise the CAs transition in three stages, so instances updated by the rolling
+// deploys and those not yet updated trust each other's certificates throughout:
+//  1. a new CA is generated and trusted next to the old one (the ca field of the CA and
+//     of the certificates it signs), while the old CA still signs
+//  2. the new CA signs: the CA and its certificates are replaced, both CAs stay trusted,
+//     and the other variables of the plan are rotated
+//  3. the old CA is no longer trusted
+//
+// CAs signed by a rotated CA are regenerated in stage 2 like the certificates it signs.
+func (c *Client) RotationStages(namespace string, plan []Variable) []RotationStage {
+	planned := map[string]bool{}
+	for _, variable := range plan {
+		planned[variable.Name] = true
+	}
+	signs := map[string]bool{}
+	for _, variable := range plan {
+		signs[variable.CA()] = true
+	}
+
+	var transitions []*caTransition
+	byCA := map[string]*caTransition{}
+	for _, variable := range plan {
+		if variable.IsCA() && signs[variable.Name] && !planned[variable.CA()] {
+			transition := &caTransition{client: c, namespace: namespace, ca: variable}
+			transitions = append(transitions, transition)
+			byCA[variable.Name] = transition
+		}
+	}
+	for _, variable := range plan {
+		if transition, ok := byCA[variable.CA()]; ok {
+			transition.signed = append(transition.signed, variable)
+		}
+	}
+
+	rotateOthers := func() error {
+		for _, variable := range plan {
+			if _, ok := byCA[variable.Name]; ok {
+				continue
+			}
+			if _, ok := byCA[variable.CA()]; ok {
+				continue
+			}
+			if err := c.Rotate(namespace, variable); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(transitions) == 0 {
+		return []RotationStage{{Description: "rotate the variables", apply: rotateOthers}}
+	}
+
+	forEach := func(step func(*caTransition) error) func() error {
+		return func() error {
+			for _, transition := range transitions {
+				if err := step(transition); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return []RotationStage{
+		{Description: "trust the new CAs next to the old ones", apply: forEach((*caTransition).trustNext)},
+		{Description: "sign with the new CAs and rotate the other variables", apply: func() error {
+			if err := forEach((*caTransition).signWithNext)(); err != nil {
+				return err
+			}
+			return rotateOthers()
+		}},
+		{Description: "stop trusting the old CAs", apply: forEach((*caTransition).dropPrevious)},
+	}
+}
+
+// caTransition replaces a CA and the certificates it signs in three stages
+type caTransition struct {
+	client    *Client
+	namespace string
+	ca        Variable
+	signed    []Variable
+
+	// caTrusted and signedTrusted are the ca fields of the CA and of the certificates it
+	// signs while both CAs are trusted
+	caTrusted, signedTrusted string
+	// next is the new version of the CA
+	next map[string]interface{}
+}
+
+// trustNext generates the new CA, or reuses the one of an interrupted rotation, and adds
+// it to the trusted CAs of the CA and its certificates
+func (t *caTransition) trustNext() error {
+	name := variableName(t.namespace, t.ca.Name)
+	nextName := name + nextCASuffix
+
+	next, err := t.client.Get(nextName)
+	if errors.Is(err, ErrCredentialNotFound) {
+		next, err = t.client.Generate(nextName, "certificate", certificateParameters(t.namespace, t.ca))
+	}
+	if err != nil {
+		return fmt.Errorf("generating the new version of %s: %w", name, err)
+	}
+	if t.next, err = certificateValue(next); err != nil {
+		return err
+	}
+
+	current, err := t.getCertificate(name)
+	if err != nil {
+		return err
+	}
+	t.caTrusted = caBundle(current["ca"], t.next["ca"])
+	t.signedTrusted = caBundle(current["certificate"], t.next["certificate"])
+
+	return t.setAllTrusted(t.caTrusted, t.signedTrusted)
+}
+
+// signWithNext replaces the CA with its new version and regenerates the certificates it
+// signs, which keep trusting both CAs
+func (t *caTransition) signWithNext() error {
+	name := variableName(t.namespace, t.ca.Name)
+	next := map[string]interface{}{
+		"certificate": t.next["certificate"],
+		"private_key": t.next["private_key"],
+		"ca":          t.caTrusted,
+	}
+	if _, err := t.client.Set(name, next); err != nil {
+		return fmt.Errorf("replacing %s: %w", name, err)
+	}
+
+	for _, variable := range t.signed {
+		if err := t.client.Rotate(t.namespace, variable); err != nil {
+			return err
+		}
+		if err := t.setTrusted(variableName(t.namespace, variable.Name), t.signedTrusted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropPrevious removes the old CA from the trusted CAs of the CA and its certificates
+func (t *caTransition) dropPrevious() error {
+	if err := t.setAllTrusted(caBundle(t.next["ca"]), caBundle(t.next["certificate"])); err != nil {
+		return err
+	}
+
+	nextName := variableName(t.namespace, t.ca.Name) + nextCASuffix
+	if err := t.client.Delete(nextName); err != nil && !errors.Is(err, ErrCredentialNotFound) {
+		return fmt.Errorf("deleting %s: %w", nextName, err)
+	}
+	return nil
+}
+
+// setAllTrusted replaces the ca fields of the CA and of the certificates it signs
+func (t *caTransition) setAllTrusted(caTrusted, signedTrusted string) error {
+	if err := t.setTrusted(variableName(t.namespace, t.ca.Name), caTrusted); err != nil {
+		return err
+	}
+	for _, variable := range t.signed {
+		if err := t.setTrusted(variableName(t.namespace, variable.Name), signedTrusted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTrusted replaces the ca field of a certificate credential
+func (t *caTransition) setTrusted(name, trusted string) error {
+	value, err := t.getCertificate(name)
+	if err != nil {
+		return err
+	}
+	value["ca"] = trusted
+	if _, err := t.client.Set(name, value); err != nil {
+		return fmt.Errorf("updating the trusted CAs of %s: %w", name, err)
+	}
+	return nil
+}
+
+func (t *caTransition) getCertificate(name string) (map[string]interface{}, error) {
+	cred, err := t.client.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("getting %s: %w", name, err)
+	}
+	return certificateValue(cred)
+}
+
+// certificateValue returns the certificate, private_key and ca fields of a certificate credential
+func certificateValue(cred *Credential) (map[string]interface{}, error) {
+	value, ok := cred.Value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate", cred.Name)
+	}
+	result := map[string]interface{}{}
+	for _, key := range []string{"certificate", "private_key", "ca"} {
+		field, _ := value[key].(string)
+		result[key] = field
+	}
+	return result, nil
+}
+
+// caBundle concatenates the PEM certificates of bundles, without duplicates
+func caBundle(bundles ...interface{}) string {
+	var result []string
+	for _, bundle := range bundles {
+		value, _ := bundle.(string)
+		rest := []byte(value)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			encoded := strings.TrimSpace(string(pem.EncodeToMemory(block)))
+			if !slices.Contains(result, encoded) {
+				result = append(result, encoded)
+			}
+		}
+	}
+	if len(result) == 0 {
+		return ""
+	}
+	return strings.Join(result, "\n") + "\n"
+}
+
+// Rotate replaces the credential of a manifest variable of a deployment whose credentials
+// are stored under namespace (e.g. /instant-bosh/cf). Types config-server can generate are
+// regenerated with the options of the variable, others are deleted so the director
+// generates them on the next deploy. Rotate CAs before the certificates they sign.
+func (c *Client) Rotate(namespace string, variable Variable) error {
+	name := variableName(namespace, variable.Name)
+
+	if err := c.Delete(name); err != nil && !errors.Is(err, ErrCredentialNotFound) {
+		return fmt.Errorf("deleting %s: %w", name, err)
+	}
+	if !variable.Regeneratable() {
+		return nil
+	}
+
+	var parameters interface{}
+	if variable.Type == "certificate" {
+		parameters = certificateParameters(namespace, variable)
+	}
+
+	if _, err := c.Generate(name, variable.Type, parameters); err != nil {
+		return fmt.Errorf("generating %s: %w", name, err)
+	}
+	return nil
+}
+
+// certificateParameters returns the generation options of a certificate variable
+func certificateParameters(namespace string, variable Variable) CertificateParameters {
+	certificate := CertificateParameters{
+		CommonName:       stringOption(variable.Options, "common_name"),
+		AlternativeNames: stringsOption(variable.Options, "alternative_names"),
+		ExtendedKeyUsage: stringsOption(variable.Options, "extended_key_usage"),
+		IsCA:             variable.IsCA(),
+	}
+	if ca := variable.CA(); ca != "" {
+		certificate.CA = variableName(namespace, ca)
+	}
+	return certificate
+}
+
+// variableName resolves a manifest variable name against the namespace of its deployment
+func variableName(namespace, name string) string {
+	if strings.HasPrefix(name, "/") {
+		return name
+	}
+	return strings.TrimSuffix(namespace, "/") + "/" + name
+}
+
+func stringOption(options map[string]interface{}, key string) string {
+	value, _ := options[key].(string)
+	return value
+}
+
+func stringsOption(options map[string]interface{}, key string) []string {
+	values, _ := options[key].([]interface{})
+	var result []string
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
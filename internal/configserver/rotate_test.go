@@ -0,0 +1,193 @@
+package configserver_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rkoster/instant-bosh/internal/configserver"
+)
+
+const rotateManifest = `
+variables:
+- name: cf_admin_password
+  type: password
+- name: uaa_admin
+  type: user
+- name: router_ssl
+  type: certificate
+  options:
+    ca: service_cf_internal_ca
+    common_name: router.service.cf.internal
+    alternative_names: [router.service.cf.internal, "*.router.service.cf.internal"]
+    extended_key_usage: [server_auth]
+- name: service_cf_internal_ca
+  type: certificate
+  options:
+    is_ca: true
+    common_name: internalCA
+- name: uaa_ssl
+  type: certificate
+  options:
+    ca: uaa_ca
+    common_name: uaa.service.cf.internal
+- name: uaa_ca
+  type: certificate
+  options:
+    is_ca: true
+    common_name: uaaCA
+`
+
+func planNames(plan []configserver.Variable) []string {
+	var names []string
+	for _, variable := range plan {
+		names = append(names, variable.Name)
+	}
+	return names
+}
+
+func TestRotationPlan(t *testing.T) {
+	variables, err := configserver.ManifestVariables(rotateManifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		credType string
+		pattern  string
+		expected []string
+	}{
+		{credType: "password", expected: []string{"cf_admin_password"}},
+		// The CA is rotated first and takes the certificates it signs along
+		{pattern: "service_cf_internal_ca", expected: []string{"service_cf_internal_ca", "router_ssl"}},
+		{pattern: "uaa_*", expected: []string{"uaa_admin", "uaa_ca", "uaa_ssl"}},
+		{credType: "certificate", pattern: "*_ssl", expected: []string{"router_ssl", "uaa_ssl"}},
+		{pattern: "missing", expected: nil},
+	}
+
+	for _, tt := range tests {
+		plan, err := configserver.RotationPlan(variables, tt.credType, tt.pattern)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if names := planNames(plan); !reflect.DeepEqual(names, tt.expected) {
+			t.Errorf("RotationPlan(%q, %q) = %v, want %v", tt.credType, tt.pattern, names, tt.expected)
+		}
+	}
+
+	if _, err := configserver.RotationPlan(variables, "", "["); err == nil {
+		t.Error("expected error for an invalid pattern")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	creds := map[string]configserver.Credential{
+		"/instant-bosh/cf/service_cf_internal_ca": {Name: "/instant-bosh/cf/service_cf_internal_ca", Value: map[string]interface{}{}},
+		"/instant-bosh/cf/router_ssl":             {Name: "/instant-bosh/cf/router_ssl", Value: map[string]interface{}{}},
+		"/instant-bosh/cf/uaa_admin":              {Name: "/instant-bosh/cf/uaa_admin", Value: map[string]interface{}{}},
+	}
+	client, log := newConfigServerWithLog(t, creds)
+
+	variables, _ := configserver.ManifestVariables(rotateManifest)
+	plan, _ := configserver.RotationPlan(variables, "", "service_cf_internal_ca")
+	userPlan, _ := configserver.RotationPlan(variables, "user", "")
+
+	for _, variable := range append(plan, userPlan...) {
+		if err := client.Rotate("/instant-bosh/cf", variable); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	expected := []string{
+		"DELETE /instant-bosh/cf/service_cf_internal_ca",
+		"POST /instant-bosh/cf/service_cf_internal_ca",
+		"DELETE /instant-bosh/cf/router_ssl",
+		"POST /instant-bosh/cf/router_ssl",
+		// Config-server can't generate users, the director does on the next deploy
+		"DELETE /instant-bosh/cf/uaa_admin",
+	}
+	if !reflect.DeepEqual(*log, expected) {
+		t.Errorf("expected requests %v, got %v", expected, *log)
+	}
+
+	// The fake stores the generation request as value
+	parameters := creds["/instant-bosh/cf/router_ssl"].Value.(map[string]interface{})["parameters"].(map[string]interface{})
+	if parameters["ca"] != "/instant-bosh/cf/service_cf_internal_ca" || parameters["common_name"] != "router.service.cf.internal" {
+		t.Errorf("unexpected certificate parameters %v", parameters)
+	}
+	if names := parameters["alternative_names"].([]interface{}); len(names) != 2 {
+		t.Errorf("expected 2 alternative names, got %v", names)
+	}
+}
+
+func TestRotationStages(t *testing.T) {
+	oldCA := fakePEM("CERTIFICATE", "old ca")
+	creds := map[string]configserver.Credential{
+		"/instant-bosh/cf/service_cf_internal_ca": {Name: "/instant-bosh/cf/service_cf_internal_ca", Value: map[string]interface{}{
+			"certificate": oldCA, "private_key": fakePEM("RSA PRIVATE KEY", "old ca"), "ca": oldCA,
+		}},
+		"/instant-bosh/cf/router_ssl": {Name: "/instant-bosh/cf/router_ssl", Value: map[string]interface{}{
+			"certificate": fakePEM("CERTIFICATE", "old router"), "private_key": fakePEM("RSA PRIVATE KEY", "old router"), "ca": oldCA,
+		}},
+	}
+	client, log := newConfigServerWithLog(t, creds)
+	field := func(name, key string) string {
+		return creds["/instant-bosh/cf/"+name].Value.(map[string]interface{})[key].(string)
+	}
+
+	variables, _ := configserver.ManifestVariables(rotateManifest)
+	plan, _ := configserver.RotationPlan(variables, "", "service_cf_internal_ca")
+	stages := client.RotationStages("/instant-bosh/cf", plan)
+	if len(stages) != 3 {
+		t.Fatalf("expected 3 stages, got %d", len(stages))
+	}
+
+	// Both CAs are trusted while the old one still signs
+	if err := stages[0].Apply(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	newCA := field("service_cf_internal_ca_next", "certificate")
+	both := oldCA + newCA
+	if field("service_cf_internal_ca", "certificate") != oldCA {
+		t.Error("expected the old CA to sign until the second stage")
+	}
+	if field("service_cf_internal_ca", "ca") != both || field("router_ssl", "ca") != both {
+		t.Errorf("expected both CAs to be trusted, got %q and %q", field("service_cf_internal_ca", "ca"), field("router_ssl", "ca"))
+	}
+
+	// The new CA signs, both stay trusted
+	if err := stages[1].Apply(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if field("service_cf_internal_ca", "certificate") != newCA {
+		t.Error("expected the new CA to replace the old one")
+	}
+	if field("router_ssl", "certificate") == fakePEM("CERTIFICATE", "old router") {
+		t.Error("expected router_ssl to be regenerated")
+	}
+	if field("service_cf_internal_ca", "ca") != both || field("router_ssl", "ca") != both {
+		t.Errorf("expected both CAs to stay trusted, got %q and %q", field("service_cf_internal_ca", "ca"), field("router_ssl", "ca"))
+	}
+
+	// Only the new CA is trusted
+	*log = nil
+	if err := stages[2].Apply(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if field("service_cf_internal_ca", "ca") != newCA || field("router_ssl", "ca") != newCA {
+		t.Errorf("expected only the new CA to be trusted, got %q and %q", field("service_cf_internal_ca", "ca"), field("router_ssl", "ca"))
+	}
+	expected := []string{
+		"PUT /instant-bosh/cf/service_cf_internal_ca",
+		"PUT /instant-bosh/cf/router_ssl",
+		"DELETE /instant-bosh/cf/service_cf_internal_ca_next",
+	}
+	if !reflect.DeepEqual(*log, expected) {
+		t.Errorf("expected requests %v, got %v", expected, *log)
+	}
+
+	// Without a rotated CA signing other variables everything rotates in one stage
+	passwordPlan, _ := configserver.RotationPlan(variables, "password", "")
+	if stages := client.RotationStages("/instant-bosh/cf", passwordPlan); len(stages) != 1 {
+		t.Errorf("expected 1 stage, got %d", len(stages))
+	}
+}
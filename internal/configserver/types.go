@@ -0,0 +1,94 @@
+package configserver
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetTypes are the credential types accepted by ParseValue
+var SetTypes = []string{"value", "password", "json", "user", "certificate", "ssh", "rsa"}
+
+// GenerateTypes are the credential types config-server can generate
+var GenerateTypes = []string{"password", "certificate", "ssh", "rsa"}
+
+// requiredKeys are the keys a value of a structured type must have
+var requiredKeys = map[string][]string{
+	"user":        {"username", "password"},
+	"certificate": {"certificate", "private_key"},
+	"ssh":         {"public_key", "private_key"},
+	"rsa":         {"public_key", "private_key"},
+}
+
+// CertificateParameters are the generation options of a certificate, as in the
+// variables section of a BOSH manifest
+type CertificateParameters struct {
+	CommonName       string   `json:"common_name,omitempty"`
+	AlternativeNames []string `json:"alternative_names,omitempty"`
+	IsCA             bool     `json:"is_ca,omitempty"`
+	// CA is the name of the CA credential signing the certificate
+	CA               string   `json:"ca,omitempty"`
+	ExtendedKeyUsage []string `json:"extended_key_usage,omitempty"`
+}
+
+// InferType returns the CredHub credential type matching the shape of a value, as
+// config-server stores values without their type
+func InferType(value interface{}) string {
+	v, ok := value.(map[string]interface{})
+	if !ok {
+		if _, ok := value.(string); ok {
+			return "value"
+		}
+		return "json"
+	}
+
+	has := func(keys ...string) bool {
+		for _, key := range keys {
+			if _, ok := v[key]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case has("certificate", "private_key"), has("ca", "certificate"):
+		return "certificate"
+	case has("public_key", "private_key", "public_key_fingerprint"):
+		return "ssh"
+	case has("public_key", "private_key"):
+		return "rsa"
+	case has("username", "password"):
+		return "user"
+	default:
+		return "json"
+	}
+}
+
+// ParseValue converts the content given for a credential of the given type to the value
+// stored in config-server. Value and password credentials are stored as strings, the
+// other types as the JSON or YAML object in content.
+func ParseValue(credType string, content string) (interface{}, error) {
+	switch credType {
+	case "value", "password":
+		return strings.TrimSuffix(content, "\n"), nil
+	case "json", "user", "certificate", "ssh", "rsa":
+	default:
+		return nil, fmt.Errorf("unsupported credential type %q (supported: %s)", credType, strings.Join(SetTypes, ", "))
+	}
+
+	// YAML is a superset of JSON, so both are accepted
+	var value map[string]interface{}
+	if err := yaml.Unmarshal([]byte(content), &value); err != nil {
+		return nil, fmt.Errorf("parsing %s value: %w", credType, err)
+	}
+	if value == nil {
+		return nil, fmt.Errorf("%s value must be an object", credType)
+	}
+	for _, key := range requiredKeys[credType] {
+		if _, ok := value[key]; !ok {
+			return nil, fmt.Errorf("%s value is missing %s", credType, key)
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,60 @@
+package configserver_test
+
+import (
+	"testing"
+
+	"github.com/rkoster/instant-bosh/internal/configserver"
+)
+
+func TestInferType(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{value: "secret", expected: "value"},
+		{value: map[string]interface{}{"ca": "", "certificate": "", "private_key": ""}, expected: "certificate"},
+		{value: map[string]interface{}{"public_key": "", "private_key": "", "public_key_fingerprint": ""}, expected: "ssh"},
+		{value: map[string]interface{}{"public_key": "", "private_key": ""}, expected: "rsa"},
+		{value: map[string]interface{}{"username": "", "password": ""}, expected: "user"},
+		{value: map[string]interface{}{"key": "value"}, expected: "json"},
+	}
+
+	for _, tt := range tests {
+		if actual := configserver.InferType(tt.value); actual != tt.expected {
+			t.Errorf("InferType(%v) = %s, want %s", tt.value, actual, tt.expected)
+		}
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	value, err := configserver.ParseValue("password", "secret\n")
+	if err != nil || value != "secret" {
+		t.Errorf("expected password secret, got %v (%v)", value, err)
+	}
+
+	value, err = configserver.ParseValue("user", `{"username": "admin", "password": "secret"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value.(map[string]interface{})["username"] != "admin" {
+		t.Errorf("unexpected user value %v", value)
+	}
+
+	value, err = configserver.ParseValue("certificate", "certificate: |\n  -----BEGIN CERTIFICATE-----\nprivate_key: key\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value.(map[string]interface{})["private_key"] != "key" {
+		t.Errorf("unexpected certificate value %v", value)
+	}
+
+	for _, tt := range []struct{ credType, content string }{
+		{"certificate", "certificate: cert"},
+		{"json", "just a string"},
+		{"unknown", "x"},
+	} {
+		if _, err := configserver.ParseValue(tt.credType, tt.content); err == nil {
+			t.Errorf("ParseValue(%s, %q): expected error", tt.credType, tt.content)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package configserver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Export returns the values of the credentials under pathPrefix in the format of a BOSH
+// vars-store file. Keys are the credential names relative to pathPrefix, so the result
+// can also be passed to bosh deploy with --vars-file; without a prefix they are absolute.
+// Like Find, this needs a director to list the credentials.
+func (c *Client) Export(pathPrefix string) (map[string]interface{}, error) {
+	pathPrefix = strings.TrimSuffix(pathPrefix, "/")
+	if pathPrefix != "" && !strings.HasPrefix(pathPrefix, "/") {
+		pathPrefix = "/" + pathPrefix
+	}
+
+	creds, err := c.Find(pathPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := map[string]interface{}{}
+	for _, cred := range creds {
+		key := cred.Name
+		if pathPrefix != "" {
+			var ok bool
+			// Find matches any name starting with the prefix, e.g. /cf-other for /cf
+			if key, ok = strings.CutPrefix(cred.Name, pathPrefix+"/"); !ok {
+				continue
+			}
+		}
+
+		stored, err := c.Get(cred.Name)
+		if err != nil {
+			return nil, fmt.Errorf("getting %s: %w", cred.Name, err)
+		}
+		vars[key] = stored.Value
+	}
+	return vars, nil
+}
+
+// Import stores the values of a vars-store file read by Export. Relative keys are
+// resolved against pathPrefix. It returns the names of the stored credentials.
+func (c *Client) Import(vars map[string]interface{}, pathPrefix string) ([]string, error) {
+	pathPrefix = strings.TrimSuffix(pathPrefix, "/")
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name := key
+		if !strings.HasPrefix(key, "/") {
+			if pathPrefix == "" {
+				return names, fmt.Errorf("credential %s has a relative name, a path to import it to is required", key)
+			}
+			name = pathPrefix + "/" + key
+		}
+
+		cred, err := c.Set(name, vars[key])
+		if err != nil {
+			return names, fmt.Errorf("setting %s: %w", name, err)
+		}
+		names = append(names, cred.Name)
+	}
+	return names, nil
+}
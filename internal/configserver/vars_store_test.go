@@ -0,0 +1,70 @@
+package configserver_test
+
+import (
+	"reflect"
+	"testing"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshdirfakes "github.com/cloudfoundry/bosh-cli/v7/director/directorfakes"
+	"github.com/rkoster/instant-bosh/internal/configserver"
+)
+
+func TestExportImport(t *testing.T) {
+	ca := map[string]interface{}{"ca": "ca", "certificate": "ca", "private_key": "key"}
+	creds := map[string]configserver.Credential{
+		"/instant-bosh/cf/cf_admin_password": {ID: "1", Name: "/instant-bosh/cf/cf_admin_password", Value: "secret"},
+		"/instant-bosh/cf/router_ca":         {ID: "2", Name: "/instant-bosh/cf/router_ca", Value: ca},
+		"/instant-bosh/cf-other/password":    {ID: "3", Name: "/instant-bosh/cf-other/password", Value: "other"},
+	}
+	client := newConfigServer(t, creds)
+
+	deployment := &boshdirfakes.FakeDeployment{}
+	deployment.VariablesReturns([]boshdir.VariableResult{
+		{ID: "1", Name: "/instant-bosh/cf/cf_admin_password"},
+		{ID: "2", Name: "/instant-bosh/cf/router_ca"},
+		{ID: "3", Name: "/instant-bosh/cf-other/password"},
+	}, nil)
+	director := &boshdirfakes.FakeDirector{}
+	director.DeploymentsReturns([]boshdir.Deployment{deployment}, nil)
+	client.SetDirector(director)
+
+	vars, err := client.Export("/instant-bosh/cf/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"cf_admin_password": "secret", "router_ca": ca}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Errorf("expected %v, got %v", expected, vars)
+	}
+
+	all, err := client.Export("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if all["/instant-bosh/cf-other/password"] != "other" {
+		t.Errorf("expected absolute names without a path, got %v", all)
+	}
+
+	// Recreated environment
+	for name := range creds {
+		delete(creds, name)
+	}
+
+	names, err := client.Import(vars, "/instant-bosh/cf")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"/instant-bosh/cf/cf_admin_password", "/instant-bosh/cf/router_ca"}) {
+		t.Errorf("unexpected imported names %v", names)
+	}
+	if creds["/instant-bosh/cf/cf_admin_password"].Value != "secret" {
+		t.Errorf("expected password to be restored, got %v", creds["/instant-bosh/cf/cf_admin_password"])
+	}
+	if !reflect.DeepEqual(creds["/instant-bosh/cf/router_ca"].Value, ca) {
+		t.Errorf("expected CA to be restored, got %v", creds["/instant-bosh/cf/router_ca"])
+	}
+
+	if _, err := client.Import(map[string]interface{}{"relative": "x"}, ""); err == nil {
+		t.Error("expected error for relative names without a path")
+	}
+}
@@ -12,6 +12,8 @@ type ContainerInfo struct {
 	Name    string
 	Created time.Time
 	Network string
+	// IP is the address of the container on the network, if known
+	IP string
 }
 
 // ImageInfo contains information about the container's source OCI image
@@ -59,6 +61,10 @@ type CPI interface {
 	GetDirectorPort() string
 	GetSSHPort() string
 
+	// EnvironmentName names the local state directory of this environment
+	// (~/.local/state/ibosh/<name>), e.g. "docker" or "incus-local".
+	EnvironmentName() string
+
 	// Network access method
 	// Returns true if direct network access is available to the container
 	// Returns false if BOSH_ALL_PROXY (jumpbox) is needed
@@ -85,6 +91,12 @@ type CPI interface {
 	// GetTargetImageRef returns the OCI image reference that would be used for new containers.
 	GetTargetImageRef() string
 
+	// Platform returns the platform (e.g. "linux/arm64") images are selected for
+	// from multi-arch manifest lists.
+	// For Docker CPI: the explicit platform if set, otherwise the Docker daemon platform
+	// For Incus CPI: the Incus server platform
+	Platform(ctx context.Context) (string, error)
+
 	// SetResolvedImage sets the resolved (digest-pinned) image reference for container creation.
 	// This should be called before Start() to ensure the container is created with a digest-pinned
 	// image reference, enabling accurate upgrade comparisons.
@@ -98,4 +110,6 @@ type StartOptions struct {
 	SkipUpdate         bool
 	SkipStemcellUpload bool
 	CustomImage        string
+	Refresh            bool   // Bypass the registry cache and re-fetch image metadata
+	Platform           string // Explicit image platform (e.g. "linux/arm64"), empty for the host platform
 }
@@ -44,6 +44,16 @@ type FakeCPI struct {
 	ensurePrerequisitesReturnsOnCall map[int]struct {
 		result1 error
 	}
+	EnvironmentNameStub        func() string
+	environmentNameMutex       sync.RWMutex
+	environmentNameArgsForCall []struct {
+	}
+	environmentNameReturns struct {
+		result1 string
+	}
+	environmentNameReturnsOnCall map[int]struct {
+		result1 string
+	}
 	ExecCommandStub        func(context.Context, string, []string) (string, error)
 	execCommandMutex       sync.RWMutex
 	execCommandArgsForCall []struct {
@@ -233,6 +243,19 @@ type FakeCPI struct {
 		result1 bool
 		result2 error
 	}
+	PlatformStub        func(context.Context) (string, error)
+	platformMutex       sync.RWMutex
+	platformArgsForCall []struct {
+		arg1 context.Context
+	}
+	platformReturns struct {
+		result1 string
+		result2 error
+	}
+	platformReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
 	RemoveContainerStub        func(context.Context) error
 	removeContainerMutex       sync.RWMutex
 	removeContainerArgsForCall []struct {
@@ -490,6 +513,59 @@ func (fake *FakeCPI) EnsurePrerequisitesReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeCPI) EnvironmentName() string {
+	fake.environmentNameMutex.Lock()
+	ret, specificReturn := fake.environmentNameReturnsOnCall[len(fake.environmentNameArgsForCall)]
+	fake.environmentNameArgsForCall = append(fake.environmentNameArgsForCall, struct {
+	}{})
+	stub := fake.EnvironmentNameStub
+	fakeReturns := fake.environmentNameReturns
+	fake.recordInvocation("EnvironmentName", []interface{}{})
+	fake.environmentNameMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCPI) EnvironmentNameCallCount() int {
+	fake.environmentNameMutex.RLock()
+	defer fake.environmentNameMutex.RUnlock()
+	return len(fake.environmentNameArgsForCall)
+}
+
+func (fake *FakeCPI) EnvironmentNameCalls(stub func() string) {
+	fake.environmentNameMutex.Lock()
+	defer fake.environmentNameMutex.Unlock()
+	fake.EnvironmentNameStub = stub
+}
+
+func (fake *FakeCPI) EnvironmentNameReturns(result1 string) {
+	fake.environmentNameMutex.Lock()
+	defer fake.environmentNameMutex.Unlock()
+	fake.EnvironmentNameStub = nil
+	fake.environmentNameReturns = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *FakeCPI) EnvironmentNameReturnsOnCall(i int, result1 string) {
+	fake.environmentNameMutex.Lock()
+	defer fake.environmentNameMutex.Unlock()
+	fake.EnvironmentNameStub = nil
+	if fake.environmentNameReturnsOnCall == nil {
+		fake.environmentNameReturnsOnCall = make(map[int]struct {
+			result1 string
+		})
+	}
+	fake.environmentNameReturnsOnCall[i] = struct {
+		result1 string
+	}{result1}
+}
+
 func (fake *FakeCPI) ExecCommand(arg1 context.Context, arg2 string, arg3 []string) (string, error) {
 	var arg3Copy []string
 	if arg3 != nil {
@@ -1434,6 +1510,70 @@ func (fake *FakeCPI) IsRunningReturnsOnCall(i int, result1 bool, result2 error)
 	}{result1, result2}
 }
 
+func (fake *FakeCPI) Platform(arg1 context.Context) (string, error) {
+	fake.platformMutex.Lock()
+	ret, specificReturn := fake.platformReturnsOnCall[len(fake.platformArgsForCall)]
+	fake.platformArgsForCall = append(fake.platformArgsForCall, struct {
+		arg1 context.Context
+	}{arg1})
+	stub := fake.PlatformStub
+	fakeReturns := fake.platformReturns
+	fake.recordInvocation("Platform", []interface{}{arg1})
+	fake.platformMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeCPI) PlatformCallCount() int {
+	fake.platformMutex.RLock()
+	defer fake.platformMutex.RUnlock()
+	return len(fake.platformArgsForCall)
+}
+
+func (fake *FakeCPI) PlatformCalls(stub func(context.Context) (string, error)) {
+	fake.platformMutex.Lock()
+	defer fake.platformMutex.Unlock()
+	fake.PlatformStub = stub
+}
+
+func (fake *FakeCPI) PlatformArgsForCall(i int) context.Context {
+	fake.platformMutex.RLock()
+	defer fake.platformMutex.RUnlock()
+	argsForCall := fake.platformArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCPI) PlatformReturns(result1 string, result2 error) {
+	fake.platformMutex.Lock()
+	defer fake.platformMutex.Unlock()
+	fake.PlatformStub = nil
+	fake.platformReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCPI) PlatformReturnsOnCall(i int, result1 string, result2 error) {
+	fake.platformMutex.Lock()
+	defer fake.platformMutex.Unlock()
+	fake.PlatformStub = nil
+	if fake.platformReturnsOnCall == nil {
+		fake.platformReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.platformReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeCPI) RemoveContainer(arg1 context.Context) error {
 	fake.removeContainerMutex.Lock()
 	ret, specificReturn := fake.removeContainerReturnsOnCall[len(fake.removeContainerArgsForCall)]
@@ -2,9 +2,15 @@ package cpi
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os/exec"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/rkoster/instant-bosh/internal/director"
+	"github.com/rkoster/instant-bosh/internal/docker"
+	"github.com/rkoster/instant-bosh/internal/incus"
+	"github.com/rkoster/instant-bosh/internal/state"
 )
 
 // CPIType represents the type of CPI in use
@@ -21,41 +27,83 @@ const (
 	CPITypeUnknown CPIType = "unknown"
 )
 
-// boshEnvResponse represents the JSON response from `bosh env --json`
-type boshEnvResponse struct {
-	Tables []struct {
-		Rows []struct {
-			CPI string `json:"cpi"`
-		} `json:"Rows"`
-	} `json:"Tables"`
-}
-
-// DetectCPIType detects the CPI type from `bosh env --json` output
-// Returns CPITypeDocker for "docker_cpi", CPITypeIncus for "lxd_cpi"
+// DetectCPIType detects the CPI of the instant-bosh director. It asks the director of the
+// local state for its CPI, or the director the BOSH environment variables point at (see
+// print-env) when they are set, and falls back to the backend that has an instant-bosh
+// container when no director can tell.
 func DetectCPIType(ctx context.Context) (CPIType, error) {
-	cmd := exec.CommandContext(ctx, "bosh", "env", "--json")
-	output, err := cmd.Output()
-	if err != nil {
-		return CPITypeUnknown, fmt.Errorf("running bosh env: %w", err)
+	logger := boshlog.NewLogger(boshlog.LevelError)
+	backends := DefaultBackends(logger)
+
+	cpiType, directorErr := DetectCPITypeFromDirectors(backends, &director.DefaultDirectorFactory{}, logger)
+	if directorErr == nil {
+		return cpiType, nil
 	}
 
-	return ParseCPITypeFromBoshEnv(output)
+	cpiType, err := DetectCPITypeFromBackends(ctx, backends)
+	if err != nil {
+		return CPITypeUnknown, fmt.Errorf("%w (asking the director: %v)", err, directorErr)
+	}
+	return cpiType, nil
 }
 
-// ParseCPITypeFromBoshEnv parses the CPI type from bosh env JSON output
-// This is exported for testing
-func ParseCPITypeFromBoshEnv(output []byte) (CPIType, error) {
-	var response boshEnvResponse
-	if err := json.Unmarshal(output, &response); err != nil {
-		return CPITypeUnknown, fmt.Errorf("parsing bosh env output: %w", err)
+// DetectCPITypeFromDirectors asks the director the BOSH environment variables point at for
+// its CPI. Without those overrides it asks the directors in the local state of the backends.
+func DetectCPITypeFromDirectors(backends []Backend, directorFactory director.DirectorFactory, logger boshlog.Logger) (CPIType, error) {
+	config, err := director.NewConfigFromEnv()
+	if err == nil {
+		return detectFromConfig(config, directorFactory, logger)
 	}
+	var notConfigured *director.ErrEnvNotConfigured
+	if !errors.As(err, &notConfigured) {
+		return CPITypeUnknown, err
+	}
+
+	err = errors.New("no local state found")
+	for _, backend := range backends {
+		instance, newErr := backend.New()
+		if newErr != nil {
+			continue
+		}
+		env := director.EnvironmentName(instance, instance.GetContainerName())
+		instance.Close()
 
-	if len(response.Tables) == 0 || len(response.Tables[0].Rows) == 0 {
-		return CPITypeUnknown, fmt.Errorf("no CPI information in bosh env output")
+		s, loadErr := state.Load(env)
+		if loadErr != nil {
+			continue
+		}
+		cpiType, detectErr := detectFromConfig(director.ConfigFromState(s), directorFactory, logger)
+		if detectErr == nil {
+			return cpiType, nil
+		}
+		err = fmt.Errorf("environment %s: %w", env, detectErr)
 	}
+	return CPITypeUnknown, err
+}
+
+// detectFromConfig detects the CPI type of the director of a configuration
+func detectFromConfig(config *director.Config, directorFactory director.DirectorFactory, logger boshlog.Logger) (CPIType, error) {
+	defer config.Cleanup()
 
-	cpiName := response.Tables[0].Rows[0].CPI
+	directorClient, err := directorFactory.NewDirector(config, logger)
+	if err != nil {
+		return CPITypeUnknown, fmt.Errorf("creating director client: %w", err)
+	}
+	return DetectCPITypeFromDirector(directorClient)
+}
 
+// DetectCPITypeFromDirector returns the CPI type the director reports on its /info endpoint
+func DetectCPITypeFromDirector(directorClient boshdir.Director) (CPIType, error) {
+	info, err := directorClient.Info()
+	if err != nil {
+		return CPITypeUnknown, fmt.Errorf("fetching director info: %w", err)
+	}
+	return ParseCPIName(info.CPI)
+}
+
+// ParseCPIName returns the CPI type of a CPI name reported by the director
+// Returns CPITypeDocker for "docker_cpi", CPITypeIncus for "lxd_cpi"
+func ParseCPIName(cpiName string) (CPIType, error) {
 	switch cpiName {
 	case "docker_cpi":
 		return CPITypeDocker, nil
@@ -66,6 +114,65 @@ func ParseCPITypeFromBoshEnv(output []byte) (CPIType, error) {
 	}
 }
 
+// Backend is a backend instant-bosh can run on, with a function creating its CPI
+type Backend struct {
+	Type CPIType
+	New  func() (CPI, error)
+}
+
+// DefaultBackends returns the Docker and Incus backends with their default settings
+func DefaultBackends(logger boshlog.Logger) []Backend {
+	return []Backend{
+		{Type: CPITypeDocker, New: func() (CPI, error) {
+			dockerClient, err := docker.NewClient(logger, "")
+			if err != nil {
+				return nil, err
+			}
+			return NewDockerCPI(dockerClient), nil
+		}},
+		{Type: CPITypeIncus, New: func() (CPI, error) {
+			incusClient, err := incus.NewClient(logger, "", "", "", "", "")
+			if err != nil {
+				return nil, err
+			}
+			return NewIncusCPI(incusClient), nil
+		}},
+	}
+}
+
+// DetectCPITypeFromBackends returns the type of the backend that has an instant-bosh
+// container, preferring one where it is running. Unreachable backends are skipped.
+func DetectCPITypeFromBackends(ctx context.Context, backends []Backend) (CPIType, error) {
+	found := CPITypeUnknown
+	for _, backend := range backends {
+		instance, err := backend.New()
+		if err != nil {
+			continue
+		}
+		exists, err := instance.Exists(ctx)
+		running := false
+		if err == nil && exists {
+			running, _ = instance.IsRunning(ctx)
+		}
+		instance.Close()
+
+		if err != nil || !exists {
+			continue
+		}
+		if running {
+			return backend.Type, nil
+		}
+		if found == CPITypeUnknown {
+			found = backend.Type
+		}
+	}
+
+	if found == CPITypeUnknown {
+		return CPITypeUnknown, fmt.Errorf("no instant-bosh instance found")
+	}
+	return found, nil
+}
+
 // CPITypeFromInstance returns the CPI type based on the CPI instance type
 func CPITypeFromInstance(cpiInstance CPI) CPIType {
 	switch cpiInstance.(type) {
@@ -1,99 +1,168 @@
 package cpi_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshdirfakes "github.com/cloudfoundry/bosh-cli/v7/director/directorfakes"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 	"github.com/rkoster/instant-bosh/internal/cpi"
+	"github.com/rkoster/instant-bosh/internal/cpi/cpifakes"
+	"github.com/rkoster/instant-bosh/internal/director/directorfakes"
+	"github.com/rkoster/instant-bosh/internal/state"
 )
 
-func TestParseCPITypeFromBoshEnv_Docker(t *testing.T) {
-	output := []byte(`{
-		"Tables": [
-			{
-				"Rows": [
-					{
-						"cpi": "docker_cpi",
-						"name": "instant-bosh",
-						"uuid": "12345",
-						"version": "280.0.17"
-					}
-				]
-			}
-		]
-	}`)
-
-	cpiType, err := cpi.ParseCPITypeFromBoshEnv(output)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+func TestParseCPIName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected cpi.CPIType
+	}{
+		{name: "docker_cpi", expected: cpi.CPITypeDocker},
+		{name: "lxd_cpi", expected: cpi.CPITypeIncus},
+	}
+	for _, tt := range tests {
+		cpiType, err := cpi.ParseCPIName(tt.name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cpiType != tt.expected {
+			t.Errorf("ParseCPIName(%q) = %v, want %v", tt.name, cpiType, tt.expected)
+		}
 	}
 
-	if cpiType != cpi.CPITypeDocker {
-		t.Errorf("expected CPITypeDocker, got %v", cpiType)
+	if _, err := cpi.ParseCPIName("warden_cpi"); err == nil {
+		t.Fatal("expected error for unknown CPI type")
 	}
 }
 
-func TestParseCPITypeFromBoshEnv_Incus(t *testing.T) {
-	output := []byte(`{
-		"Tables": [
-			{
-				"Rows": [
-					{
-						"cpi": "lxd_cpi",
-						"name": "instant-bosh",
-						"uuid": "12345",
-						"version": "280.0.17"
-					}
-				]
-			}
-		]
-	}`)
-
-	cpiType, err := cpi.ParseCPITypeFromBoshEnv(output)
+func TestDetectCPITypeFromDirector(t *testing.T) {
+	director := &boshdirfakes.FakeDirector{}
+	director.InfoReturns(boshdir.Info{Name: "instant-bosh", CPI: "lxd_cpi"}, nil)
+
+	cpiType, err := cpi.DetectCPITypeFromDirector(director)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-
 	if cpiType != cpi.CPITypeIncus {
 		t.Errorf("expected CPITypeIncus, got %v", cpiType)
 	}
-}
 
-func TestParseCPITypeFromBoshEnv_Unknown(t *testing.T) {
-	output := []byte(`{
-		"Tables": [
-			{
-				"Rows": [
-					{
-						"cpi": "aws_cpi",
-						"name": "my-bosh",
-						"uuid": "12345",
-						"version": "280.0.17"
-					}
-				]
-			}
-		]
-	}`)
-
-	_, err := cpi.ParseCPITypeFromBoshEnv(output)
-	if err == nil {
-		t.Fatal("expected error for unknown CPI type")
+	director.InfoReturns(boshdir.Info{}, errors.New("connection refused"))
+	if _, err := cpi.DetectCPITypeFromDirector(director); err == nil {
+		t.Fatal("expected error for an unreachable director")
 	}
 }
 
-func TestParseCPITypeFromBoshEnv_EmptyTables(t *testing.T) {
-	output := []byte(`{"Tables": []}`)
+func backend(cpiType cpi.CPIType, exists, running bool) cpi.Backend {
+	return cpi.Backend{Type: cpiType, New: func() (cpi.CPI, error) {
+		fake := &cpifakes.FakeCPI{}
+		fake.ExistsReturns(exists, nil)
+		fake.IsRunningReturns(running, nil)
+		return fake, nil
+	}}
+}
+
+func TestDetectCPITypeFromBackends(t *testing.T) {
+	unreachable := cpi.Backend{Type: cpi.CPITypeDocker, New: func() (cpi.CPI, error) {
+		return nil, errors.New("docker daemon not running")
+	}}
+
+	tests := []struct {
+		description string
+		backends    []cpi.Backend
+		expected    cpi.CPIType
+	}{
+		{
+			description: "skips unreachable backends",
+			backends:    []cpi.Backend{unreachable, backend(cpi.CPITypeIncus, true, true)},
+			expected:    cpi.CPITypeIncus,
+		},
+		{
+			description: "prefers a running instance",
+			backends:    []cpi.Backend{backend(cpi.CPITypeDocker, true, false), backend(cpi.CPITypeIncus, true, true)},
+			expected:    cpi.CPITypeIncus,
+		},
+		{
+			description: "falls back to a stopped instance",
+			backends:    []cpi.Backend{backend(cpi.CPITypeDocker, true, false), backend(cpi.CPITypeIncus, false, false)},
+			expected:    cpi.CPITypeDocker,
+		},
+	}
+	for _, tt := range tests {
+		cpiType, err := cpi.DetectCPITypeFromBackends(context.Background(), tt.backends)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.description, err)
+		}
+		if cpiType != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.description, tt.expected, cpiType)
+		}
+	}
 
-	_, err := cpi.ParseCPITypeFromBoshEnv(output)
-	if err == nil {
-		t.Fatal("expected error for empty tables")
+	backends := []cpi.Backend{unreachable, backend(cpi.CPITypeIncus, false, false)}
+	if _, err := cpi.DetectCPITypeFromBackends(context.Background(), backends); err == nil {
+		t.Fatal("expected error without an instant-bosh instance")
 	}
 }
 
-func TestParseCPITypeFromBoshEnv_InvalidJSON(t *testing.T) {
-	output := []byte(`not valid json`)
+func TestDetectCPITypeFromDirectors(t *testing.T) {
+	t.Setenv(state.EnvStateDir, t.TempDir())
+	for _, name := range []string{"BOSH_ENVIRONMENT", "BOSH_CLIENT", "BOSH_CLIENT_SECRET", "BOSH_CA_CERT"} {
+		t.Setenv(name, "")
+	}
+
+	environment := func(name string) cpi.Backend {
+		return cpi.Backend{New: func() (cpi.CPI, error) {
+			fake := &cpifakes.FakeCPI{}
+			fake.EnvironmentNameReturns(name)
+			return fake, nil
+		}}
+	}
+	backends := []cpi.Backend{environment("docker"), environment("incus-local")}
 
-	_, err := cpi.ParseCPITypeFromBoshEnv(output)
-	if err == nil {
-		t.Fatal("expected error for invalid JSON")
+	directorClient := &boshdirfakes.FakeDirector{}
+	directorClient.InfoReturns(boshdir.Info{CPI: "lxd_cpi"}, nil)
+	directorFactory := &directorfakes.FakeDirectorFactory{}
+	directorFactory.NewDirectorReturns(directorClient, nil)
+	logger := boshlog.NewLogger(boshlog.LevelNone)
+
+	if _, err := cpi.DetectCPITypeFromDirectors(backends, directorFactory, logger); err == nil {
+		t.Fatal("expected error without local state")
+	}
+
+	s := &state.State{HostAddress: "10.0.0.1", DirectNetworkAccess: true, Ports: state.Ports{Director: "25555"}}
+	if err := state.Save("incus-local", s, "jumpbox-key"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The director of the local state is asked for its CPI
+	cpiType, err := cpi.DetectCPITypeFromDirectors(backends, directorFactory, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cpiType != cpi.CPITypeIncus {
+		t.Errorf("expected CPITypeIncus, got %v", cpiType)
+	}
+	if config, _ := directorFactory.NewDirectorArgsForCall(0); config.Environment != "https://10.0.0.1:25555" {
+		t.Errorf("expected the director of the local state, got %s", config.Environment)
+	}
+
+	// The BOSH environment variables override the local state
+	t.Setenv("BOSH_ENVIRONMENT", "https://10.0.0.2:25555")
+	t.Setenv("BOSH_CLIENT", "admin")
+	t.Setenv("BOSH_CLIENT_SECRET", "secret")
+	t.Setenv("BOSH_CA_CERT", "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n")
+	directorClient.InfoReturns(boshdir.Info{CPI: "docker_cpi"}, nil)
+
+	cpiType, err = cpi.DetectCPITypeFromDirectors(backends, directorFactory, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cpiType != cpi.CPITypeDocker {
+		t.Errorf("expected CPITypeDocker, got %v", cpiType)
+	}
+	if config, _ := directorFactory.NewDirectorArgsForCall(1); config.Environment != "https://10.0.0.2:25555" {
+		t.Errorf("expected the director of the environment, got %s", config.Environment)
 	}
 }
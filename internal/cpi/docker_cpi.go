@@ -191,10 +191,14 @@ func (d *DockerCPI) GetSSHPort() string {
 	return docker.SSHPort
 }
 
+func (d *DockerCPI) EnvironmentName() string {
+	return d.client.EnvironmentName()
+}
+
 func (d *DockerCPI) HasDirectNetworkAccess() bool {
-	// Docker requires SOCKS5 proxy through jumpbox
-	// since we access via localhost port forwarding
-	return false
+	// Without a route to the instant-bosh network (e.g. Docker Desktop), Docker
+	// requires SOCKS5 proxy through jumpbox since we access via localhost port forwarding
+	return d.client.HasDirectNetworkAccess()
 }
 
 func (d *DockerCPI) GetContainersOnNetwork(ctx context.Context) ([]ContainerInfo, error) {
@@ -209,6 +213,7 @@ func (d *DockerCPI) GetContainersOnNetwork(ctx context.Context) ([]ContainerInfo
 			Name:    dc.Name,
 			Created: dc.Created,
 			Network: dc.Network,
+			IP:      dc.IP,
 		}
 	}
 	return cpiContainers, nil
@@ -301,6 +306,11 @@ func (d *DockerCPI) GetCurrentImageInfo(ctx context.Context) (ImageInfo, error)
 	}, nil
 }
 
+// Platform returns the explicit platform if set, otherwise the Docker daemon platform.
+func (d *DockerCPI) Platform(ctx context.Context) (string, error) {
+	return d.client.Platform(ctx)
+}
+
 // GetTargetImageRef returns the OCI image reference that would be used for new containers.
 // If a resolved (digest-pinned) image has been set, returns that; otherwise returns the original tag-based ref.
 func (d *DockerCPI) GetTargetImageRef() string {
@@ -85,6 +85,9 @@ compilation:
 `)
 )
 
+// environmentNameReplacer turns remote URLs into valid directory names.
+var environmentNameReplacer = strings.NewReplacer("://", "-", "/", "-", ":", "-", "\\", "-")
+
 type IncusCPI struct {
 	client      *incus.Client
 	resolvedRef string // Digest-pinned image reference (e.g., "ghcr.io/repo@sha256:...")
@@ -348,6 +351,16 @@ func (i *IncusCPI) GetSSHPort() string {
 	return incus.SSHPort
 }
 
+// EnvironmentName includes the remote, and the project if it is not the default,
+// so environments on different Incus servers keep separate local state.
+func (i *IncusCPI) EnvironmentName() string {
+	name := "incus-" + i.client.GetRemote()
+	if project := i.client.GetProject(); project != "" && project != incus.DefaultProject {
+		name += "-" + project
+	}
+	return environmentNameReplacer.Replace(name)
+}
+
 func (i *IncusCPI) HasDirectNetworkAccess() bool {
 	// Incus containers have direct network access via static routing
 	// No jumpbox proxy needed
@@ -413,6 +426,11 @@ func (i *IncusCPI) GetCurrentImageInfo(ctx context.Context) (ImageInfo, error) {
 	}, nil
 }
 
+// Platform returns the Incus server platform.
+func (i *IncusCPI) Platform(ctx context.Context) (string, error) {
+	return i.client.Platform(ctx)
+}
+
 // GetTargetImageRef returns the OCI image reference that would be used for new containers.
 // If a resolved (digest-pinned) image has been set, returns that; otherwise returns the original tag-based ref.
 func (i *IncusCPI) GetTargetImageRef() string {
@@ -0,0 +1,258 @@
+package credhubproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rkoster/instant-bosh/internal/configserver"
+)
+
+// Version is the CredHub server version reported to clients. The credhub CLI uses it to
+// decide which API features it may call.
+const Version = "2.12.0"
+
+// Store is the credential store behind the proxy, implemented by *configserver.Client.
+type Store interface {
+	Get(name string) (*configserver.Credential, error)
+	Set(name string, value interface{}) (*configserver.Credential, error)
+	Find(pathPrefix string) ([]configserver.Credential, error)
+	Delete(name string) error
+}
+
+// StoreFunc returns the store to use for a request authenticated with token.
+type StoreFunc func(token string) Store
+
+// credential is a credential in the CredHub API format.
+type credential struct {
+	ID    string      `json:"id"`
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type handler struct {
+	authServerURL string
+	store         StoreFunc
+}
+
+// NewHandler returns an http.Handler serving the subset of the CredHub API used by the
+// credhub CLI (/info, /version, /api/v1/data and /api/v1/interpolate) on top of
+// config-server. Tokens are issued by the UAA at authServerURL and passed on to the
+// store, so config-server remains responsible for authorization.
+func NewHandler(authServerURL string, store StoreFunc) http.Handler {
+	h := &handler{authServerURL: authServerURL, store: store}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /info", h.info)
+	mux.HandleFunc("GET /version", h.version)
+	mux.HandleFunc("GET /api/v1/data", h.authenticated(h.getOrFind))
+	mux.HandleFunc("PUT /api/v1/data", h.authenticated(h.set))
+	mux.HandleFunc("DELETE /api/v1/data", h.authenticated(h.delete))
+	mux.HandleFunc("POST /api/v1/interpolate", h.authenticated(h.interpolate))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s is not supported by the instant-bosh CredHub proxy", r.Method, r.URL.Path))
+	})
+	return mux
+}
+
+func (h *handler) info(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"app":         map[string]string{"name": "CredHub", "version": Version},
+		"auth-server": map[string]string{"url": h.authServerURL},
+	})
+}
+
+func (h *handler) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"version": Version})
+}
+
+// authenticated requires a bearer token and passes the store for it to next.
+func (h *handler) authenticated(next func(w http.ResponseWriter, r *http.Request, store Store)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{
+				"error":             "invalid_token",
+				"error_description": "Full authentication is required to access this resource",
+			})
+			return
+		}
+		next(w, r, h.store(token))
+	}
+}
+
+func (h *handler) getOrFind(w http.ResponseWriter, r *http.Request, store Store) {
+	query := r.URL.Query()
+	switch {
+	case query.Has("name"):
+		cred, err := store.Get(query.Get("name"))
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		// Config-server only keeps the current version, so every version query returns it
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": []credential{toCredential(*cred)}})
+
+	case query.Has("path"):
+		path := query.Get("path")
+		if path != "" && !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		h.find(w, store, path, func(name string) bool {
+			return path == "" || strings.HasPrefix(name, strings.TrimSuffix(path, "/")+"/")
+		})
+
+	case query.Has("name-like"):
+		nameLike := strings.ToLower(query.Get("name-like"))
+		h.find(w, store, "", func(name string) bool {
+			return strings.Contains(strings.ToLower(name), nameLike)
+		})
+
+	default:
+		writeError(w, http.StatusBadRequest, "The query parameter name, path or name-like is required for this request.")
+	}
+}
+
+func (h *handler) find(w http.ResponseWriter, store Store, prefix string, match func(name string) bool) {
+	creds, err := store.Find(prefix)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	type result struct {
+		Name string `json:"name"`
+	}
+	results := []result{}
+	for _, cred := range creds {
+		if match(cred.Name) {
+			results = append(results, result{Name: cred.Name})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"credentials": results})
+}
+
+func (h *handler) set(w http.ResponseWriter, r *http.Request, store Store) {
+	var request struct {
+		Name  string      `json:"name"`
+		Type  string      `json:"type"`
+		Value interface{} `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("The request could not be fulfilled because the request body is malformed: %v", err))
+		return
+	}
+	if request.Name == "" {
+		writeError(w, http.StatusBadRequest, "A credential name must be provided. Please validate your input and retry your request.")
+		return
+	}
+	if request.Value == nil {
+		writeError(w, http.StatusBadRequest, "A non-empty value must be specified for the credential. Please validate and retry your request.")
+		return
+	}
+
+	cred, err := store.Set(request.Name, request.Value)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	result := toCredential(*cred)
+	if request.Type != "" {
+		// Config-server does not store types, so echo the one that was set
+		result.Type = request.Type
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *handler) delete(w http.ResponseWriter, r *http.Request, store Store) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "A credential name must be provided. Please validate your input and retry your request.")
+		return
+	}
+
+	if err := store.Delete(name); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// interpolate replaces the credentials of service bindings in a VCAP_SERVICES document
+// that reference a credential ({"credhub-ref": "/name"}) with its value.
+func (h *handler) interpolate(w http.ResponseWriter, r *http.Request, store Store) {
+	var services map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&services); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("The request could not be fulfilled because the request body is malformed: %v", err))
+		return
+	}
+
+	for _, bindings := range services {
+		list, ok := bindings.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, binding := range list {
+			properties, ok := binding.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			credentials, ok := properties["credentials"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			ref, ok := credentials["credhub-ref"].(string)
+			if !ok {
+				continue
+			}
+
+			cred, err := store.Get(ref)
+			if err != nil {
+				writeStoreError(w, err)
+				return
+			}
+			properties["credentials"] = cred.Value
+		}
+	}
+
+	writeJSON(w, http.StatusOK, services)
+}
+
+func toCredential(cred configserver.Credential) credential {
+	return credential{
+		ID:    cred.ID,
+		Name:  cred.Name,
+		Type:  configserver.InferType(cred.Value),
+		Value: cred.Value,
+	}
+}
+
+// writeStoreError translates a config-server error to a CredHub API error response.
+func writeStoreError(w http.ResponseWriter, err error) {
+	var statusErr *configserver.StatusError
+	switch {
+	case errors.Is(err, configserver.ErrCredentialNotFound):
+		writeError(w, http.StatusNotFound, "The request could not be completed because the credential does not exist or you do not have sufficient authorization.")
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500:
+		writeError(w, statusErr.StatusCode, statusErr.Body)
+	default:
+		writeError(w, http.StatusBadGateway, err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
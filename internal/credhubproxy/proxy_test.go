@@ -0,0 +1,253 @@
+package credhubproxy_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rkoster/instant-bosh/internal/configserver"
+	"github.com/rkoster/instant-bosh/internal/credhubproxy"
+)
+
+// memoryStore is an in-memory config-server recording the token it was created for.
+type memoryStore struct {
+	token string
+	creds map[string]interface{}
+}
+
+func (s *memoryStore) Get(name string) (*configserver.Credential, error) {
+	value, ok := s.creds[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", configserver.ErrCredentialNotFound, name)
+	}
+	return &configserver.Credential{ID: "1", Name: name, Value: value}, nil
+}
+
+func (s *memoryStore) Set(name string, value interface{}) (*configserver.Credential, error) {
+	s.creds[name] = value
+	return &configserver.Credential{ID: "2", Name: name, Value: value}, nil
+}
+
+func (s *memoryStore) Find(pathPrefix string) ([]configserver.Credential, error) {
+	var creds []configserver.Credential
+	for name, value := range s.creds {
+		if strings.HasPrefix(name, pathPrefix) {
+			creds = append(creds, configserver.Credential{Name: name, Value: value})
+		}
+	}
+	return creds, nil
+}
+
+func (s *memoryStore) Delete(name string) error {
+	if _, ok := s.creds[name]; !ok {
+		return fmt.Errorf("%w: %s", configserver.ErrCredentialNotFound, name)
+	}
+	delete(s.creds, name)
+	return nil
+}
+
+func newProxy(t *testing.T) (*httptest.Server, *memoryStore) {
+	t.Helper()
+
+	store := &memoryStore{creds: map[string]interface{}{
+		"/instant-bosh/cf/cf_admin_password": "secret",
+		"/instant-bosh/cf/router_ssl":        map[string]interface{}{"ca": "ca", "certificate": "cert", "private_key": "key"},
+		"/instant-bosh/zookeeper/password":   "zk",
+	}}
+	server := httptest.NewServer(credhubproxy.NewHandler("https://uaa.example.com:8443", func(token string) credhubproxy.Store {
+		store.token = token
+		return store
+	}))
+	t.Cleanup(server.Close)
+	return server, store
+}
+
+func request(t *testing.T, method, url, body string) (int, map[string]interface{}) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer the-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("executing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	var result map[string]interface{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatalf("parsing response %q: %v", data, err)
+		}
+	}
+	return resp.StatusCode, result
+}
+
+func TestInfo(t *testing.T) {
+	server, _ := newProxy(t)
+
+	resp, err := http.Get(server.URL + "/info")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var info struct {
+		App        struct{ Name, Version string }
+		AuthServer struct{ URL string } `json:"auth-server"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.App.Name != "CredHub" || info.App.Version != credhubproxy.Version {
+		t.Errorf("unexpected app %+v", info.App)
+	}
+	if info.AuthServer.URL != "https://uaa.example.com:8443" {
+		t.Errorf("unexpected auth-server URL %q", info.AuthServer.URL)
+	}
+}
+
+func TestRequiresToken(t *testing.T) {
+	server, _ := newProxy(t)
+
+	resp, err := http.Get(server.URL + "/api/v1/data?name=/instant-bosh/cf/cf_admin_password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", resp.StatusCode)
+	}
+}
+
+func TestGet(t *testing.T) {
+	server, store := newProxy(t)
+
+	status, result := request(t, "GET", server.URL+"/api/v1/data?name=/instant-bosh/cf/router_ssl&current=true", "")
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %v", status, result)
+	}
+	if store.token != "the-token" {
+		t.Errorf("expected token to be passed to the store, got %q", store.token)
+	}
+	data := result["data"].([]interface{})
+	if len(data) != 1 {
+		t.Fatalf("expected 1 credential, got %d", len(data))
+	}
+	cred := data[0].(map[string]interface{})
+	if cred["name"] != "/instant-bosh/cf/router_ssl" || cred["type"] != "certificate" {
+		t.Errorf("unexpected credential %v", cred)
+	}
+
+	status, result = request(t, "GET", server.URL+"/api/v1/data?name=/missing", "")
+	if status != http.StatusNotFound || result["error"] == nil {
+		t.Errorf("expected CredHub error with status 404, got %d: %v", status, result)
+	}
+}
+
+func TestFind(t *testing.T) {
+	server, _ := newProxy(t)
+
+	tests := []struct {
+		query string
+		names []string
+	}{
+		{query: "path=/instant-bosh/cf", names: []string{"/instant-bosh/cf/cf_admin_password", "/instant-bosh/cf/router_ssl"}},
+		{query: "path=/instant-bosh/c", names: []string{}},
+		{query: "name-like=PASSWORD", names: []string{"/instant-bosh/cf/cf_admin_password", "/instant-bosh/zookeeper/password"}},
+	}
+
+	for _, tt := range tests {
+		status, result := request(t, "GET", server.URL+"/api/v1/data?"+tt.query, "")
+		if status != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %v", tt.query, status, result)
+		}
+		var names []string
+		for _, cred := range result["credentials"].([]interface{}) {
+			names = append(names, cred.(map[string]interface{})["name"].(string))
+		}
+		if strings.Join(names, ",") != strings.Join(tt.names, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.query, tt.names, names)
+		}
+	}
+}
+
+func TestSetAndDelete(t *testing.T) {
+	server, store := newProxy(t)
+
+	status, result := request(t, "PUT", server.URL+"/api/v1/data", `{"name":"/demo/password","type":"password","value":"fixed"}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %v", status, result)
+	}
+	if result["type"] != "password" || result["value"] != "fixed" {
+		t.Errorf("unexpected credential %v", result)
+	}
+	if store.creds["/demo/password"] != "fixed" {
+		t.Errorf("expected credential to be stored")
+	}
+
+	status, result = request(t, "PUT", server.URL+"/api/v1/data", `{"type":"password","value":"fixed"}`)
+	if status != http.StatusBadRequest {
+		t.Errorf("expected status 400 without name, got %d: %v", status, result)
+	}
+
+	status, _ = request(t, "DELETE", server.URL+"/api/v1/data?name=/demo/password", "")
+	if status != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", status)
+	}
+	if _, ok := store.creds["/demo/password"]; ok {
+		t.Errorf("expected credential to be deleted")
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	server, _ := newProxy(t)
+
+	body := `{"p-service":[{"name":"db","credentials":{"credhub-ref":"/instant-bosh/cf/router_ssl"}},{"name":"plain","credentials":{"user":"u"}}]}`
+	status, result := request(t, "POST", server.URL+"/api/v1/interpolate", body)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %v", status, result)
+	}
+
+	bindings := result["p-service"].([]interface{})
+	interpolated := bindings[0].(map[string]interface{})["credentials"].(map[string]interface{})
+	if interpolated["certificate"] != "cert" {
+		t.Errorf("expected referenced credential to be interpolated, got %v", interpolated)
+	}
+	plain := bindings[1].(map[string]interface{})["credentials"].(map[string]interface{})
+	if plain["user"] != "u" {
+		t.Errorf("expected credentials without reference to be unchanged, got %v", plain)
+	}
+}
+
+func TestNewCertificate(t *testing.T) {
+	cert, caPEM, err := credhubproxy.NewCertificate("127.0.0.1", "localhost")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+		t.Fatal("expected PEM to contain a certificate")
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected certificate to be trusted for %s: %v", server.URL, err)
+	}
+	resp.Body.Close()
+}
@@ -2,9 +2,19 @@ package director
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"reflect"
+	"strconv"
 	"sync"
+	"time"
+	"unsafe"
 
 	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
 	boshuaa "github.com/cloudfoundry/bosh-cli/v7/uaa"
@@ -12,15 +22,21 @@ import (
 	boshhttp "github.com/cloudfoundry/bosh-utils/httpclient"
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 	"github.com/rkoster/instant-bosh/internal/container"
+	"github.com/rkoster/instant-bosh/internal/state"
+	"github.com/rkoster/instant-bosh/internal/tokencache"
 	"gopkg.in/yaml.v3"
 )
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 github.com/cloudfoundry/bosh-cli/v7/director.Director
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 github.com/cloudfoundry/bosh-cli/v7/director.Stemcell
 
-// dialerMutex protects the global state manipulation in NewDirector
-// (os.Unsetenv and boshhttp.ResetDialerContext)
-var dialerMutex sync.Mutex
+// Ports the director services are exposed on.
+const (
+	DirectorPort     = "25555"
+	JumpboxSSHPort   = "2222"
+	ConfigServerPort = "8081"
+	UAAPort          = "8443"
+)
 
 // Config holds the BOSH director connection configuration
 type Config struct {
@@ -38,6 +54,11 @@ type Config struct {
 	// UAA configuration (for config-server auth)
 	UAAURL    string
 	UAACACert string
+
+	// persistentKey marks JumpboxKeyPath as part of the local state, which Cleanup keeps.
+	persistentKey bool
+	// closers close the connections of the director clients created from the config.
+	closers []func() error
 }
 
 // ConfigProvider is an interface for retrieving BOSH director configuration.
@@ -45,10 +66,16 @@ type Config struct {
 //
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . ConfigProvider
 type ConfigProvider interface {
+	// GetDirectorConfig returns the director configuration from the local state.
+	// If no state has been stored yet, it is read from the container once.
 	GetDirectorConfig(ctx context.Context, containerClient container.Client, containerName string) (*Config, error)
+
+	// RefreshDirectorConfig reads the director configuration from the running container
+	// and stores it in the local state, together with the image the container runs.
+	RefreshDirectorConfig(ctx context.Context, containerClient container.Client, containerName string, image state.Image) (*Config, error)
 }
 
-// DefaultConfigProvider retrieves director config from the running container.
+// DefaultConfigProvider retrieves director config from the local state.
 type DefaultConfigProvider struct{}
 
 // DirectorFactory is an interface for creating BOSH director clients.
@@ -67,33 +94,176 @@ func (f *DefaultDirectorFactory) NewDirector(config *Config, logger boshlog.Logg
 	return NewDirector(config, logger)
 }
 
-// GetDirectorConfig retrieves the BOSH director configuration from the running container.
+// GetDirectorConfig retrieves the BOSH director configuration from the local state.
 func (p *DefaultConfigProvider) GetDirectorConfig(ctx context.Context, containerClient container.Client, containerName string) (*Config, error) {
 	return GetDirectorConfig(ctx, containerClient, containerName)
 }
 
-// Cleanup removes the temporary jumpbox key file
+// RefreshDirectorConfig re-reads the BOSH director configuration from the running container.
+func (p *DefaultConfigProvider) RefreshDirectorConfig(ctx context.Context, containerClient container.Client, containerName string, image state.Image) (*Config, error) {
+	return RefreshDirectorConfig(ctx, containerClient, containerName, image)
+}
+
+// Cleanup closes the connections of the director clients created from the config and
+// removes the temporary jumpbox key file.
+// Keys stored in the local state are kept, they are removed on destroy.
 func (c *Config) Cleanup() error {
-	if c.JumpboxKeyPath != "" {
+	var closeErr error
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		if err := c.closers[i](); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	c.closers = nil
+
+	if c.JumpboxKeyPath != "" && !c.persistentKey {
 		if err := os.Remove(c.JumpboxKeyPath); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("failed to remove jumpbox key file: %w", err)
 		}
 	}
-	return nil
+	return closeErr
 }
 
-// GetDirectorConfig retrieves the BOSH director configuration from the running container
+// EnvironmentName returns the name of the local state directory for a container.
+// CPIs name their environment (e.g. "docker" or "incus-local"), other clients
+// fall back to the container name.
+func EnvironmentName(containerClient container.Client, containerName string) string {
+	type environmentNamer interface {
+		EnvironmentName() string
+	}
+	if namer, ok := containerClient.(environmentNamer); ok {
+		if name := namer.EnvironmentName(); name != "" {
+			return name
+		}
+	}
+	return containerName
+}
+
+// GetDirectorConfig retrieves the BOSH director configuration from the local state.
+// Environments started before the local state existed are read from the container once.
 func GetDirectorConfig(ctx context.Context, containerClient container.Client, containerName string) (*Config, error) {
-	varsStore, err := containerClient.ExecCommand(ctx, containerName, []string{"cat", "/var/vcap/store/vars-store.yml"})
+	s, err := state.Load(EnvironmentName(containerClient, containerName))
+	if err == nil {
+		return ConfigFromState(s), nil
+	}
+	if !errors.Is(err, state.ErrNotFound) {
+		return nil, fmt.Errorf("failed to load local state: %w", err)
+	}
+	return RefreshDirectorConfig(ctx, containerClient, containerName, state.Image{})
+}
+
+// RefreshDirectorConfig reads the BOSH director configuration from the running container
+// and stores it in the local state directory.
+func RefreshDirectorConfig(ctx context.Context, containerClient container.Client, containerName string, image state.Image) (*Config, error) {
+	vars, err := readVarsStore(ctx, containerClient, containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the host address where ports are exposed
+	// For Docker this is 127.0.0.1, for remote Incus this is the Incus server IP
+	hostAddress := containerClient.GetHostAddress()
+
+	// Determine if we need BOSH_ALL_PROXY based on network access method
+	// Try to cast to CPI interface to check if direct network access is available
+	var directNetworkAccess bool
+	type networkAccessChecker interface {
+		HasDirectNetworkAccess() bool
+	}
+	if checker, ok := containerClient.(networkAccessChecker); ok {
+		// Use CPI's explicit declaration of network access method
+		directNetworkAccess = checker.HasDirectNetworkAccess()
+	} else {
+		// Fallback: check if localhost (Docker-like setup that needs proxy)
+		directNetworkAccess = hostAddress != "127.0.0.1" && hostAddress != "localhost"
+	}
+
+	s := &state.State{
+		ContainerName:       containerName,
+		HostAddress:         hostAddress,
+		DirectNetworkAccess: directNetworkAccess,
+		Ports: state.Ports{
+			Director:     DirectorPort,
+			SSH:          JumpboxSSHPort,
+			ConfigServer: ConfigServerPort,
+			UAA:          UAAPort,
+		},
+		Director: state.Credentials{
+			Client:       "admin",
+			ClientSecret: vars.adminPassword,
+			CACert:       vars.directorCACert,
+		},
+		ConfigServer: state.Credentials{
+			Client:       "director_config_server",
+			ClientSecret: vars.configServerSecret,
+			CACert:       vars.configServerCACert,
+		},
+		UAACACert: vars.directorCACert, // UAA uses same CA as director
+		Image:     image,
+	}
+
+	if err := state.Save(EnvironmentName(containerClient, containerName), s, vars.jumpboxKey); err != nil {
+		return nil, fmt.Errorf("failed to save local state: %w", err)
+	}
+
+	return ConfigFromState(s), nil
+}
+
+// ConfigFromState builds the director connection configuration from the local state.
+func ConfigFromState(s *state.State) *Config {
+	var allProxy string
+	if !s.DirectNetworkAccess {
+		allProxy = fmt.Sprintf("ssh+socks5://jumpbox@%s:%s?private-key=%s", s.HostAddress, s.Ports.SSH, s.JumpboxKeyPath)
+	}
+
+	return &Config{
+		Environment:        fmt.Sprintf("https://%s:%s", s.HostAddress, s.Ports.Director),
+		Client:             s.Director.Client,
+		ClientSecret:       s.Director.ClientSecret,
+		CACert:             s.Director.CACert,
+		AllProxy:           allProxy,
+		JumpboxKeyPath:     s.JumpboxKeyPath,
+		ConfigServerURL:    fmt.Sprintf("https://%s:%s", s.HostAddress, s.Ports.ConfigServer),
+		ConfigServerClient: s.ConfigServer.Client,
+		ConfigServerSecret: s.ConfigServer.ClientSecret,
+		ConfigServerCACert: s.ConfigServer.CACert,
+		UAAURL:             fmt.Sprintf("https://%s:%s", s.HostAddress, s.Ports.UAA),
+		UAACACert:          s.UAACACert,
+		persistentKey:      true,
+	}
+}
+
+// varsStore holds the values of the director's vars-store.yml needed to connect to it.
+type varsStore struct {
+	adminPassword      string
+	directorCACert     string
+	jumpboxKey         string
+	configServerSecret string
+	configServerCACert string
+}
+
+// ReadVarsStore reads the credentials the director was created with (e.g. director_ssl,
+// nats_server_tls and uaa_ssl) from the vars store in the container.
+func ReadVarsStore(ctx context.Context, containerClient container.Client, containerName string) (map[string]interface{}, error) {
+	varsStoreYAML, err := containerClient.ExecCommand(ctx, containerName, []string{"cat", "/var/vcap/store/vars-store.yml"})
 	if err != nil {
 		return nil, fmt.Errorf("failed to read vars-store.yml: %w", err)
 	}
 
 	// Parse YAML
 	var data map[string]interface{}
-	if err := yaml.Unmarshal([]byte(varsStore), &data); err != nil {
+	if err := yaml.Unmarshal([]byte(varsStoreYAML), &data); err != nil {
 		return nil, fmt.Errorf("failed to parse vars-store.yml: %w", err)
 	}
+	return data, nil
+}
+
+// readVarsStore reads the director credentials from the vars store in the container.
+func readVarsStore(ctx context.Context, containerClient container.Client, containerName string) (*varsStore, error) {
+	data, err := ReadVarsStore(ctx, containerClient, containerName)
+	if err != nil {
+		return nil, err
+	}
 
 	// Extract admin password
 	adminPassword, err := extractYAMLValue(data, "admin_password")
@@ -169,145 +339,206 @@ func GetDirectorConfig(ctx context.Context, containerClient container.Client, co
 		return nil, fmt.Errorf("config_server_ssl.ca is not a string")
 	}
 
-	// Create temporary file for jumpbox key
-	keyFileHandle, err := os.CreateTemp("", "jumpbox-key-*")
+	return &varsStore{
+		adminPassword:      adminPasswordStr,
+		directorCACert:     directorCertStr,
+		jumpboxKey:         jumpboxKeyStr,
+		configServerSecret: configServerSecretStr,
+		configServerCACert: configServerCACertStr,
+	}, nil
+}
+
+// NewDirector creates a BOSH director client using the provided configuration.
+// The client ignores BOSH_* environment variables: if AllProxy is set, connections go
+// through a JumpboxDialer owned by this client.
+func NewDirector(config *Config, logger boshlog.Logger) (boshdir.Director, error) {
+	return NewDirectorWithTaskReporter(config, logger, boshdir.NewNoopTaskReporter())
+}
+
+// NewDirectorWithTaskReporter creates a BOSH director client like NewDirector, which reports
+// the output of the tasks it waits for (e.g. deploys and deletes) to taskReporter.
+// The connections of the client are closed by config.Cleanup.
+func NewDirectorWithTaskReporter(config *Config, logger boshlog.Logger, taskReporter boshdir.TaskReporter) (boshdir.Director, error) {
+	dialContext, closeDialer, err := config.NewDialer()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temp file for jumpbox key: %w", err)
+		return nil, err
 	}
-	keyFile := keyFileHandle.Name()
+	config.closers = append(config.closers, closeDialer)
 
-	if _, err := keyFileHandle.Write([]byte(jumpboxKeyStr)); err != nil {
-		if closeErr := keyFileHandle.Close(); closeErr != nil {
-			os.Remove(keyFile)
-			return nil, fmt.Errorf("failed to close jumpbox key file after write error: %w", closeErr)
-		}
-		os.Remove(keyFile)
-		return nil, fmt.Errorf("failed to write jumpbox key: %w", err)
+	// Create director config
+	directorConfig, err := boshdir.NewConfigFromURL(config.Environment)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Building director config from URL '%s'", config.Environment)
 	}
 
-	if err := keyFileHandle.Close(); err != nil {
-		os.Remove(keyFile)
-		return nil, fmt.Errorf("failed to close jumpbox key file: %w", err)
+	// Create UAA config for authentication
+	// UAA runs on a different port (8443) than the director (25555)
+	uaaConfig, err := boshuaa.NewConfigFromURL(config.UAAURL)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Building UAA config from URL '%s'", config.UAAURL)
 	}
 
-	// Set restrictive permissions
-	if err := os.Chmod(keyFile, 0600); err != nil {
-		os.Remove(keyFile)
-		return nil, fmt.Errorf("failed to set permissions on jumpbox key: %w", err)
+	uaaHTTPClient, err := newHTTPClient(config.UAACACert, dialContext)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Building UAA HTTP client")
 	}
+	uaaEndpoint := url.URL{
+		Scheme: "https",
+		Host:   net.JoinHostPort(uaaConfig.Host, strconv.Itoa(uaaConfig.Port)),
+		Path:   uaaConfig.Path,
+	}
+	uaa := boshuaa.NewClient(
+		uaaEndpoint.String(),
+		config.Client,
+		config.ClientSecret,
+		boshhttp.NewHTTPClient(boshhttp.NewNetworkSafeRetryClient(uaaHTTPClient, 5, 500*time.Millisecond, logger), logger),
+		logger,
+	)
+
+	// Acquire bearer tokens from UAA for director API requests
+	// NOTE: We intentionally do NOT pass config.Client and config.ClientSecret to the auth adjustment.
+	// The bosh-cli library's AuthRequestAdjustment checks for username first, and if set,
+	// uses Basic auth instead of the token function.
+	tokenSession := &clientTokenSession{
+		uaa:   uaa,
+		cache: tokencache.Default(),
+		key:   tokencache.Key{UAAURL: uaaEndpoint.String(), Client: config.Client, ClientSecret: config.ClientSecret},
+	}
+	authAdjustment := boshdir.NewAuthRequestAdjustment(tokenSession.TokenFunc, "", "")
 
-	// Get the host address where ports are exposed
-	// For Docker this is 127.0.0.1, for remote Incus this is the Incus server IP
-	hostAddress := containerClient.GetHostAddress()
-
-	// Determine if we need BOSH_ALL_PROXY based on network access method
-	// Try to cast to CPI interface to check if direct network access is available
-	var allProxy string
-	type networkAccessChecker interface {
-		HasDirectNetworkAccess() bool
+	// The director HTTP client matches the one of the bosh-cli factory, which takes its
+	// dialer from BOSH_ALL_PROXY, but dials with the dialer of this client
+	rawClient, err := newHTTPClient(config.CACert, dialContext)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Building director HTTP client")
 	}
-	if checker, ok := containerClient.(networkAccessChecker); ok {
-		// Use CPI's explicit declaration of network access method
-		if !checker.HasDirectNetworkAccess() {
-			allProxy = fmt.Sprintf("ssh+socks5://jumpbox@%s:2222?private-key=%s", hostAddress, keyFile)
+	directorHost := net.JoinHostPort(directorConfig.Host, strconv.Itoa(directorConfig.Port))
+	rawClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > 10 {
+			return bosherr.Error("Too many redirects")
 		}
-	} else {
-		// Fallback: check if localhost (Docker-like setup that needs proxy)
-		if hostAddress == "127.0.0.1" || hostAddress == "localhost" {
-			allProxy = fmt.Sprintf("ssh+socks5://jumpbox@%s:2222?private-key=%s", hostAddress, keyFile)
+
+		// Since redirected requests are not retried,
+		// forcefully adjust auth token as this is the last chance.
+		if err := authAdjustment.Adjust(req, true); err != nil {
+			return err
 		}
-	}
 
-	return &Config{
-		Environment:        fmt.Sprintf("https://%s:25555", hostAddress),
-		Client:             "admin",
-		ClientSecret:       adminPasswordStr,
-		CACert:             directorCertStr,
-		AllProxy:           allProxy,
-		JumpboxKeyPath:     keyFile,
-		ConfigServerURL:    fmt.Sprintf("https://%s:8081", hostAddress),
-		ConfigServerClient: "director_config_server",
-		ConfigServerSecret: configServerSecretStr,
-		ConfigServerCACert: configServerCACertStr,
-		UAAURL:             fmt.Sprintf("https://%s:8443", hostAddress),
-		UAACACert:          directorCertStr, // UAA uses same CA as director
-	}, nil
-}
+		// The director redirects task output to its own (possibly internal) address
+		req.URL.Host = directorHost
 
-// NewDirector creates a BOSH director client using the provided configuration
-func NewDirector(config *Config, logger boshlog.Logger) (boshdir.Director, error) {
-	// Protect global state manipulation with a mutex for thread safety
-	dialerMutex.Lock()
-
-	// Clear stale BOSH environment variables to ensure the bosh-cli library
-	// uses only our explicitly provided configuration, not stale shell env vars.
-	// This is critical because the user may have BOSH_* vars set from a previous
-	// session (e.g., via `eval $(ibosh print-env)`), which would override our
-	// programmatic configuration.
-	os.Unsetenv("BOSH_CLIENT")
-	os.Unsetenv("BOSH_CLIENT_SECRET")
-	os.Unsetenv("BOSH_CA_CERT")
-	os.Unsetenv("BOSH_ENVIRONMENT")
-
-	// Set BOSH_ALL_PROXY if configured, otherwise unset it.
-	// The bosh-utils library reads this environment variable to configure
-	// the HTTP client's dialer for SOCKS5 proxy support (e.g., via SSH jumpbox).
-	if config.AllProxy != "" {
-		os.Setenv("BOSH_ALL_PROXY", config.AllProxy)
-	} else {
-		os.Unsetenv("BOSH_ALL_PROXY")
+		authValue := req.Header.Get("Authorization")
+		req.Header = make(map[string][]string)
+		if authValue != "" {
+			req.Header.Add("Authorization", authValue)
+		}
+		req.Body = nil
+
+		return nil
 	}
 
-	// Reset the HTTP client dialer to pick up the environment variable change.
-	// The bosh-utils library caches the dialer with proxy settings at package init time,
-	// so we must explicitly reset it after changing BOSH_ALL_PROXY.
-	boshhttp.ResetDialerContext()
+	retryClient := boshhttp.NewNetworkSafeRetryClient(rawClient, 5, 500*time.Millisecond, logger)
+	authedClient := boshdir.NewAdjustableClient(retryClient, authAdjustment)
+	httpClient := boshhttp.NewHTTPClientOpts(authedClient, logger, boshhttp.Opts{NoRedactUrlQuery: true})
 
-	dialerMutex.Unlock()
+	directorEndpoint := url.URL{Scheme: "https", Host: directorHost}
+	client := boshdir.NewClient(directorEndpoint.String(), httpClient, taskReporter, boshdir.NewNoopFileReporter(), logger)
 
-	// Create director config
-	directorConfig, err := boshdir.NewConfigFromURL(config.Environment)
-	if err != nil {
-		return nil, bosherr.WrapErrorf(err, "Building director config from URL '%s'", config.Environment)
+	return newDirectorImpl(client)
+}
+
+// newDirectorImpl wraps a director API client in a boshdir.DirectorImpl.
+// bosh-cli only builds DirectorImpl in its factory, which takes the dialer from the
+// process-wide BOSH_ALL_PROXY environment variable, so its single client field is set directly.
+func newDirectorImpl(client boshdir.Client) (boshdir.Director, error) {
+	implType := reflect.TypeOf(boshdir.DirectorImpl{})
+	if implType.NumField() != 1 || implType.Field(0).Type != reflect.TypeOf(boshdir.Client{}) {
+		return nil, fmt.Errorf("unsupported bosh-cli version: unexpected director.DirectorImpl layout")
 	}
 
-	directorConfig.CACert = config.CACert
-	// NOTE: We intentionally do NOT set directorConfig.Client and directorConfig.ClientSecret here.
-	// The bosh-cli library's AuthRequestAdjustment checks for username first, and if set,
-	// uses Basic auth instead of the TokenFunc. Since we use UAA token-based auth,
-	// we only set TokenFunc below and leave Client/ClientSecret empty on the director config.
+	var director boshdir.DirectorImpl
+	*(*boshdir.Client)(unsafe.Pointer(&director)) = client
+	return director, nil
+}
 
-	// Create UAA config for authentication
-	// UAA runs on a different port (8443) than the director (25555)
-	uaaConfig, err := boshuaa.NewConfigFromURL(config.UAAURL)
-	if err != nil {
-		return nil, bosherr.WrapErrorf(err, "Building UAA config from URL '%s'", config.UAAURL)
+// NewDialer returns a dialer reaching the director network, used for the director and
+// UAA connections and for SSH connections to deployment VMs. The returned function
+// closes the SSH connection of a jumpbox dialer.
+func (c *Config) NewDialer() (DialContextFunc, func() error, error) {
+	if c.AllProxy == "" {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		return dialer.DialContext, func() error { return nil }, nil
 	}
-	uaaConfig.CACert = config.UAACACert
-	uaaConfig.Client = config.Client
-	uaaConfig.ClientSecret = config.ClientSecret
 
-	// Create UAA client
-	uaaFactory := boshuaa.NewFactory(logger)
-	uaa, err := uaaFactory.New(uaaConfig)
+	jumpboxDialer, err := NewJumpboxDialerFromProxyURL(c.AllProxy)
 	if err != nil {
-		return nil, bosherr.WrapError(err, "Building UAA client")
+		return nil, nil, fmt.Errorf("creating jumpbox dialer: %w", err)
+	}
+	return jumpboxDialer.DialContext, jumpboxDialer.Close, nil
+}
+
+// newHTTPClient creates an HTTP client trusting caCert that dials with dialContext.
+// It matches the transport settings of the bosh-utils default client.
+func newHTTPClient(caCert string, dialContext DialContextFunc) (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caCert != "" {
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, fmt.Errorf("parsing CA certificate")
+		}
+		tlsConfig.RootCAs = certPool
 	}
 
-	// Create token function for UAA-based authentication
-	// This will acquire a bearer token from UAA and use it for director API requests
-	directorConfig.TokenFunc = boshuaa.NewClientTokenSession(uaa).TokenFunc
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:     tlsConfig,
+			DialContext:         dialContext,
+			TLSHandshakeTimeout: 30 * time.Second,
+			DisableKeepAlives:   true,
+		},
+	}, nil
+}
+
+// clientTokenSession acquires UAA tokens with the client credentials grant,
+// like boshuaa.ClientTokenSession, re-using the token until the director rejects it.
+// Tokens are shared with other invocations and the config-server client through the token cache.
+type clientTokenSession struct {
+	uaa   boshuaa.Client
+	cache *tokencache.Cache
+	key   tokencache.Key
+	mu    sync.Mutex
+	token string
+}
+
+// TokenFunc returns the authorization header value for director requests.
+func (s *clientTokenSession) TokenFunc(retried bool) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == "" || retried {
+		token, err := s.cache.Token(s.key, retried, s.requestToken)
+		if err != nil {
+			return "", err
+		}
+		s.token = token.Type + " " + token.AccessToken
+	}
 
-	// Create director factory
-	directorFactory := boshdir.NewFactory(logger)
+	return s.token, nil
+}
 
-	// Create director client
-	director, err := directorFactory.New(directorConfig, boshdir.NewNoopTaskReporter(), boshdir.NewNoopFileReporter())
+// requestToken requests a new token from UAA. Its expiry is read from the token itself,
+// tokens without one are not cached.
+func (s *clientTokenSession) requestToken() (tokencache.Token, error) {
+	resp, err := s.uaa.ClientCredentialsGrant()
 	if err != nil {
-		return nil, bosherr.WrapError(err, "Building director client")
+		return tokencache.Token{}, err
 	}
 
-	return director, nil
+	token := tokencache.Token{Type: resp.Type, AccessToken: resp.AccessToken}
+	if info, err := boshuaa.NewTokenInfoFromValue(resp.AccessToken); err == nil && info.ExpiredAt > 0 {
+		token.ExpiresAt = time.Unix(int64(info.ExpiredAt), 0)
+	}
+	return token, nil
 }
 
 func extractYAMLValue(data map[string]interface{}, key string) (interface{}, error) {
@@ -0,0 +1,179 @@
+package director_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rkoster/instant-bosh/internal/container/containerfakes"
+	"github.com/rkoster/instant-bosh/internal/director"
+	"github.com/rkoster/instant-bosh/internal/state"
+)
+
+func varsStoreYAML(adminPassword string) string {
+	return fmt.Sprintf(`admin_password: %s
+director_ssl:
+  ca: director-ca
+jumpbox_ssh:
+  private_key: jumpbox-key
+director_config_server_client_secret: config-server-secret
+config_server_ssl:
+  ca: config-server-ca
+`, adminPassword)
+}
+
+// directContainerClient is a container client of a CPI whose instances are reachable
+// without the jumpbox
+type directContainerClient struct {
+	*containerfakes.FakeClient
+}
+
+func (directContainerClient) HasDirectNetworkAccess() bool { return true }
+
+func TestGetDirectorConfig(t *testing.T) {
+	t.Setenv(state.EnvStateDir, t.TempDir())
+
+	containerClient := &containerfakes.FakeClient{}
+	containerClient.GetHostAddressReturns("127.0.0.1")
+	containerClient.ExecCommandReturns(varsStoreYAML("secret"), nil)
+
+	// Without local state the vars store is read from the container
+	config, err := director.GetDirectorConfig(context.Background(), containerClient, "instant-bosh")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if containerClient.ExecCommandCallCount() != 1 {
+		t.Fatalf("expected the vars store to be read once, got %d calls", containerClient.ExecCommandCallCount())
+	}
+	if _, name, cmd := containerClient.ExecCommandArgsForCall(0); name != "instant-bosh" || cmd[1] != "/var/vcap/store/vars-store.yml" {
+		t.Errorf("unexpected exec of %v in %s", cmd, name)
+	}
+	if config.ClientSecret != "secret" || config.CACert != "director-ca" || config.ConfigServerCACert != "config-server-ca" {
+		t.Errorf("unexpected credentials %+v", config)
+	}
+	// Docker-like hosts reach the director network through the jumpbox
+	if !strings.HasPrefix(config.AllProxy, "ssh+socks5://jumpbox@127.0.0.1:2222?private-key=") {
+		t.Errorf("expected a jumpbox proxy, got %s", config.AllProxy)
+	}
+
+	// The stored state is used afterwards, without exec-ing into the container
+	containerClient.ExecCommandReturns(varsStoreYAML("changed"), nil)
+	config, err = director.GetDirectorConfig(context.Background(), containerClient, "instant-bosh")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if containerClient.ExecCommandCallCount() != 1 {
+		t.Errorf("expected the local state to be used, got %d calls", containerClient.ExecCommandCallCount())
+	}
+	if config.ClientSecret != "secret" {
+		t.Errorf("expected the stored secret, got %s", config.ClientSecret)
+	}
+
+	// Without state, an unreachable container is an error
+	other := &containerfakes.FakeClient{}
+	other.ExecCommandReturns("", errors.New("container not running"))
+	if _, err := director.GetDirectorConfig(context.Background(), other, "other"); err == nil {
+		t.Error("expected error when the vars store can't be read")
+	}
+}
+
+func TestRefreshDirectorConfig(t *testing.T) {
+	t.Setenv(state.EnvStateDir, t.TempDir())
+
+	containerClient := &containerfakes.FakeClient{}
+	containerClient.GetHostAddressReturns("127.0.0.1")
+	containerClient.ExecCommandReturns(varsStoreYAML("secret"), nil)
+	if _, err := director.GetDirectorConfig(context.Background(), containerClient, "instant-bosh"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A recreated director has new credentials, refreshing replaces the stored state
+	containerClient.ExecCommandReturns(varsStoreYAML("rotated"), nil)
+	image := state.Image{Ref: "ghcr.io/rkoster/instant-bosh@sha256:abc", Digest: "sha256:abc"}
+	config, err := director.RefreshDirectorConfig(context.Background(), containerClient, "instant-bosh", image)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if containerClient.ExecCommandCallCount() != 2 {
+		t.Errorf("expected the vars store to be read again, got %d calls", containerClient.ExecCommandCallCount())
+	}
+	if config.ClientSecret != "rotated" {
+		t.Errorf("expected the refreshed secret, got %s", config.ClientSecret)
+	}
+
+	s, err := state.Load("instant-bosh")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Director.ClientSecret != "rotated" || s.Image != image {
+		t.Errorf("expected the refreshed state to be stored, got %+v", s)
+	}
+	config, err = director.GetDirectorConfig(context.Background(), containerClient, "instant-bosh")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.ClientSecret != "rotated" {
+		t.Errorf("expected the refreshed secret from the local state, got %s", config.ClientSecret)
+	}
+}
+
+func TestRefreshDirectorConfig_NetworkAccess(t *testing.T) {
+	t.Setenv(state.EnvStateDir, t.TempDir())
+
+	fake := &containerfakes.FakeClient{}
+	fake.GetHostAddressReturns("10.0.0.5")
+	fake.ExecCommandReturns(varsStoreYAML("secret"), nil)
+
+	// A remote host without a declared network access method is reached directly
+	config, err := director.RefreshDirectorConfig(context.Background(), fake, "remote", state.Image{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.AllProxy != "" {
+		t.Errorf("expected no proxy for a remote host, got %s", config.AllProxy)
+	}
+
+	// The CPI declares direct access even on localhost
+	config, err = director.RefreshDirectorConfig(context.Background(), directContainerClient{fake}, "direct", state.Image{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.AllProxy != "" {
+		t.Errorf("expected no proxy with direct network access, got %s", config.AllProxy)
+	}
+}
+
+func TestConfigFromState(t *testing.T) {
+	s := &state.State{
+		HostAddress: "127.0.0.1",
+		Ports: state.Ports{
+			Director:     director.DirectorPort,
+			SSH:          director.JumpboxSSHPort,
+			ConfigServer: director.ConfigServerPort,
+			UAA:          director.UAAPort,
+		},
+		Director:       state.Credentials{Client: "admin", ClientSecret: "secret", CACert: "director-ca"},
+		ConfigServer:   state.Credentials{Client: "director_config_server", ClientSecret: "cs-secret", CACert: "cs-ca"},
+		UAACACert:      "director-ca",
+		JumpboxKeyPath: "/state/instant-bosh/jumpbox.key",
+	}
+
+	config := director.ConfigFromState(s)
+	if config.Environment != "https://127.0.0.1:25555" || config.UAAURL != "https://127.0.0.1:8443" || config.ConfigServerURL != "https://127.0.0.1:8081" {
+		t.Errorf("unexpected endpoints %s, %s and %s", config.Environment, config.UAAURL, config.ConfigServerURL)
+	}
+	if config.ConfigServerClient != "director_config_server" || config.ConfigServerSecret != "cs-secret" {
+		t.Errorf("unexpected config-server credentials %+v", config)
+	}
+	expectedProxy := "ssh+socks5://jumpbox@127.0.0.1:2222?private-key=/state/instant-bosh/jumpbox.key"
+	if config.AllProxy != expectedProxy {
+		t.Errorf("expected proxy %s, got %s", expectedProxy, config.AllProxy)
+	}
+
+	s.DirectNetworkAccess = true
+	if config := director.ConfigFromState(s); config.AllProxy != "" {
+		t.Errorf("expected no proxy with direct network access, got %s", config.AllProxy)
+	}
+}
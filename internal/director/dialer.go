@@ -0,0 +1,159 @@
+package director
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DialContextFunc dials a network connection, matching net.Dialer.DialContext.
+type DialContextFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// JumpboxDialer dials connections through an SSH connection to a jumpbox, like
+// BOSH_ALL_PROXY=ssh+socks5://... does for the BOSH CLI, but without process-wide state.
+// Every director client gets its own dialer, so clients for different directors
+// (e.g. instant-bosh and a nested warden director) can be used at the same time.
+// The SSH connection is opened on first use and shared by all connections of the dialer.
+type JumpboxDialer struct {
+	address string
+	config  *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// NewJumpboxDialer creates a dialer for a jumpbox address (host:port), user and PEM encoded private key.
+func NewJumpboxDialer(address, user string, privateKey []byte) (*JumpboxDialer, error) {
+	signer, err := ssh.ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("parsing jumpbox private key: %w", err)
+	}
+
+	return &JumpboxDialer{
+		address: address,
+		config: &ssh.ClientConfig{
+			User: user,
+			Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			// The jumpbox host key is generated when the director is created and is not
+			// distributed, the BOSH CLI does not verify it either.
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         30 * time.Second,
+		},
+	}, nil
+}
+
+// NewJumpboxDialerFromProxyURL creates a dialer from a BOSH_ALL_PROXY style URL
+// (ssh+socks5://jumpbox@host:port?private-key=/path/to/key).
+func NewJumpboxDialerFromProxyURL(allProxy string) (*JumpboxDialer, error) {
+	if !strings.HasPrefix(allProxy, "ssh+") {
+		return nil, fmt.Errorf("unsupported proxy URL %q: only ssh+socks5:// is supported", allProxy)
+	}
+
+	proxyURL, err := url.Parse(strings.TrimPrefix(allProxy, "ssh+"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing proxy URL: %w", err)
+	}
+
+	keyPath := proxyURL.Query().Get("private-key")
+	if keyPath == "" {
+		return nil, fmt.Errorf("proxy URL is missing the private-key query parameter")
+	}
+	privateKey, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading jumpbox private key: %w", err)
+	}
+
+	user := "jumpbox"
+	if proxyURL.User != nil && proxyURL.User.Username() != "" {
+		user = proxyURL.User.Username()
+	}
+
+	return NewJumpboxDialer(proxyURL.Host, user, privateKey)
+}
+
+// DialContext opens a connection to address from the jumpbox.
+// A broken SSH connection (e.g. after the director restarted) is re-established once.
+func (d *JumpboxDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	client, err := d.sshClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := client.DialContext(ctx, network, address)
+	if err == nil {
+		return conn, nil
+	}
+	// The jumpbox rejecting the target (e.g. connection refused) or a cancelled dial
+	// leave the SSH connection, and the other connections through it, intact
+	var openChannelErr *ssh.OpenChannelError
+	if errors.As(err, &openChannelErr) || ctx.Err() != nil {
+		return nil, fmt.Errorf("dialing %s through jumpbox %s: %w", address, d.address, err)
+	}
+
+	d.reset(client)
+	client, reconnectErr := d.sshClient(ctx)
+	if reconnectErr != nil {
+		return nil, fmt.Errorf("dialing %s through jumpbox %s: %w", address, d.address, err)
+	}
+	conn, err = client.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s through jumpbox %s: %w", address, d.address, err)
+	}
+	return conn, nil
+}
+
+// Close closes the SSH connection to the jumpbox.
+func (d *JumpboxDialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client == nil {
+		return nil
+	}
+	err := d.client.Close()
+	d.client = nil
+	return err
+}
+
+func (d *JumpboxDialer) sshClient(ctx context.Context) (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	dialer := &net.Dialer{Timeout: d.config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", d.address)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to jumpbox %s: %w", d.address, err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, d.address, d.config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("opening SSH connection to jumpbox %s: %w", d.address, err)
+	}
+
+	d.client = ssh.NewClient(sshConn, chans, reqs)
+	return d.client, nil
+}
+
+// reset drops a broken SSH connection, unless another dial already replaced it.
+func (d *JumpboxDialer) reset(client *ssh.Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client == client {
+		d.client.Close()
+		d.client = nil
+	}
+}
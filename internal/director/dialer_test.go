@@ -0,0 +1,248 @@
+package director
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/rkoster/instant-bosh/internal/tokencache"
+	"golang.org/x/crypto/ssh"
+)
+
+// startJumpbox starts an SSH server that accepts the given client key and forwards
+// direct-tcpip channels, like the jumpbox on the director. It returns its address.
+func startJumpbox(t *testing.T, authorizedKey ssh.PublicKey) string {
+	t.Helper()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("creating host signer: %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "jumpbox" && string(key.Marshal()) == string(authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					if newChannel.ChannelType() != "direct-tcpip" {
+						newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+						continue
+					}
+					// RFC 4254 7.2: host to connect (string), port (uint32), originator...
+					data := newChannel.ExtraData()
+					hostLen := binary.BigEndian.Uint32(data[:4])
+					host := string(data[4 : 4+hostLen])
+					port := binary.BigEndian.Uint32(data[4+hostLen : 8+hostLen])
+
+					target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10)))
+					if err != nil {
+						newChannel.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						target.Close()
+						continue
+					}
+					go ssh.DiscardRequests(requests)
+					go func() {
+						defer channel.Close()
+						defer target.Close()
+						go io.Copy(target, channel)
+						io.Copy(channel, target)
+					}()
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestJumpboxDialer(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating client key: %v", err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("converting public key: %v", err)
+	}
+	pemBlock, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		t.Fatalf("marshalling private key: %v", err)
+	}
+
+	jumpboxAddress := startJumpbox(t, sshPublicKey)
+
+	// Target service only reachable "from the jumpbox"
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	dialer, err := NewJumpboxDialer(jumpboxAddress, "jumpbox", pem.EncodeToMemory(pemBlock))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer dialer.Close()
+
+	for i := 0; i < 2; i++ {
+		conn, err := dialer.DialContext(context.Background(), "tcp", target.Addr().String())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(buf) != "ping" {
+			t.Errorf("expected echo of ping, got %q", buf)
+		}
+		conn.Close()
+	}
+
+	// A target refusing the connection leaves the other connections through the jumpbox open
+	conn, err := dialer.DialContext(context.Background(), "tcp", target.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	refused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	refused.Close()
+	if _, err := dialer.DialContext(context.Background(), "tcp", refused.Addr().String()); err == nil {
+		t.Fatal("expected error dialing a closed port")
+	}
+	if _, err := conn.Write([]byte("pong")); err != nil {
+		t.Fatalf("expected the existing connection to stay open: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "pong" {
+		t.Errorf("expected echo of pong on the existing connection, got %q (%v)", buf, err)
+	}
+
+	// A closed SSH connection is re-established on the next dial
+	dialer.Close()
+	reconnected, err := dialer.DialContext(context.Background(), "tcp", target.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error after reconnect: %v", err)
+	}
+	reconnected.Close()
+}
+
+func TestNewJumpboxDialerFromProxyURL(t *testing.T) {
+	if _, err := NewJumpboxDialerFromProxyURL("socks5://127.0.0.1:1080"); err == nil {
+		t.Error("expected error for non-ssh proxy URL")
+	}
+	if _, err := NewJumpboxDialerFromProxyURL("ssh+socks5://jumpbox@127.0.0.1:2222"); err == nil {
+		t.Error("expected error for missing private key")
+	}
+	if _, err := NewJumpboxDialerFromProxyURL("ssh+socks5://jumpbox@127.0.0.1:2222?private-key=/does/not/exist"); err == nil {
+		t.Error("expected error for unreadable private key")
+	}
+}
+
+func TestNewDirector(t *testing.T) {
+	t.Setenv(tokencache.EnvDisable, "1")
+	// A stale proxy from the shell must neither be used nor changed
+	t.Setenv("BOSH_ALL_PROXY", "socks5://127.0.0.1:1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": "test-director", "cpi": "docker_cpi"})
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "token_type": "bearer", "expires_in": 3600})
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	config := &Config{
+		Environment:  server.URL,
+		Client:       "admin",
+		ClientSecret: "secret",
+		CACert:       caCert,
+		UAAURL:       server.URL,
+		UAACACert:    caCert,
+	}
+
+	director, err := NewDirector(config, boshlog.NewLogger(boshlog.LevelNone))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if proxy := os.Getenv("BOSH_ALL_PROXY"); proxy != "socks5://127.0.0.1:1" {
+		t.Errorf("expected BOSH_ALL_PROXY to be unchanged, got %q", proxy)
+	}
+
+	info, err := director.Info()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Name != "test-director" {
+		t.Errorf("expected director name test-director, got %q", info.Name)
+	}
+	if err := config.Cleanup(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/rkoster/instant-bosh/internal/container"
 	"github.com/rkoster/instant-bosh/internal/director"
+	"github.com/rkoster/instant-bosh/internal/state"
 )
 
 type FakeConfigProvider struct {
@@ -25,6 +26,22 @@ type FakeConfigProvider struct {
 		result1 *director.Config
 		result2 error
 	}
+	RefreshDirectorConfigStub        func(context.Context, container.Client, string, state.Image) (*director.Config, error)
+	refreshDirectorConfigMutex       sync.RWMutex
+	refreshDirectorConfigArgsForCall []struct {
+		arg1 context.Context
+		arg2 container.Client
+		arg3 string
+		arg4 state.Image
+	}
+	refreshDirectorConfigReturns struct {
+		result1 *director.Config
+		result2 error
+	}
+	refreshDirectorConfigReturnsOnCall map[int]struct {
+		result1 *director.Config
+		result2 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -95,6 +112,73 @@ func (fake *FakeConfigProvider) GetDirectorConfigReturnsOnCall(i int, result1 *d
 	}{result1, result2}
 }
 
+func (fake *FakeConfigProvider) RefreshDirectorConfig(arg1 context.Context, arg2 container.Client, arg3 string, arg4 state.Image) (*director.Config, error) {
+	fake.refreshDirectorConfigMutex.Lock()
+	ret, specificReturn := fake.refreshDirectorConfigReturnsOnCall[len(fake.refreshDirectorConfigArgsForCall)]
+	fake.refreshDirectorConfigArgsForCall = append(fake.refreshDirectorConfigArgsForCall, struct {
+		arg1 context.Context
+		arg2 container.Client
+		arg3 string
+		arg4 state.Image
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.RefreshDirectorConfigStub
+	fakeReturns := fake.refreshDirectorConfigReturns
+	fake.recordInvocation("RefreshDirectorConfig", []interface{}{arg1, arg2, arg3, arg4})
+	fake.refreshDirectorConfigMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeConfigProvider) RefreshDirectorConfigCallCount() int {
+	fake.refreshDirectorConfigMutex.RLock()
+	defer fake.refreshDirectorConfigMutex.RUnlock()
+	return len(fake.refreshDirectorConfigArgsForCall)
+}
+
+func (fake *FakeConfigProvider) RefreshDirectorConfigCalls(stub func(context.Context, container.Client, string, state.Image) (*director.Config, error)) {
+	fake.refreshDirectorConfigMutex.Lock()
+	defer fake.refreshDirectorConfigMutex.Unlock()
+	fake.RefreshDirectorConfigStub = stub
+}
+
+func (fake *FakeConfigProvider) RefreshDirectorConfigArgsForCall(i int) (context.Context, container.Client, string, state.Image) {
+	fake.refreshDirectorConfigMutex.RLock()
+	defer fake.refreshDirectorConfigMutex.RUnlock()
+	argsForCall := fake.refreshDirectorConfigArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeConfigProvider) RefreshDirectorConfigReturns(result1 *director.Config, result2 error) {
+	fake.refreshDirectorConfigMutex.Lock()
+	defer fake.refreshDirectorConfigMutex.Unlock()
+	fake.RefreshDirectorConfigStub = nil
+	fake.refreshDirectorConfigReturns = struct {
+		result1 *director.Config
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeConfigProvider) RefreshDirectorConfigReturnsOnCall(i int, result1 *director.Config, result2 error) {
+	fake.refreshDirectorConfigMutex.Lock()
+	defer fake.refreshDirectorConfigMutex.Unlock()
+	fake.RefreshDirectorConfigStub = nil
+	if fake.refreshDirectorConfigReturnsOnCall == nil {
+		fake.refreshDirectorConfigReturnsOnCall = make(map[int]struct {
+			result1 *director.Config
+			result2 error
+		})
+	}
+	fake.refreshDirectorConfigReturnsOnCall[i] = struct {
+		result1 *director.Config
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeConfigProvider) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
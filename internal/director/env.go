@@ -0,0 +1,76 @@
+package director
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rkoster/instant-bosh/internal/certs"
+)
+
+// ErrEnvNotConfigured is returned by NewConfigFromEnv when BOSH environment variables are missing
+type ErrEnvNotConfigured struct {
+	MissingVars []string
+}
+
+func (e *ErrEnvNotConfigured) Error() string {
+	return fmt.Sprintf("BOSH environment not configured. Missing: %s", strings.Join(e.MissingVars, ", "))
+}
+
+// NewConfigFromEnv returns the director configuration set by print-env (BOSH_ENVIRONMENT,
+// BOSH_CLIENT, BOSH_CLIENT_SECRET, BOSH_CA_CERT and optionally BOSH_ALL_PROXY), i.e. the
+// director the BOSH CLI targets. UAA_URL and UAA_CA_CERT default to the UAA of the director.
+func NewConfigFromEnv() (*Config, error) {
+	config := &Config{
+		Environment:  os.Getenv("BOSH_ENVIRONMENT"),
+		Client:       os.Getenv("BOSH_CLIENT"),
+		ClientSecret: os.Getenv("BOSH_CLIENT_SECRET"),
+		CACert:       os.Getenv("BOSH_CA_CERT"),
+		AllProxy:     os.Getenv("BOSH_ALL_PROXY"),
+		UAAURL:       os.Getenv("UAA_URL"),
+		UAACACert:    os.Getenv("UAA_CA_CERT"),
+	}
+
+	var missing []string
+	for _, v := range []struct{ name, value string }{
+		{"BOSH_ENVIRONMENT", config.Environment},
+		{"BOSH_CLIENT", config.Client},
+		{"BOSH_CLIENT_SECRET", config.ClientSecret},
+		{"BOSH_CA_CERT", config.CACert},
+	} {
+		if v.value == "" {
+			missing = append(missing, v.name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &ErrEnvNotConfigured{MissingVars: missing}
+	}
+
+	// The CA certificates may be given as paths (print-env --format direnv)
+	var err error
+	if config.CACert, err = certs.ReadCACert("BOSH_CA_CERT", config.CACert); err != nil {
+		return nil, err
+	}
+	if config.UAACACert == "" {
+		// UAA uses the same CA as the director
+		config.UAACACert = config.CACert
+	} else if config.UAACACert, err = certs.ReadCACert("UAA_CA_CERT", config.UAACACert); err != nil {
+		return nil, err
+	}
+
+	if config.UAAURL == "" {
+		environment := config.Environment
+		if !strings.Contains(environment, "://") {
+			environment = "https://" + environment
+		}
+		u, err := url.Parse(environment)
+		if err != nil {
+			return nil, fmt.Errorf("parsing BOSH_ENVIRONMENT: %w", err)
+		}
+		config.UAAURL = "https://" + net.JoinHostPort(u.Hostname(), UAAPort)
+	}
+
+	return config, nil
+}
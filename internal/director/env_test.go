@@ -0,0 +1,44 @@
+package director_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rkoster/instant-bosh/internal/director"
+)
+
+const testCACert = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+
+func TestNewConfigFromEnv(t *testing.T) {
+	caPath := filepath.Join(t.TempDir(), "director-ca.pem")
+	if err := os.WriteFile(caPath, []byte(testCACert), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("BOSH_ENVIRONMENT", "https://10.245.0.10:25555")
+	t.Setenv("BOSH_CLIENT", "admin")
+	t.Setenv("BOSH_CLIENT_SECRET", "secret")
+	t.Setenv("BOSH_CA_CERT", caPath)
+	t.Setenv("BOSH_ALL_PROXY", "")
+	t.Setenv("UAA_URL", "")
+	t.Setenv("UAA_CA_CERT", "")
+
+	config, err := director.NewConfigFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.CACert != testCACert || config.UAACACert != testCACert {
+		t.Errorf("expected CA certificates to be read from %s, got %q and %q", caPath, config.CACert, config.UAACACert)
+	}
+	if config.UAAURL != "https://10.245.0.10:8443" {
+		t.Errorf("expected UAA URL of the director, got %s", config.UAAURL)
+	}
+
+	t.Setenv("BOSH_CLIENT_SECRET", "")
+	var notConfigured *director.ErrEnvNotConfigured
+	if _, err := director.NewConfigFromEnv(); !errors.As(err, &notConfigured) || len(notConfigured.MissingVars) != 1 {
+		t.Errorf("expected missing BOSH_CLIENT_SECRET, got %v", err)
+	}
+}
@@ -22,6 +22,8 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	ibregistry "github.com/rkoster/instant-bosh/internal/registry"
 	"gopkg.in/yaml.v3"
 )
 
@@ -113,7 +115,10 @@ type Client struct {
 	logTag           string
 	socketPath       string
 	imageName        string
+	platform         string // explicit platform (e.g. "linux/arm64"), empty for the daemon platform
+	registryClient   ibregistry.Client
 	readinessChecker ReadinessChecker
+	networkAccess    networkAccess
 }
 
 // getDockerHost attempts to get the Docker host from the current context
@@ -226,11 +231,20 @@ func (c *Client) Close() error {
 }
 
 // GetHostAddress returns the address where BOSH director ports are exposed.
-// For Docker, this is always "127.0.0.1" since Docker forwards ports locally.
+// For Docker, this is "127.0.0.1" since Docker forwards ports locally, or the
+// container IP when the host can route to the instant-bosh network.
 func (c *Client) GetHostAddress() string {
+	if c.HasDirectNetworkAccess() {
+		return ContainerIP
+	}
 	return "127.0.0.1"
 }
 
+// EnvironmentName names the local state directory of the Docker environment.
+func (c *Client) EnvironmentName() string {
+	return "docker"
+}
+
 func (c *Client) VolumeExists(ctx context.Context, name string) (bool, error) {
 	c.logger.Debug(c.logTag, "Checking if volume %s exists", name)
 	_, err := c.cli.VolumeInspect(ctx, name)
@@ -342,7 +356,7 @@ func (c *Client) StartContainer(ctx context.Context) error {
 		},
 	}
 
-	resp, err := c.cli.ContainerCreate(ctx, config, hostConfig, networkConfig, nil, ContainerName)
+	resp, err := c.cli.ContainerCreate(ctx, config, hostConfig, networkConfig, c.ociPlatform(), ContainerName)
 	if err != nil {
 		return fmt.Errorf("creating container: %w", err)
 	}
@@ -486,6 +500,7 @@ type ContainerInfo struct {
 	Name    string
 	Created time.Time
 	Network string
+	IP      string
 }
 
 // GetContainersOnNetworkDetailed returns detailed information about containers on the network
@@ -528,6 +543,7 @@ func (c *Client) GetContainersOnNetworkDetailed(ctx context.Context) ([]Containe
 				Name:    name,
 				Created: time.Unix(c.Created, 0),
 				Network: NetworkName,
+				IP:      strings.Split(networkResource.Containers[c.ID].IPv4Address, "/")[0],
 			})
 		}
 	}
@@ -583,10 +599,25 @@ type pullProgress struct {
 	ID       string `json:"id"`
 }
 
+// registryAuth returns the encoded explicit registry credentials for the image
+// (see registry.Auth), or an empty string to let the Docker daemon use its own credentials.
+func (c *Client) registryAuth() (string, error) {
+	auth, err := ibregistry.LoadAuth()
+	if err != nil {
+		return "", err
+	}
+	return auth.DockerRegistryAuth(c.imageName)
+}
+
 func (c *Client) PullImage(ctx context.Context) error {
 	c.logger.Info(c.logTag, "Pulling image %s...", c.imageName)
 
-	out, err := c.cli.ImagePull(ctx, c.imageName, image.PullOptions{})
+	registryAuth, err := c.registryAuth()
+	if err != nil {
+		return fmt.Errorf("loading registry credentials: %w", err)
+	}
+
+	out, err := c.cli.ImagePull(ctx, c.imageName, image.PullOptions{RegistryAuth: registryAuth, Platform: c.platform})
 	if err != nil {
 		return fmt.Errorf("pulling image: %w", err)
 	}
@@ -655,7 +686,12 @@ func (c *Client) CheckForImageUpdate(ctx context.Context) (bool, error) {
 
 	// Use Docker's native DistributionInspect API to get the remote manifest
 	// This properly handles authentication and avoids direct HTTP calls to the registry
-	remoteInspect, err := c.cli.DistributionInspect(ctx, c.imageName, "")
+	registryAuth, err := c.registryAuth()
+	if err != nil {
+		return false, fmt.Errorf("loading registry credentials: %w", err)
+	}
+
+	remoteInspect, err := c.cli.DistributionInspect(ctx, c.imageName, registryAuth)
 	if err != nil {
 		// If we can't check the remote, return the error
 		// The caller can decide whether to treat this as no update or show a warning
@@ -750,6 +786,48 @@ func (c *Client) GetImageName() string {
 	return c.imageName
 }
 
+// SetPlatform sets an explicit platform (e.g. "linux/arm64") for image resolution,
+// pulls and new containers. By default the platform of the Docker daemon is used.
+func (c *Client) SetPlatform(platform string) {
+	c.platform = platform
+}
+
+// SetRegistryClient sets the registry client used to resolve image tags, so lookups share
+// its cache and refresh settings. By default a client with the on-disk cache is created.
+func (c *Client) SetRegistryClient(registryClient ibregistry.Client) {
+	c.registryClient = registryClient
+}
+
+// Platform returns the platform used to select images from multi-arch manifest lists:
+// the explicit platform if set, otherwise the OS and architecture of the Docker daemon.
+func (c *Client) Platform(ctx context.Context) (string, error) {
+	if c.platform != "" {
+		return c.platform, nil
+	}
+
+	version, err := c.cli.ServerVersion(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getting docker server version: %w", err)
+	}
+	return ibregistry.PlatformFromArchitecture(version.Arch), nil
+}
+
+// ociPlatform returns the explicit platform for container creation, or nil for the daemon default.
+func (c *Client) ociPlatform() *ocispec.Platform {
+	if c.platform == "" {
+		return nil
+	}
+	parts := strings.SplitN(c.platform, "/", 3)
+	if len(parts) < 2 {
+		return nil
+	}
+	platform := &ocispec.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform
+}
+
 // SetImageName sets the image name to use for new containers.
 // This is typically called with a digest-pinned reference (e.g., "ghcr.io/repo@sha256:...")
 // to ensure consistent image tracking across container restarts.
@@ -222,6 +222,33 @@ var _ = Describe("Docker Client", func() {
 		})
 	})
 
+	Describe("GetImageMetadata", func() {
+		var (
+			fakeDockerAPI *dockerfakes.FakeDockerAPI
+			client        *docker.Client
+		)
+
+		BeforeEach(func() {
+			fakeDockerAPI = &dockerfakes.FakeDockerAPI{}
+			client = docker.NewTestClient(fakeDockerAPI, logger, "test-image")
+		})
+
+		Context("when the registry is unreachable", func() {
+			It("resolves the version tag locally without pinning the manifest list digest", func() {
+				fakeDockerAPI.ImageInspectWithRawReturns(types.ImageInspect{
+					RepoTags:    []string{"127.0.0.1:1/cloudfoundry/ubuntu-noble-stemcell:latest", "127.0.0.1:1/cloudfoundry/ubuntu-noble-stemcell:1.165"},
+					RepoDigests: []string{"127.0.0.1:1/cloudfoundry/ubuntu-noble-stemcell@sha256:index"},
+				}, nil, nil)
+
+				metadata, err := client.GetImageMetadata(context.Background(), "127.0.0.1:1/cloudfoundry/ubuntu-noble-stemcell:latest")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(metadata.Tag).To(Equal("1.165"))
+				Expect(metadata.FullReference).To(Equal("127.0.0.1:1/cloudfoundry/ubuntu-noble-stemcell:1.165"))
+				Expect(metadata.Digest).To(BeEmpty())
+			})
+		})
+	})
+
 	Describe("IsContainerImageDifferent", func() {
 		var (
 			fakeDockerAPI *dockerfakes.FakeDockerAPI
@@ -47,6 +47,7 @@ type DockerAPI interface {
 	VolumeInspect(ctx context.Context, volumeID string) (volume.Volume, error)
 
 	// Utility methods
+	ServerVersion(ctx context.Context) (types.Version, error)
 	Close() error
 	DaemonHost() string
 }
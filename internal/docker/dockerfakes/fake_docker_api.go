@@ -284,6 +284,19 @@ type FakeDockerAPI struct {
 	networkRemoveReturnsOnCall map[int]struct {
 		result1 error
 	}
+	ServerVersionStub        func(context.Context) (types.Version, error)
+	serverVersionMutex       sync.RWMutex
+	serverVersionArgsForCall []struct {
+		arg1 context.Context
+	}
+	serverVersionReturns struct {
+		result1 types.Version
+		result2 error
+	}
+	serverVersionReturnsOnCall map[int]struct {
+		result1 types.Version
+		result2 error
+	}
 	VolumeCreateStub        func(context.Context, volume.CreateOptions) (volume.Volume, error)
 	volumeCreateMutex       sync.RWMutex
 	volumeCreateArgsForCall []struct {
@@ -1545,6 +1558,70 @@ func (fake *FakeDockerAPI) NetworkRemoveReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeDockerAPI) ServerVersion(arg1 context.Context) (types.Version, error) {
+	fake.serverVersionMutex.Lock()
+	ret, specificReturn := fake.serverVersionReturnsOnCall[len(fake.serverVersionArgsForCall)]
+	fake.serverVersionArgsForCall = append(fake.serverVersionArgsForCall, struct {
+		arg1 context.Context
+	}{arg1})
+	stub := fake.ServerVersionStub
+	fakeReturns := fake.serverVersionReturns
+	fake.recordInvocation("ServerVersion", []interface{}{arg1})
+	fake.serverVersionMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeDockerAPI) ServerVersionCallCount() int {
+	fake.serverVersionMutex.RLock()
+	defer fake.serverVersionMutex.RUnlock()
+	return len(fake.serverVersionArgsForCall)
+}
+
+func (fake *FakeDockerAPI) ServerVersionCalls(stub func(context.Context) (types.Version, error)) {
+	fake.serverVersionMutex.Lock()
+	defer fake.serverVersionMutex.Unlock()
+	fake.ServerVersionStub = stub
+}
+
+func (fake *FakeDockerAPI) ServerVersionArgsForCall(i int) context.Context {
+	fake.serverVersionMutex.RLock()
+	defer fake.serverVersionMutex.RUnlock()
+	argsForCall := fake.serverVersionArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDockerAPI) ServerVersionReturns(result1 types.Version, result2 error) {
+	fake.serverVersionMutex.Lock()
+	defer fake.serverVersionMutex.Unlock()
+	fake.ServerVersionStub = nil
+	fake.serverVersionReturns = struct {
+		result1 types.Version
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDockerAPI) ServerVersionReturnsOnCall(i int, result1 types.Version, result2 error) {
+	fake.serverVersionMutex.Lock()
+	defer fake.serverVersionMutex.Unlock()
+	fake.ServerVersionStub = nil
+	if fake.serverVersionReturnsOnCall == nil {
+		fake.serverVersionReturnsOnCall = make(map[int]struct {
+			result1 types.Version
+			result2 error
+		})
+	}
+	fake.serverVersionReturnsOnCall[i] = struct {
+		result1 types.Version
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeDockerAPI) VolumeCreate(arg1 context.Context, arg2 volume.CreateOptions) (volume.Volume, error) {
 	fake.volumeCreateMutex.Lock()
 	ret, specificReturn := fake.volumeCreateReturnsOnCall[len(fake.volumeCreateArgsForCall)]
@@ -0,0 +1,53 @@
+package docker
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EnvDirectNetwork forces (true) or disables (false) direct routing from the host to the
+// instant-bosh network. When unset, direct access is detected by connecting to the director.
+const EnvDirectNetwork = "IBOSH_DOCKER_DIRECT_NETWORK"
+
+// directNetworkProbeTimeout bounds the detection on hosts without a route, where the
+// connection attempt hangs instead of failing (e.g. Docker Desktop on macOS).
+const directNetworkProbeTimeout = time.Second
+
+// networkAccess caches the direct network access detection of a client.
+type networkAccess struct {
+	once   sync.Once
+	direct bool
+}
+
+// HasDirectNetworkAccess reports whether the host can route to the instant-bosh network
+// (10.245.0.0/16). This is the case with a native Linux Docker daemon, or when a route to
+// the bridge network has been set up (e.g. with docker-mac-net-connect). The result is
+// cached for the lifetime of the client.
+func (c *Client) HasDirectNetworkAccess() bool {
+	c.networkAccess.once.Do(func() {
+		c.networkAccess.direct = DetectDirectNetworkAccess(os.Getenv(EnvDirectNetwork), probeDirector)
+		c.logger.Debug(c.logTag, "Direct network access to %s: %t", NetworkSubnet, c.networkAccess.direct)
+	})
+	return c.networkAccess.direct
+}
+
+// DetectDirectNetworkAccess applies the EnvDirectNetwork override and falls back to probe.
+func DetectDirectNetworkAccess(override string, probe func() bool) bool {
+	if direct, err := strconv.ParseBool(override); err == nil {
+		return direct
+	}
+	return probe()
+}
+
+// probeDirector connects to the director on its container IP.
+func probeDirector() bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ContainerIP, DirectorPort), directNetworkProbeTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,39 @@
+package docker_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rkoster/instant-bosh/internal/docker"
+)
+
+var _ = Describe("DetectDirectNetworkAccess", func() {
+	var probed bool
+	probe := func(result bool) func() bool {
+		return func() bool {
+			probed = true
+			return result
+		}
+	}
+
+	BeforeEach(func() {
+		probed = false
+	})
+
+	It("probes the director when no override is set", func() {
+		Expect(docker.DetectDirectNetworkAccess("", probe(true))).To(BeTrue())
+		Expect(probed).To(BeTrue())
+
+		Expect(docker.DetectDirectNetworkAccess("", probe(false))).To(BeFalse())
+	})
+
+	It("uses the override without probing", func() {
+		Expect(docker.DetectDirectNetworkAccess("true", probe(false))).To(BeTrue())
+		Expect(docker.DetectDirectNetworkAccess("false", probe(true))).To(BeFalse())
+		Expect(probed).To(BeFalse())
+	})
+
+	It("ignores an invalid override", func() {
+		Expect(docker.DetectDirectNetworkAccess("sometimes", probe(true))).To(BeTrue())
+		Expect(probed).To(BeTrue())
+	})
+})
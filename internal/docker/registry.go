@@ -2,6 +2,7 @@ package docker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/types/ref"
+	ibregistry "github.com/rkoster/instant-bosh/internal/registry"
 )
 
 // ImageMetadata contains resolved image information
@@ -21,7 +23,8 @@ type ImageMetadata struct {
 }
 
 // GetImageMetadata resolves an image reference and retrieves its metadata.
-// It tries the remote registry first, then falls back to local Docker daemon.
+// It tries the remote registry first, then falls back to local Docker daemon,
+// which doesn't know the platform digest of the image.
 func (c *Client) GetImageMetadata(ctx context.Context, imageRef string) (*ImageMetadata, error) {
 	c.logger.Debug(c.logTag, "Resolving image metadata for %s", imageRef)
 
@@ -30,19 +33,28 @@ func (c *Client) GetImageMetadata(ctx context.Context, imageRef string) (*ImageM
 	if err == nil {
 		c.logger.Debug(c.logTag, "Resolved from registry: %s -> %s", imageRef, metadata.FullReference)
 		
-		// If we got "latest" from registry, also try local to see if we can find a version tag there
+		// If we got "latest" from registry, also try local to see if we can find a version tag there.
+		// Only the tag is taken from the local image, its repo digest is the one of the manifest
+		// list instead of the platform digest resolved from the registry.
 		if metadata.Tag == "latest" {
 			c.logger.Debug(c.logTag, "Registry returned 'latest', trying local Docker daemon for version resolution")
 			localMetadata, localErr := c.getImageMetadataFromLocal(ctx, imageRef)
 			if localErr == nil && localMetadata.Tag != "latest" {
 				c.logger.Debug(c.logTag, "Local resolved 'latest' to version: %s", localMetadata.Tag)
-				return localMetadata, nil
+				metadata.Tag = localMetadata.Tag
+				metadata.FullReference = localMetadata.FullReference
 			}
 		}
-		
+
 		return metadata, nil
 	}
 
+	// The local image would be for the wrong platform, don't fall back
+	var platformErr *ibregistry.NoMatchingPlatformError
+	if errors.As(err, &platformErr) {
+		return nil, err
+	}
+
 	c.logger.Debug(c.logTag, "Failed to resolve from registry (%v), trying local Docker daemon", err)
 
 	// Fallback to local Docker daemon
@@ -57,31 +69,39 @@ func (c *Client) GetImageMetadata(ctx context.Context, imageRef string) (*ImageM
 
 // getImageMetadataFromRegistry resolves image metadata from a remote registry
 func (c *Client) getImageMetadataFromRegistry(ctx context.Context, imageRef string) (*ImageMetadata, error) {
-	// Create regclient with Docker credential helper support
-	rc := regclient.New(
-		regclient.WithDockerCreds(),
-		regclient.WithDockerCerts(),
-	)
-
 	// Parse the image reference
 	r, err := ref.New(imageRef)
 	if err != nil {
 		return nil, fmt.Errorf("parsing image reference: %w", err)
 	}
 
-	// Get the manifest to retrieve the digest
-	manifest, err := rc.ManifestGet(ctx, r)
+	// Create regclient with explicit registry credentials and Docker credential helper support
+	auth, err := ibregistry.LoadAuth()
+	if err != nil {
+		return nil, fmt.Errorf("loading registry credentials: %w", err)
+	}
+	opts, err := auth.RegClientOpts(r.Registry)
 	if err != nil {
-		return nil, fmt.Errorf("getting manifest: %w", err)
+		return nil, err
 	}
+	rc := regclient.New(opts...)
 
-	digest := manifest.GetDescriptor().Digest.String()
+	// Resolve the digest of the image for the target platform
+	platform, err := c.Platform(ctx)
+	if err != nil {
+		c.logger.Debug(c.logTag, "Failed to get daemon platform, using %s: %v", ibregistry.DefaultPlatform(), err)
+		platform = ibregistry.DefaultPlatform()
+	}
+	digest, manifestDigest, err := ibregistry.PlatformDigest(ctx, rc, r, platform)
+	if err != nil {
+		return nil, err
+	}
 
 	// If the tag is "latest", try to find a version tag with the same digest
 	resolvedTag := r.Tag
 	if r.Tag == "latest" {
 		c.logger.Debug(c.logTag, "Tag is 'latest', attempting to resolve to version tag")
-		versionTag, err := c.findVersionTagForDigest(ctx, rc, r, digest)
+		versionTag, err := c.findVersionTagForDigest(ctx, imageRef, manifestDigest)
 		if err != nil {
 			c.logger.Debug(c.logTag, "Could not resolve version tag: %v", err)
 			// Continue with "latest" if we can't find a version tag
@@ -103,44 +123,23 @@ func (c *Client) getImageMetadataFromRegistry(ctx context.Context, imageRef stri
 }
 
 // findVersionTagForDigest tries to find a version tag that points to the same digest
-func (c *Client) findVersionTagForDigest(ctx context.Context, rc *regclient.RegClient, r ref.Ref, targetDigest string) (string, error) {
-	// List all tags for the repository
-	tagList, err := rc.TagList(ctx, r)
-	if err != nil {
-		return "", fmt.Errorf("listing tags: %w", err)
+func (c *Client) findVersionTagForDigest(ctx context.Context, imageRef string, targetDigest string) (string, error) {
+	if c.registryClient == nil {
+		registryClient, err := ibregistry.NewClient(c.logger)
+		if err != nil {
+			return "", err
+		}
+		c.registryClient = registryClient
 	}
 
-	tags, err := tagList.GetTags()
+	// Tags are sorted with version tags first
+	tags, err := c.registryClient.FindTagsForDigest(ctx, imageRef, targetDigest)
 	if err != nil {
-		return "", fmt.Errorf("getting tags: %w", err)
+		return "", err
 	}
-
-	// Find version tags that match the target digest
-	for _, tag := range tags {
-		if !isVersionTag(tag) {
-			continue
-		}
-
-		// Create a reference for this tag
-		tagRef, err := ref.New(fmt.Sprintf("%s/%s:%s", r.Registry, r.Repository, tag))
-		if err != nil {
-			c.logger.Debug(c.logTag, "Failed to parse tag reference %s: %v", tag, err)
-			continue
-		}
-
-		// Get the manifest for this tag
-		manifest, err := rc.ManifestGet(ctx, tagRef)
-		if err != nil {
-			c.logger.Debug(c.logTag, "Failed to get manifest for tag %s: %v", tag, err)
-			continue
-		}
-
-		// Check if digest matches
-		if manifest.GetDescriptor().Digest.String() == targetDigest {
-			return tag, nil
-		}
+	if len(tags) > 0 && isVersionTag(tags[0]) {
+		return tags[0], nil
 	}
-
 	return "", nil
 }
 
@@ -151,7 +150,9 @@ func isVersionTag(tag string) bool {
 	return versionPattern.MatchString(tag)
 }
 
-// getImageMetadataFromLocal resolves image metadata from local Docker daemon
+// getImageMetadataFromLocal resolves image metadata from local Docker daemon.
+// The digest is left empty: the repo digests of a local image are manifest list digests,
+// which would not pin the platform of the image.
 func (c *Client) getImageMetadataFromLocal(ctx context.Context, imageRef string) (*ImageMetadata, error) {
 	// Inspect the local image
 	inspect, _, err := c.cli.ImageInspectWithRaw(ctx, imageRef)
@@ -162,20 +163,6 @@ func (c *Client) getImageMetadataFromLocal(ctx context.Context, imageRef string)
 		return nil, fmt.Errorf("inspecting local image: %w", err)
 	}
 
-	// Extract digest from RepoDigests
-	var digest string
-	if len(inspect.RepoDigests) > 0 {
-		// RepoDigests format: "registry/repo@sha256:..."
-		parts := strings.Split(inspect.RepoDigests[0], "@")
-		if len(parts) == 2 {
-			digest = parts[1]
-		}
-	}
-
-	if digest == "" {
-		return nil, fmt.Errorf("local image has no repo digest")
-	}
-
 	// Parse the image reference to extract components
 	registry, repository, tag, err := ParseImageRef(imageRef)
 	if err != nil {
@@ -196,7 +183,6 @@ func (c *Client) getImageMetadataFromLocal(ctx context.Context, imageRef string)
 		Registry:      registry,
 		Repository:    repository,
 		Tag:           resolvedTag,
-		Digest:        digest,
 		FullReference: fmt.Sprintf("%s/%s:%s", registry, repository, resolvedTag),
 	}
 
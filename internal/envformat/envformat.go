@@ -0,0 +1,159 @@
+package envformat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format is an output format of the print-env commands.
+type Format string
+
+const (
+	// Shell emits POSIX export lines for eval "$(ibosh ... print-env)".
+	Shell Format = "sh"
+	// Fish emits set -gx lines for ibosh ... print-env --format fish | source.
+	Fish Format = "fish"
+	// PowerShell emits $env: assignments for ibosh ... print-env --format powershell | Invoke-Expression.
+	PowerShell Format = "powershell"
+	// Dotenv emits NAME="value" lines for .env files.
+	Dotenv Format = "dotenv"
+	// JSON emits a single JSON object of all variables.
+	JSON Format = "json"
+	// Direnv emits export lines for an .envrc, with certificates written to files
+	// and referenced by path.
+	Direnv Format = "direnv"
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{Shell, Fish, PowerShell, Dotenv, JSON, Direnv}
+
+// ParseFormat parses a format name. An empty name is Shell.
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return Shell, nil
+	}
+	for _, format := range Formats {
+		if string(format) == name {
+			return format, nil
+		}
+	}
+
+	names := make([]string, len(Formats))
+	for i, format := range Formats {
+		names[i] = string(format)
+	}
+	return "", fmt.Errorf("unsupported format %q (supported: %s)", name, strings.Join(names, ", "))
+}
+
+// Var is an environment variable to print.
+type Var struct {
+	Name  string
+	Value string
+	// Unset removes the variable from the environment; Value is ignored.
+	Unset bool
+	// File is the file name the value is written to in the Direnv format (e.g. CA certificates).
+	File string
+}
+
+// Line is a line of output, passed to UI.PrintLinef.
+type Line struct {
+	Format string
+	Args   []interface{}
+}
+
+// Render formats vars. Files of the Direnv format must have been written with WriteFiles first.
+func Render(format Format, vars []Var) ([]Line, error) {
+	var lines []Line
+	switch format {
+	case Shell, Direnv:
+		for _, v := range vars {
+			switch {
+			case v.Unset:
+				lines = append(lines, Line{Format: fmt.Sprintf("unset %s 2>/dev/null; true", v.Name)})
+			case needsShellQuoting(v.Value):
+				lines = append(lines, Line{Format: fmt.Sprintf("export %s='%%s'", v.Name), Args: []interface{}{strings.ReplaceAll(v.Value, "'", `'\''`)}})
+			default:
+				lines = append(lines, Line{Format: fmt.Sprintf("export %s=%%s", v.Name), Args: []interface{}{v.Value}})
+			}
+		}
+
+	case Fish:
+		replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+		for _, v := range vars {
+			if v.Unset {
+				lines = append(lines, Line{Format: fmt.Sprintf("set -e %s", v.Name)})
+				continue
+			}
+			lines = append(lines, Line{Format: fmt.Sprintf("set -gx %s '%%s'", v.Name), Args: []interface{}{replacer.Replace(v.Value)}})
+		}
+
+	case PowerShell:
+		// Double-quoted strings with escaped newlines keep every assignment on one line,
+		// so the output can be piped to Invoke-Expression line by line.
+		replacer := strings.NewReplacer("`", "``", `"`, "`\"", "$", "`$", "\r", "`r", "\n", "`n")
+		for _, v := range vars {
+			if v.Unset {
+				lines = append(lines, Line{Format: fmt.Sprintf("Remove-Item Env:%s -ErrorAction SilentlyContinue", v.Name)})
+				continue
+			}
+			lines = append(lines, Line{Format: fmt.Sprintf("$env:%s = \"%%s\"", v.Name), Args: []interface{}{replacer.Replace(v.Value)}})
+		}
+
+	case Dotenv:
+		replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", `\r`, "\n", `\n`)
+		for _, v := range vars {
+			if v.Unset {
+				continue
+			}
+			lines = append(lines, Line{Format: fmt.Sprintf("%s=\"%%s\"", v.Name), Args: []interface{}{replacer.Replace(v.Value)}})
+		}
+
+	case JSON:
+		values := map[string]string{}
+		for _, v := range vars {
+			if !v.Unset {
+				values[v.Name] = v.Value
+			}
+		}
+		data, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("encoding environment as JSON: %w", err)
+		}
+		lines = append(lines, Line{Format: "%s", Args: []interface{}{string(data)}})
+
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+
+	return lines, nil
+}
+
+// WriteFiles writes the values of vars with a File into dir, readable only by the
+// current user, and returns vars with those values replaced by the file paths.
+func WriteFiles(dir string, vars []Var) ([]Var, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating directory %s: %w", dir, err)
+	}
+
+	result := make([]Var, len(vars))
+	for i, v := range vars {
+		result[i] = v
+		if v.File == "" || v.Unset {
+			continue
+		}
+		path := filepath.Join(dir, v.File)
+		if err := os.WriteFile(path, []byte(v.Value), 0600); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", path, err)
+		}
+		result[i].Value = path
+	}
+	return result, nil
+}
+
+// needsShellQuoting reports whether a value must be single quoted in a POSIX shell.
+func needsShellQuoting(value string) bool {
+	return value == "" || strings.ContainsAny(value, " \t\r\n'\"\\$`;&|<>(){}#~*")
+}
@@ -0,0 +1,128 @@
+package envformat_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rkoster/instant-bosh/internal/envformat"
+)
+
+var testVars = []envformat.Var{
+	{Name: "BOSH_CLIENT", Value: "admin"},
+	{Name: "BOSH_CA_CERT", Value: "-----BEGIN CERTIFICATE-----\nit's\n-----END CERTIFICATE-----", File: "director-ca.pem"},
+	{Name: "BOSH_ALL_PROXY", Unset: true},
+}
+
+func render(t *testing.T, format envformat.Format, vars []envformat.Var) string {
+	t.Helper()
+	lines, err := envformat.Render(format, vars)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var out strings.Builder
+	for _, line := range lines {
+		fmt.Fprintf(&out, line.Format+"\n", line.Args...)
+	}
+	return out.String()
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		format   envformat.Format
+		expected string
+	}{
+		{
+			format: envformat.Shell,
+			expected: "export BOSH_CLIENT=admin\n" +
+				"export BOSH_CA_CERT='-----BEGIN CERTIFICATE-----\nit'\\''s\n-----END CERTIFICATE-----'\n" +
+				"unset BOSH_ALL_PROXY 2>/dev/null; true\n",
+		},
+		{
+			format: envformat.Fish,
+			expected: "set -gx BOSH_CLIENT 'admin'\n" +
+				"set -gx BOSH_CA_CERT '-----BEGIN CERTIFICATE-----\nit\\'s\n-----END CERTIFICATE-----'\n" +
+				"set -e BOSH_ALL_PROXY\n",
+		},
+		{
+			format: envformat.PowerShell,
+			expected: "$env:BOSH_CLIENT = \"admin\"\n" +
+				"$env:BOSH_CA_CERT = \"-----BEGIN CERTIFICATE-----`nit's`n-----END CERTIFICATE-----\"\n" +
+				"Remove-Item Env:BOSH_ALL_PROXY -ErrorAction SilentlyContinue\n",
+		},
+		{
+			format: envformat.Dotenv,
+			expected: "BOSH_CLIENT=\"admin\"\n" +
+				"BOSH_CA_CERT=\"-----BEGIN CERTIFICATE-----\\nit's\\n-----END CERTIFICATE-----\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := render(t, tt.format, testVars); got != tt.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.format, tt.expected, got)
+		}
+	}
+}
+
+func TestRenderEscapesPowerShell(t *testing.T) {
+	got := render(t, envformat.PowerShell, []envformat.Var{{Name: "SECRET", Value: "a$b`c\"d"}})
+	expected := "$env:SECRET = \"a`$b``c`\"d\"\n"
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	var values map[string]string
+	if err := json.Unmarshal([]byte(render(t, envformat.JSON, testVars)), &values); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if len(values) != 2 {
+		t.Errorf("expected 2 variables without the unset one, got %v", values)
+	}
+	if values["BOSH_CA_CERT"] != testVars[1].Value {
+		t.Errorf("expected CA certificate to round-trip, got %q", values["BOSH_CA_CERT"])
+	}
+}
+
+func TestWriteFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "docker")
+
+	vars, err := envformat.WriteFiles(dir, testVars)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	path := filepath.Join(dir, "director-ca.pem")
+	if vars[1].Value != path {
+		t.Errorf("expected BOSH_CA_CERT to reference %s, got %s", path, vars[1].Value)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(content) != testVars[1].Value {
+		t.Errorf("unexpected file content %q", content)
+	}
+	if vars[0].Value != "admin" {
+		t.Errorf("expected variables without a file to be unchanged, got %q", vars[0].Value)
+	}
+	if got := render(t, envformat.Direnv, vars); !strings.Contains(got, "export BOSH_CA_CERT="+path+"\n") {
+		t.Errorf("expected direnv output to reference %s, got\n%s", path, got)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if format, err := envformat.ParseFormat(""); err != nil || format != envformat.Shell {
+		t.Errorf("expected empty format to be sh, got %q (%v)", format, err)
+	}
+	if format, err := envformat.ParseFormat("fish"); err != nil || format != envformat.Fish {
+		t.Errorf("expected fish, got %q (%v)", format, err)
+	}
+	if _, err := envformat.ParseFormat("csh"); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
@@ -14,6 +14,7 @@ import (
 	incus "github.com/lxc/incus/v6/client"
 	"github.com/lxc/incus/v6/shared/api"
 	"github.com/lxc/incus/v6/shared/cliconfig"
+	ibregistry "github.com/rkoster/instant-bosh/internal/registry"
 	"gopkg.in/yaml.v3"
 )
 
@@ -199,10 +200,24 @@ func (c *Client) GetRemote() string {
 	return c.remote
 }
 
+func (c *Client) GetProject() string {
+	return c.project
+}
+
 func (c *Client) NetworkName() string {
 	return c.networkName
 }
 
+// Platform returns the platform of the Incus server (e.g. "linux/arm64").
+// Incus pulls OCI images for the server architecture.
+func (c *Client) Platform(ctx context.Context) (string, error) {
+	server, _, err := c.cli.GetServer()
+	if err != nil {
+		return "", fmt.Errorf("getting incus server info: %w", err)
+	}
+	return ibregistry.PlatformFromArchitecture(server.Environment.KernelArchitecture), nil
+}
+
 // GetImageName returns the target image name for new containers.
 func (c *Client) GetImageName() string {
 	return c.imageName
@@ -510,6 +525,85 @@ func (c *Client) StartContainer(ctx context.Context) error {
 	return nil
 }
 
+// explicitCredentialsRemote names the in-memory OCI remote used with explicit registry credentials
+const explicitCredentialsRemote = "ibosh-registry"
+
+// ociImageServer connects to the OCI registry hosting the image.
+// Explicit registry credentials (see registry.Auth) are passed to Incus through the
+// credentials helper of an OCI remote that is never saved in the CLI config: ibosh itself,
+// which serves them with registry.ServeCredentialHelper.
+// Without explicit credentials, an OCI remote from the CLI config is used (and created if needed).
+func (c *Client) ociImageServer(registry string) (incus.ImageServer, error) {
+	auth, err := ibregistry.LoadAuth()
+	if err != nil {
+		return nil, fmt.Errorf("loading registry credentials: %w", err)
+	}
+	cred, err := auth.Lookup(registry)
+	if err != nil {
+		return nil, err
+	}
+
+	if cred.Username != "" && cred.Password != "" {
+		c.logger.Debug(c.logTag, "Using explicit credentials for registry %s", registry)
+		executable, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("finding the ibosh executable for the credentials helper: %w", err)
+		}
+		config := &cliconfig.Config{Remotes: map[string]cliconfig.Remote{
+			explicitCredentialsRemote: {Addr: "https://" + registry, Protocol: "oci", CredHelper: executable},
+		}}
+		ociImageServer, err := config.GetImageServer(explicitCredentialsRemote)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to OCI registry %s: %w", registry, err)
+		}
+		return ociImageServer, nil
+	}
+	if !cred.Empty() {
+		c.logger.Warn(c.logTag, "Incus only supports username/password registry credentials, ignoring identity token for %s", registry)
+	}
+
+	// Find OCI remote for this registry, or create one if it doesn't exist
+	if c.cliConfig == nil {
+		return nil, fmt.Errorf("no CLI config available, cannot find OCI remote for %s", registry)
+	}
+
+	var ociRemoteName string
+	registryURL := "https://" + registry
+	for name, remote := range c.cliConfig.Remotes {
+		if remote.Protocol == "oci" && remote.Addr == registryURL {
+			ociRemoteName = name
+			c.logger.Debug(c.logTag, "Found OCI remote '%s' for registry %s", name, registry)
+			break
+		}
+	}
+
+	if ociRemoteName == "" {
+		// Auto-create OCI remote for this registry
+		ociRemoteName = "oci-" + strings.ReplaceAll(registry, ".", "-")
+		c.logger.Info(c.logTag, "Adding OCI remote '%s' for registry %s", ociRemoteName, registry)
+
+		c.cliConfig.Remotes[ociRemoteName] = cliconfig.Remote{
+			Addr:     registryURL,
+			Protocol: "oci",
+			Public:   true,
+		}
+
+		// Save the updated config
+		configPath := c.cliConfig.ConfigPath("config.yml")
+		if err := c.cliConfig.SaveConfig(configPath); err != nil {
+			return nil, fmt.Errorf("saving CLI config after adding OCI remote: %w", err)
+		}
+	}
+
+	// Connect to the OCI remote
+	ociImageServer, err := c.cliConfig.GetImageServer(ociRemoteName)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to OCI remote '%s': %w", ociRemoteName, err)
+	}
+
+	return ociImageServer, nil
+}
+
 // createInstanceFromImage creates an instance from an OCI image.
 // It mimics "incus launch oci-remote:image" by using CreateInstanceFromImage
 // which lets the server pull the image directly from the OCI registry.
@@ -571,43 +665,9 @@ func (c *Client) createInstanceFromImage(ctx context.Context, req api.InstancesP
 		repository = parts[1]
 	}
 
-	// Find OCI remote for this registry, or create one if it doesn't exist
-	if c.cliConfig == nil {
-		return fmt.Errorf("no CLI config available, cannot find OCI remote for %s", registry)
-	}
-
-	var ociRemoteName string
-	registryURL := "https://" + registry
-	for name, remote := range c.cliConfig.Remotes {
-		if remote.Protocol == "oci" && remote.Addr == registryURL {
-			ociRemoteName = name
-			c.logger.Debug(c.logTag, "Found OCI remote '%s' for registry %s", name, registry)
-			break
-		}
-	}
-
-	if ociRemoteName == "" {
-		// Auto-create OCI remote for this registry
-		ociRemoteName = "oci-" + strings.ReplaceAll(registry, ".", "-")
-		c.logger.Info(c.logTag, "Adding OCI remote '%s' for registry %s", ociRemoteName, registry)
-
-		c.cliConfig.Remotes[ociRemoteName] = cliconfig.Remote{
-			Addr:     registryURL,
-			Protocol: "oci",
-			Public:   true,
-		}
-
-		// Save the updated config
-		configPath := c.cliConfig.ConfigPath("config.yml")
-		if err := c.cliConfig.SaveConfig(configPath); err != nil {
-			return fmt.Errorf("saving CLI config after adding OCI remote: %w", err)
-		}
-	}
-
-	// Connect to the OCI remote
-	ociImageServer, err := c.cliConfig.GetImageServer(ociRemoteName)
+	ociImageServer, err := c.ociImageServer(registry)
 	if err != nil {
-		return fmt.Errorf("connecting to OCI remote '%s': %w", ociRemoteName, err)
+		return err
 	}
 
 	// For OCI remotes, we create a minimal image info with the alias set.
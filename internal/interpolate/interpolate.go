@@ -0,0 +1,145 @@
+// Package interpolate evaluates BOSH manifests like `bosh interpolate`, in-process with
+// the bosh-cli template library instead of running the bosh CLI.
+package interpolate
+
+import (
+	"fmt"
+	"os"
+
+	boshtpl "github.com/cloudfoundry/bosh-cli/v7/director/template"
+	"github.com/cppforlife/go-patch/patch"
+	"gopkg.in/yaml.v2"
+)
+
+// Options are the bosh interpolate flags.
+type Options struct {
+	// OpsFiles are the paths of ops files, applied in order (-o)
+	OpsFiles []string
+	// Ops are applied after the ops files, e.g. operations built in code
+	Ops []patch.OpDefinition
+
+	// Vars are variables in the format name=value (-v)
+	Vars []string
+	// VarsFiles are the paths of YAML files with variables (-l, --vars-file)
+	VarsFiles []string
+	// VarsEnv are prefixes of environment variables with variables (--vars-env),
+	// e.g. "MY" to load MY_var=value
+	VarsEnv []string
+
+	// Path extracts the value at a path of the result (--path), e.g. /variables
+	Path string
+	// ExpectAllKeys fails when variables are missing (--var-errs)
+	ExpectAllKeys bool
+}
+
+// File interpolates the manifest at path.
+func File(path string, opts Options) ([]byte, error) {
+	manifest, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	return Manifest(manifest, opts)
+}
+
+// Manifest applies the ops files and variables to a manifest, with the same variable
+// precedence as the bosh CLI: -v over --vars-file over --vars-env.
+func Manifest(manifest []byte, opts Options) ([]byte, error) {
+	vars, err := variables(opts)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := operations(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	evalOpts := boshtpl.EvaluateOpts{ExpectAllKeys: opts.ExpectAllKeys}
+	if opts.Path != "" {
+		pointer, err := patch.NewPointerFromString(opts.Path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing path %q: %w", opts.Path, err)
+		}
+		evalOpts.PostVarSubstitutionOp = patch.FindOp{Path: pointer}
+		// Like the bosh CLI, print multiline strings (e.g. certificates) as is
+		evalOpts.UnescapedMultiline = true
+	}
+
+	result, err := boshtpl.NewTemplate(manifest).Evaluate(vars, ops, evalOpts)
+	if err != nil {
+		return nil, fmt.Errorf("interpolating manifest: %w", err)
+	}
+	return result, nil
+}
+
+// variables collects the variables of all sources, parsed like the bosh CLI flags
+func variables(opts Options) (boshtpl.StaticVariables, error) {
+	vars := boshtpl.StaticVariables{}
+
+	for _, prefix := range opts.VarsEnv {
+		var arg boshtpl.VarsEnvArg
+		if err := arg.UnmarshalFlag(prefix); err != nil {
+			return nil, fmt.Errorf("loading variables from environment: %w", err)
+		}
+		for name, value := range arg.Vars {
+			vars[name] = value
+		}
+	}
+
+	for _, path := range opts.VarsFiles {
+		var arg boshtpl.VarsFileArg
+		if err := arg.UnmarshalFlag(path); err != nil {
+			return nil, fmt.Errorf("loading variables file: %w", err)
+		}
+		for name, value := range arg.Vars {
+			vars[name] = value
+		}
+	}
+
+	for _, kv := range opts.Vars {
+		var arg boshtpl.VarKV
+		if err := arg.UnmarshalFlag(kv); err != nil {
+			return nil, fmt.Errorf("parsing variable: %w", err)
+		}
+		vars[arg.Name] = arg.Value
+	}
+
+	return vars, nil
+}
+
+// operations reads the ops files and appends the ops of opts
+func operations(opts Options) (patch.Ops, error) {
+	var ops patch.Ops
+
+	for _, path := range opts.OpsFiles {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading ops file: %w", err)
+		}
+
+		var definitions []patch.OpDefinition
+		if err := yaml.Unmarshal(content, &definitions); err != nil {
+			return nil, fmt.Errorf("parsing ops file %s: %w", path, err)
+		}
+		// Name failing operations like the bosh CLI
+		for i := range definitions {
+			description := fmt.Sprintf("operation [%d] in %s failed", i, path)
+			definitions[i].Error = &description
+		}
+
+		fileOps, err := patch.NewOpsFromDefinitions(definitions)
+		if err != nil {
+			return nil, fmt.Errorf("building ops of %s: %w", path, err)
+		}
+		ops = append(ops, fileOps...)
+	}
+
+	if len(opts.Ops) > 0 {
+		extraOps, err := patch.NewOpsFromDefinitions(opts.Ops)
+		if err != nil {
+			return nil, fmt.Errorf("building ops: %w", err)
+		}
+		ops = append(ops, extraOps...)
+	}
+
+	return ops, nil
+}
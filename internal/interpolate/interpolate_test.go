@@ -0,0 +1,119 @@
+package interpolate_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cppforlife/go-patch/patch"
+	"github.com/rkoster/instant-bosh/internal/interpolate"
+)
+
+const manifest = `name: cf
+domain: ((system_domain))
+router: ((router_static_ip))
+variables:
+- name: admin_password
+  type: password
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFile(t *testing.T) {
+	manifestPath := writeFile(t, "manifest.yml", manifest)
+	opsPath := writeFile(t, "ops.yml", `
+- type: replace
+  path: /instance_groups?/-
+  value: {name: router}
+- type: remove
+  path: /variables
+`)
+	varsPath := writeFile(t, "vars.yml", "system_domain: file.example.com\nrouter_static_ip: 10.0.0.1\n")
+	t.Setenv("IBOSH_TEST_router_static_ip", "10.0.0.2")
+	t.Setenv("IBOSH_TEST_system_domain", "env.example.com")
+
+	name := "renamed"
+	namePath := "/name"
+	var nameValue interface{} = name
+
+	result, err := interpolate.File(manifestPath, interpolate.Options{
+		OpsFiles:  []string{opsPath},
+		Ops:       []patch.OpDefinition{{Type: "replace", Path: &namePath, Value: &nameValue}},
+		Vars:      []string{"system_domain=flag.example.com"},
+		VarsFiles: []string{varsPath},
+		VarsEnv:   []string{"IBOSH_TEST"},
+	})
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+
+	expected := `domain: flag.example.com
+instance_groups:
+- name: router
+name: renamed
+router: 10.0.0.1
+`
+	if string(result) != expected {
+		t.Errorf("File() =\n%s\nwant:\n%s", result, expected)
+	}
+}
+
+func TestPath(t *testing.T) {
+	result, err := interpolate.Manifest([]byte(manifest), interpolate.Options{Path: "/variables"})
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+	expected := "- name: admin_password\n  type: password\n"
+	if string(result) != expected {
+		t.Errorf("Manifest() = %q, want %q", result, expected)
+	}
+
+	if _, err := interpolate.Manifest([]byte(manifest), interpolate.Options{Path: "/missing"}); err == nil {
+		t.Error("Manifest() expected error for missing path")
+	}
+}
+
+func TestExpectAllKeys(t *testing.T) {
+	result, err := interpolate.Manifest([]byte(manifest), interpolate.Options{Vars: []string{"system_domain=example.com"}})
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+	if !strings.Contains(string(result), "router: ((router_static_ip))") {
+		t.Errorf("Manifest() should keep missing variables, got:\n%s", result)
+	}
+
+	_, err = interpolate.Manifest([]byte(manifest), interpolate.Options{
+		Vars:          []string{"system_domain=example.com"},
+		ExpectAllKeys: true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "router_static_ip") {
+		t.Errorf("Manifest() error = %v, want missing router_static_ip", err)
+	}
+}
+
+func TestOpsFileErrors(t *testing.T) {
+	opsPath := writeFile(t, "ops.yml", `
+- type: replace
+  path: /missing/key
+  value: foo
+`)
+	_, err := interpolate.Manifest([]byte(manifest), interpolate.Options{OpsFiles: []string{opsPath}})
+	if err == nil || !strings.Contains(err.Error(), "operation [0] in "+opsPath+" failed") {
+		t.Errorf("Manifest() error = %v, want failing operation of %s", err, opsPath)
+	}
+
+	if _, err := interpolate.Manifest([]byte(manifest), interpolate.Options{OpsFiles: []string{"/nonexistent/ops.yml"}}); err == nil {
+		t.Error("Manifest() expected error for missing ops file")
+	}
+	if _, err := interpolate.Manifest([]byte(manifest), interpolate.Options{Vars: []string{"invalid"}}); err == nil {
+		t.Error("Manifest() expected error for invalid variable")
+	}
+}
@@ -0,0 +1,256 @@
+// Package ipam selects static IPs from the networks of a BOSH cloud config.
+package ipam
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	"gopkg.in/yaml.v3"
+)
+
+// maxRangeSize limits the number of IPs taken from a single range, e.g. an IPv6 subnet.
+const maxRangeSize = 1 << 16
+
+// Range is an inclusive range of IPs.
+type Range struct {
+	First netip.Addr
+	Last  netip.Addr
+}
+
+// Contains reports whether ip is in the range.
+func (r Range) Contains(ip netip.Addr) bool {
+	return r.First.Compare(ip) <= 0 && ip.Compare(r.Last) <= 0
+}
+
+// ParseRange parses an IP range as used in cloud configs: "10.245.0.34 - 10.245.0.100",
+// a single IP or a CIDR.
+func ParseRange(value string) (Range, error) {
+	value = strings.TrimSpace(value)
+
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return Range{}, fmt.Errorf("invalid IP range %q: %w", value, err)
+		}
+		prefix = prefix.Masked()
+		last := prefix.Addr().AsSlice()
+		for bit := prefix.Bits(); bit < len(last)*8; bit++ {
+			last[bit/8] |= 1 << (7 - bit%8)
+		}
+		lastAddr, _ := netip.AddrFromSlice(last)
+		return Range{First: prefix.Addr(), Last: lastAddr}, nil
+	}
+
+	first, last, isRange := strings.Cut(value, "-")
+	firstAddr, err := netip.ParseAddr(strings.TrimSpace(first))
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid IP range %q: %w", value, err)
+	}
+	if !isRange {
+		return Range{First: firstAddr, Last: firstAddr}, nil
+	}
+	lastAddr, err := netip.ParseAddr(strings.TrimSpace(last))
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid IP range %q: %w", value, err)
+	}
+	if lastAddr.Compare(firstAddr) < 0 {
+		return Range{}, fmt.Errorf("invalid IP range %q: end is before start", value)
+	}
+	return Range{First: firstAddr, Last: lastAddr}, nil
+}
+
+func parseRanges(values []string) ([]Range, error) {
+	var ranges []Range
+	for _, value := range values {
+		r, err := ParseRange(value)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+type cloudConfig struct {
+	Networks []struct {
+		Name    string `yaml:"name"`
+		Subnets []struct {
+			Range    string   `yaml:"range"`
+			Gateway  string   `yaml:"gateway"`
+			Reserved []string `yaml:"reserved"`
+			Static   []string `yaml:"static"`
+		} `yaml:"subnets"`
+	} `yaml:"networks"`
+}
+
+// StaticIPs returns the static IPs of a network in the given cloud configs (the director
+// merges named cloud configs): the static ranges of all its subnets in order, without
+// their reserved ranges, gateways and IPs outside the subnet range.
+func StaticIPs(cloudConfigs []string, network string) ([]netip.Addr, error) {
+	var ips []netip.Addr
+	seen := map[netip.Addr]bool{}
+	found := false
+
+	for _, content := range cloudConfigs {
+		var config cloudConfig
+		if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+			return nil, fmt.Errorf("parsing cloud config: %w", err)
+		}
+
+		for _, n := range config.Networks {
+			if n.Name != network {
+				continue
+			}
+			found = true
+
+			for _, subnet := range n.Subnets {
+				reserved, err := parseRanges(subnet.Reserved)
+				if err != nil {
+					return nil, fmt.Errorf("network %s: reserved: %w", network, err)
+				}
+				if subnet.Gateway != "" {
+					gateway, err := ParseRange(subnet.Gateway)
+					if err != nil {
+						return nil, fmt.Errorf("network %s: gateway: %w", network, err)
+					}
+					reserved = append(reserved, gateway)
+				}
+				var subnetRange *Range
+				if subnet.Range != "" {
+					r, err := ParseRange(subnet.Range)
+					if err != nil {
+						return nil, fmt.Errorf("network %s: range: %w", network, err)
+					}
+					subnetRange = &r
+				}
+
+				static, err := parseRanges(subnet.Static)
+				if err != nil {
+					return nil, fmt.Errorf("network %s: static: %w", network, err)
+				}
+				for _, r := range static {
+					count := 0
+					for ip := r.First; ip.IsValid() && ip.Compare(r.Last) <= 0; ip = ip.Next() {
+						if count++; count > maxRangeSize {
+							return nil, fmt.Errorf("network %s: static range %s - %s has more than %d IPs", network, r.First, r.Last, maxRangeSize)
+						}
+						if seen[ip] || inRanges(reserved, ip) || (subnetRange != nil && !subnetRange.Contains(ip)) {
+							continue
+						}
+						seen[ip] = true
+						ips = append(ips, ip)
+					}
+				}
+			}
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("network %q not found in cloud config", network)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no static IPs in network %q of the cloud config", network)
+	}
+	return ips, nil
+}
+
+func inRanges(ranges []Range, ip netip.Addr) bool {
+	for _, r := range ranges {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CloudConfigs returns the contents of the current cloud configs of a director.
+func CloudConfigs(director boshdir.Director) ([]string, error) {
+	configs, err := director.ListConfigs(1, boshdir.ConfigsFilter{Type: "cloud"})
+	if err != nil {
+		return nil, fmt.Errorf("listing cloud configs: %w", err)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no cloud config")
+	}
+
+	var contents []string
+	for _, config := range configs {
+		contents = append(contents, config.Content)
+	}
+	return contents, nil
+}
+
+// UsedIPs returns the IPs in use by the deployments of a director: the IPs of their
+// instances, and the static IPs in their manifests, which may not have an instance yet.
+func UsedIPs(director boshdir.Director) (map[netip.Addr]bool, error) {
+	deployments, err := director.Deployments()
+	if err != nil {
+		return nil, fmt.Errorf("listing deployments: %w", err)
+	}
+
+	used := map[netip.Addr]bool{}
+	for _, deployment := range deployments {
+		instances, err := deployment.Instances()
+		if err != nil {
+			return nil, fmt.Errorf("listing instances of deployment %s: %w", deployment.Name(), err)
+		}
+		for _, instance := range instances {
+			AddUsed(used, instance.IPs...)
+		}
+
+		manifest, err := deployment.Manifest()
+		if err != nil {
+			return nil, fmt.Errorf("getting manifest of deployment %s: %w", deployment.Name(), err)
+		}
+		staticIPs, err := manifestStaticIPs(manifest)
+		if err != nil {
+			return nil, fmt.Errorf("deployment %s: %w", deployment.Name(), err)
+		}
+		for _, r := range staticIPs {
+			for ip, count := r.First, 0; ip.IsValid() && ip.Compare(r.Last) <= 0 && count < maxRangeSize; ip, count = ip.Next(), count+1 {
+				used[ip] = true
+			}
+		}
+	}
+	return used, nil
+}
+
+// AddUsed marks IPs as used, ignoring values that are not an IP.
+func AddUsed(used map[netip.Addr]bool, ips ...string) {
+	for _, value := range ips {
+		if ip, err := netip.ParseAddr(strings.TrimSpace(value)); err == nil {
+			used[ip] = true
+		}
+	}
+}
+
+// manifestStaticIPs returns the static IPs assigned to instance groups in a manifest
+func manifestStaticIPs(manifest string) ([]Range, error) {
+	type group struct {
+		Networks []struct {
+			StaticIPs []string `yaml:"static_ips"`
+		} `yaml:"networks"`
+	}
+	var document struct {
+		InstanceGroups []group `yaml:"instance_groups"`
+		// Jobs are the instance groups of v1 manifests
+		Jobs []group `yaml:"jobs"`
+	}
+	if err := yaml.Unmarshal([]byte(manifest), &document); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+
+	var ranges []Range
+	for _, g := range append(document.InstanceGroups, document.Jobs...) {
+		for _, network := range g.Networks {
+			r, err := parseRanges(network.StaticIPs)
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, r...)
+		}
+	}
+	return ranges, nil
+}
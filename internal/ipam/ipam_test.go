@@ -0,0 +1,117 @@
+package ipam_test
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshdirfakes "github.com/cloudfoundry/bosh-cli/v7/director/directorfakes"
+	"github.com/rkoster/instant-bosh/internal/ipam"
+)
+
+const cloudConfig = `
+networks:
+- name: default
+  subnets:
+  - range: 10.245.0.0/16
+    gateway: 10.245.0.1
+    reserved: [10.245.0.2 - 10.245.0.9, 10.245.0.12]
+    static: [10.245.0.1 - 10.245.0.13]
+  - range: 10.246.0.0/24
+    gateway: 10.246.0.1
+    static: [10.246.0.20, 10.246.1.5]
+- name: other
+  subnets:
+  - static: [192.168.0.10]
+`
+
+func addrs(values ...string) []netip.Addr {
+	var result []netip.Addr
+	for _, value := range values {
+		result = append(result, netip.MustParseAddr(value))
+	}
+	return result
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		value       string
+		first, last string
+	}{
+		{value: "10.245.0.34 - 10.245.0.100", first: "10.245.0.34", last: "10.245.0.100"},
+		{value: "10.245.0.34-10.245.0.100", first: "10.245.0.34", last: "10.245.0.100"},
+		{value: "10.245.0.7", first: "10.245.0.7", last: "10.245.0.7"},
+		{value: "10.245.0.0/30", first: "10.245.0.0", last: "10.245.0.3"},
+	}
+	for _, tt := range tests {
+		r, err := ipam.ParseRange(tt.value)
+		if err != nil {
+			t.Fatalf("ParseRange(%q): unexpected error: %v", tt.value, err)
+		}
+		if r.First.String() != tt.first || r.Last.String() != tt.last {
+			t.Errorf("ParseRange(%q) = %s - %s, want %s - %s", tt.value, r.First, r.Last, tt.first, tt.last)
+		}
+	}
+
+	for _, value := range []string{"10.245.0.9 - 10.245.0.1", "not-an-ip", "10.245.0.0/33"} {
+		if _, err := ipam.ParseRange(value); err == nil {
+			t.Errorf("ParseRange(%q): expected error", value)
+		}
+	}
+}
+
+func TestStaticIPs(t *testing.T) {
+	ips, err := ipam.StaticIPs([]string{cloudConfig}, "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Without the gateway, reserved IPs and 10.246.1.5 outside the subnet range
+	expected := addrs("10.245.0.10", "10.245.0.11", "10.245.0.13", "10.246.0.20")
+	if !reflect.DeepEqual(ips, expected) {
+		t.Errorf("expected %v, got %v", expected, ips)
+	}
+
+	// Named cloud configs are merged
+	extra := "networks:\n- name: default\n  subnets:\n  - static: [10.247.0.5]\n"
+	ips, err = ipam.StaticIPs([]string{cloudConfig, extra}, "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if last := ips[len(ips)-1]; last.String() != "10.247.0.5" {
+		t.Errorf("expected IPs of the second cloud config, got %v", ips)
+	}
+
+	if _, err := ipam.StaticIPs([]string{cloudConfig}, "missing"); err == nil {
+		t.Error("expected error for a missing network")
+	}
+}
+
+func TestUsedIPs(t *testing.T) {
+	cf := &boshdirfakes.FakeDeployment{}
+	cf.NameReturns("cf")
+	cf.InstancesReturns([]boshdir.Instance{{IPs: []string{"10.245.0.10"}}, {IPs: nil}}, nil)
+	cf.ManifestReturns(`
+instance_groups:
+- name: router
+  networks:
+  - name: default
+    static_ips: [10.245.0.34, 10.245.0.40 - 10.245.0.41]
+`, nil)
+
+	director := &boshdirfakes.FakeDirector{}
+	director.DeploymentsReturns([]boshdir.Deployment{cf}, nil)
+
+	used, err := ipam.UsedIPs(director)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, ip := range addrs("10.245.0.10", "10.245.0.34", "10.245.0.40", "10.245.0.41") {
+		if !used[ip] {
+			t.Errorf("expected %s to be used", ip)
+		}
+	}
+	if len(used) != 4 {
+		t.Errorf("expected 4 used IPs, got %v", used)
+	}
+}
@@ -0,0 +1,202 @@
+package ipam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/rkoster/instant-bosh/internal/state"
+)
+
+const (
+	// DefaultReservationTTL is how long a reserved IP is held for its owner, long enough
+	// for the deploy using it to create its instances.
+	DefaultReservationTTL = time.Hour
+
+	// ReservationsFileName is the name of the reservations file in the state directory of an environment.
+	ReservationsFileName = "ip-reservations.json"
+
+	lockTimeout  = 10 * time.Second
+	lockInterval = 100 * time.Millisecond
+	// staleLockAge is the age of a lock file left behind by a killed process.
+	staleLockAge = time.Minute
+)
+
+// ErrNoAvailableIP is returned by Reserve when all candidate IPs are used or reserved.
+var ErrNoAvailableIP = errors.New("no available IP")
+
+type reservation struct {
+	IP        netip.Addr `json:"ip"`
+	Owner     string     `json:"owner"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+// Reservations hands out IPs to concurrent deploys, which would otherwise select the same
+// IP before either deploy created an instance with it. Reservations are stored in a file
+// guarded by a lock file and expire after a TTL, when the director knows the IP is used.
+type Reservations struct {
+	path string
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+// NewReservations returns reservations stored in path that expire after ttl.
+func NewReservations(path string, ttl time.Duration) *Reservations {
+	return &Reservations{path: path, ttl: ttl, now: time.Now}
+}
+
+// Reserve returns the first candidate IP that is neither used nor reserved by another
+// owner (e.g. a deployment name) and reserves it for owner. An owner gets its own
+// reservation back, so re-running a deploy that hasn't created its instances yet
+// selects the same IP.
+func (r *Reservations) Reserve(owner string, candidates []netip.Addr, used map[netip.Addr]bool) (netip.Addr, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer unlock()
+
+	reservations, err := r.load()
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	selected, err := selectIP(reservations, owner, candidates, used)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	var kept []reservation
+	for _, res := range reservations {
+		if res.Owner != owner {
+			kept = append(kept, res)
+		}
+	}
+	kept = append(kept, reservation{IP: selected, Owner: owner, ExpiresAt: r.now().Add(r.ttl)})
+	if err := r.save(kept); err != nil {
+		return netip.Addr{}, err
+	}
+	return selected, nil
+}
+
+// Select returns the IP Reserve would reserve for owner without reserving it, for
+// manifests that are deployed by someone else or not at all.
+func (r *Reservations) Select(owner string, candidates []netip.Addr, used map[netip.Addr]bool) (netip.Addr, error) {
+	reservations, err := r.load()
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return selectIP(reservations, owner, candidates, used)
+}
+
+// Release removes the reservation of owner, e.g. when its deploy failed.
+func (r *Reservations) Release(owner string) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	reservations, err := r.load()
+	if err != nil {
+		return err
+	}
+	var kept []reservation
+	for _, res := range reservations {
+		if res.Owner != owner {
+			kept = append(kept, res)
+		}
+	}
+	return r.save(kept)
+}
+
+// selectIP returns the IP of owner among reservations, or the first candidate that is
+// neither used nor reserved
+func selectIP(reservations []reservation, owner string, candidates []netip.Addr, used map[netip.Addr]bool) (netip.Addr, error) {
+	reserved := map[netip.Addr]bool{}
+	for _, res := range reservations {
+		reserved[res.IP] = true
+	}
+
+	for _, res := range reservations {
+		if res.Owner == owner && !used[res.IP] && slices.Contains(candidates, res.IP) {
+			return res.IP, nil
+		}
+	}
+	for _, ip := range candidates {
+		if !used[ip] && !reserved[ip] {
+			return ip, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("%w: all %d IPs are in use or reserved", ErrNoAvailableIP, len(candidates))
+}
+
+// load returns the reservations that haven't expired
+func (r *Reservations) load() ([]reservation, error) {
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading IP reservations: %w", err)
+	}
+
+	var reservations []reservation
+	if err := json.Unmarshal(data, &reservations); err != nil {
+		return nil, fmt.Errorf("parsing IP reservations %s: %w", r.path, err)
+	}
+
+	now := r.now()
+	var valid []reservation
+	for _, res := range reservations {
+		if now.Before(res.ExpiresAt) {
+			valid = append(valid, res)
+		}
+	}
+	return valid, nil
+}
+
+func (r *Reservations) save(reservations []reservation) error {
+	data, err := json.MarshalIndent(reservations, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding IP reservations: %w", err)
+	}
+	if err := state.WriteFile(r.path, data); err != nil {
+		return fmt.Errorf("writing IP reservations: %w", err)
+	}
+	return nil
+}
+
+// lock creates the lock file next to the reservations, waiting while another process
+// holds it. Creating a file exclusively works the same on all platforms.
+func (r *Reservations) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return nil, fmt.Errorf("creating IP reservations directory: %w", err)
+	}
+
+	lockPath := r.path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("locking IP reservations: %w", err)
+		}
+
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("locking IP reservations: %s is held by another process", lockPath)
+		}
+		time.Sleep(lockInterval)
+	}
+}
@@ -0,0 +1,86 @@
+package ipam_test
+
+import (
+	"errors"
+	"net/netip"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rkoster/instant-bosh/internal/ipam"
+)
+
+func TestReserve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docker", ipam.ReservationsFileName)
+	reservations := ipam.NewReservations(path, time.Hour)
+	candidates := addrs("10.245.0.34", "10.245.0.35", "10.245.0.36")
+	used := map[netip.Addr]bool{netip.MustParseAddr("10.245.0.34"): true}
+
+	cf, err := reservations.Reserve("cf", candidates, used)
+	if err != nil || cf.String() != "10.245.0.35" {
+		t.Fatalf("expected cf to reserve 10.245.0.35, got %v, %v", cf, err)
+	}
+
+	// Selecting returns the next free IP without reserving it
+	if ip, err := reservations.Select("manifest", candidates, used); err != nil || ip.String() != "10.245.0.36" {
+		t.Fatalf("expected manifest to select 10.245.0.36, got %v, %v", ip, err)
+	}
+
+	// Another deployment doesn't get the reserved IP, the same deployment does
+	bosh, err := reservations.Reserve("bosh-warden", candidates, used)
+	if err != nil || bosh.String() != "10.245.0.36" {
+		t.Fatalf("expected bosh-warden to reserve 10.245.0.36, got %v, %v", bosh, err)
+	}
+	if again, _ := reservations.Reserve("cf", candidates, used); again != cf {
+		t.Errorf("expected cf to get its reservation %s back, got %s", cf, again)
+	}
+
+	if _, err := reservations.Reserve("zookeeper", candidates, used); !errors.Is(err, ipam.ErrNoAvailableIP) {
+		t.Errorf("expected ErrNoAvailableIP, got %v", err)
+	}
+
+	if err := reservations.Release("cf"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if zookeeper, err := reservations.Reserve("zookeeper", candidates, used); err != nil || zookeeper != cf {
+		t.Errorf("expected the released IP %s, got %v, %v", cf, zookeeper, err)
+	}
+
+	// Reservations expire
+	expired := ipam.NewReservations(filepath.Join(t.TempDir(), ipam.ReservationsFileName), -time.Minute)
+	expired.Reserve("a", candidates, used)
+	if ip, err := expired.Reserve("b", candidates, used); err != nil || ip.String() != "10.245.0.35" {
+		t.Errorf("expected expired reservations to be free, got %v, %v", ip, err)
+	}
+}
+
+func TestReserveConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ipam.ReservationsFileName)
+	candidates := addrs("10.245.0.34", "10.245.0.35", "10.245.0.36", "10.245.0.37")
+
+	var wg sync.WaitGroup
+	results := make([]netip.Addr, len(candidates))
+	for i := range candidates {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Separate instances, like separate ibosh processes
+			reservations := ipam.NewReservations(path, time.Hour)
+			ip, err := reservations.Reserve(string(rune('a'+i)), candidates, nil)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			results[i] = ip
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[netip.Addr]bool{}
+	for _, ip := range results {
+		if seen[ip] {
+			t.Errorf("IP %s was reserved twice: %v", ip, results)
+		}
+		seen[ip] = true
+	}
+}
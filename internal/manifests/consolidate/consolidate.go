@@ -70,16 +70,20 @@ var sourceMapping = map[string]targetGroup{
 }
 
 // jobsExtractedFromScheduler lists job names that must be moved out of the scheduler
-// source instance group and placed directly into the router target group.
-var jobsExtractedFromScheduler = map[string]bool{
-	"ssh_proxy": true,
+// source instance group, with the target group they are placed in directly.
+var jobsExtractedFromScheduler = map[string]targetGroup{
+	"ssh_proxy": groupRouter,
 }
 
 // groupSpec defines the properties of a consolidated instance group.
 type groupSpec struct {
-	name   targetGroup
-	vmType string
-	serial bool // value for the per-IG update.serial field
+	name      targetGroup
+	vmType    string
+	serial    bool     // value for the per-IG update.serial field
+	instances int      // number of instances
+	azs       []string // availability zones, z1 if empty
+
+	vmExtensions []string // replaces the vm_extensions of the source groups if set
 }
 
 // instanceGroups defines all consolidated instance groups in deployment order.
@@ -99,11 +103,11 @@ type groupSpec struct {
 // NOTE: credhub is colocated with UAA in control (not database) because credhub's
 // start script (wait_for_uaa) blocks until UAA is reachable.
 var instanceGroups = []groupSpec{
-	{groupDatabase, "small", true},
-	{groupBlobstore, "small", false},
-	{groupControl, "medium", true},
-	{groupCompute, "small-highmem", false},
-	{groupRouter, "minimal", false},
+	{name: groupDatabase, vmType: "small", serial: true, instances: 1},
+	{name: groupBlobstore, vmType: "small", serial: false, instances: 1},
+	{name: groupControl, vmType: "medium", serial: true, instances: 1},
+	{name: groupCompute, vmType: "small-highmem", serial: false, instances: 1},
+	{name: groupRouter, vmType: "minimal", serial: false, instances: 1},
 }
 
 // manifestDoc is the top-level structure of a BOSH deployment manifest.
@@ -169,18 +173,36 @@ type Manifest struct {
 // known source mapping — this acts as a safety net to ensure new upstream instance
 // groups do not silently disappear from the deployment.
 func ConsolidateInstanceGroups(manifestBytes []byte) ([]byte, error) {
+	return ConsolidateWithProfile(manifestBytes, defaultProfile(), Options{})
+}
+
+// Options are the options of ConsolidateWithProfile.
+type Options struct {
+	// StaticIPs are added to the static IPs of target groups, for groups with more
+	// instances than static IPs in the manifest (e.g. the routers of ha-like).
+	StaticIPs map[string][]string
+}
+
+// ConsolidateWithProfile consolidates the instance groups of a fully-interpolated BOSH
+// manifest like ConsolidateInstanceGroups, into the target groups of profile.
+// The stock profile returns the manifest unchanged.
+func ConsolidateWithProfile(manifestBytes []byte, profile *Profile, opts Options) ([]byte, error) {
+	if len(profile.groups) == 0 {
+		return manifestBytes, nil
+	}
+
 	var m Manifest
 	if err := yaml.Unmarshal(manifestBytes, &m); err != nil {
 		return nil, fmt.Errorf("consolidate: failed to parse manifest: %w", err)
 	}
 
 	// Validate: every source instance group must be in the mapping.
-	if err := validateMapping(m.InstanceGroups); err != nil {
+	if err := validateMapping(profile, m.InstanceGroups); err != nil {
 		return nil, err
 	}
 
 	// Build consolidated groups.
-	consolidated, err := buildConsolidated(m.InstanceGroups)
+	consolidated, err := buildConsolidated(profile, m.InstanceGroups, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -192,7 +214,7 @@ func ConsolidateInstanceGroups(manifestBytes []byte) ([]byte, error) {
 	m.Releases = filterHaproxyReleases(m.Releases)
 
 	// Rewrite bosh-dns-aliases addon targets to use consolidated instance group names.
-	m.Addons = rewriteAddonAliases(m.Addons)
+	m.Addons = rewriteAddonAliases(profile, m.Addons)
 
 	// Replace instance groups with consolidated ones.
 	m.InstanceGroups = consolidated
@@ -204,17 +226,18 @@ func ConsolidateInstanceGroups(manifestBytes []byte) ([]byte, error) {
 	return out, nil
 }
 
-// validateMapping checks that every instance group in the manifest has an entry in sourceMapping.
-func validateMapping(groups []InstanceGroup) error {
+// validateMapping checks that every instance group in the manifest has an entry in the
+// source mapping of the profile.
+func validateMapping(profile *Profile, groups []InstanceGroup) error {
 	var unknown []string
 	for _, ig := range groups {
-		if _, ok := sourceMapping[ig.Name]; !ok {
+		if _, ok := profile.sources[ig.Name]; !ok {
 			unknown = append(unknown, ig.Name)
 		}
 	}
 	if len(unknown) > 0 {
 		return fmt.Errorf(
-			"consolidate: unmapped instance groups: [%s] — add them to sourceMapping in consolidate.go",
+			"consolidate: unmapped instance groups: [%s] — add them to a mapping file or to sourceMapping in consolidate.go",
 			strings.Join(unknown, ", "),
 		)
 	}
@@ -298,21 +321,24 @@ func (c *consolidated) addVMExtension(ext string) {
 // consolidated VMs are always running, so errand jobs become persistent co-located
 // processes rather than one-off errand runs. The source IG's lifecycle field is not
 // carried over.
-func buildConsolidated(sources []InstanceGroup) ([]InstanceGroup, error) {
+func buildConsolidated(profile *Profile, sources []InstanceGroup, opts Options) ([]InstanceGroup, error) {
 	// Working state per target group.
 	state := map[targetGroup]*consolidated{}
-	for _, spec := range instanceGroups {
+	for _, spec := range profile.groups {
 		state[spec.name] = &consolidated{}
 	}
 
 	for _, src := range sources {
-		tg := sourceMapping[src.Name]
+		tg := profile.sources[src.Name]
 		if tg == "" {
 			// Explicitly removed (e.g. haproxy).
 			continue
 		}
 
-		s := state[tg]
+		s, ok := state[tg]
+		if !ok {
+			return nil, fmt.Errorf("consolidate: instance group %s maps to unknown group %s", src.Name, tg)
+		}
 
 		// Collect persistent disk info for database/blobstore groups.
 		if src.PersistentDiskType != "" {
@@ -336,15 +362,19 @@ func buildConsolidated(sources []InstanceGroup) ([]InstanceGroup, error) {
 			}
 		}
 
-		// Handle scheduler specially: extract ssh_proxy to router.
-		if src.Name == "scheduler" {
-			routerState := state[groupRouter]
+		// Extract jobs into other groups (e.g. ssh_proxy from scheduler to router).
+		if extracted, ok := profile.extractedJobs[src.Name]; ok {
 			for _, job := range src.Jobs {
-				if jobsExtractedFromScheduler[job.Name] {
-					routerState.addJob(job)
-				} else {
+				target, ok := extracted[job.Name]
+				if !ok {
 					s.addJob(job)
+					continue
+				}
+				targetState, ok := state[target]
+				if !ok {
+					return nil, fmt.Errorf("consolidate: job %s of %s is extracted to unknown group %s", job.Name, src.Name, target)
 				}
+				targetState.addJob(job)
 			}
 			continue
 		}
@@ -360,16 +390,20 @@ func buildConsolidated(sources []InstanceGroup) ([]InstanceGroup, error) {
 
 	// Build the final InstanceGroup slice in declaration order.
 	var result []InstanceGroup
-	for _, spec := range instanceGroups {
+	for _, spec := range profile.groups {
 		s := state[spec.name]
 		if len(s.jobs) == 0 {
 			continue
 		}
 
+		azs := spec.azs
+		if len(azs) == 0 {
+			azs = []string{"z1"}
+		}
 		ig := InstanceGroup{
 			Name:      string(spec.name),
-			AZs:       []string{"z1"},
-			Instances: 1,
+			AZs:       azs,
+			Instances: spec.instances,
 			VMType:    spec.vmType,
 			Stemcell:  "default",
 			Update:    map[string]interface{}{"serial": spec.serial},
@@ -385,19 +419,26 @@ func buildConsolidated(sources []InstanceGroup) ([]InstanceGroup, error) {
 		if len(s.vmExtensions) > 0 {
 			ig.VMExtensions = s.vmExtensions
 		}
+		if spec.vmExtensions != nil {
+			ig.VMExtensions = spec.vmExtensions
+		}
 
-		// Assign static IPs to router's network config.
-		if spec.name == groupRouter && len(s.staticIPs) > 0 {
+		// Assign static IPs (the router's) to the network config.
+		staticIPs := append(s.staticIPs, opts.StaticIPs[string(spec.name)]...)
+		if len(staticIPs) > 0 {
 			// Deduplicate.
 			seen := map[string]bool{}
 			var unique []string
-			for _, ip := range s.staticIPs {
+			for _, ip := range staticIPs {
 				if !seen[ip] {
 					seen[ip] = true
 					unique = append(unique, ip)
 				}
 			}
-			ig.Networks[0].StaticIPs = unique
+			if len(unique) < ig.Instances {
+				return nil, fmt.Errorf("consolidate: group %s has %d instances but %d static IPs", spec.name, ig.Instances, len(unique))
+			}
+			ig.Networks[0].StaticIPs = unique[:ig.Instances]
 		}
 
 		ig.Jobs = s.jobs
@@ -466,7 +507,7 @@ var domainOverrides = map[string]targetGroup{
 //
 // domainOverrides takes precedence over sourceMapping for specific domains where
 // a job was extracted into a different consolidated group than its source IG maps to.
-func rewriteAddonAliases(addons []interface{}) []interface{} {
+func rewriteAddonAliases(profile *Profile, addons []interface{}) []interface{} {
 	for _, addon := range addons {
 		addonMap, ok := addon.(map[string]interface{})
 		if !ok {
@@ -515,9 +556,9 @@ func rewriteAddonAliases(addons []interface{}) []interface{} {
 					ig, _ := targetMap["instance_group"].(string)
 					// Domain-level overrides take precedence (e.g. ssh_proxy lives in
 					// router even though its source IG "scheduler" maps to control).
-					if override, exists := domainOverrides[domain]; exists {
+					if override, exists := profile.domainOverrides[domain]; exists {
 						targetMap["instance_group"] = string(override)
-					} else if mapped, exists := sourceMapping[ig]; exists {
+					} else if mapped, exists := profile.sources[ig]; exists {
 						if mapped == "" {
 							// Drop targets for removed groups (e.g. haproxy).
 							continue
@@ -0,0 +1,163 @@
+package consolidate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Mapping is a user-defined consolidation mapping, merged into a built-in profile with
+// Profile.WithMapping. It maps instance groups added by extra ops files (e.g. isolation
+// segments or an app-autoscaler) and tunes the target groups:
+//
+//	instance_groups:          # source instance group -> target group, "" removes it
+//	  isolated-diego-cell: isolated
+//	extract_jobs:             # source instance group -> job -> target group
+//	  scheduler:
+//	    ssh_proxy: control
+//	dns_aliases:              # DNS alias domain -> target group, for extracted jobs
+//	  ssh-proxy.service.cf.internal: control
+//	groups:                   # overrides of target groups; unknown names add a group
+//	- name: compute
+//	  instances: 2
+//	  vm_type: large
+//	  vm_extensions: [100GB_ephemeral_disk]
+//	- name: isolated          # added groups are deployed after the built-in ones
+//	  vm_type: small-highmem
+type Mapping struct {
+	InstanceGroups map[string]string            `yaml:"instance_groups"`
+	ExtractJobs    map[string]map[string]string `yaml:"extract_jobs"`
+	DNSAliases     map[string]string            `yaml:"dns_aliases"`
+	Groups         []GroupOverride              `yaml:"groups"`
+}
+
+// GroupOverride overrides the properties of a target group; unset fields keep the
+// properties of the profile.
+type GroupOverride struct {
+	Name         string   `yaml:"name"`
+	Instances    int      `yaml:"instances,omitempty"`
+	VMType       string   `yaml:"vm_type,omitempty"`
+	VMExtensions []string `yaml:"vm_extensions,omitempty"`
+	AZs          []string `yaml:"azs,omitempty"`
+	Serial       *bool    `yaml:"serial,omitempty"`
+}
+
+// ParseMapping parses a YAML mapping file. Unknown fields are an error, so typos do
+// not silently fall back to the built-in mapping.
+func ParseMapping(data []byte) (*Mapping, error) {
+	var m Mapping
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("consolidate: failed to parse mapping: %w", err)
+	}
+	return &m, nil
+}
+
+// WithMapping returns a copy of the profile with mapping merged into it: its entries
+// replace or extend the source mapping, job extractions and DNS alias overrides, and
+// its group overrides replace properties of target groups or add new groups.
+// Every target of the merged profile must be one of its groups.
+func (p *Profile) WithMapping(mapping *Mapping) (*Profile, error) {
+	if len(p.groups) == 0 {
+		return nil, fmt.Errorf("consolidate: the %s profile does not consolidate, a mapping can't be applied", p.name)
+	}
+
+	merged := &Profile{
+		name:            p.name,
+		sources:         maps.Clone(p.sources),
+		extractedJobs:   map[string]map[string]targetGroup{},
+		domainOverrides: maps.Clone(p.domainOverrides),
+		groups:          slices.Clone(p.groups),
+	}
+	for source, jobs := range p.extractedJobs {
+		merged.extractedJobs[source] = maps.Clone(jobs)
+	}
+
+	for source, target := range mapping.InstanceGroups {
+		merged.sources[source] = targetGroup(target)
+	}
+	for source, jobs := range mapping.ExtractJobs {
+		if merged.extractedJobs[source] == nil {
+			merged.extractedJobs[source] = map[string]targetGroup{}
+		}
+		for job, target := range jobs {
+			merged.extractedJobs[source][job] = targetGroup(target)
+		}
+	}
+	for domain, target := range mapping.DNSAliases {
+		merged.domainOverrides[domain] = targetGroup(target)
+	}
+
+	for _, override := range mapping.Groups {
+		if override.Name == "" {
+			return nil, fmt.Errorf("consolidate: mapping group without a name")
+		}
+		if override.Instances < 0 {
+			return nil, fmt.Errorf("consolidate: mapping group %s has %d instances", override.Name, override.Instances)
+		}
+
+		i := slices.IndexFunc(merged.groups, func(spec groupSpec) bool { return string(spec.name) == override.Name })
+		if i < 0 {
+			if override.VMType == "" {
+				return nil, fmt.Errorf("consolidate: mapping group %s is not a group of the %s profile and has no vm_type", override.Name, p.name)
+			}
+			merged.groups = append(merged.groups, groupSpec{name: targetGroup(override.Name), instances: 1})
+			i = len(merged.groups) - 1
+		}
+
+		spec := &merged.groups[i]
+		if override.Instances > 0 {
+			spec.instances = override.Instances
+		}
+		if override.VMType != "" {
+			spec.vmType = override.VMType
+		}
+		if override.VMExtensions != nil {
+			spec.vmExtensions = override.VMExtensions
+		}
+		if override.AZs != nil {
+			spec.azs = override.AZs
+		}
+		if override.Serial != nil {
+			spec.serial = *override.Serial
+		}
+	}
+
+	if err := merged.validateTargets(); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// validateTargets checks that every target of the profile is one of its groups, so a
+// misspelled target is reported before any instance group is consolidated.
+func (p *Profile) validateTargets() error {
+	known := func(target targetGroup) bool {
+		return target == "" || slices.ContainsFunc(p.groups, func(spec groupSpec) bool { return spec.name == target })
+	}
+
+	for _, source := range slices.Sorted(maps.Keys(p.sources)) {
+		if target := p.sources[source]; !known(target) {
+			return fmt.Errorf("consolidate: instance group %s maps to unknown group %s", source, target)
+		}
+	}
+	for _, source := range slices.Sorted(maps.Keys(p.extractedJobs)) {
+		for _, job := range slices.Sorted(maps.Keys(p.extractedJobs[source])) {
+			if target := p.extractedJobs[source][job]; target == "" || !known(target) {
+				return fmt.Errorf("consolidate: job %s of %s is extracted to unknown group %s", job, source, target)
+			}
+		}
+	}
+	for _, domain := range slices.Sorted(maps.Keys(p.domainOverrides)) {
+		if target := p.domainOverrides[domain]; target == "" || !known(target) {
+			return fmt.Errorf("consolidate: DNS alias %s maps to unknown group %s", domain, target)
+		}
+	}
+	return nil
+}
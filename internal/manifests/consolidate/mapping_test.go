@@ -0,0 +1,181 @@
+package consolidate_test
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/rkoster/instant-bosh/internal/manifests/consolidate"
+)
+
+// withIsolatedDiegoCell adds an isolated-diego-cell instance group to the test manifest,
+// as the isolation segment ops file of cf-deployment does.
+func withIsolatedDiegoCell(t *testing.T) []byte {
+	t.Helper()
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(buildInterpolatedManifest(t), &m); err != nil {
+		t.Fatalf("failed to unmarshal manifest: %v", err)
+	}
+	m["instance_groups"] = append(instanceGroups(t, m), map[string]interface{}{
+		"name":      "isolated-diego-cell",
+		"azs":       []interface{}{"z1"},
+		"instances": 1,
+		"vm_type":   "small-highmem",
+		"stemcell":  "default",
+		"networks":  []interface{}{map[string]interface{}{"name": "default"}},
+		"jobs": []interface{}{
+			map[string]interface{}{"name": "rep", "release": "diego"},
+		},
+	})
+	out, err := yaml.Marshal(m)
+	if err != nil {
+		t.Fatalf("failed to marshal test manifest: %v", err)
+	}
+	return out
+}
+
+// mappedProfile parses mapping and merges it into the named profile.
+func mappedProfile(t *testing.T, name, mapping string) (*consolidate.Profile, error) {
+	t.Helper()
+	m, err := consolidate.ParseMapping([]byte(mapping))
+	if err != nil {
+		t.Fatalf("ParseMapping() error = %v", err)
+	}
+	profile, err := consolidate.LookupProfile(name)
+	if err != nil {
+		t.Fatalf("LookupProfile(%q) error = %v", name, err)
+	}
+	return profile.WithMapping(m)
+}
+
+// TestParseMappingRejectsUnknownFields asserts typos in a mapping file are reported.
+func TestParseMappingRejectsUnknownFields(t *testing.T) {
+	if _, err := consolidate.ParseMapping([]byte("instance_group:\n  autoscaler: control\n")); err == nil {
+		t.Error("expected an error for the unknown field instance_group, got nil")
+	}
+	if _, err := consolidate.ParseMapping(nil); err != nil {
+		t.Errorf("ParseMapping(nil) error = %v, an empty mapping is valid", err)
+	}
+}
+
+// TestMappingAddsSourceGroup asserts an instance group added by an extra ops file fails
+// without a mapping and is consolidated into a new group with one.
+func TestMappingAddsSourceGroup(t *testing.T) {
+	input := withIsolatedDiegoCell(t)
+	if _, err := consolidate.ConsolidateInstanceGroups(input); err == nil || !strings.Contains(err.Error(), "isolated-diego-cell") {
+		t.Fatalf("ConsolidateInstanceGroups() error = %v, want unmapped isolated-diego-cell", err)
+	}
+
+	profile, err := mappedProfile(t, consolidate.ProfileDefault, `
+instance_groups:
+  isolated-diego-cell: isolated
+groups:
+- name: isolated
+  vm_type: small-highmem
+  vm_extensions: [100GB_ephemeral_disk]
+`)
+	if err != nil {
+		t.Fatalf("WithMapping() error = %v", err)
+	}
+	out, err := consolidate.ConsolidateWithProfile(input, profile, consolidate.Options{})
+	if err != nil {
+		t.Fatalf("ConsolidateWithProfile() error = %v", err)
+	}
+
+	names := groupNames(t, out)
+	if names[len(names)-1] != "isolated" {
+		t.Fatalf("added group must be deployed last, got %v", names)
+	}
+	isolated := findInstanceGroup(t, out, "isolated")
+	if isolated.VMType != "small-highmem" || isolated.Instances != 1 || !containsJob(isolated, "rep") {
+		t.Errorf("isolated group = %+v, want 1 small-highmem instance with rep", isolated)
+	}
+	if strings.Join(isolated.VMExtensions, ",") != "100GB_ephemeral_disk" {
+		t.Errorf("isolated vm_extensions = %v, want [100GB_ephemeral_disk]", isolated.VMExtensions)
+	}
+}
+
+// TestMappingOverridesGroups asserts group overrides, job extraction and DNS aliases are
+// merged into the built-in profile.
+func TestMappingOverridesGroups(t *testing.T) {
+	profile, err := mappedProfile(t, consolidate.ProfileDefault, `
+extract_jobs:
+  scheduler:
+    ssh_proxy: control
+dns_aliases:
+  ssh-proxy.service.cf.internal: control
+groups:
+- name: compute
+  instances: 2
+  vm_type: large
+  vm_extensions: []
+`)
+	if err != nil {
+		t.Fatalf("WithMapping() error = %v", err)
+	}
+	if profile.Instances("compute") != 2 {
+		t.Errorf("compute instances = %d, want 2", profile.Instances("compute"))
+	}
+	out, err := consolidate.ConsolidateWithProfile(buildInterpolatedManifest(t), profile, consolidate.Options{})
+	if err != nil {
+		t.Fatalf("ConsolidateWithProfile() error = %v", err)
+	}
+
+	compute := findInstanceGroup(t, out, "compute")
+	if compute.Instances != 2 || compute.VMType != "large" || len(compute.VMExtensions) != 0 {
+		t.Errorf("compute = %d %s instances with %v, want 2 large without vm_extensions", compute.Instances, compute.VMType, compute.VMExtensions)
+	}
+	if !containsJob(findInstanceGroup(t, out, "control"), "ssh_proxy") {
+		t.Error("control group must contain the extracted ssh_proxy job")
+	}
+	if containsJob(findInstanceGroup(t, out, "router"), "ssh_proxy") {
+		t.Error("router group must not contain ssh_proxy")
+	}
+	if router := findInstanceGroup(t, out, "router"); router.VMType != "minimal" {
+		t.Errorf("router vm_type = %s, groups without overrides must keep the profile's", router.VMType)
+	}
+}
+
+// TestMappingValidation asserts invalid mappings are rejected before consolidation.
+func TestMappingValidation(t *testing.T) {
+	cases := map[string]struct {
+		profile string
+		mapping string
+		want    string
+	}{
+		"unknown target": {
+			profile: consolidate.ProfileDefault,
+			mapping: "instance_groups:\n  autoscaler: controll\n",
+			want:    "autoscaler maps to unknown group controll",
+		},
+		"unknown extraction target": {
+			profile: consolidate.ProfileDefault,
+			mapping: "extract_jobs:\n  scheduler:\n    ssh_proxy: edge\n",
+			want:    "ssh_proxy of scheduler is extracted to unknown group edge",
+		},
+		"removed group in tiny": {
+			profile: consolidate.ProfileTiny,
+			mapping: "instance_groups:\n  tcp-router: router\n",
+			want:    "tcp-router maps to unknown group router",
+		},
+		"new group without vm_type": {
+			profile: consolidate.ProfileDefault,
+			mapping: "groups:\n- name: isolated\n",
+			want:    "isolated is not a group of the default profile and has no vm_type",
+		},
+		"stock profile": {
+			profile: consolidate.ProfileStock,
+			mapping: "instance_groups:\n  autoscaler: control\n",
+			want:    "does not consolidate",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := mappedProfile(t, tc.profile, tc.mapping)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("WithMapping() error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package consolidate
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// Names of the built-in profiles.
+const (
+	ProfileTiny    = "tiny"
+	ProfileDefault = "default"
+	ProfileHALike  = "ha-like"
+	ProfileStock   = "stock"
+)
+
+// Profile describes how the cf-deployment instance groups are consolidated: which
+// target group each source instance group is merged into, which jobs are moved to
+// another group than their source, and the target groups in deployment order.
+// A profile without groups (stock) leaves the instance groups as they are.
+type Profile struct {
+	name string
+
+	// sources maps each source instance group to its target group; "" removes it.
+	sources map[string]targetGroup
+	// extractedJobs maps a source instance group to jobs placed in another target group.
+	extractedJobs map[string]map[string]targetGroup
+	// domainOverrides maps DNS alias domains of extracted jobs to their target group.
+	domainOverrides map[string]targetGroup
+	// groups are the target groups in deployment order.
+	groups []groupSpec
+}
+
+// Name returns the name of the profile.
+func (p *Profile) Name() string {
+	return p.name
+}
+
+// Instances returns the number of instances of a target group, 0 if the profile has no
+// such group. Groups with static IPs need as many static IPs as instances.
+func (p *Profile) Instances(group string) int {
+	for _, spec := range p.groups {
+		if string(spec.name) == group {
+			return spec.instances
+		}
+	}
+	return 0
+}
+
+// Target returns the target group of a source instance group, "" if it is removed or
+// not consolidated (e.g. "compute" for "router" in the tiny profile).
+func (p *Profile) Target(source string) string {
+	return string(p.sources[source])
+}
+
+// Profiles returns the names of the built-in profiles, from the fewest to the most VMs.
+func Profiles() []string {
+	return []string{ProfileTiny, ProfileDefault, ProfileHALike, ProfileStock}
+}
+
+// LookupProfile returns the built-in profile with name; an empty name is the default profile.
+func LookupProfile(name string) (*Profile, error) {
+	switch name {
+	case "", ProfileDefault:
+		return defaultProfile(), nil
+	case ProfileTiny:
+		return tinyProfile(), nil
+	case ProfileHALike:
+		return haLikeProfile(), nil
+	case ProfileStock:
+		return &Profile{name: ProfileStock}, nil
+	}
+	return nil, fmt.Errorf("consolidate: unknown profile '%s' (available: %s)", name, strings.Join(Profiles(), ", "))
+}
+
+// defaultProfile consolidates into the five groups control, compute, database, router and blobstore.
+func defaultProfile() *Profile {
+	return &Profile{
+		name:            ProfileDefault,
+		sources:         maps.Clone(sourceMapping),
+		extractedJobs:   map[string]map[string]targetGroup{"scheduler": maps.Clone(jobsExtractedFromScheduler)},
+		domainOverrides: maps.Clone(domainOverrides),
+		groups:          append([]groupSpec(nil), instanceGroups...),
+	}
+}
+
+// tinyProfile consolidates into three groups, as few as the package and port collisions allow:
+//   - database  – serial:true  – database, nats, singleton-blobstore and doppler. doppler must
+//     stay apart from log-api (port 8082), nats apart from diego (pid_utils).
+//   - control   – serial:true  – as in the default profile.
+//   - compute   – serial:false – diego-cell with router, tcp-router, ssh_proxy and smoke-tests.
+//     gorouter must stay apart from UAA (port 8080), smoke-tests apart from capi and pxc
+//     (golang-1-linux).
+func tinyProfile() *Profile {
+	p := defaultProfile()
+	p.name = ProfileTiny
+	for source, target := range p.sources {
+		switch target {
+		case groupBlobstore:
+			p.sources[source] = groupDatabase
+		case groupRouter:
+			p.sources[source] = groupCompute
+		}
+	}
+	p.extractedJobs["scheduler"]["ssh_proxy"] = groupCompute
+	for domain := range p.domainOverrides {
+		p.domainOverrides[domain] = groupCompute
+	}
+	p.groups = []groupSpec{
+		{name: groupDatabase, vmType: "small", serial: true, instances: 1},
+		{name: groupControl, vmType: "medium", serial: true, instances: 1},
+		{name: groupCompute, vmType: "small-highmem", serial: false, instances: 1},
+	}
+	return p
+}
+
+// haLikeProfile is the default profile with three diego cells and two routers spread
+// across the availability zones, to exercise placement, routing and evacuation.
+func haLikeProfile() *Profile {
+	p := defaultProfile()
+	p.name = ProfileHALike
+	for i, spec := range p.groups {
+		switch spec.name {
+		case groupCompute:
+			p.groups[i].instances = 3
+			p.groups[i].azs = []string{"z1", "z2", "z3"}
+		case groupRouter:
+			p.groups[i].instances = 2
+			p.groups[i].azs = []string{"z1", "z2"}
+		}
+	}
+	return p
+}
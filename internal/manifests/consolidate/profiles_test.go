@@ -0,0 +1,172 @@
+package consolidate_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/rkoster/instant-bosh/internal/manifests/consolidate"
+)
+
+// groupNames returns the instance group names of a consolidated manifest, in order.
+func groupNames(t *testing.T, manifestBytes []byte) []string {
+	t.Helper()
+	var m struct {
+		InstanceGroups []consolidate.InstanceGroup `yaml:"instance_groups"`
+	}
+	if err := yaml.Unmarshal(manifestBytes, &m); err != nil {
+		t.Fatalf("failed to parse consolidated manifest: %v", err)
+	}
+	var names []string
+	for _, ig := range m.InstanceGroups {
+		names = append(names, ig.Name)
+	}
+	return names
+}
+
+// consolidateWithProfile looks up the profile name and consolidates the test manifest with it.
+func consolidateWithProfile(t *testing.T, name string, opts consolidate.Options) []byte {
+	t.Helper()
+	profile, err := consolidate.LookupProfile(name)
+	if err != nil {
+		t.Fatalf("LookupProfile(%q) error = %v", name, err)
+	}
+	out, err := consolidate.ConsolidateWithProfile(buildInterpolatedManifest(t), profile, opts)
+	if err != nil {
+		t.Fatalf("ConsolidateWithProfile(%q) error = %v", name, err)
+	}
+	return out
+}
+
+// TestLookupProfile asserts the built-in profiles are found and unknown names are rejected.
+func TestLookupProfile(t *testing.T) {
+	for _, name := range consolidate.Profiles() {
+		profile, err := consolidate.LookupProfile(name)
+		if err != nil {
+			t.Fatalf("LookupProfile(%q) error = %v", name, err)
+		}
+		if profile.Name() != name {
+			t.Errorf("LookupProfile(%q).Name() = %q", name, profile.Name())
+		}
+	}
+
+	profile, err := consolidate.LookupProfile("")
+	if err != nil {
+		t.Fatalf("LookupProfile(\"\") error = %v", err)
+	}
+	if profile.Name() != consolidate.ProfileDefault {
+		t.Errorf("empty profile name must be the default profile, got %q", profile.Name())
+	}
+
+	if _, err := consolidate.LookupProfile("huge"); err == nil || !strings.Contains(err.Error(), "unknown profile 'huge'") {
+		t.Errorf("LookupProfile(\"huge\") error = %v, want unknown profile error", err)
+	}
+}
+
+// TestDefaultProfileMatchesConsolidateInstanceGroups asserts the default profile is what
+// ConsolidateInstanceGroups has always produced.
+func TestDefaultProfileMatchesConsolidateInstanceGroups(t *testing.T) {
+	want, err := consolidate.ConsolidateInstanceGroups(buildInterpolatedManifest(t))
+	if err != nil {
+		t.Fatalf("ConsolidateInstanceGroups() error = %v", err)
+	}
+	got := consolidateWithProfile(t, consolidate.ProfileDefault, consolidate.Options{})
+	if !bytes.Equal(got, want) {
+		t.Error("default profile output differs from ConsolidateInstanceGroups output")
+	}
+}
+
+// TestTinyProfileHasThreeGroups asserts the tiny profile consolidates into database, control
+// and compute, with the router and blobstore jobs moved into compute and database.
+func TestTinyProfileHasThreeGroups(t *testing.T) {
+	out := consolidateWithProfile(t, consolidate.ProfileTiny, consolidate.Options{})
+
+	if got := strings.Join(groupNames(t, out), ","); got != "database,control,compute" {
+		t.Fatalf("tiny profile groups = %s, want database,control,compute", got)
+	}
+
+	compute := findInstanceGroup(t, out, "compute")
+	for _, job := range []string{"rep", "gorouter", "tcp_router", "ssh_proxy"} {
+		if !containsJob(compute, job) {
+			t.Errorf("compute group must contain %s job, got: %v", job, jobNames(compute))
+		}
+	}
+	database := findInstanceGroup(t, out, "database")
+	for _, job := range []string{"pxc-mysql", "nats-tls", "blobstore", "doppler"} {
+		if !containsJob(database, job) {
+			t.Errorf("database group must contain %s job, got: %v", job, jobNames(database))
+		}
+	}
+
+	found := false
+	for _, net := range compute.Networks {
+		for _, ip := range net.StaticIPs {
+			found = found || ip == stubRouterIP
+		}
+	}
+	if !found {
+		t.Errorf("compute group must have router static IP %q, got: %+v", stubRouterIP, compute.Networks)
+	}
+
+	if strings.Contains(string(out), "instance_group: router") || strings.Contains(string(out), "instance_group: blobstore") {
+		t.Error("DNS aliases must not target the router or blobstore groups in the tiny profile")
+	}
+}
+
+// TestHALikeProfileNeedsRouterIPs asserts the ha-like profile errors without a static IP
+// for the second router.
+func TestHALikeProfileNeedsRouterIPs(t *testing.T) {
+	profile, err := consolidate.LookupProfile(consolidate.ProfileHALike)
+	if err != nil {
+		t.Fatalf("LookupProfile() error = %v", err)
+	}
+	if profile.Instances("router") != 2 {
+		t.Errorf("ha-like router instances = %d, want 2", profile.Instances("router"))
+	}
+	if _, err := consolidate.ConsolidateWithProfile(buildInterpolatedManifest(t), profile, consolidate.Options{}); err == nil {
+		t.Error("ha-like profile without extra router static IPs must fail")
+	}
+}
+
+// TestHALikeProfileScalesComputeAndRouter asserts the instances, AZs and static IPs of the
+// ha-like profile.
+func TestHALikeProfileScalesComputeAndRouter(t *testing.T) {
+	out := consolidateWithProfile(t, consolidate.ProfileHALike, consolidate.Options{
+		StaticIPs: map[string][]string{"router": {"10.0.1.6"}},
+	})
+
+	compute := findInstanceGroup(t, out, "compute")
+	if compute.Instances != 3 || strings.Join(compute.AZs, ",") != "z1,z2,z3" {
+		t.Errorf("compute = %d instances in %v, want 3 in z1,z2,z3", compute.Instances, compute.AZs)
+	}
+
+	router := findInstanceGroup(t, out, "router")
+	if router.Instances != 2 || strings.Join(router.AZs, ",") != "z1,z2" {
+		t.Errorf("router = %d instances in %v, want 2 in z1,z2", router.Instances, router.AZs)
+	}
+	if len(router.Networks) == 0 || strings.Join(router.Networks[0].StaticIPs, ",") != stubRouterIP+",10.0.1.6" {
+		t.Errorf("router static IPs = %+v, want %s,10.0.1.6", router.Networks, stubRouterIP)
+	}
+
+	if control := findInstanceGroup(t, out, "control"); control.Instances != 1 {
+		t.Errorf("control instances = %d, want 1", control.Instances)
+	}
+}
+
+// TestStockProfileLeavesManifestUnchanged asserts the stock profile does not consolidate.
+func TestStockProfileLeavesManifestUnchanged(t *testing.T) {
+	input := buildInterpolatedManifest(t)
+	profile, err := consolidate.LookupProfile(consolidate.ProfileStock)
+	if err != nil {
+		t.Fatalf("LookupProfile() error = %v", err)
+	}
+	out, err := consolidate.ConsolidateWithProfile(input, profile, consolidate.Options{})
+	if err != nil {
+		t.Fatalf("ConsolidateWithProfile() error = %v", err)
+	}
+	if !bytes.Equal(out, input) {
+		t.Error("stock profile must return the manifest unchanged")
+	}
+}
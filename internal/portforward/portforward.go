@@ -0,0 +1,151 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	"github.com/rkoster/instant-bosh/internal/director"
+)
+
+// Forward is a local port forwarded to a port on a deployment instance.
+type Forward struct {
+	LocalPort  int
+	RemotePort int
+}
+
+// ParseForward parses a "<local>:<remote>" port pair. A single port forwards the
+// same port number locally.
+func ParseForward(spec string) (Forward, error) {
+	local, remote, found := strings.Cut(spec, ":")
+	if !found {
+		remote = local
+	}
+
+	localPort, err := parsePort(local)
+	if err != nil {
+		return Forward{}, fmt.Errorf("invalid port forward %q: local %w", spec, err)
+	}
+	remotePort, err := parsePort(remote)
+	if err != nil {
+		return Forward{}, fmt.Errorf("invalid port forward %q: remote %w", spec, err)
+	}
+	return Forward{LocalPort: localPort, RemotePort: remotePort}, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("port %q must be a number between 1 and 65535", s)
+	}
+	return port, nil
+}
+
+// InstanceAddress returns the IP of the single instance of deployment matching slug.
+func InstanceAddress(deployment boshdir.Deployment, slug boshdir.AllOrInstanceGroupOrInstanceSlug) (string, string, error) {
+	vms, err := deployment.VMInfos()
+	if err != nil {
+		return "", "", fmt.Errorf("listing instances of %s: %w", deployment.Name(), err)
+	}
+
+	var matches []boshdir.VMInfo
+	for _, vm := range vms {
+		if slug.Name() != "" && vm.JobName != slug.Name() {
+			continue
+		}
+		if indexOrID := slug.IndexOrID(); indexOrID != "" && vm.ID != indexOrID && (vm.Index == nil || strconv.Itoa(*vm.Index) != indexOrID) {
+			continue
+		}
+		matches = append(matches, vm)
+	}
+
+	switch {
+	case len(matches) == 0:
+		return "", "", fmt.Errorf("no instances of %s found matching %q", deployment.Name(), slug.String())
+	case len(matches) > 1:
+		return "", "", fmt.Errorf("%d instances of %s match %q, port forwarding requires exactly one", len(matches), deployment.Name(), slug.String())
+	case len(matches[0].IPs) == 0:
+		return "", "", fmt.Errorf("instance %s/%s has no IP address", matches[0].JobName, matches[0].ID)
+	}
+
+	return matches[0].JobName + "/" + matches[0].ID, matches[0].IPs[0], nil
+}
+
+// Serve accepts connections on listener and forwards each of them to remoteAddress,
+// dialed with dial (e.g. through the director's jumpbox). It returns when ctx is done.
+// Failures of individual connections are reported to onError and do not stop Serve.
+func Serve(ctx context.Context, listener net.Listener, dial director.DialContextFunc, remoteAddress string, onError func(error)) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("accepting connection on %s: %w", listener.Addr(), err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := forward(ctx, conn, dial, remoteAddress); err != nil {
+				onError(err)
+			}
+		}()
+	}
+}
+
+func forward(ctx context.Context, conn net.Conn, dial director.DialContextFunc, remoteAddress string) error {
+	defer conn.Close()
+
+	remote, err := dial(ctx, "tcp", remoteAddress)
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", remoteAddress, err)
+	}
+	defer remote.Close()
+
+	// Stop copying when the forwarder shuts down
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+		remote.Close()
+	})
+	defer stop()
+
+	errs := make(chan error, 2)
+	go func() { errs <- pipe(remote, conn) }()
+	go func() { errs <- pipe(conn, remote) }()
+
+	// Wait for both directions, a half-closed connection may still receive data
+	err = errors.Join(<-errs, <-errs)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// pipe copies src to dst and closes the write side of dst when src is drained.
+func pipe(dst, src net.Conn) error {
+	_, err := io.Copy(dst, src)
+	if closeWriter, ok := dst.(interface{ CloseWrite() error }); ok {
+		closeWriter.CloseWrite()
+	} else {
+		dst.Close()
+	}
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package portforward_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshdirfakes "github.com/cloudfoundry/bosh-cli/v7/director/directorfakes"
+	"github.com/rkoster/instant-bosh/internal/portforward"
+)
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    portforward.Forward
+		wantErr bool
+	}{
+		{spec: "8080:80", want: portforward.Forward{LocalPort: 8080, RemotePort: 80}},
+		{spec: "2181", want: portforward.Forward{LocalPort: 2181, RemotePort: 2181}},
+		{spec: "8080:", wantErr: true},
+		{spec: "http:80", wantErr: true},
+		{spec: "70000:80", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := portforward.ParseForward(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseForward(%q): expected error", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseForward(%q): unexpected error: %v", tt.spec, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseForward(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestInstanceAddress(t *testing.T) {
+	zero, one := 0, 1
+	deployment := &boshdirfakes.FakeDeployment{}
+	deployment.NameReturns("cf")
+	deployment.VMInfosReturns([]boshdir.VMInfo{
+		{JobName: "router", ID: "abc", Index: &zero, IPs: []string{"10.245.0.34"}},
+		{JobName: "api", ID: "def", Index: &zero, IPs: []string{"10.245.0.40"}},
+		{JobName: "api", ID: "ghi", Index: &one, IPs: []string{"10.245.0.41"}},
+	}, nil)
+
+	tests := []struct {
+		slug     boshdir.AllOrInstanceGroupOrInstanceSlug
+		instance string
+		ip       string
+		wantErr  bool
+	}{
+		{slug: boshdir.NewAllOrInstanceGroupOrInstanceSlug("router", ""), instance: "router/abc", ip: "10.245.0.34"},
+		{slug: boshdir.NewAllOrInstanceGroupOrInstanceSlug("api", "1"), instance: "api/ghi", ip: "10.245.0.41"},
+		{slug: boshdir.NewAllOrInstanceGroupOrInstanceSlug("api", "def"), instance: "api/def", ip: "10.245.0.40"},
+		{slug: boshdir.NewAllOrInstanceGroupOrInstanceSlug("api", ""), wantErr: true},
+		{slug: boshdir.NewAllOrInstanceGroupOrInstanceSlug("uaa", ""), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		instance, ip, err := portforward.InstanceAddress(deployment, tt.slug)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("InstanceAddress(%s): expected error", tt.slug)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("InstanceAddress(%s): unexpected error: %v", tt.slug, err)
+			continue
+		}
+		if instance != tt.instance || ip != tt.ip {
+			t.Errorf("InstanceAddress(%s) = %s, %s; want %s, %s", tt.slug, instance, ip, tt.instance, tt.ip)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	// Echo service standing in for a service on a deployment instance
+	remote, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	defer remote.Close()
+	go func() {
+		for {
+			conn, err := remote.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+
+	var dialed []string
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, remote.Addr().String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	connErrs := make(chan error, 1)
+	go func() {
+		done <- portforward.Serve(ctx, listener, dial, "10.245.0.34:80", func(err error) { connErrs <- err })
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("expected echo of ping, got %q", buf)
+	}
+	conn.Close()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after cancel")
+	}
+
+	// Serve waits for its connections, so dialed is safe to read
+	if len(dialed) != 1 || dialed[0] != "10.245.0.34:80" {
+		t.Errorf("expected a single dial to 10.245.0.34:80, got %v", dialed)
+	}
+	select {
+	case err := <-connErrs:
+		t.Errorf("unexpected connection error: %v", err)
+	default:
+	}
+}
+
+func TestServeReportsDialErrors(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, errors.New("no route to instance")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	connErrs := make(chan error, 1)
+	go portforward.Serve(ctx, listener, dial, "10.245.0.34:80", func(err error) { connErrs <- err })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	select {
+	case err := <-connErrs:
+		if err == nil {
+			t.Error("expected a connection error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected dial error to be reported")
+	}
+}
@@ -0,0 +1,322 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	dockerregistry "github.com/docker/docker/api/types/registry"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/types/ref"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables for explicit registry credentials.
+const (
+	// EnvRegistryHost is the registry the credentials from the environment are used for.
+	// If unset, the credentials from the environment are not used.
+	EnvRegistryHost = "IBOSH_REGISTRY_HOST"
+	// EnvRegistryUsername and EnvRegistryPassword provide basic auth credentials.
+	EnvRegistryUsername = "IBOSH_REGISTRY_USERNAME"
+	EnvRegistryPassword = "IBOSH_REGISTRY_PASSWORD"
+	// EnvRegistryToken provides an access token (e.g. a GitHub PAT or robot account token).
+	// It is sent as the password, with EnvRegistryUsername or "token" as the username.
+	EnvRegistryToken = "IBOSH_REGISTRY_TOKEN"
+	// EnvRegistryCredentialHelper names a docker credential helper
+	// (e.g. "ecr-login" runs docker-credential-ecr-login).
+	EnvRegistryCredentialHelper = "IBOSH_REGISTRY_CREDENTIAL_HELPER"
+	// EnvRegistryConfig overrides the path of the per-registry config file.
+	EnvRegistryConfig = "IBOSH_REGISTRY_CONFIG"
+)
+
+// defaultTokenUsername is the username sent with a token when none is configured.
+// Registries that accept tokens as basic auth passwords ignore the username.
+const defaultTokenUsername = "token"
+
+// identityTokenUsername is returned by credential helpers for identity (refresh) tokens.
+const identityTokenUsername = "<token>"
+
+// Credential holds the credentials for a single registry.
+type Credential struct {
+	Username      string
+	Password      string
+	IdentityToken string // OAuth2 refresh token returned by some credential helpers
+}
+
+// Empty returns true if no credentials are set.
+func (c Credential) Empty() bool {
+	return c.Username == "" && c.Password == "" && c.IdentityToken == ""
+}
+
+// AuthConfig is the per-registry config file (~/.config/ibosh/registries.yml):
+//
+//	registries:
+//	  registry.example.com:
+//	    username: robot
+//	    password: secret
+//	  123456789.dkr.ecr.eu-west-1.amazonaws.com:
+//	    credential_helper: ecr-login
+type AuthConfig struct {
+	Registries map[string]RegistryAuth `yaml:"registries"`
+}
+
+// RegistryAuth configures the credentials for a single registry.
+type RegistryAuth struct {
+	Username         string `yaml:"username,omitempty"`
+	Password         string `yaml:"password,omitempty"`
+	Token            string `yaml:"token,omitempty"`
+	CredentialHelper string `yaml:"credential_helper,omitempty"`
+}
+
+// Auth resolves explicit credentials for registries. Lookups go through:
+//  1. the entry for the registry in the config file
+//  2. the IBOSH_REGISTRY_* environment variables, if IBOSH_REGISTRY_HOST is the registry
+//
+// If neither provides credentials, callers fall back to their own defaults
+// (~/.docker/config.json for regclient and the Docker daemon, the OCI remote for Incus).
+// A nil *Auth has no credentials.
+type Auth struct {
+	config AuthConfig
+	env    RegistryAuth
+	host   string
+
+	// runHelper executes a credential helper, replaceable in tests.
+	runHelper func(helper, host string) (Credential, error)
+}
+
+// DefaultAuthConfigPath returns the path of the per-registry config file.
+func DefaultAuthConfigPath() (string, error) {
+	if path := os.Getenv(EnvRegistryConfig); path != "" {
+		return path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "ibosh", "registries.yml"), nil
+}
+
+// LoadAuth loads registry credentials from the environment and the config file.
+// A missing config file is not an error.
+func LoadAuth() (*Auth, error) {
+	auth := &Auth{
+		env: RegistryAuth{
+			Username:         os.Getenv(EnvRegistryUsername),
+			Password:         os.Getenv(EnvRegistryPassword),
+			Token:            os.Getenv(EnvRegistryToken),
+			CredentialHelper: os.Getenv(EnvRegistryCredentialHelper),
+		},
+		host:      normalizeRegistryHost(os.Getenv(EnvRegistryHost)),
+		runHelper: runCredentialHelper,
+	}
+
+	path, err := DefaultAuthConfigPath()
+	if err != nil {
+		return auth, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return auth, nil
+		}
+		return nil, fmt.Errorf("reading registry config %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, &auth.config); err != nil {
+		return nil, fmt.Errorf("parsing registry config %s: %w", path, err)
+	}
+
+	return auth, nil
+}
+
+// Lookup returns the explicit credentials for a registry host.
+// An empty Credential means no explicit credentials are configured.
+func (a *Auth) Lookup(host string) (Credential, error) {
+	if a == nil {
+		return Credential{}, nil
+	}
+	host = normalizeRegistryHost(host)
+
+	for name, entry := range a.config.Registries {
+		if normalizeRegistryHost(name) == host {
+			return a.resolve(entry, host)
+		}
+	}
+
+	if a.host != "" && a.host == host {
+		return a.resolve(a.env, host)
+	}
+
+	return Credential{}, nil
+}
+
+// LookupImage returns the explicit credentials for the registry of an image reference.
+func (a *Auth) LookupImage(imageRef string) (Credential, error) {
+	r, err := ref.New(imageRef)
+	if err != nil {
+		return Credential{}, fmt.Errorf("parsing image reference: %w", err)
+	}
+	return a.Lookup(r.Registry)
+}
+
+// RegClientOpts returns the regclient options for accessing a registry host.
+// Explicit credentials take precedence over ~/.docker/config.json.
+func (a *Auth) RegClientOpts(host string) ([]regclient.Opt, error) {
+	opts := []regclient.Opt{
+		regclient.WithDockerCreds(),
+		regclient.WithDockerCerts(),
+	}
+
+	cred, err := a.Lookup(host)
+	if err != nil {
+		return nil, err
+	}
+	if cred.Empty() {
+		return opts, nil
+	}
+
+	hostConfig := config.HostNewName(host)
+	hostConfig.User = cred.Username
+	hostConfig.Pass = cred.Password
+	hostConfig.Token = cred.IdentityToken
+	return append(opts, regclient.WithConfigHost(*hostConfig)), nil
+}
+
+// DockerRegistryAuth returns the encoded credentials for the Docker Engine API
+// (image pull and distribution inspect) for an image reference.
+// It returns an empty string if no explicit credentials are configured,
+// in which case the Docker daemon uses its own credential store.
+func (a *Auth) DockerRegistryAuth(imageRef string) (string, error) {
+	r, err := ref.New(imageRef)
+	if err != nil {
+		return "", fmt.Errorf("parsing image reference: %w", err)
+	}
+
+	cred, err := a.Lookup(r.Registry)
+	if err != nil {
+		return "", err
+	}
+	if cred.Empty() {
+		return "", nil
+	}
+
+	serverAddress := r.Registry
+	if serverAddress == "docker.io" {
+		serverAddress = "https://index.docker.io/v1/"
+	}
+
+	return dockerregistry.EncodeAuthConfig(dockerregistry.AuthConfig{
+		Username:      cred.Username,
+		Password:      cred.Password,
+		IdentityToken: cred.IdentityToken,
+		ServerAddress: serverAddress,
+	})
+}
+
+// resolve turns a config entry into credentials, running the credential helper if configured.
+func (a *Auth) resolve(entry RegistryAuth, host string) (Credential, error) {
+	switch {
+	case entry.CredentialHelper != "":
+		cred, err := a.runHelper(entry.CredentialHelper, host)
+		if err != nil {
+			return Credential{}, fmt.Errorf("getting credentials for %s from helper %s: %w", host, entry.CredentialHelper, err)
+		}
+		return cred, nil
+	case entry.Token != "":
+		username := entry.Username
+		if username == "" {
+			username = defaultTokenUsername
+		}
+		return Credential{Username: username, Password: entry.Token}, nil
+	default:
+		return Credential{Username: entry.Username, Password: entry.Password}, nil
+	}
+}
+
+// runCredentialHelper executes docker-credential-<helper> get, following the
+// docker credential helper protocol.
+func runCredentialHelper(helper, host string) (Credential, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(host)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		// Helpers report missing credentials on stdout with a non-zero exit code
+		if strings.Contains(string(output), "credentials not found") {
+			return Credential{}, nil
+		}
+		return Credential{}, fmt.Errorf("%w: %s%s", err, strings.TrimSpace(string(output)), strings.TrimSpace(stderr.String()))
+	}
+
+	var response struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(output, &response); err != nil {
+		return Credential{}, fmt.Errorf("parsing helper output: %w", err)
+	}
+
+	if response.Username == identityTokenUsername {
+		return Credential{IdentityToken: response.Secret}, nil
+	}
+	return Credential{Username: response.Username, Password: response.Secret}, nil
+}
+
+// ServeCredentialHelper answers a docker credential helper get request, which has the
+// registry server URL on stdin, with the explicit credentials for that registry (see
+// LoadAuth). This lets ibosh act as the credential helper of tools that run one, such as
+// the Incus OCI remote, so credentials are not passed on in URLs.
+func ServeCredentialHelper(stdin io.Reader, stdout io.Writer) error {
+	serverURL, err := io.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("reading server URL: %w", err)
+	}
+	host := strings.TrimSpace(string(serverURL))
+
+	auth, err := LoadAuth()
+	if err != nil {
+		return err
+	}
+	cred, err := auth.Lookup(host)
+	if err != nil {
+		return err
+	}
+	if cred.Empty() {
+		// The message helpers report missing credentials with
+		return errors.New("credentials not found in native keychain")
+	}
+
+	response := struct {
+		ServerURL string `json:"ServerURL"`
+		Username  string `json:"Username"`
+		Secret    string `json:"Secret"`
+	}{ServerURL: host, Username: cred.Username, Secret: cred.Password}
+	if cred.IdentityToken != "" {
+		response.Username = identityTokenUsername
+		response.Secret = cred.IdentityToken
+	}
+	return json.NewEncoder(stdout).Encode(response)
+}
+
+// normalizeRegistryHost maps the different Docker Hub host names onto docker.io
+// and strips schemes and trailing slashes from configured names.
+func normalizeRegistryHost(host string) string {
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	host = strings.TrimSuffix(host, "/")
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "index.docker.io/v1":
+		return "docker.io"
+	}
+	return host
+}
@@ -0,0 +1,209 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func fakeHelper(creds map[string]Credential) func(helper, host string) (Credential, error) {
+	return func(helper, host string) (Credential, error) {
+		if helper != "test" {
+			return Credential{}, errors.New("unknown helper " + helper)
+		}
+		return creds[host], nil
+	}
+}
+
+func TestAuth_LookupConfigFile(t *testing.T) {
+	auth := &Auth{
+		config: AuthConfig{Registries: map[string]RegistryAuth{
+			"registry.example.com":   {Username: "robot", Password: "secret"},
+			"https://ghcr.io/":       {Token: "ghp_abc"},
+			"ecr.example.com":        {CredentialHelper: "test"},
+			"index.docker.io":        {Username: "hub", Password: "hubsecret"},
+			"other.example.com:5000": {Username: "other", Token: "tok"},
+		}},
+		runHelper: fakeHelper(map[string]Credential{
+			"ecr.example.com": {Username: "AWS", Password: "ecr-token"},
+		}),
+	}
+
+	for host, expected := range map[string]Credential{
+		"registry.example.com":   {Username: "robot", Password: "secret"},
+		"ghcr.io":                {Username: defaultTokenUsername, Password: "ghp_abc"},
+		"ecr.example.com":        {Username: "AWS", Password: "ecr-token"},
+		"docker.io":              {Username: "hub", Password: "hubsecret"},
+		"other.example.com:5000": {Username: "other", Password: "tok"},
+		"quay.io":                {},
+	} {
+		cred, err := auth.Lookup(host)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", host, err)
+		}
+		if cred != expected {
+			t.Errorf("expected %+v for %s, got %+v", expected, host, cred)
+		}
+	}
+}
+
+func TestAuth_LookupEnvironment(t *testing.T) {
+	unscoped := &Auth{env: RegistryAuth{Username: "user", Password: "pass"}}
+	cred, err := unscoped.Lookup("quay.io")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cred.Empty() {
+		t.Errorf("expected no credentials without %s, got %+v", EnvRegistryHost, cred)
+	}
+
+	scoped := &Auth{env: RegistryAuth{Token: "tok"}, host: "registry.example.com"}
+	cred, err = scoped.Lookup("registry.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cred.Password != "tok" {
+		t.Errorf("expected token credentials, got %+v", cred)
+	}
+	cred, err = scoped.Lookup("ghcr.io")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cred.Empty() {
+		t.Errorf("expected no credentials outside of %s, got %+v", EnvRegistryHost, cred)
+	}
+}
+
+func TestAuth_HelperError(t *testing.T) {
+	auth := &Auth{
+		env:       RegistryAuth{CredentialHelper: "missing"},
+		host:      "ghcr.io",
+		runHelper: fakeHelper(nil),
+	}
+	if _, err := auth.Lookup("ghcr.io"); err == nil {
+		t.Error("expected error from failing credential helper")
+	}
+}
+
+func TestAuth_NilAuth(t *testing.T) {
+	var auth *Auth
+	cred, err := auth.Lookup("ghcr.io")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cred.Empty() {
+		t.Errorf("expected no credentials, got %+v", cred)
+	}
+}
+
+func TestAuth_DockerRegistryAuth(t *testing.T) {
+	auth := &Auth{env: RegistryAuth{Username: "robot", Password: "secret"}, host: "registry.example.com"}
+
+	encoded, err := auth.DockerRegistryAuth("registry.example.com/team/instant-bosh:custom")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("invalid encoding: %v", err)
+	}
+	var decoded struct {
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		ServerAddress string `json:"serveraddress"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if decoded.Username != "robot" || decoded.Password != "secret" || decoded.ServerAddress != "registry.example.com" {
+		t.Errorf("unexpected auth config: %+v", decoded)
+	}
+
+	encoded, err = auth.DockerRegistryAuth("ghcr.io/rkoster/instant-bosh:latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if encoded != "" {
+		t.Errorf("expected no credentials for other registries, got %q", encoded)
+	}
+}
+
+func TestLoadAuth(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "registries.yml")
+	err := os.WriteFile(configPath, []byte(`
+registries:
+  registry.example.com:
+    username: robot
+    password: secret
+`), 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Setenv(EnvRegistryConfig, configPath)
+	t.Setenv(EnvRegistryHost, "ghcr.io")
+	t.Setenv(EnvRegistryUsername, "")
+	t.Setenv(EnvRegistryPassword, "")
+	t.Setenv(EnvRegistryToken, "ghp_abc")
+	t.Setenv(EnvRegistryCredentialHelper, "")
+
+	auth, err := LoadAuth()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cred, err := auth.Lookup("registry.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cred.Username != "robot" {
+		t.Errorf("expected credentials from config file, got %+v", cred)
+	}
+
+	cred, err = auth.Lookup("ghcr.io")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cred.Password != "ghp_abc" {
+		t.Errorf("expected token from environment, got %+v", cred)
+	}
+
+	if err := os.WriteFile(configPath, []byte("registries: ["), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := LoadAuth(); err == nil {
+		t.Error("expected error for malformed config file")
+	}
+}
+
+func TestServeCredentialHelper(t *testing.T) {
+	t.Setenv(EnvRegistryConfig, filepath.Join(t.TempDir(), "missing.yml"))
+	t.Setenv(EnvRegistryHost, "registry.example.com")
+	t.Setenv(EnvRegistryUsername, "robot")
+	t.Setenv(EnvRegistryPassword, "secret")
+	t.Setenv(EnvRegistryToken, "")
+	t.Setenv(EnvRegistryCredentialHelper, "")
+
+	var stdout bytes.Buffer
+	if err := ServeCredentialHelper(strings.NewReader("https://registry.example.com\n"), &stdout); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var response map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if response["Username"] != "robot" || response["Secret"] != "secret" {
+		t.Errorf("unexpected helper response %v", response)
+	}
+
+	err := ServeCredentialHelper(strings.NewReader("https://ghcr.io"), &stdout)
+	if err == nil || !strings.Contains(err.Error(), "credentials not found") {
+		t.Errorf("expected credentials not found error, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+)
+
+const (
+	// DefaultCacheTTL is how long mutable registry data (tag lists and
+	// tag to digest mappings) is served from the cache before it is re-fetched.
+	DefaultCacheTTL = 1 * time.Hour
+
+	// noExpiry marks cache entries for immutable data (content addressed by digest).
+	noExpiry time.Duration = 0
+
+	cacheKindTags      = "tags"
+	cacheKindDigests   = "digests"
+	cacheKindPlatforms = "platforms"
+	cacheKindParents   = "parents"
+	cacheKindFiles     = "files"
+)
+
+// DefaultCacheDir returns the directory used for the registry cache
+// (e.g. ~/.cache/ibosh/registry on Linux).
+func DefaultCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "ibosh", "registry"), nil
+}
+
+// diskCache stores registry lookups as JSON files on disk.
+// All failures are logged and treated as cache misses, the cache never breaks a lookup.
+type diskCache struct {
+	dir     string
+	ttl     time.Duration
+	refresh bool
+	logger  boshlog.Logger
+	logTag  string
+}
+
+// cacheEntry is the on-disk representation of a cached value.
+type cacheEntry struct {
+	StoredAt time.Time       `json:"stored_at"`
+	Value    json.RawMessage `json:"value"`
+}
+
+func newDiskCache(logger boshlog.Logger, dir string, ttl time.Duration, refresh bool) *diskCache {
+	return &diskCache{
+		dir:     dir,
+		ttl:     ttl,
+		refresh: refresh,
+		logger:  logger,
+		logTag:  "registryCache",
+	}
+}
+
+// get loads a cached value into v. It returns false if the cache is disabled,
+// refresh was requested, the entry is missing or it is older than ttl.
+// A ttl of noExpiry never expires.
+func (c *diskCache) get(kind, key string, ttl time.Duration, v interface{}) bool {
+	if c == nil || c.refresh {
+		return false
+	}
+
+	data, err := os.ReadFile(c.path(kind, key))
+	if err != nil {
+		return false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		c.logger.Debug(c.logTag, "Ignoring corrupt cache entry %s/%s: %v", kind, key, err)
+		return false
+	}
+
+	if ttl != noExpiry && time.Since(entry.StoredAt) > ttl {
+		c.logger.Debug(c.logTag, "Cache entry %s/%s expired", kind, key)
+		return false
+	}
+
+	if err := json.Unmarshal(entry.Value, v); err != nil {
+		c.logger.Debug(c.logTag, "Ignoring undecodable cache entry %s/%s: %v", kind, key, err)
+		return false
+	}
+
+	c.logger.Debug(c.logTag, "Cache hit for %s/%s", kind, key)
+	return true
+}
+
+// put stores a value in the cache. The file is written atomically so
+// concurrent ibosh invocations never read a partially written entry.
+func (c *diskCache) put(kind, key string, v interface{}) {
+	if c == nil {
+		return
+	}
+
+	value, err := json.Marshal(v)
+	if err != nil {
+		c.logger.Debug(c.logTag, "Failed to encode cache entry %s/%s: %v", kind, key, err)
+		return
+	}
+	data, err := json.Marshal(cacheEntry{StoredAt: time.Now(), Value: value})
+	if err != nil {
+		c.logger.Debug(c.logTag, "Failed to encode cache entry %s/%s: %v", kind, key, err)
+		return
+	}
+
+	path := c.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		c.logger.Debug(c.logTag, "Failed to create cache directory: %v", err)
+		return
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		c.logger.Debug(c.logTag, "Failed to create cache file: %v", err)
+		return
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		c.logger.Debug(c.logTag, "Failed to write cache file: %v", err)
+		return
+	}
+	if err := tmpFile.Close(); err != nil {
+		c.logger.Debug(c.logTag, "Failed to write cache file: %v", err)
+		return
+	}
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		c.logger.Debug(c.logTag, "Failed to store cache file: %v", err)
+	}
+}
+
+// path returns the file used for a cache entry. Keys are hashed because
+// image references contain characters that are not valid in file names.
+func (c *diskCache) path(kind, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, kind, hex.EncodeToString(sum[:])+".json")
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+)
+
+func newTestCache(t *testing.T, ttl time.Duration, refresh bool) *diskCache {
+	t.Helper()
+	return newDiskCache(boshlog.NewLogger(boshlog.LevelNone), t.TempDir(), ttl, refresh)
+}
+
+func TestDiskCache_PutAndGet(t *testing.T) {
+	cache := newTestCache(t, time.Hour, false)
+
+	cache.put(cacheKindTags, "ghcr.io/rkoster/instant-bosh", []string{"1.165", "latest"})
+
+	var tags []string
+	if !cache.get(cacheKindTags, "ghcr.io/rkoster/instant-bosh", cache.ttl, &tags) {
+		t.Fatal("expected cache hit")
+	}
+	if len(tags) != 2 || tags[0] != "1.165" || tags[1] != "latest" {
+		t.Errorf("unexpected cached tags: %v", tags)
+	}
+
+	var digest string
+	if cache.get(cacheKindDigests, "ghcr.io/rkoster/instant-bosh:latest", cache.ttl, &digest) {
+		t.Error("expected cache miss for unknown key")
+	}
+}
+
+func TestDiskCache_Expiry(t *testing.T) {
+	cache := newTestCache(t, time.Hour, false)
+	key := "ghcr.io/rkoster/instant-bosh:latest"
+
+	cache.put(cacheKindDigests, key, "sha256:aaa")
+
+	// Backdate the entry beyond the TTL
+	old := time.Now().Add(-2 * time.Hour)
+	entry := `{"stored_at":"` + old.Format(time.RFC3339Nano) + `","value":"sha256:aaa"}`
+	if err := os.WriteFile(cache.path(cacheKindDigests, key), []byte(entry), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var digest string
+	if cache.get(cacheKindDigests, key, cache.ttl, &digest) {
+		t.Error("expected expired entry to be a cache miss")
+	}
+	if !cache.get(cacheKindDigests, key, noExpiry, &digest) {
+		t.Error("expected entry without expiry to be a cache hit")
+	}
+	if digest != "sha256:aaa" {
+		t.Errorf("expected digest 'sha256:aaa', got %q", digest)
+	}
+}
+
+func TestDiskCache_Refresh(t *testing.T) {
+	cache := newTestCache(t, time.Hour, true)
+	key := "ghcr.io/rkoster/instant-bosh:latest"
+
+	cache.put(cacheKindDigests, key, "sha256:aaa")
+
+	var digest string
+	if cache.get(cacheKindDigests, key, cache.ttl, &digest) {
+		t.Error("expected refresh to bypass cached entries")
+	}
+
+	// Entries written during a refresh are served to later invocations
+	cache.refresh = false
+	if !cache.get(cacheKindDigests, key, cache.ttl, &digest) {
+		t.Error("expected refreshed entry to be cached")
+	}
+}
+
+func TestDiskCache_Disabled(t *testing.T) {
+	var cache *diskCache
+
+	cache.put(cacheKindDigests, "key", "value")
+
+	var value string
+	if cache.get(cacheKindDigests, "key", noExpiry, &value) {
+		t.Error("expected disabled cache to always miss")
+	}
+}
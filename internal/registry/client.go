@@ -4,16 +4,18 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"path"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
-	"github.com/gonvenience/ytbx"
-	"github.com/homeport/dyff/pkg/dyff"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/types/ref"
 )
@@ -21,36 +23,158 @@ import (
 const (
 	// ManifestPath is the path to the BOSH manifest inside instant-bosh images
 	ManifestPath = "/var/vcap/bosh/manifest.yml"
+
+	// maxConcurrentTagLookups bounds the number of parallel manifest requests
+	// made while resolving tags to digests.
+	maxConcurrentTagLookups = 8
 )
 
+// ClientOptions configures the registry client.
+type ClientOptions struct {
+	// CacheDir is the directory for the on-disk cache. Defaults to DefaultCacheDir().
+	CacheDir string
+	// CacheTTL is how long tag lists and tag to digest mappings are cached.
+	// Defaults to DefaultCacheTTL. Files extracted from digest-pinned images never expire.
+	CacheTTL time.Duration
+	// Refresh ignores cached entries and re-fetches everything from the registry.
+	// Fresh results are still written to the cache.
+	Refresh bool
+	// DisableCache turns off the on-disk cache entirely.
+	DisableCache bool
+	// Auth provides explicit registry credentials. Defaults to LoadAuth().
+	Auth *Auth
+	// Platform selects the entry of multi-arch manifest lists (e.g. "linux/arm64").
+	// Defaults to $IBOSH_PLATFORM or DefaultPlatform().
+	Platform string
+}
+
 // client implements the Client interface using regclient for OCI registry operations.
 type client struct {
-	logger boshlog.Logger
-	logTag string
+	logger   boshlog.Logger
+	logTag   string
+	cache    *diskCache
+	auth     *Auth
+	platform string
+
+	// manifestDigests maps platform manifest digests to the digest of their
+	// manifest list, used to find the tags of multi-arch images.
+	manifestDigests sync.Map
+}
+
+// NewClient creates a new registry client with the default on-disk cache.
+func NewClient(logger boshlog.Logger) (Client, error) {
+	return NewClientWithOptions(logger, ClientOptions{})
 }
 
-// NewClient creates a new registry client.
-func NewClient(logger boshlog.Logger) Client {
-	return &client{
+// NewClientWithOptions creates a new registry client with the given options.
+// If the cache directory cannot be determined the client works without a cache.
+// It returns an error if the registry credentials cannot be loaded.
+func NewClientWithOptions(logger boshlog.Logger, opts ClientOptions) (Client, error) {
+	c := &client{
 		logger: logger,
 		logTag: "registryClient",
+		auth:   opts.Auth,
+	}
+
+	platformName := opts.Platform
+	if platformName == "" {
+		platformName = os.Getenv(EnvPlatform)
+	}
+	platform, err := ParsePlatform(platformName)
+	if err != nil {
+		logger.Warn(c.logTag, "Using platform %s: %v", DefaultPlatform(), err)
+		platform = DefaultPlatform()
+	}
+	c.platform = platform
+
+	if c.auth == nil {
+		auth, err := LoadAuth()
+		if err != nil {
+			return nil, fmt.Errorf("loading registry credentials: %w", err)
+		}
+		c.auth = auth
+	}
+
+	if opts.DisableCache {
+		return c, nil
 	}
+
+	cacheDir := opts.CacheDir
+	if cacheDir == "" {
+		dir, err := DefaultCacheDir()
+		if err != nil {
+			logger.Debug(c.logTag, "Registry cache disabled, no cache directory: %v", err)
+			return c, nil
+		}
+		cacheDir = dir
+	}
+
+	ttl := opts.CacheTTL
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	c.cache = newDiskCache(logger, cacheDir, ttl, opts.Refresh)
+	return c, nil
+}
+
+// newRegClient creates a regclient for the registry of r. Explicit credentials
+// (see Auth) take precedence over Docker credentials from ~/.docker/config.json.
+func (c *client) newRegClient(r ref.Ref) (*regclient.RegClient, error) {
+	opts, err := c.auth.RegClientOpts(r.Registry)
+	if err != nil {
+		return nil, err
+	}
+	return regclient.New(opts...), nil
 }
 
 // ExtractFileFromImage extracts a file from an OCI image by directly downloading
 // it from the container registry without requiring the full image to be pulled.
+// Extracted files are cached by image digest, so they are only downloaded once.
 func (c *client) ExtractFileFromImage(ctx context.Context, imageRef string, filePath string) ([]byte, error) {
-	c.logger.Debug(c.logTag, "Extracting file %s from image %s via registry", filePath, imageRef)
-
-	// Create regclient with Docker credentials from ~/.docker/config.json
-	rc := regclient.New(regclient.WithDockerCreds())
-
 	// Parse image reference
 	r, err := ref.New(imageRef)
 	if err != nil {
 		return nil, fmt.Errorf("invalid image reference %s: %w", imageRef, err)
 	}
 
+	rc, err := c.newRegClient(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pin the reference to the platform manifest digest, this selects the right
+	// entry of multi-arch images and allows caching the file as immutable content
+	digest, err := c.lookupPlatformDigest(ctx, rc, r)
+	if err != nil {
+		var platformErr *NoMatchingPlatformError
+		if errors.As(err, &platformErr) {
+			return nil, err
+		}
+		c.logger.Debug(c.logTag, "Failed to resolve digest for %s, not caching: %v", imageRef, err)
+		return c.extractFileFromRegistry(ctx, rc, r, filePath)
+	}
+	r = r.SetDigest(digest)
+
+	cacheKey := r.CommonName() + "#" + path.Clean(filePath)
+	var fileData []byte
+	if c.cache.get(cacheKindFiles, cacheKey, noExpiry, &fileData) {
+		return fileData, nil
+	}
+
+	fileData, err = c.extractFileFromRegistry(ctx, rc, r, filePath)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.put(cacheKindFiles, cacheKey, fileData)
+	return fileData, nil
+}
+
+// extractFileFromRegistry downloads the image layers until filePath is found.
+func (c *client) extractFileFromRegistry(ctx context.Context, rc *regclient.RegClient, r ref.Ref, filePath string) ([]byte, error) {
+	imageRef := r.CommonName()
+	c.logger.Debug(c.logTag, "Extracting file %s from image %s via registry", filePath, imageRef)
+
 	// Get the manifest
 	m, err := rc.ManifestGet(ctx, r)
 	if err != nil {
@@ -151,107 +275,64 @@ func prependImageMetadata(manifest []byte, image ImageInfo) []byte {
 // GetManifestDiff compares BOSH manifests from two images and returns a human-readable diff.
 // Image metadata (ref, digest) is prepended to show image changes.
 func (c *client) GetManifestDiff(ctx context.Context, currentImage, newImage ImageInfo) (string, error) {
-	c.logger.Info(c.logTag, "Comparing manifests between %s and %s", currentImage.Ref, newImage.Ref)
-
-	// Extract manifest from current image
-	currentManifest, err := c.ExtractFileFromImage(ctx, currentImage.Ref, ManifestPath)
+	diff, err := c.CompareManifests(ctx, currentImage, newImage)
 	if err != nil {
-		return "", fmt.Errorf("failed to extract manifest from current image: %w", err)
+		return "", err
 	}
 
-	// Extract manifest from new image
-	newManifest, err := c.ExtractFileFromImage(ctx, newImage.Ref, ManifestPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to extract manifest from new image: %w", err)
+	if diff.Empty() {
+		c.logger.Debug(c.logTag, "No differences found in manifests")
 	}
 
-	// Prepend image metadata to both manifests
-	currentManifestWithMeta := prependImageMetadata(currentManifest, currentImage)
-	newManifestWithMeta := prependImageMetadata(newManifest, newImage)
+	return diff.Format(DiffFormatHuman)
+}
 
-	// Parse YAML documents using ytbx
-	currentDocs, err := ytbx.LoadYAMLDocuments(currentManifestWithMeta)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse current manifest: %w", err)
-	}
+// CompareManifests extracts the BOSH manifests from two images and compares them.
+func (c *client) CompareManifests(ctx context.Context, currentImage, newImage ImageInfo) (*ManifestDiff, error) {
+	c.logger.Info(c.logTag, "Comparing manifests between %s and %s", currentImage.Ref, newImage.Ref)
 
-	newDocs, err := ytbx.LoadYAMLDocuments(newManifestWithMeta)
+	// Extract manifest from current image
+	currentManifest, err := c.ExtractFileFromImage(ctx, currentImage.Ref, ManifestPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse new manifest: %w", err)
-	}
-
-	// Create InputFile structures for dyff
-	currentInput := ytbx.InputFile{
-		Location:  "current",
-		Documents: currentDocs,
-	}
-
-	newInput := ytbx.InputFile{
-		Location:  "new",
-		Documents: newDocs,
+		return nil, fmt.Errorf("failed to extract manifest from current image: %w", err)
 	}
 
-	// Create dyff report
-	report, err := dyff.CompareInputFiles(
-		currentInput,
-		newInput,
-	)
+	// Extract manifest from new image
+	newManifest, err := c.ExtractFileFromImage(ctx, newImage.Ref, ManifestPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to compare manifests: %w", err)
+		return nil, fmt.Errorf("failed to extract manifest from new image: %w", err)
 	}
 
-	// Check if there are any differences
-	if len(report.Diffs) == 0 {
-		c.logger.Debug(c.logTag, "No differences found in manifests")
-		return "", nil
-	}
-
-	// Format and display the diff using dyff's human-readable output
-	var output strings.Builder
-	humanReport := dyff.HumanReport{
-		Report:            report,
-		OmitHeader:        true,
-		NoTableStyle:      false,
-		DoNotInspectCerts: true,
-		UseGoPatchPaths:   false,
-	}
-
-	if err := humanReport.WriteReport(&output); err != nil {
-		return "", fmt.Errorf("failed to generate diff report: %w", err)
-	}
-
-	return strings.TrimSpace(output.String()), nil
+	return NewManifestDiff(currentImage, currentManifest, newImage, newManifest)
 }
 
 // GetImageDigest retrieves the digest of an image from the remote registry.
+// For multi-arch images this is the digest of the manifest for the client platform.
 func (c *client) GetImageDigest(ctx context.Context, imageRef string) (string, error) {
 	c.logger.Debug(c.logTag, "Getting digest for image %s", imageRef)
 
-	// Create regclient with Docker credentials
-	rc := regclient.New(
-		regclient.WithDockerCreds(),
-		regclient.WithDockerCerts(),
-	)
-
 	// Parse the image reference
 	r, err := ref.New(imageRef)
 	if err != nil {
 		return "", fmt.Errorf("parsing image reference: %w", err)
 	}
 
-	// Get the manifest to retrieve the digest
-	manifest, err := rc.ManifestGet(ctx, r)
+	rc, err := c.newRegClient(r)
 	if err != nil {
-		return "", fmt.Errorf("getting manifest: %w", err)
+		return "", err
 	}
 
-	digest := manifest.GetDescriptor().Digest.String()
-	c.logger.Debug(c.logTag, "Image %s has digest %s", imageRef, digest)
+	digest, err := c.lookupPlatformDigest(ctx, rc, r)
+	if err != nil {
+		return "", err
+	}
 
+	c.logger.Debug(c.logTag, "Image %s has digest %s", imageRef, digest)
 	return digest, nil
 }
 
 // ResolveImageRef resolves a tag-based image reference to a digest-pinned reference.
+// For multi-arch images the reference is pinned to the manifest for the client platform.
 // If the input already contains a digest (@sha256:...), it returns the reference unchanged.
 func (c *client) ResolveImageRef(ctx context.Context, imageRef string) (pinnedRef, digest string, err error) {
 	c.logger.Debug(c.logTag, "Resolving image reference %s", imageRef)
@@ -268,19 +349,15 @@ func (c *client) ResolveImageRef(ctx context.Context, imageRef string) (pinnedRe
 		return imageRef, r.Digest, nil
 	}
 
-	// Create regclient with Docker credentials
-	rc := regclient.New(
-		regclient.WithDockerCreds(),
-		regclient.WithDockerCerts(),
-	)
-
-	// Get the manifest to retrieve the digest
-	manifest, err := rc.ManifestGet(ctx, r)
+	rc, err := c.newRegClient(r)
 	if err != nil {
-		return "", "", fmt.Errorf("getting manifest: %w", err)
+		return "", "", err
 	}
 
-	digest = manifest.GetDescriptor().Digest.String()
+	digest, err = c.lookupPlatformDigest(ctx, rc, r)
+	if err != nil {
+		return "", "", err
+	}
 
 	// Build the digest-pinned reference: registry/repo@sha256:...
 	pinnedRef = fmt.Sprintf("%s/%s@%s", r.Registry, r.Repository, digest)
@@ -290,6 +367,9 @@ func (c *client) ResolveImageRef(ctx context.Context, imageRef string) (pinnedRe
 }
 
 // FindTagsForDigest finds all tags in a repository that point to a specific digest.
+// Platform manifest digests (as returned by ResolveImageRef) match the tags of their manifest list.
+// Tags are resolved concurrently and their digests are cached, so repeated
+// lookups only query the registry for new or expired tags.
 // Returns tags sorted with version tags first (e.g., ["1.165", "latest"]).
 func (c *client) FindTagsForDigest(ctx context.Context, imageRef string, targetDigest string) ([]string, error) {
 	c.logger.Debug(c.logTag, "Finding tags for digest %s in %s", targetDigest, imageRef)
@@ -300,25 +380,26 @@ func (c *client) FindTagsForDigest(ctx context.Context, imageRef string, targetD
 		return nil, fmt.Errorf("parsing image reference: %w", err)
 	}
 
-	// Create regclient with Docker credentials
-	rc := regclient.New(
-		regclient.WithDockerCreds(),
-		regclient.WithDockerCerts(),
-	)
-
-	// List all tags for the repository
-	tagList, err := rc.TagList(ctx, r)
+	rc, err := c.newRegClient(r)
 	if err != nil {
-		return nil, fmt.Errorf("listing tags: %w", err)
+		return nil, err
 	}
 
-	tags, err := tagList.GetTags()
+	tags, err := c.listTags(ctx, rc, r)
 	if err != nil {
-		return nil, fmt.Errorf("getting tags: %w", err)
+		return nil, err
 	}
 
+	manifestDigest := c.manifestDigestFor(r, targetDigest)
+
 	// Find tags that match the target digest
-	var matchingTags []string
+	var (
+		matchingTags []string
+		mu           sync.Mutex
+		wg           sync.WaitGroup
+		sem          = make(chan struct{}, maxConcurrentTagLookups)
+	)
+tagLoop:
 	for _, tag := range tags {
 		// Create a reference for this tag
 		tagRef, err := ref.New(fmt.Sprintf("%s/%s:%s", r.Registry, r.Repository, tag))
@@ -327,17 +408,36 @@ func (c *client) FindTagsForDigest(ctx context.Context, imageRef string, targetD
 			continue
 		}
 
-		// Get the manifest for this tag
-		manifest, err := rc.ManifestGet(ctx, tagRef)
-		if err != nil {
-			c.logger.Debug(c.logTag, "Failed to get manifest for tag %s: %v", tag, err)
-			continue
+		// Wait for a free slot before starting a lookup, so at most
+		// maxConcurrentTagLookups goroutines exist at a time
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break tagLoop
 		}
 
-		// Check if digest matches
-		if manifest.GetDescriptor().Digest.String() == targetDigest {
-			matchingTags = append(matchingTags, tag)
-		}
+		wg.Add(1)
+		go func(tag string, tagRef ref.Ref) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			digest, err := c.lookupDigest(ctx, rc, tagRef)
+			if err != nil {
+				c.logger.Debug(c.logTag, "Failed to get digest for tag %s: %v", tag, err)
+				return
+			}
+
+			// Check if digest matches
+			if digest == targetDigest || digest == manifestDigest {
+				mu.Lock()
+				matchingTags = append(matchingTags, tag)
+				mu.Unlock()
+			}
+		}(tag, tagRef)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	// Sort tags: version tags first, then alphabetically
@@ -359,6 +459,122 @@ func (c *client) FindTagsForDigest(ctx context.Context, imageRef string, targetD
 	return matchingTags, nil
 }
 
+// listTags returns all tags of the repository of r, using the cache when possible.
+func (c *client) listTags(ctx context.Context, rc *regclient.RegClient, r ref.Ref) ([]string, error) {
+	cacheKey := r.Registry + "/" + r.Repository
+
+	var tags []string
+	if c.cache.get(cacheKindTags, cacheKey, c.cacheTTL(), &tags) {
+		return tags, nil
+	}
+
+	tagList, err := rc.TagList(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("listing tags: %w", err)
+	}
+
+	tags, err = tagList.GetTags()
+	if err != nil {
+		return nil, fmt.Errorf("getting tags: %w", err)
+	}
+
+	c.cache.put(cacheKindTags, cacheKey, tags)
+	return tags, nil
+}
+
+// lookupDigest returns the digest a reference points to, using the cache when possible.
+// References that already contain a digest are returned without a registry request.
+func (c *client) lookupDigest(ctx context.Context, rc *regclient.RegClient, r ref.Ref) (string, error) {
+	if r.Digest != "" {
+		return r.Digest, nil
+	}
+
+	cacheKey := r.CommonName()
+
+	var digest string
+	if c.cache.get(cacheKindDigests, cacheKey, c.cacheTTL(), &digest) {
+		return digest, nil
+	}
+
+	// A HEAD request is sufficient to get the digest, fall back to a full GET
+	// for registries that don't return the digest header
+	manifest, err := rc.ManifestHead(ctx, r, regclient.WithManifestRequireDigest())
+	if err != nil {
+		manifest, err = rc.ManifestGet(ctx, r)
+		if err != nil {
+			return "", fmt.Errorf("getting manifest: %w", err)
+		}
+	}
+
+	digest = manifest.GetDescriptor().Digest.String()
+	c.cache.put(cacheKindDigests, cacheKey, digest)
+	return digest, nil
+}
+
+// platformDigests is the cached result of PlatformDigest.
+type platformDigests struct {
+	Digest         string `json:"digest"`
+	ManifestDigest string `json:"manifest_digest"`
+}
+
+// lookupPlatformDigest returns the digest of the manifest for the client platform,
+// using the cache when possible. Results for digest references never expire.
+func (c *client) lookupPlatformDigest(ctx context.Context, rc *regclient.RegClient, r ref.Ref) (string, error) {
+	cacheKey := r.CommonName() + "|" + c.platform
+	ttl := c.cacheTTL()
+	if r.Digest != "" {
+		ttl = noExpiry
+	}
+
+	var digests platformDigests
+	if !c.cache.get(cacheKindPlatforms, cacheKey, ttl, &digests) {
+		digest, manifestDigest, err := PlatformDigest(ctx, rc, r, c.platform)
+		if err != nil {
+			return "", err
+		}
+		digests = platformDigests{Digest: digest, ManifestDigest: manifestDigest}
+		c.cache.put(cacheKindPlatforms, cacheKey, digests)
+		if digest != manifestDigest {
+			c.cache.put(cacheKindParents, parentDigestKey(r, digest), manifestDigest)
+		}
+	}
+
+	if digests.Digest != digests.ManifestDigest {
+		c.manifestDigests.Store(parentDigestKey(r, digests.Digest), digests.ManifestDigest)
+	}
+
+	c.logger.Debug(c.logTag, "Image %s has digest %s for platform %s", r.CommonName(), digests.Digest, c.platform)
+	return digests.Digest, nil
+}
+
+// manifestDigestFor returns the manifest list digest of a platform manifest digest,
+// or an empty string if digest is not known to be part of a manifest list.
+func (c *client) manifestDigestFor(r ref.Ref, digest string) string {
+	parentKey := parentDigestKey(r, digest)
+	if parent, ok := c.manifestDigests.Load(parentKey); ok {
+		return parent.(string)
+	}
+
+	var parent string
+	if c.cache.get(cacheKindParents, parentKey, noExpiry, &parent) {
+		return parent
+	}
+	return ""
+}
+
+// parentDigestKey identifies a platform manifest digest within the repository of r.
+func parentDigestKey(r ref.Ref, digest string) string {
+	return r.Registry + "/" + r.Repository + "@" + digest
+}
+
+// cacheTTL returns the TTL for mutable registry data.
+func (c *client) cacheTTL() time.Duration {
+	if c.cache == nil {
+		return DefaultCacheTTL
+	}
+	return c.cache.ttl
+}
+
 // isVersionTag checks if a tag looks like a version number.
 // Matches: 1.165, 1.165.0, v1.165, 1.165-alpha, 1.0.0-rc1
 func isVersionTag(tag string) bool {
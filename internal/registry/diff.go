@@ -0,0 +1,455 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gonvenience/ytbx"
+	"github.com/homeport/dyff/pkg/dyff"
+	"gopkg.in/yaml.v3"
+)
+
+// DiffFormat selects how a manifest diff is rendered.
+type DiffFormat string
+
+const (
+	// DiffFormatHuman renders dyff's human-readable report (the default).
+	DiffFormatHuman DiffFormat = "human"
+
+	// DiffFormatGoPatch renders the changes as a go-patch ops file that turns
+	// the current manifest into the new manifest.
+	DiffFormatGoPatch DiffFormat = "go-patch"
+
+	// DiffFormatJSON renders a machine-readable JSON document with the image
+	// metadata, release version changes and every individual difference.
+	DiffFormatJSON DiffFormat = "json"
+
+	// DiffFormatReleases renders a compact summary of BOSH release version changes.
+	DiffFormatReleases DiffFormat = "releases"
+)
+
+// imageMetadataKey is the top-level key used for the image metadata that is
+// prepended to each manifest (see prependImageMetadata).
+const imageMetadataKey = "image"
+
+// DiffFormats lists all supported diff formats.
+var DiffFormats = []DiffFormat{DiffFormatHuman, DiffFormatGoPatch, DiffFormatJSON, DiffFormatReleases}
+
+// ParseDiffFormat parses a diff format name. An empty name selects DiffFormatHuman.
+func ParseDiffFormat(name string) (DiffFormat, error) {
+	if name == "" {
+		return DiffFormatHuman, nil
+	}
+	for _, f := range DiffFormats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+
+	names := make([]string, len(DiffFormats))
+	for i, f := range DiffFormats {
+		names[i] = string(f)
+	}
+	return "", fmt.Errorf("unknown diff format %q (supported: %s)", name, strings.Join(names, ", "))
+}
+
+// ReleaseChange describes a BOSH release whose version differs between two manifests.
+// From is empty for added releases, To is empty for removed releases.
+type ReleaseChange struct {
+	Name string `json:"name"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// ManifestDiff holds the comparison of the BOSH manifests of two images.
+type ManifestDiff struct {
+	CurrentImage   ImageInfo
+	NewImage       ImageInfo
+	Report         dyff.Report
+	ReleaseChanges []ReleaseChange
+}
+
+// NewManifestDiff compares two BOSH manifests. Image metadata (ref, digest) is
+// prepended to each manifest so the human report also shows image changes.
+func NewManifestDiff(currentImage ImageInfo, currentManifest []byte, newImage ImageInfo, newManifest []byte) (*ManifestDiff, error) {
+	// Parse YAML documents using ytbx
+	currentDocs, err := ytbx.LoadYAMLDocuments(prependImageMetadata(currentManifest, currentImage))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse current manifest: %w", err)
+	}
+
+	newDocs, err := ytbx.LoadYAMLDocuments(prependImageMetadata(newManifest, newImage))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse new manifest: %w", err)
+	}
+
+	report, err := dyff.CompareInputFiles(
+		ytbx.InputFile{Location: "current", Documents: currentDocs},
+		ytbx.InputFile{Location: "new", Documents: newDocs},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare manifests: %w", err)
+	}
+
+	releaseChanges, err := compareReleases(currentManifest, newManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ManifestDiff{
+		CurrentImage:   currentImage,
+		NewImage:       newImage,
+		Report:         report,
+		ReleaseChanges: releaseChanges,
+	}, nil
+}
+
+// Empty returns true if the manifests (including image metadata) are identical.
+func (d *ManifestDiff) Empty() bool {
+	return len(d.Report.Diffs) == 0
+}
+
+// Format renders the diff in the requested format.
+// The human, go-patch and releases formats return an empty string if there is
+// nothing to report. The JSON format always returns a document.
+func (d *ManifestDiff) Format(format DiffFormat) (string, error) {
+	switch format {
+	case DiffFormatHuman, "":
+		return d.formatHuman()
+	case DiffFormatGoPatch:
+		return d.formatGoPatch()
+	case DiffFormatJSON:
+		return d.formatJSON()
+	case DiffFormatReleases:
+		return d.formatReleases(), nil
+	default:
+		return "", fmt.Errorf("unknown diff format %q", format)
+	}
+}
+
+func (d *ManifestDiff) formatHuman() (string, error) {
+	if d.Empty() {
+		return "", nil
+	}
+
+	var output strings.Builder
+	humanReport := dyff.HumanReport{
+		Report:            d.Report,
+		OmitHeader:        true,
+		NoTableStyle:      false,
+		DoNotInspectCerts: true,
+		UseGoPatchPaths:   false,
+	}
+
+	if err := humanReport.WriteReport(&output); err != nil {
+		return "", fmt.Errorf("failed to generate diff report: %w", err)
+	}
+
+	return strings.TrimSpace(output.String()), nil
+}
+
+// goPatchOp is a single go-patch operation.
+type goPatchOp struct {
+	Type  string     `yaml:"type"`
+	Path  string     `yaml:"path"`
+	Value *yaml.Node `yaml:"value,omitempty"`
+}
+
+func (d *ManifestDiff) formatGoPatch() (string, error) {
+	var ops []goPatchOp
+	for _, diff := range d.manifestDiffs() {
+		diffOps, err := d.goPatchOpsForDiff(diff)
+		if err != nil {
+			return "", err
+		}
+		ops = append(ops, diffOps...)
+	}
+
+	if len(ops) == 0 {
+		return "", nil
+	}
+
+	out, err := yaml.Marshal(ops)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal go-patch ops: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// goPatchOpsForDiff translates a single dyff difference into go-patch operations.
+func (d *ManifestDiff) goPatchOpsForDiff(diff dyff.Diff) ([]goPatchOp, error) {
+	path := diff.Path.ToGoPatchStyle()
+
+	var ops []goPatchOp
+	for _, detail := range diff.Details {
+		switch detail.Kind {
+		case dyff.ADDITION:
+			switch detail.To.Kind {
+			case yaml.MappingNode:
+				for i := 0; i+1 < len(detail.To.Content); i += 2 {
+					ops = append(ops, goPatchOp{
+						Type:  "replace",
+						Path:  optionalGoPatchPath(joinGoPatchPath(path, escapeGoPatchKey(detail.To.Content[i].Value))),
+						Value: detail.To.Content[i+1],
+					})
+				}
+			case yaml.SequenceNode:
+				for _, entry := range detail.To.Content {
+					ops = append(ops, goPatchOp{Type: "replace", Path: joinGoPatchPath(path, "-"), Value: entry})
+				}
+			default:
+				ops = append(ops, goPatchOp{Type: "replace", Path: optionalGoPatchPath(path), Value: detail.To})
+			}
+
+		case dyff.REMOVAL:
+			switch detail.From.Kind {
+			case yaml.MappingNode:
+				for i := 0; i+1 < len(detail.From.Content); i += 2 {
+					ops = append(ops, goPatchOp{
+						Type: "remove",
+						Path: joinGoPatchPath(path, escapeGoPatchKey(detail.From.Content[i].Value)),
+					})
+				}
+			case yaml.SequenceNode:
+				// Entries of named lists can be addressed by name, anything else
+				// requires replacing the list with its new content.
+				var removeOps []goPatchOp
+				for _, entry := range detail.From.Content {
+					name := namedEntryName(entry)
+					if name == "" {
+						removeOps = nil
+						break
+					}
+					removeOps = append(removeOps, goPatchOp{Type: "remove", Path: joinGoPatchPath(path, "name="+name)})
+				}
+				if removeOps == nil {
+					op, err := d.replaceWithNewValue(diff, path)
+					if err != nil {
+						return nil, err
+					}
+					removeOps = []goPatchOp{op}
+				}
+				ops = append(ops, removeOps...)
+			default:
+				ops = append(ops, goPatchOp{Type: "remove", Path: path})
+			}
+
+		case dyff.MODIFICATION:
+			ops = append(ops, goPatchOp{Type: "replace", Path: path, Value: detail.To})
+
+		case dyff.ORDERCHANGE:
+			op, err := d.replaceWithNewValue(diff, path)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, op)
+		}
+	}
+
+	return ops, nil
+}
+
+// replaceWithNewValue returns a replace operation that sets path to its value in the new manifest.
+func (d *ManifestDiff) replaceWithNewValue(diff dyff.Diff, path string) (goPatchOp, error) {
+	if diff.Path.DocumentIdx >= len(d.Report.To.Documents) {
+		return goPatchOp{}, fmt.Errorf("document %d not found in new manifest", diff.Path.DocumentIdx)
+	}
+	value, err := ytbx.Grab(d.Report.To.Documents[diff.Path.DocumentIdx], path)
+	if err != nil {
+		return goPatchOp{}, fmt.Errorf("failed to look up %s in new manifest: %w", path, err)
+	}
+	return goPatchOp{Type: "replace", Path: path, Value: value}, nil
+}
+
+// jsonDiff is the JSON representation of a ManifestDiff.
+type jsonDiff struct {
+	Current  jsonImageInfo   `json:"current"`
+	New      jsonImageInfo   `json:"new"`
+	Releases []ReleaseChange `json:"releases"`
+	Diffs    []jsonDiffEntry `json:"diffs"`
+}
+
+// jsonImageInfo is the JSON representation of ImageInfo.
+type jsonImageInfo struct {
+	Ref    string `json:"ref"`
+	Digest string `json:"digest,omitempty"`
+}
+
+type jsonDiffEntry struct {
+	Path string      `json:"path"`
+	Kind string      `json:"kind"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+func (d *ManifestDiff) formatJSON() (string, error) {
+	doc := jsonDiff{
+		Current:  jsonImageInfo{Ref: d.CurrentImage.Ref, Digest: d.CurrentImage.Digest},
+		New:      jsonImageInfo{Ref: d.NewImage.Ref, Digest: d.NewImage.Digest},
+		Releases: d.ReleaseChanges,
+		Diffs:    []jsonDiffEntry{},
+	}
+	if doc.Releases == nil {
+		doc.Releases = []ReleaseChange{}
+	}
+
+	for _, diff := range d.manifestDiffs() {
+		for _, detail := range diff.Details {
+			entry := jsonDiffEntry{
+				Path: diff.Path.ToGoPatchStyle(),
+				Kind: detailKindName(detail.Kind),
+			}
+			var err error
+			if entry.From, err = decodeNode(detail.From); err != nil {
+				return "", err
+			}
+			if entry.To, err = decodeNode(detail.To); err != nil {
+				return "", err
+			}
+			doc.Diffs = append(doc.Diffs, entry)
+		}
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal diff as JSON: %w", err)
+	}
+	return string(out), nil
+}
+
+func (d *ManifestDiff) formatReleases() string {
+	var lines []string
+	for _, change := range d.ReleaseChanges {
+		switch {
+		case change.From == "":
+			lines = append(lines, fmt.Sprintf("%s: added %s", change.Name, change.To))
+		case change.To == "":
+			lines = append(lines, fmt.Sprintf("%s: removed %s", change.Name, change.From))
+		default:
+			lines = append(lines, fmt.Sprintf("%s: %s -> %s", change.Name, change.From, change.To))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// manifestDiffs returns the differences of the BOSH manifest itself,
+// leaving out the prepended image metadata.
+func (d *ManifestDiff) manifestDiffs() []dyff.Diff {
+	var diffs []dyff.Diff
+	for _, diff := range d.Report.Diffs {
+		if diff.Path != nil && len(diff.Path.PathElements) > 0 && diff.Path.PathElements[0].Name == imageMetadataKey {
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// compareReleases returns the release version changes between two manifests, sorted by name.
+func compareReleases(currentManifest, newManifest []byte) ([]ReleaseChange, error) {
+	currentReleases, err := manifestReleaseVersions(currentManifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse releases from current manifest: %w", err)
+	}
+	newReleases, err := manifestReleaseVersions(newManifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse releases from new manifest: %w", err)
+	}
+
+	var changes []ReleaseChange
+	for name, from := range currentReleases {
+		if to := newReleases[name]; to != from {
+			changes = append(changes, ReleaseChange{Name: name, From: from, To: to})
+		}
+	}
+	for name, to := range newReleases {
+		if _, ok := currentReleases[name]; !ok {
+			changes = append(changes, ReleaseChange{Name: name, To: to})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes, nil
+}
+
+// manifestReleaseVersions returns a map of release name to version.
+func manifestReleaseVersions(manifest []byte) (map[string]string, error) {
+	var parsed struct {
+		Releases []struct {
+			Name    string    `yaml:"name"`
+			Version yaml.Node `yaml:"version"`
+		} `yaml:"releases"`
+	}
+	if err := yaml.Unmarshal(manifest, &parsed); err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]string, len(parsed.Releases))
+	for _, r := range parsed.Releases {
+		versions[r.Name] = r.Version.Value
+	}
+	return versions, nil
+}
+
+// namedEntryName returns the value of the "name" key of a mapping node, or "" if there is none.
+func namedEntryName(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "name" {
+			return node.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// joinGoPatchPath appends a segment to a go-patch path.
+func joinGoPatchPath(path, segment string) string {
+	return strings.TrimSuffix(path, "/") + "/" + segment
+}
+
+// optionalGoPatchPath marks the last segment of path as optional, so a replace adds the
+// map key instead of failing because the key does not exist yet.
+func optionalGoPatchPath(path string) string {
+	if strings.HasSuffix(path, "?") || strings.HasSuffix(path, "/-") {
+		return path
+	}
+	return path + "?"
+}
+
+// escapeGoPatchKey escapes a map key for use as a go-patch path segment.
+func escapeGoPatchKey(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+func detailKindName(kind rune) string {
+	switch kind {
+	case dyff.ADDITION:
+		return "addition"
+	case dyff.REMOVAL:
+		return "removal"
+	case dyff.MODIFICATION:
+		return "modification"
+	case dyff.ORDERCHANGE:
+		return "order-change"
+	default:
+		return string(kind)
+	}
+}
+
+// decodeNode converts a YAML node into a value that can be marshaled as JSON.
+func decodeNode(node *yaml.Node) (interface{}, error) {
+	if node == nil {
+		return nil, nil
+	}
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to decode YAML node: %w", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,208 @@
+package registry_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cppforlife/go-patch/patch"
+	"gopkg.in/yaml.v2"
+
+	"github.com/rkoster/instant-bosh/internal/registry"
+)
+
+var currentManifest = []byte(`
+name: bosh
+releases:
+- name: bosh
+  version: "282.0.0"
+- name: os-conf
+  version: "22.2.1"
+instance_groups:
+- name: bosh
+  properties:
+    director:
+      workers: 4
+`)
+
+var newManifest = []byte(`
+name: bosh
+releases:
+- name: bosh
+  version: "282.1.0"
+- name: uaa
+  version: "77.0.0"
+instance_groups:
+- name: bosh
+  properties:
+    director:
+      workers: 6
+`)
+
+var (
+	currentImage = registry.ImageInfo{Ref: "ghcr.io/rkoster/instant-bosh:1.0", Digest: "sha256:aaa"}
+	newImage     = registry.ImageInfo{Ref: "ghcr.io/rkoster/instant-bosh:1.1", Digest: "sha256:bbb"}
+)
+
+func newTestDiff(t *testing.T) *registry.ManifestDiff {
+	t.Helper()
+	diff, err := registry.NewManifestDiff(currentImage, currentManifest, newImage, newManifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return diff
+}
+
+func TestParseDiffFormat(t *testing.T) {
+	for name, expected := range map[string]registry.DiffFormat{
+		"":         registry.DiffFormatHuman,
+		"human":    registry.DiffFormatHuman,
+		"go-patch": registry.DiffFormatGoPatch,
+		"json":     registry.DiffFormatJSON,
+		"releases": registry.DiffFormatReleases,
+	} {
+		format, err := registry.ParseDiffFormat(name)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", name, err)
+		}
+		if format != expected {
+			t.Errorf("expected %q for %q, got %q", expected, name, format)
+		}
+	}
+
+	if _, err := registry.ParseDiffFormat("xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestManifestDiff_Releases(t *testing.T) {
+	diff := newTestDiff(t)
+
+	output, err := diff.Format(registry.DiffFormatReleases)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "bosh: 282.0.0 -> 282.1.0\nos-conf: removed 22.2.1\nuaa: added 77.0.0"
+	if output != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+func TestManifestDiff_GoPatch(t *testing.T) {
+	for name, manifests := range map[string][2][]byte{
+		"releases and properties": {currentManifest, newManifest},
+		"added keys": {currentManifest, []byte(`
+name: bosh
+releases:
+- name: bosh
+  version: "282.0.0"
+- name: os-conf
+  version: "22.2.1"
+instance_groups:
+- name: bosh
+  properties:
+    director:
+      workers: 4
+      enable_snapshots: true
+    blobstore:
+      provider: dav
+features:
+  use_dns_addresses: true
+`)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			diff, err := registry.NewManifestDiff(currentImage, manifests[0], newImage, manifests[1])
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			output, err := diff.Format(registry.DiffFormatGoPatch)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Contains(output, "/image") {
+				t.Errorf("expected image metadata to be excluded, got:\n%s", output)
+			}
+
+			var defs []patch.OpDefinition
+			if err := yaml.Unmarshal([]byte(output), &defs); err != nil {
+				t.Fatalf("invalid go-patch ops: %v\n%s", err, output)
+			}
+			ops, err := patch.NewOpsFromDefinitions(defs)
+			if err != nil {
+				t.Fatalf("invalid go-patch ops: %v\n%s", err, output)
+			}
+
+			var current, expected interface{}
+			if err := yaml.Unmarshal(manifests[0], &current); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := yaml.Unmarshal(manifests[1], &expected); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			patched, err := ops.Apply(current)
+			if err != nil {
+				t.Fatalf("failed to apply go-patch ops to the current manifest: %v\n%s", err, output)
+			}
+			if !reflect.DeepEqual(patched, expected) {
+				t.Errorf("expected the patched manifest to equal the new manifest, got:\n%v\nops:\n%s", patched, output)
+			}
+		})
+	}
+}
+
+func TestManifestDiff_JSON(t *testing.T) {
+	diff := newTestDiff(t)
+
+	output, err := diff.Format(registry.DiffFormatJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc struct {
+		Current  registry.ImageInfo       `json:"current"`
+		New      registry.ImageInfo       `json:"new"`
+		Releases []registry.ReleaseChange `json:"releases"`
+		Diffs    []struct {
+			Path string `json:"path"`
+			Kind string `json:"kind"`
+		} `json:"diffs"`
+	}
+	if err := json.Unmarshal([]byte(output), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, output)
+	}
+
+	if doc.New.Digest != "sha256:bbb" {
+		t.Errorf("expected new digest 'sha256:bbb', got %q", doc.New.Digest)
+	}
+	if len(doc.Releases) != 3 {
+		t.Errorf("expected 3 release changes, got %d", len(doc.Releases))
+	}
+	if len(doc.Diffs) == 0 {
+		t.Error("expected diffs to be reported")
+	}
+}
+
+func TestManifestDiff_Identical(t *testing.T) {
+	diff, err := registry.NewManifestDiff(currentImage, currentManifest, currentImage, currentManifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !diff.Empty() {
+		t.Error("expected identical manifests to produce an empty diff")
+	}
+
+	for _, format := range []registry.DiffFormat{registry.DiffFormatHuman, registry.DiffFormatGoPatch, registry.DiffFormatReleases} {
+		output, err := diff.Format(format)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", format, err)
+		}
+		if output != "" {
+			t.Errorf("expected empty %s output, got:\n%s", format, output)
+		}
+	}
+}
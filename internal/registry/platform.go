@@ -0,0 +1,143 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types/errs"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// EnvPlatform overrides the platform used to select images from multi-arch manifest lists.
+const EnvPlatform = "IBOSH_PLATFORM"
+
+// DefaultPlatform returns the platform of the local machine. instant-bosh images
+// and stemcells only exist for Linux, so the OS is always linux (also on macOS,
+// where Docker runs a Linux VM with the same architecture).
+func DefaultPlatform() string {
+	return "linux/" + runtime.GOARCH
+}
+
+// ParsePlatform validates and normalizes a platform string (e.g. "linux/arm64" or "arm64").
+// An empty string selects DefaultPlatform().
+func ParsePlatform(name string) (string, error) {
+	if name == "" {
+		return DefaultPlatform(), nil
+	}
+	if !strings.Contains(name, "/") {
+		name = "linux/" + name
+	}
+	plat, err := platform.Parse(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid platform %q: %w", name, err)
+	}
+	return plat.String(), nil
+}
+
+// PlatformFromArchitecture converts an architecture name as reported by the Docker
+// daemon or the Linux kernel (e.g. "x86_64", "aarch64") into a linux platform string.
+// An empty architecture returns an empty string.
+func PlatformFromArchitecture(arch string) string {
+	switch arch {
+	case "":
+		return ""
+	case "x86_64", "x86-64":
+		arch = "amd64"
+	case "aarch64", "armv8", "armv8l":
+		arch = "arm64"
+	case "armv7l", "armv7":
+		return "linux/arm/v7"
+	case "i386", "i686":
+		arch = "386"
+	}
+	if platform, err := ParsePlatform("linux/" + arch); err == nil {
+		return platform
+	}
+	return "linux/" + arch
+}
+
+// NoMatchingPlatformError is returned when an image has no manifest for the requested platform.
+type NoMatchingPlatformError struct {
+	ImageRef  string
+	Platform  string
+	Available []string
+}
+
+func (e *NoMatchingPlatformError) Error() string {
+	if len(e.Available) == 0 {
+		return fmt.Sprintf("image %s is not available for platform %s", e.ImageRef, e.Platform)
+	}
+	return fmt.Sprintf("image %s is not available for platform %s (available: %s)",
+		e.ImageRef, e.Platform, strings.Join(e.Available, ", "))
+}
+
+// PlatformDigest resolves an image reference to the digest of the image manifest
+// for the given platform. For manifest lists (multi-arch images) the matching entry
+// is selected. For single-platform images the platform from the image config is verified.
+// It also returns the digest of the referenced manifest itself (the manifest list
+// digest for multi-arch images), which is what tags point to.
+func PlatformDigest(ctx context.Context, rc *regclient.RegClient, r ref.Ref, platformName string) (platformDigest, manifestDigest string, err error) {
+	plat, err := platform.Parse(platformName)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid platform %q: %w", platformName, err)
+	}
+
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return "", "", fmt.Errorf("getting manifest: %w", err)
+	}
+	manifestDigest = m.GetDescriptor().Digest.String()
+
+	if m.IsList() {
+		desc, err := manifest.GetPlatformDesc(m, &plat)
+		if err != nil {
+			if !errors.Is(err, errs.ErrNotFound) {
+				return "", "", fmt.Errorf("selecting platform %s: %w", plat.String(), err)
+			}
+			return "", "", &NoMatchingPlatformError{
+				ImageRef:  r.CommonName(),
+				Platform:  plat.String(),
+				Available: availablePlatforms(m),
+			}
+		}
+		return desc.Digest.String(), manifestDigest, nil
+	}
+
+	// Single-platform image, verify the platform from the image config
+	config, err := rc.ImageConfig(ctx, r)
+	if err != nil {
+		return "", "", fmt.Errorf("getting image config: %w", err)
+	}
+	imagePlatform := config.GetConfig().Platform
+	if imagePlatform.OS != "" && !platform.Compatible(plat, imagePlatform) {
+		return "", "", &NoMatchingPlatformError{
+			ImageRef:  r.CommonName(),
+			Platform:  plat.String(),
+			Available: []string{imagePlatform.String()},
+		}
+	}
+
+	return manifestDigest, manifestDigest, nil
+}
+
+// availablePlatforms lists the platforms of a manifest list, skipping attestations.
+func availablePlatforms(m manifest.Manifest) []string {
+	platforms, err := manifest.GetPlatformList(m)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, p := range platforms {
+		if p == nil || p.OS == "unknown" {
+			continue
+		}
+		names = append(names, p.String())
+	}
+	return names
+}
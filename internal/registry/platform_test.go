@@ -0,0 +1,67 @@
+package registry_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rkoster/instant-bosh/internal/registry"
+)
+
+func TestParsePlatform(t *testing.T) {
+	for name, expected := range map[string]string{
+		"":               registry.DefaultPlatform(),
+		"linux/amd64":    "linux/amd64",
+		"linux/arm64":    "linux/arm64",
+		"linux/arm64/v8": "linux/arm64",
+		"arm64":          "linux/arm64",
+		"linux/x86_64":   "linux/amd64",
+	} {
+		platform, err := registry.ParsePlatform(name)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", name, err)
+		}
+		if platform != expected {
+			t.Errorf("expected %q for %q, got %q", expected, name, platform)
+		}
+	}
+
+	if _, err := registry.ParsePlatform("linux/not a platform"); err == nil {
+		t.Error("expected error for invalid platform")
+	}
+}
+
+func TestPlatformFromArchitecture(t *testing.T) {
+	for arch, expected := range map[string]string{
+		"x86_64":  "linux/amd64",
+		"amd64":   "linux/amd64",
+		"aarch64": "linux/arm64",
+		"arm64":   "linux/arm64",
+		"armv7l":  "linux/arm/v7",
+		"":        "",
+	} {
+		if platform := registry.PlatformFromArchitecture(arch); platform != expected {
+			t.Errorf("expected %q for %q, got %q", expected, arch, platform)
+		}
+	}
+}
+
+func TestNoMatchingPlatformError(t *testing.T) {
+	var err error = &registry.NoMatchingPlatformError{
+		ImageRef:  "ghcr.io/rkoster/instant-bosh:latest",
+		Platform:  "linux/arm64",
+		Available: []string{"linux/amd64"},
+	}
+
+	var platformErr *registry.NoMatchingPlatformError
+	if !errors.As(err, &platformErr) {
+		t.Fatal("expected error to be a NoMatchingPlatformError")
+	}
+
+	message := err.Error()
+	for _, expected := range []string{"ghcr.io/rkoster/instant-bosh:latest", "linux/arm64", "available: linux/amd64"} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("expected error message to contain %q, got %q", expected, message)
+		}
+	}
+}
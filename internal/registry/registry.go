@@ -28,6 +28,9 @@ type Client interface {
 	// Returns an empty string if no differences are found.
 	GetManifestDiff(ctx context.Context, currentImage, newImage ImageInfo) (string, error)
 
+	// CompareManifests extracts the BOSH manifests of two images and returns the structured comparison.
+	CompareManifests(ctx context.Context, currentImage, newImage ImageInfo) (*ManifestDiff, error)
+
 	// GetImageDigest retrieves the digest of an image from the remote registry.
 	// Returns the digest in the format "sha256:...".
 	GetImageDigest(ctx context.Context, imageRef string) (string, error)
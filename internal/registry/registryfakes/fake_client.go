@@ -9,6 +9,21 @@ import (
 )
 
 type FakeClient struct {
+	CompareManifestsStub        func(context.Context, registry.ImageInfo, registry.ImageInfo) (*registry.ManifestDiff, error)
+	compareManifestsMutex       sync.RWMutex
+	compareManifestsArgsForCall []struct {
+		arg1 context.Context
+		arg2 registry.ImageInfo
+		arg3 registry.ImageInfo
+	}
+	compareManifestsReturns struct {
+		result1 *registry.ManifestDiff
+		result2 error
+	}
+	compareManifestsReturnsOnCall map[int]struct {
+		result1 *registry.ManifestDiff
+		result2 error
+	}
 	ExtractFileFromImageStub        func(context.Context, string, string) ([]byte, error)
 	extractFileFromImageMutex       sync.RWMutex
 	extractFileFromImageArgsForCall []struct {
@@ -88,6 +103,72 @@ type FakeClient struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeClient) CompareManifests(arg1 context.Context, arg2 registry.ImageInfo, arg3 registry.ImageInfo) (*registry.ManifestDiff, error) {
+	fake.compareManifestsMutex.Lock()
+	ret, specificReturn := fake.compareManifestsReturnsOnCall[len(fake.compareManifestsArgsForCall)]
+	fake.compareManifestsArgsForCall = append(fake.compareManifestsArgsForCall, struct {
+		arg1 context.Context
+		arg2 registry.ImageInfo
+		arg3 registry.ImageInfo
+	}{arg1, arg2, arg3})
+	stub := fake.CompareManifestsStub
+	fakeReturns := fake.compareManifestsReturns
+	fake.recordInvocation("CompareManifests", []interface{}{arg1, arg2, arg3})
+	fake.compareManifestsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) CompareManifestsCallCount() int {
+	fake.compareManifestsMutex.RLock()
+	defer fake.compareManifestsMutex.RUnlock()
+	return len(fake.compareManifestsArgsForCall)
+}
+
+func (fake *FakeClient) CompareManifestsCalls(stub func(context.Context, registry.ImageInfo, registry.ImageInfo) (*registry.ManifestDiff, error)) {
+	fake.compareManifestsMutex.Lock()
+	defer fake.compareManifestsMutex.Unlock()
+	fake.CompareManifestsStub = stub
+}
+
+func (fake *FakeClient) CompareManifestsArgsForCall(i int) (context.Context, registry.ImageInfo, registry.ImageInfo) {
+	fake.compareManifestsMutex.RLock()
+	defer fake.compareManifestsMutex.RUnlock()
+	argsForCall := fake.compareManifestsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) CompareManifestsReturns(result1 *registry.ManifestDiff, result2 error) {
+	fake.compareManifestsMutex.Lock()
+	defer fake.compareManifestsMutex.Unlock()
+	fake.CompareManifestsStub = nil
+	fake.compareManifestsReturns = struct {
+		result1 *registry.ManifestDiff
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) CompareManifestsReturnsOnCall(i int, result1 *registry.ManifestDiff, result2 error) {
+	fake.compareManifestsMutex.Lock()
+	defer fake.compareManifestsMutex.Unlock()
+	fake.CompareManifestsStub = nil
+	if fake.compareManifestsReturnsOnCall == nil {
+		fake.compareManifestsReturnsOnCall = make(map[int]struct {
+			result1 *registry.ManifestDiff
+			result2 error
+		})
+	}
+	fake.compareManifestsReturnsOnCall[i] = struct {
+		result1 *registry.ManifestDiff
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeClient) ExtractFileFromImage(arg1 context.Context, arg2 string, arg3 string) ([]byte, error) {
 	fake.extractFileFromImageMutex.Lock()
 	ret, specificReturn := fake.extractFileFromImageReturnsOnCall[len(fake.extractFileFromImageArgsForCall)]
@@ -0,0 +1,178 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// EnvStateDir overrides the base directory holding the state of all environments.
+	EnvStateDir = "IBOSH_STATE_DIR"
+
+	stateFileName      = "state.json"
+	jumpboxKeyFileName = "jumpbox.key"
+)
+
+// ErrNotFound is returned by Load when no state has been stored for an environment.
+var ErrNotFound = errors.New("no local state found")
+
+// State is the connection information of an instant-bosh environment, stored in
+// ~/.local/state/ibosh/<env> when the director is started. Commands read it instead
+// of exec-ing into the container for every invocation.
+type State struct {
+	ContainerName       string      `json:"container_name"`
+	HostAddress         string      `json:"host_address"`
+	DirectNetworkAccess bool        `json:"direct_network_access"`
+	Ports               Ports       `json:"ports"`
+	Director            Credentials `json:"director"`
+	ConfigServer        Credentials `json:"config_server"`
+	UAACACert           string      `json:"uaa_ca_cert"`
+	Image               Image       `json:"image"`
+	UpdatedAt           time.Time   `json:"updated_at"`
+
+	// JumpboxKeyPath is the path of the jumpbox private key, set by Load and Save.
+	JumpboxKeyPath string `json:"-"`
+}
+
+// Ports are the host ports the director services are exposed on.
+type Ports struct {
+	Director     string `json:"director"`
+	SSH          string `json:"ssh"`
+	ConfigServer string `json:"config_server"`
+	UAA          string `json:"uaa"`
+}
+
+// Credentials holds a UAA client and the CA certificate of the service it is used for.
+type Credentials struct {
+	Client       string `json:"client"`
+	ClientSecret string `json:"client_secret"`
+	CACert       string `json:"ca_cert"`
+}
+
+// Image is the digest-pinned image the director container was created from.
+type Image struct {
+	Ref    string `json:"ref"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// BaseDir returns the directory holding the state of all environments
+// ($XDG_STATE_HOME/ibosh, defaulting to ~/.local/state/ibosh).
+func BaseDir() (string, error) {
+	if dir := os.Getenv(EnvStateDir); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "ibosh"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("determining home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "ibosh"), nil
+}
+
+// Dir returns the state directory of an environment.
+func Dir(env string) (string, error) {
+	if env == "" {
+		return "", errors.New("environment name is required")
+	}
+	base, err := BaseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, env), nil
+}
+
+// Load reads the state of an environment. It returns an error wrapping
+// ErrNotFound if the environment has no stored state.
+func Load(env string) (*State, error) {
+	dir, err := Dir(env)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, stateFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w for environment %s", ErrNotFound, env)
+		}
+		return nil, fmt.Errorf("reading state: %w", err)
+	}
+
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing state %s: %w", filepath.Join(dir, stateFileName), err)
+	}
+
+	keyPath := filepath.Join(dir, jumpboxKeyFileName)
+	if _, err := os.Stat(keyPath); err != nil {
+		return nil, fmt.Errorf("%w for environment %s: missing jumpbox key", ErrNotFound, env)
+	}
+	s.JumpboxKeyPath = keyPath
+
+	return &s, nil
+}
+
+// Save stores the state and jumpbox private key of an environment.
+// Files are written atomically and are only readable by the current user.
+func Save(env string, s *State, jumpboxKey string) error {
+	dir, err := Dir(env)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("creating state directory: %w", err)
+	}
+
+	keyPath := filepath.Join(dir, jumpboxKeyFileName)
+	if err := WriteFile(keyPath, []byte(jumpboxKey)); err != nil {
+		return fmt.Errorf("writing jumpbox key: %w", err)
+	}
+
+	s.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding state: %w", err)
+	}
+	if err := WriteFile(filepath.Join(dir, stateFileName), data); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+
+	s.JumpboxKeyPath = keyPath
+	return nil
+}
+
+// Remove deletes the state of an environment. Removing missing state is not an error.
+func Remove(env string) error {
+	dir, err := Dir(env)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("removing state directory: %w", err)
+	}
+	return nil
+}
+
+// WriteFile atomically replaces path with data, only readable by the current user
+// (os.CreateTemp creates files with mode 0600).
+func WriteFile(path string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
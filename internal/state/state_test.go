@@ -0,0 +1,94 @@
+package state_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rkoster/instant-bosh/internal/state"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	baseDir := t.TempDir()
+	t.Setenv(state.EnvStateDir, baseDir)
+
+	s := &state.State{
+		ContainerName: "instant-bosh",
+		HostAddress:   "127.0.0.1",
+		Ports:         state.Ports{Director: "25555", SSH: "2222", ConfigServer: "8081", UAA: "8443"},
+		Director:      state.Credentials{Client: "admin", ClientSecret: "secret", CACert: "director-ca"},
+		Image:         state.Image{Ref: "ghcr.io/rkoster/instant-bosh@sha256:abc", Digest: "sha256:abc"},
+	}
+	if err := state.Save("docker", s, "private-key"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedKeyPath := filepath.Join(baseDir, "docker", "jumpbox.key")
+	if s.JumpboxKeyPath != expectedKeyPath {
+		t.Errorf("expected key path %s, got %s", expectedKeyPath, s.JumpboxKeyPath)
+	}
+	info, err := os.Stat(expectedKeyPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected jumpbox key mode 0600, got %v", info.Mode().Perm())
+	}
+
+	loaded, err := state.Load("docker")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loaded.Director != s.Director || loaded.Image != s.Image || loaded.Ports != s.Ports {
+		t.Errorf("expected %+v, got %+v", s, loaded)
+	}
+	if loaded.JumpboxKeyPath != expectedKeyPath {
+		t.Errorf("expected key path %s, got %s", expectedKeyPath, loaded.JumpboxKeyPath)
+	}
+	if loaded.UpdatedAt.IsZero() {
+		t.Error("expected UpdatedAt to be set")
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	t.Setenv(state.EnvStateDir, t.TempDir())
+
+	if _, err := state.Load("docker"); !errors.Is(err, state.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	t.Setenv(state.EnvStateDir, t.TempDir())
+
+	if err := state.Save("incus-local", &state.State{}, "private-key"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := state.Remove("incus-local"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := state.Load("incus-local"); !errors.Is(err, state.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after remove, got %v", err)
+	}
+	if err := state.Remove("incus-local"); err != nil {
+		t.Errorf("expected removing missing state to succeed, got %v", err)
+	}
+}
+
+func TestBaseDir(t *testing.T) {
+	t.Setenv(state.EnvStateDir, "")
+	t.Setenv("XDG_STATE_HOME", "/xdg/state")
+
+	dir, err := state.BaseDir()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dir != "/xdg/state/ibosh" {
+		t.Errorf("expected /xdg/state/ibosh, got %s", dir)
+	}
+
+	if _, err := state.Dir(""); err == nil {
+		t.Error("expected error for empty environment name")
+	}
+}
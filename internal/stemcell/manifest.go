@@ -21,7 +21,7 @@ type ManifestData struct {
 // CloudPropertiesData represents the cloud_properties section of stemcell.MF
 type CloudPropertiesData struct {
 	ImageReference string `yaml:"image_reference"`
-	Digest         string `yaml:"digest"`
+	Digest         string `yaml:"digest,omitempty"`
 }
 
 // GenerateManifest creates the stemcell.MF content for a light stemcell
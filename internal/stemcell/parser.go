@@ -27,7 +27,7 @@ type manifest struct {
 }
 
 // ParseFromManifest extracts stemcell requirements from a BOSH manifest
-// manifest should be the YAML content (e.g., output of `bosh interpolate`)
+// manifest should be the YAML content (e.g., an interpolated manifest)
 func ParseFromManifest(manifestYAML []byte) ([]Requirement, error) {
 	var m manifest
 	if err := yaml.Unmarshal(manifestYAML, &m); err != nil {
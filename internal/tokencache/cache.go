@@ -0,0 +1,180 @@
+// Package tokencache stores UAA access tokens on disk, so consecutive ibosh invocations
+// re-use a token until it expires instead of requesting a new one every time.
+package tokencache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rkoster/instant-bosh/internal/state"
+)
+
+const (
+	// EnvDisable disables the on-disk token cache when set to a non-empty value.
+	EnvDisable = "IBOSH_NO_TOKEN_CACHE"
+
+	dirName = "tokens"
+
+	// expiryBuffer is the time before expiry a token is no longer handed out,
+	// so it does not expire while a request is in flight.
+	expiryBuffer = 30 * time.Second
+)
+
+// Token is an access token issued by UAA.
+type Token struct {
+	Type        string    `json:"token_type"`
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Valid reports whether the token can still be used at the given time.
+func (t Token) Valid(now time.Time) bool {
+	return t.AccessToken != "" && now.Add(expiryBuffer).Before(t.ExpiresAt)
+}
+
+// Key identifies the tokens of a UAA client. The secret is part of the key, so a cached
+// token is only handed out to callers holding the credentials it was issued for.
+type Key struct {
+	// UAAURL identifies the environment
+	UAAURL       string
+	Client       string
+	ClientSecret string
+}
+
+func (k Key) fileName() string {
+	sum := sha256.Sum256([]byte(strings.TrimSuffix(k.UAAURL, "/") + "\x00" + k.Client + "\x00" + k.ClientSecret))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+// Cache stores tokens as files only readable by the current user. A nil Cache caches nothing.
+type Cache struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// New returns a cache storing tokens in dir.
+func New(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// Default returns the cache in the ibosh state directory, or nil if caching is
+// disabled with IBOSH_NO_TOKEN_CACHE or the state directory can't be determined.
+func Default() *Cache {
+	if os.Getenv(EnvDisable) != "" {
+		return nil
+	}
+	base, err := state.BaseDir()
+	if err != nil {
+		return nil
+	}
+	return New(filepath.Join(base, dirName))
+}
+
+// Get returns the cached token of a client if it is still valid.
+func (c *Cache) Get(key Key) (Token, bool) {
+	if c == nil {
+		return Token{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(c.dir, key.fileName()))
+	if err != nil {
+		return Token{}, false
+	}
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil || !token.Valid(time.Now()) {
+		return Token{}, false
+	}
+	return token, true
+}
+
+// Put stores the token of a client and removes expired tokens of other clients.
+func (c *Cache) Put(key Key, token Token) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return fmt.Errorf("creating token cache directory: %w", err)
+	}
+	c.prune()
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("encoding token: %w", err)
+	}
+	if err := state.WriteFile(filepath.Join(c.dir, key.fileName()), data); err != nil {
+		return fmt.Errorf("writing token: %w", err)
+	}
+	return nil
+}
+
+// Invalidate removes the cached token of a client, e.g. after it was rejected.
+func (c *Cache) Invalidate(key Key) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Remove(filepath.Join(c.dir, key.fileName())); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing token: %w", err)
+	}
+	return nil
+}
+
+// Token returns the cached token of a client, or requests one with fetch and caches it.
+// With refresh, e.g. after the cached token was rejected, a new token is always requested.
+// The cache is best effort: when it can't be written the fetched token is still returned.
+func (c *Cache) Token(key Key, refresh bool, fetch func() (Token, error)) (Token, error) {
+	if !refresh {
+		if token, ok := c.Get(key); ok {
+			return token, nil
+		}
+	}
+
+	token, err := fetch()
+	if err != nil {
+		return Token{}, err
+	}
+	if token.Valid(time.Now()) {
+		_ = c.Put(key, token)
+	} else {
+		_ = c.Invalidate(key)
+	}
+	return token, nil
+}
+
+// prune removes expired tokens, which are left behind by destroyed environments.
+func (c *Cache) prune() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(c.dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var token Token
+		if err := json.Unmarshal(data, &token); err != nil || !now.Before(token.ExpiresAt) {
+			os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package tokencache_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/rkoster/instant-bosh/internal/state"
+	"github.com/rkoster/instant-bosh/internal/tokencache"
+)
+
+var key = tokencache.Key{UAAURL: "https://127.0.0.1:8443", Client: "admin", ClientSecret: "secret"}
+
+func TestPutAndGet(t *testing.T) {
+	dir := t.TempDir()
+	cache := tokencache.New(dir)
+
+	token := tokencache.Token{Type: "bearer", AccessToken: "abc", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := cache.Put(key, token); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cached, ok := cache.Get(key)
+	if !ok || cached.AccessToken != "abc" || cached.Type != "bearer" {
+		t.Errorf("expected cached token, got %+v, %v", cached, ok)
+	}
+
+	// Tokens are only handed out for the same environment and client credentials
+	for _, other := range []tokencache.Key{
+		{UAAURL: "https://127.0.0.1:8444", Client: "admin", ClientSecret: "secret"},
+		{UAAURL: key.UAAURL, Client: "config_server", ClientSecret: "secret"},
+		{UAAURL: key.UAAURL, Client: "admin", ClientSecret: "wrong"},
+	} {
+		if _, ok := cache.Get(other); ok {
+			t.Errorf("expected no token for %+v", other)
+		}
+	}
+
+	if runtime.GOOS != "windows" {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			info, _ := entry.Info()
+			if perm := info.Mode().Perm(); perm != 0600 {
+				t.Errorf("expected %s to have mode 0600, got %o", entry.Name(), perm)
+			}
+		}
+	}
+
+	if err := cache.Invalidate(key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := cache.Get(key); ok {
+		t.Error("expected invalidated token to be gone")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	dir := t.TempDir()
+	cache := tokencache.New(dir)
+
+	// Tokens about to expire are not handed out
+	cache.Put(key, tokencache.Token{AccessToken: "expiring", ExpiresAt: time.Now().Add(10 * time.Second)})
+	if _, ok := cache.Get(key); ok {
+		t.Error("expected a token expiring within the buffer not to be returned")
+	}
+
+	// Expired tokens of other clients are removed when storing a token
+	other := tokencache.Key{UAAURL: key.UAAURL, Client: "other"}
+	cache.Put(key, tokencache.Token{AccessToken: "expired", ExpiresAt: time.Now().Add(-time.Minute)})
+	cache.Put(other, tokencache.Token{AccessToken: "valid", ExpiresAt: time.Now().Add(time.Hour)})
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the valid token to remain, got %d files", len(entries))
+	}
+}
+
+func TestToken(t *testing.T) {
+	cache := tokencache.New(filepath.Join(t.TempDir(), "tokens"))
+
+	requests := 0
+	fetch := func() (tokencache.Token, error) {
+		requests++
+		return tokencache.Token{Type: "bearer", AccessToken: "abc", ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+
+	for _, refresh := range []bool{false, false, true} {
+		if _, err := cache.Token(key, refresh, fetch); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 token requests (initial and refresh), got %d", requests)
+	}
+
+	failure := errors.New("uaa unavailable")
+	if _, err := cache.Token(key, true, func() (tokencache.Token, error) { return tokencache.Token{}, failure }); !errors.Is(err, failure) {
+		t.Errorf("expected fetch error, got %v", err)
+	}
+
+	// A nil cache always fetches
+	var disabled *tokencache.Cache
+	disabled.Token(key, false, fetch)
+	if requests != 3 {
+		t.Errorf("expected a nil cache to fetch, got %d requests", requests)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(state.EnvStateDir, dir)
+	t.Setenv(tokencache.EnvDisable, "")
+
+	cache := tokencache.Default()
+	if cache == nil {
+		t.Fatal("expected default cache")
+	}
+	cache.Put(key, tokencache.Token{AccessToken: "abc", ExpiresAt: time.Now().Add(time.Hour)})
+	if entries, _ := os.ReadDir(filepath.Join(dir, "tokens")); len(entries) != 1 {
+		t.Errorf("expected token in state directory, got %v", entries)
+	}
+
+	t.Setenv(tokencache.EnvDisable, "1")
+	if tokencache.Default() != nil {
+		t.Error("expected no cache when disabled")
+	}
+}